@@ -0,0 +1,230 @@
+// Package align lines up the profiles that several computers recorded of
+// one dive and measures how far they disagree.
+//
+// Computers' clocks drift apart and each starts its dive at its own
+// threshold depth, so profiles placed by their start times alone are off
+// by seconds to minutes. Align finds the offset at which the depth curves
+// match best, by cross-correlation: each profile is resampled every
+// second and the offset that maximises the correlation of the depths is
+// kept.
+package align
+
+import (
+	"math"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// MaxShift is how far from its current offset Align looks for a
+// profile's best one.
+const MaxShift = 5 * time.Minute
+
+// step is the resolution profiles are resampled at.
+const step = time.Second
+
+// Divergence measures how far a profile disagrees with the dive's primary
+// one where both computers recorded.
+type Divergence struct {
+	Computer divelog.Equipment
+	Offset   time.Duration
+
+	// Correlation is that of the depth curves at Offset, 1 for profiles
+	// of the same shape. It is 0 when they do not overlap enough to
+	// tell.
+	Correlation float64
+
+	// Overlap is the time both computers recorded.
+	Overlap time.Duration
+
+	// MeanDepth is the mean depth difference, the profile's depth less
+	// the primary's: positive when the computer reads deeper. RMSDepth
+	// and MaxDepth are the root mean square and the largest difference
+	// either way.
+	MeanDepth divelog.Depth
+	RMSDepth  divelog.Depth
+	MaxDepth  divelog.Depth
+
+	// Temperature is the mean temperature difference in kelvin, zero if
+	// the computers never both recorded one.
+	Temperature float64
+}
+
+// Align sets the offset of each of d's profiles to the one at which its
+// depth curve best matches the primary profile's, within MaxShift of the
+// current offset, and reports how far each then diverges.
+func Align(d *divelog.Dive) []Divergence {
+	divs := make([]Divergence, len(d.Profiles))
+	for i := range d.Profiles {
+		p := &d.Profiles[i]
+		if offset, ok := Offset(d.Samples, p.Samples, p.Offset); ok {
+			p.Offset = offset
+		}
+		divs[i] = Compare(d.Samples, *p)
+	}
+	return divs
+}
+
+// Stats reports how far each of d's profiles diverges from the primary
+// one at the offsets recorded.
+func Stats(d *divelog.Dive) []Divergence {
+	divs := make([]Divergence, len(d.Profiles))
+	for i, p := range d.Profiles {
+		divs[i] = Compare(d.Samples, p)
+	}
+	return divs
+}
+
+// Offset returns the offset within MaxShift of guess at which the depths
+// of other best correlate with those of ref: a sample of other at Time is
+// matched with ref's at Time plus the offset. It reports false if the
+// profiles never overlap for half of the shorter one.
+func Offset(ref, other []divelog.Sample, guess time.Duration) (time.Duration, bool) {
+	r, o := resample(ref, depth), resample(other, depth)
+	guess = guess.Round(step)
+	best, bestCorr := guess, math.Inf(-1)
+	// Try the offsets nearest the guess first, so that ties go to them.
+	for k := range 2*int(MaxShift/step) + 1 {
+		lag := guess + time.Duration((k+1)/2)*step
+		if k%2 == 1 {
+			lag = guess - time.Duration((k+1)/2)*step
+		}
+		if c, n := correlate(r, o, lag); enough(r, o, n) && c > bestCorr {
+			best, bestCorr = lag, c
+		}
+	}
+	return best, !math.IsInf(bestCorr, -1)
+}
+
+// Compare measures how far p diverges from the primary profile ref.
+func Compare(ref []divelog.Sample, p divelog.Profile) Divergence {
+	div := Divergence{Computer: p.Computer, Offset: p.Offset}
+	r, o := resample(ref, depth), resample(p.Samples, depth)
+	lag := p.Offset.Round(step)
+	if c, n := correlate(r, o, lag); enough(r, o, n) && !math.IsNaN(c) {
+		div.Correlation = c
+	}
+	var n int
+	var sum, sumSq, maxDiff float64
+	each(r, o, lag, func(a, b float64) {
+		diff := b - a
+		n++
+		sum += diff
+		sumSq += diff * diff
+		maxDiff = max(maxDiff, math.Abs(diff))
+	})
+	if n == 0 {
+		return div
+	}
+	div.Overlap = time.Duration(n) * step
+	div.MeanDepth = divelog.Depth(sum / float64(n))
+	div.RMSDepth = divelog.Depth(math.Sqrt(sumSq / float64(n)))
+	div.MaxDepth = divelog.Depth(maxDiff)
+
+	n, sum = 0, 0
+	each(resample(ref, temperature), resample(p.Samples, temperature), lag, func(a, b float64) {
+		n++
+		sum += b - a
+	})
+	if n > 0 {
+		div.Temperature = sum / float64(n)
+	}
+	return div
+}
+
+// Best returns the index among d's profiles of the one best suited to be
+// the primary profile, or -1 if that is the primary profile already. It
+// is the profile with the most samples: the one covering the most of the
+// dive in the most detail.
+func Best(d *divelog.Dive) int {
+	best, most := -1, len(d.Samples)
+	for i, p := range d.Profiles {
+		if len(p.Samples) > most {
+			best, most = i, len(p.Samples)
+		}
+	}
+	return best
+}
+
+// A curve is a value resampled every step; NaN where it is unknown.
+type curve struct {
+	start time.Duration // the time of v[0], a multiple of step
+	v     []float64
+}
+
+func depth(s divelog.Sample) float64 { return float64(s.Depth) }
+
+func temperature(s divelog.Sample) float64 {
+	if s.Temperature == 0 {
+		return math.NaN()
+	}
+	return float64(s.Temperature)
+}
+
+// resample interpolates value, which is NaN for samples without one,
+// linearly between samples.
+func resample(samples []divelog.Sample, value func(divelog.Sample) float64) curve {
+	var known []divelog.Sample
+	for _, s := range samples {
+		if !math.IsNaN(value(s)) {
+			known = append(known, s)
+		}
+	}
+	if len(known) == 0 {
+		return curve{}
+	}
+	first, last := known[0].Time, known[len(known)-1].Time
+	c := curve{start: (first + step - 1) / step * step}
+	i := 0
+	for t := c.start; t <= last; t += step {
+		for i+1 < len(known) && known[i+1].Time <= t {
+			i++
+		}
+		a := known[i]
+		if a.Time == t || i+1 == len(known) {
+			c.v = append(c.v, value(a))
+			continue
+		}
+		b := known[i+1]
+		f := float64(t-a.Time) / float64(b.Time-a.Time)
+		c.v = append(c.v, value(a)+f*(value(b)-value(a)))
+	}
+	return c
+}
+
+// each calls fn with the values of r and o at the same moments, o's time
+// plus lag being r's.
+func each(r, o curve, lag time.Duration, fn func(a, b float64)) {
+	shift := int((o.start + lag - r.start) / step)
+	for j, b := range o.v {
+		if i := j + shift; i >= 0 && i < len(r.v) {
+			fn(r.v[i], b)
+		}
+	}
+}
+
+// enough reports whether n points, where r and o overlap, are enough to
+// compare them by: half the shorter curve.
+func enough(r, o curve, n int) bool { return n > 1 && n >= min(len(r.v), len(o.v))/2 }
+
+// correlate returns the Pearson correlation of r and o at lag, NaN if
+// either is flat there, and the number of points it covers.
+func correlate(r, o curve, lag time.Duration) (float64, int) {
+	var n int
+	var sa, sb, saa, sbb, sab float64
+	each(r, o, lag, func(a, b float64) {
+		n++
+		sa += a
+		sb += b
+		saa += a * a
+		sbb += b * b
+		sab += a * b
+	})
+	N := float64(n)
+	cov := sab - sa*sb/N
+	va, vb := saa-sa*sa/N, sbb-sb*sb/N
+	if n < 2 || va <= 0 || vb <= 0 {
+		return math.NaN(), n
+	}
+	return cov / math.Sqrt(va*vb), n
+}
@@ -0,0 +1,98 @@
+package align
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// multilevel is the depth of a multilevel dive t into it.
+func multilevel(t time.Duration) float64 {
+	legs := []struct {
+		end   time.Duration
+		depth float64
+	}{{0, 0}, {2 * time.Minute, 30}, {8 * time.Minute, 30}, {10 * time.Minute, 18}, {20 * time.Minute, 15},
+		{23 * time.Minute, 5}, {26 * time.Minute, 5}, {27 * time.Minute, 0}}
+	for i := 1; i < len(legs); i++ {
+		if a, b := legs[i-1], legs[i]; t <= b.end {
+			f := float64(t-a.end) / float64(b.end-a.end)
+			return a.depth + f*(b.depth-a.depth)
+		}
+	}
+	return 0
+}
+
+// record samples the dive every rate from a computer whose clock runs
+// late by lag, so that its sample at t is from t+lag into the dive, and
+// that reads bias metres deep and cold degrees cold.
+func record(rate, lag time.Duration, bias, cold float64) []divelog.Sample {
+	var samples []divelog.Sample
+	for t := rate; t+lag <= 27*time.Minute; t += rate {
+		d := multilevel(t + lag)
+		if d > 0 {
+			d += bias
+		}
+		samples = append(samples, divelog.Sample{Time: t, Depth: divelog.Depth(d), Temperature: divelog.Celsius(26 - d/3 - cold)})
+	}
+	return samples
+}
+
+func TestAlign(t *testing.T) {
+	perdix := divelog.Equipment{Kind: divelog.Computer, Name: "Perdix", Serial: "A1"}
+	d := &divelog.Dive{
+		Samples: record(10*time.Second, 0, 0, 0),
+		Profiles: []divelog.Profile{
+			{Computer: perdix, Samples: record(4*time.Second, 37*time.Second, 0.3, 0.5)},
+			{Computer: divelog.Equipment{Name: "Zoop"}, Offset: -20 * time.Second, Samples: record(20*time.Second, -20*time.Second, 0, 0)},
+		},
+	}
+	divs := Align(d)
+	if d.Profiles[0].Offset != 37*time.Second || d.Profiles[1].Offset != -20*time.Second {
+		t.Fatalf("offsets = %v, %v; want 37s, -20s", d.Profiles[0].Offset, d.Profiles[1].Offset)
+	}
+	div := divs[0]
+	if div.Computer != perdix || div.Offset != 37*time.Second || div.Correlation < 0.999 {
+		t.Errorf("divergence = %+v", div)
+	}
+	if math.Abs(float64(div.MeanDepth)-0.3) > 0.02 || math.Abs(float64(div.MaxDepth)-0.3) > 0.35 ||
+		math.Abs(div.Temperature+0.6) > 0.05 {
+		t.Errorf("MeanDepth, MaxDepth, Temperature = %.3f, %.3f, %.3f", div.MeanDepth, div.MaxDepth, div.Temperature)
+	}
+	if div.Overlap < 25*time.Minute {
+		t.Errorf("Overlap = %v", div.Overlap)
+	}
+	if divs[1].RMSDepth > 0.05 {
+		t.Errorf("Zoop RMSDepth = %.3f", divs[1].RMSDepth)
+	}
+
+	// Stats reports the same at the recorded offsets, and worse ones at
+	// a wrong offset.
+	if got := Stats(d)[0]; got != div {
+		t.Errorf("Stats = %+v, want %+v", got, div)
+	}
+	d.Profiles[0].Offset = 0
+	if got := Stats(d)[0]; got.RMSDepth < 1 || got.Correlation > div.Correlation {
+		t.Errorf("Stats at the wrong offset = %+v", got)
+	}
+
+	if i := Best(d); i != 0 {
+		t.Errorf("Best = %d, want the 4 s profile", i)
+	}
+	d.SetPrimary(0)
+	if Best(d) != -1 || len(d.Profiles) != 2 || d.Computer == nil || *d.Computer != perdix {
+		t.Errorf("after SetPrimary: Best = %d, %d profiles", Best(d), len(d.Profiles))
+	}
+}
+
+func TestOffsetNoOverlap(t *testing.T) {
+	a := record(10*time.Second, 0, 0, 0)
+	b := []divelog.Sample{{Time: 0, Depth: 3}, {Time: time.Minute, Depth: 3}}
+	if _, ok := Offset(a, b, 0); ok {
+		t.Error("Offset found a flat profile in a dive")
+	}
+	if _, ok := Offset(a, nil, 0); ok {
+		t.Error("Offset of no samples")
+	}
+}
@@ -0,0 +1,32 @@
+package divelog
+
+import "time"
+
+// Certification is a diver certification card.
+type Certification struct {
+	ID     int    `json:"id,omitempty"`
+	Agency string `json:"agency"`
+
+	// Level is the course certified, by its name or its short name, such
+	// as "Advanced Open Water Diver" or "AOW".
+	Level  string    `json:"level"`
+	Number string    `json:"number,omitempty"`
+	Date   time.Time `json:"date"`
+
+	Instructor       string `json:"instructor,omitempty"`
+	InstructorNumber string `json:"instructor_number,omitempty"`
+
+	// CardImage is the path of a scan or photo of the card.
+	CardImage string `json:"card_image,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// Training marks a dive made as part of a course.
+type Training struct {
+	// Course is the short name of the course, such as "AOW".
+	Course string `json:"course"`
+
+	// Dive names the course dive, such as "deep" or "navigation", for
+	// courses whose standards require particular dives.
+	Dive string `json:"dive,omitempty"`
+}
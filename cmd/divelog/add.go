@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/sites"
+)
+
+var cmdAdd = &command{
+	name:    "add",
+	args:    "[-i] [flags]",
+	summary: "add a dive to the log",
+	run:     runAdd,
+}
+
+func runAdd(e *env, fs *flag.FlagSet, args []string) error {
+	var f diveFlags
+	f.register(fs, e.units)
+	interactive := fs.Bool("i", false, "prompt for each field")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+	d := &divelog.Dive{Start: time.Now().Truncate(time.Minute)}
+	if *interactive || (fs.NFlag() == 0 && isTerminal(e.stdin)) {
+		if err := interact(e, fs, d); err != nil {
+			return err
+		}
+	}
+	if err := f.apply(fs, d, e.units); err != nil {
+		return err
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := sites.PutDive(s, d); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "added dive #%d\n", d.Number)
+	return nil
+}
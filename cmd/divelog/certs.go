@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+	"github.com/betonavab/divelog/training"
+)
+
+var cmdCerts = &command{
+	name:    "certs",
+	args:    "<command> [arguments]",
+	summary: "keep certifications and check course prerequisites",
+	run:     runCerts,
+}
+
+// certsCommands are the commands under "divelog certs".
+var certsCommands = []*command{
+	{"certs list", "", "list certifications", runCertsList},
+	{"certs add", "-agency agency -level level -date date [cert flags]", "add a certification", runCertsAdd},
+	{"certs edit", "<id> [cert flags]", "change a certification", runCertsEdit},
+	{"certs delete", "<id>", "delete a certification", runCertsDelete},
+	{"certs export", "[-format csv|json] [-o file]", "write the certifications as CSV or JSON", runCertsExport},
+	{"certs check", "<course> [-standards file]", "check prerequisites and training dives against a course's standards", runCertsCheck},
+	{"certs standards", "[-standards file]", "list the course standards", runCertsStandards},
+}
+
+func runCerts(e *env, fs *flag.FlagSet, args []string) error {
+	return runSubcommand(e, "certs", "command", "", certsCommands, args)
+}
+
+// openCerts opens the log and its certifications.
+func openCerts(e *env) (store.Store, store.CertRegistry, error) {
+	s, err := e.openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	reg, ok := s.(store.CertRegistry)
+	if !ok {
+		s.Close()
+		return nil, nil, errors.New("this log does not keep certifications")
+	}
+	return s, reg, nil
+}
+
+// getCert fetches a certification, turning store.ErrCertificationNotFound
+// into a message that names it.
+func getCert(reg store.CertRegistry, arg string) (*divelog.Certification, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid certification ID %q", arg)
+	}
+	c, err := reg.GetCertification(id)
+	if errors.Is(err, store.ErrCertificationNotFound) {
+		return nil, fmt.Errorf("no certification %d", id)
+	}
+	return c, err
+}
+
+// certFlags are the flags certs add and edit use to describe a
+// certification.
+type certFlags struct {
+	agency, level, number string
+	date                  string
+	instructor            string
+	instructorNumber      string
+	card                  string
+	notes                 string
+}
+
+func (f *certFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.agency, "agency", "", "certifying `agency`, e.g. PADI or SSI")
+	fs.StringVar(&f.level, "level", "", "`course` certified, e.g. \"Advanced Open Water Diver\" or AOW")
+	fs.StringVar(&f.number, "number", "", "card or diver `number`")
+	fs.StringVar(&f.date, "date", "", "certification `date`")
+	fs.StringVar(&f.instructor, "instructor", "", "instructor `name`")
+	fs.StringVar(&f.instructorNumber, "instructor-number", "", "instructor's member `number`")
+	fs.StringVar(&f.card, "card", "", "`path` of a scan or photo of the card")
+	fs.StringVar(&f.notes, "notes", "", "free-form notes")
+}
+
+// apply copies the flags that were set on the command line into c.
+func (f *certFlags) apply(fs *flag.FlagSet, c *divelog.Certification) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "agency":
+			c.Agency = f.agency
+		case "level":
+			c.Level = f.level
+		case "number":
+			c.Number = f.number
+		case "date":
+			c.Date, err = parseTime(f.date)
+		case "instructor":
+			c.Instructor = f.instructor
+		case "instructor-number":
+			c.InstructorNumber = f.instructorNumber
+		case "card":
+			c.CardImage = f.card
+		case "notes":
+			c.Notes = f.notes
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+func runCertsList(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, reg, err := openCerts(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	certs, err := reg.Certifications()
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		fmt.Fprintln(e.stdout, "No certifications.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tAGENCY\tLEVEL\tNUMBER\tINSTRUCTOR\t")
+	for _, c := range certs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t\n", c.ID, c.Date.Format("2006-01-02"), c.Agency, c.Level,
+			orDash(c.Number != "", c.Number), orDash(c.Instructor != "", formatInstructor(c)))
+	}
+	return tw.Flush()
+}
+
+func runCertsAdd(e *env, fs *flag.FlagSet, args []string) error {
+	var f certFlags
+	f.register(fs)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || f.agency == "" || f.level == "" || f.date == "" {
+		fs.Usage()
+		return errUsage
+	}
+	c := &divelog.Certification{}
+	if err := f.apply(fs, c); err != nil {
+		return err
+	}
+	s, reg, err := openCerts(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := reg.PutCertification(c); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "added certification %d\n", c.ID)
+	return nil
+}
+
+func runCertsEdit(e *env, fs *flag.FlagSet, args []string) error {
+	var f certFlags
+	f.register(fs)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || fs.NFlag() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, reg, err := openCerts(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	c, err := getCert(reg, pos[0])
+	if err != nil {
+		return err
+	}
+	if err := f.apply(fs, c); err != nil {
+		return err
+	}
+	if err := reg.PutCertification(c); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "updated certification %d\n", c.ID)
+	return nil
+}
+
+func runCertsDelete(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	s, reg, err := openCerts(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	c, err := getCert(reg, pos[0])
+	if err != nil {
+		return err
+	}
+	if err := reg.DeleteCertification(c.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "deleted certification %d (%s %s)\n", c.ID, c.Agency, c.Level)
+	return nil
+}
+
+func runCertsExport(e *env, fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "csv", "output `format`: csv or json")
+	out := fs.String("o", "-", "output `file`, - for standard output")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	var write func(io.Writer, []*divelog.Certification) error
+	switch strings.ToLower(*format) {
+	case "csv":
+		write = writeCertsCSV
+	case "json":
+		write = writeCertsJSON
+	default:
+		return fmt.Errorf("unknown format %q (want csv or json)", *format)
+	}
+	s, reg, err := openCerts(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	certs, err := reg.Certifications()
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		return write(e.stdout, certs)
+	}
+	w, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := write(w, certs); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func writeCertsCSV(w io.Writer, certs []*divelog.Certification) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "agency", "level", "number", "date", "instructor", "instructor_number", "card_image", "notes"})
+	for _, c := range certs {
+		cw.Write([]string{strconv.Itoa(c.ID), c.Agency, c.Level, c.Number, c.Date.Format("2006-01-02"),
+			c.Instructor, c.InstructorNumber, c.CardImage, c.Notes})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeCertsJSON(w io.Writer, certs []*divelog.Certification) error {
+	if certs == nil {
+		certs = []*divelog.Certification{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(certs)
+}
+
+// loadStandards returns the standards in path, or the built-in ones when
+// path is empty.
+func loadStandards(path string) (training.Standards, error) {
+	if path == "" {
+		return training.Builtin, nil
+	}
+	return training.LoadStandards(path)
+}
+
+func runCertsCheck(e *env, fs *flag.FlagSet, args []string) error {
+	path := fs.String("standards", "", "YAML `file` of course standards; default the built-in ones")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	ss, err := loadStandards(*path)
+	if err != nil {
+		return err
+	}
+	std := ss.Find(pos[0])
+	if std == nil {
+		return fmt.Errorf("no standard for course %q; see divelog certs standards", pos[0])
+	}
+	s, reg, err := openCerts(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	certs, err := reg.Certifications()
+	if err != nil {
+		return err
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	r := ss.Check(std, certs, dives)
+
+	fmt.Fprintf(e.stdout, "%s, %s\n\n", std.Course, std.Name)
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tREQUIREMENT\tMET\tPROOF\t")
+	print := func(stage string, reqs []training.Requirement) {
+		for _, req := range reqs {
+			met := "no"
+			if req.Met {
+				met = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", stage, req.What, met, formatProof(req))
+		}
+	}
+	print("prerequisite", r.Prerequisites)
+	print("training", r.Training)
+	if len(r.Prerequisites)+len(r.Training) == 0 {
+		fmt.Fprintln(tw, "-\tnone\t-\t-\t")
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout)
+	switch {
+	case r.Complete():
+		fmt.Fprintf(e.stdout, "All requirements for %s are met.\n", std.Course)
+	case r.Ready():
+		fmt.Fprintf(e.stdout, "Ready to begin %s; training dives are outstanding.\n", std.Course)
+	default:
+		fmt.Fprintf(e.stdout, "Not ready to begin %s.\n", std.Course)
+	}
+	return nil
+}
+
+// formatProof describes what meets a requirement, or how far short the
+// diver falls.
+func formatProof(req training.Requirement) string {
+	if c := req.Cert; c != nil {
+		proof := c.Agency + " " + c.Level
+		if c.Number != "" {
+			proof += " no. " + c.Number
+		}
+		proof += ", " + c.Date.Format("2006-01-02")
+		if c.Instructor != "" {
+			proof += ", instructor " + formatInstructor(c)
+		}
+		return proof
+	}
+	if len(req.Dives) == 0 {
+		return "-"
+	}
+	if len(req.Dives) > 10 {
+		return plural(len(req.Dives), "dive")
+	}
+	var numbers []string
+	for _, d := range req.Dives {
+		numbers = append(numbers, "#"+strconv.Itoa(d.Number))
+	}
+	return strings.Join(numbers, " ")
+}
+
+func formatInstructor(c *divelog.Certification) string {
+	if c.InstructorNumber == "" {
+		return c.Instructor
+	}
+	return c.Instructor + " (" + c.InstructorNumber + ")"
+}
+
+func runCertsStandards(e *env, fs *flag.FlagSet, args []string) error {
+	path := fs.String("standards", "", "YAML `file` of course standards; default the built-in ones")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	ss, err := loadStandards(*path)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COURSE\tNAME\tREQUIRES\tLOGGED DIVES\tTRAINING DIVES\t")
+	for _, std := range ss {
+		dives := orDash(std.TrainingDives > 0, strconv.Itoa(std.TrainingDives))
+		if len(std.RequiredDives) > 0 {
+			dives += " incl. " + strings.Join(std.RequiredDives, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", std.Course, std.Name,
+			orDash(len(std.Requires) > 0, strings.Join(std.Requires, ", ")),
+			orDash(std.MinDives > 0, strconv.Itoa(std.MinDives)), dives)
+	}
+	return tw.Flush()
+}
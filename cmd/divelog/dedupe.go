@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/align"
+	"github.com/betonavab/divelog/sites"
+)
+
+var cmdDedupe = &command{
+	name:    "dedupe",
+	args:    "[-n] [-force]",
+	summary: "merge dives recorded by more than one computer",
+	run:     runDedupe,
+}
+
+// A duplicate is a dive and the other records of it merged into it.
+type duplicate struct {
+	keep    *divelog.Dive
+	dropped []int
+}
+
+func runDedupe(e *env, fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("n", false, "report what would be merged without changing the log")
+	force := fs.Bool("force", false, "merge even if that invalidates signed dives")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	dives, err := s.List()
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+
+	// Each dive is merged into the lowest-numbered one it overlaps, and
+	// the merged dive, which may have grown, is compared with the next.
+	var dups []duplicate
+	var cur duplicate
+	for _, d := range dives {
+		if cur.keep != nil && cur.keep.Overlaps(d) && !sameComputer(cur.keep, d) {
+			if d.Number < cur.keep.Number {
+				cur.keep, d = d, cur.keep
+			}
+			cur.dropped = append(cur.dropped, d.Number)
+			cur.keep.Merge(d)
+			continue
+		}
+		if len(cur.dropped) > 0 {
+			dups = append(dups, cur)
+		}
+		cur = duplicate{keep: d}
+	}
+	if len(cur.dropped) > 0 {
+		dups = append(dups, cur)
+	}
+	if len(dups) == 0 {
+		fmt.Fprintln(e.stdout, "No overlapping dives.")
+		return nil
+	}
+
+	// Every dive of a duplicate is rewritten or deleted.
+	touched := make(map[int]bool)
+	for _, dup := range dups {
+		touched[dup.keep.Number] = true
+		for _, n := range dup.dropped {
+			touched[n] = true
+		}
+	}
+	if !*dryRun {
+		if err := checkSigned(e, s, *force, func(d *divelog.Dive) bool { return touched[d.Number] }); err != nil {
+			return err
+		}
+	}
+	merged := 0
+	for _, dup := range dups {
+		var drops []string
+		for _, n := range dup.dropped {
+			drops = append(drops, fmt.Sprintf("#%d", n))
+		}
+		fmt.Fprintf(e.stdout, "%s: merged %s into #%d (%s)\n", dup.keep.Start.Format("2006-01-02 15:04"),
+			strings.Join(drops, ", "), dup.keep.Number, orDash(len(dup.keep.Computers()) > 0, describeComputers(dup.keep)))
+		merged += len(dup.dropped)
+		if *dryRun {
+			continue
+		}
+		// The profiles were placed by the computers' clocks; line them
+		// up by their depths.
+		align.Align(dup.keep)
+		if err := sites.PutDive(s, dup.keep); err != nil {
+			return err
+		}
+		for _, n := range dup.dropped {
+			if err := s.Delete(n); err != nil {
+				return err
+			}
+		}
+	}
+	verb := "merged"
+	if *dryRun {
+		verb = "would merge"
+	}
+	fmt.Fprintf(e.stdout, "%s %s\n", verb, plural(merged, "dive"))
+	return nil
+}
+
+// sameComputer reports whether a and b were recorded by one computer,
+// which cannot have recorded two dives at once: they are not duplicates.
+func sameComputer(a, b *divelog.Dive) bool {
+	for _, c := range a.Computers() {
+		if slices.Contains(b.Computers(), c) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeComputers(d *divelog.Dive) string {
+	var names []string
+	for _, c := range d.Computers() {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
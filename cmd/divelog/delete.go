@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var cmdDelete = &command{
+	name:    "delete",
+	args:    "<number>",
+	summary: "remove a dive from the log",
+	run:     runDelete,
+}
+
+func runDelete(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	n, err := parseNumber(pos[0])
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if _, err := getDive(s, n); err != nil {
+		return err
+	}
+	if err := s.Delete(n); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "deleted dive #%d\n", n)
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// diveFlags are the flags add and edit use to describe a dive. Values are
+// read in the unit system selected with -units.
+type diveFlags struct {
+	date     string
+	duration time.Duration
+	depth    float64
+	avgDepth float64
+	temp     float64
+	site     string
+	lat, lon float64
+	buddies  stringList
+	gas      string
+	volume   float64
+	working  float64
+	startP   float64
+	endP     float64
+	tags     stringList
+	training string
+	rating   int
+	notes    string
+}
+
+func (f *diveFlags) register(fs *flag.FlagSet, u divelog.UnitSystem) {
+	fs.StringVar(&f.date, "date", "", "start `time`, e.g. \"2024-05-01 09:30\"")
+	fs.DurationVar(&f.duration, "duration", 0, "dive time, e.g. 45m")
+	fs.Float64Var(&f.depth, "depth", 0, "maximum depth in "+u.DepthUnit())
+	fs.Float64Var(&f.avgDepth, "avg-depth", 0, "average depth in "+u.DepthUnit())
+	fs.Float64Var(&f.temp, "temp", 0, "water temperature in "+u.TemperatureUnit())
+	fs.StringVar(&f.site, "site", "", "dive site `name`")
+	fs.Float64Var(&f.lat, "lat", 0, "site latitude in decimal degrees")
+	fs.Float64Var(&f.lon, "lon", 0, "site longitude in decimal degrees")
+	fs.Var(&f.buddies, "buddy", "buddy `name` (repeatable)")
+	fs.StringVar(&f.gas, "gas", "", "gas `mix`: air, EAN32, 18/45")
+	if u == divelog.Imperial {
+		fs.Float64Var(&f.volume, "tank", 0, "tank rated capacity in cuft (needs -working-pressure)")
+	} else {
+		fs.Float64Var(&f.volume, "tank", 0, "tank water capacity in l")
+	}
+	fs.Float64Var(&f.working, "working-pressure", 0, "tank working pressure in "+u.PressureUnit())
+	fs.Float64Var(&f.startP, "start-pressure", 0, "tank start pressure in "+u.PressureUnit())
+	fs.Float64Var(&f.endP, "end-pressure", 0, "tank end pressure in "+u.PressureUnit())
+	fs.Var(&f.tags, "tag", "`tag` (repeatable)")
+	fs.StringVar(&f.training, "training", "", "training dive for a `course`, as COURSE or COURSE:DIVE, e.g. AOW:deep")
+	fs.IntVar(&f.rating, "rating", 0, "rating from 0 to 5")
+	fs.StringVar(&f.notes, "notes", "", "free-form notes")
+}
+
+// apply copies the flags that were set on the command line into d.
+func (f *diveFlags) apply(fs *flag.FlagSet, d *divelog.Dive, u divelog.UnitSystem) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "date":
+			d.Start, err = parseTime(f.date)
+		case "duration":
+			d.Duration = f.duration
+		case "depth":
+			d.MaxDepth = u.Depth(f.depth)
+		case "avg-depth":
+			d.AvgDepth = u.Depth(f.avgDepth)
+		case "temp":
+			d.MinTemperature = u.Temperature(f.temp)
+		case "site":
+			if f.site == "" {
+				d.Site = nil
+				return
+			}
+			if d.Site == nil {
+				d.Site = &divelog.Site{}
+			}
+			d.Site.Name = f.site
+		case "lat":
+			if d.Site == nil {
+				d.Site = &divelog.Site{}
+			}
+			var c *divelog.Coordinates
+			if c, err = position(fs, d.Site); err == nil {
+				c.Lat = f.lat
+			}
+		case "lon":
+			if d.Site == nil {
+				d.Site = &divelog.Site{}
+			}
+			var c *divelog.Coordinates
+			if c, err = position(fs, d.Site); err == nil {
+				c.Lon = f.lon
+			}
+		case "buddy":
+			d.Buddies = nil
+			for _, name := range f.buddies {
+				d.Buddies = append(d.Buddies, divelog.Buddy{Name: name})
+			}
+		case "gas":
+			tank(d).Gas, err = divelog.ParseGasMix(f.gas)
+		case "tank":
+			tank(d).Volume = u.Volume(f.volume)
+		case "working-pressure":
+			tank(d).WorkingPressure = u.Pressure(f.working)
+		case "start-pressure":
+			tank(d).StartPressure = u.Pressure(f.startP)
+		case "end-pressure":
+			tank(d).EndPressure = u.Pressure(f.endP)
+		case "tag":
+			d.Tags = append([]string(nil), f.tags...)
+		case "training":
+			d.Training = parseTraining(f.training)
+		case "rating":
+			d.Rating = f.rating
+		case "notes":
+			d.Notes = f.notes
+		}
+	})
+	if err == nil && u == divelog.Imperial && isSet(fs, "tank") {
+		// Imperial cylinders are sold by the gas they hold when full.
+		t := tank(d)
+		if t.WorkingPressure == 0 {
+			return fmt.Errorf("-tank in cuft needs -working-pressure")
+		}
+		t.Volume = divelog.ImperialCylinder(divelog.CubicFeet(f.volume), t.WorkingPressure)
+	}
+	return err
+}
+
+// parseTraining parses COURSE or COURSE:DIVE. An empty string clears the
+// dive's training record.
+func parseTraining(s string) *divelog.Training {
+	course, dive, _ := strings.Cut(s, ":")
+	course, dive = strings.TrimSpace(course), strings.TrimSpace(dive)
+	if course == "" && dive == "" {
+		return nil
+	}
+	return &divelog.Training{Course: course, Dive: dive}
+}
+
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(fl *flag.Flag) { set = set || fl.Name == name })
+	return set
+}
+
+// position returns the coordinates of site for -lat or -lon to change. A
+// site without a position takes both flags to place it.
+func position(fs *flag.FlagSet, site *divelog.Site) (*divelog.Coordinates, error) {
+	if site.Coords == nil {
+		if !isSet(fs, "lat") || !isSet(fs, "lon") {
+			return nil, fmt.Errorf("a site without a position needs both -lat and -lon")
+		}
+		site.Coords = &divelog.Coordinates{}
+	}
+	return site.Coords, nil
+}
+
+// tank returns the dive's first tank, adding an air tank if it has none.
+func tank(d *divelog.Dive) *divelog.Tank {
+	if len(d.Tanks) == 0 {
+		d.Tanks = append(d.Tanks, divelog.Tank{Gas: divelog.Air})
+	}
+	return &d.Tanks[0]
+}
+
+// prompts are the flags asked for, in order, when a dive is entered
+// interactively.
+var prompts = []struct{ flag, label string }{
+	{"date", "Date and time"},
+	{"duration", "Duration"},
+	{"depth", "Max depth"},
+	{"site", "Site"},
+	{"buddy", "Buddies (comma separated)"},
+	{"gas", "Gas"},
+	{"start-pressure", "Start pressure"},
+	{"end-pressure", "End pressure"},
+	{"temp", "Water temperature"},
+	{"notes", "Notes"},
+}
+
+// interact asks for each prompt in turn, showing the value from d as the
+// default, and sets the flags whose answers differ.
+func interact(e *env, fs *flag.FlagSet, d *divelog.Dive) error {
+	defaults := flagValues(d, e.units)
+	in := bufio.NewReader(e.stdin)
+	for _, p := range prompts {
+		label := p.label
+		if fl := fs.Lookup(p.flag); fl != nil {
+			if _, unit, ok := strings.Cut(fl.Usage, " in "); ok {
+				label += " (" + unit + ")"
+			}
+		}
+		def := defaults[p.flag]
+		if def != "" {
+			fmt.Fprintf(e.stdout, "%s [%s]: ", label, def)
+		} else {
+			fmt.Fprintf(e.stdout, "%s: ", label)
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return fmt.Errorf("input ended before %s", strings.ToLower(p.label))
+			}
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line == def {
+			continue
+		}
+		if err := fs.Set(p.flag, line); err != nil {
+			return fmt.Errorf("%s: %v", strings.ToLower(p.label), err)
+		}
+	}
+	return nil
+}
+
+// flagValues formats d's fields the way the corresponding flags accept
+// them.
+func flagValues(d *divelog.Dive, u divelog.UnitSystem) map[string]string {
+	whole := func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) }
+	round := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+	m := map[string]string{"notes": d.Notes}
+	if !d.Start.IsZero() {
+		m["date"] = d.Start.Format(timeLayouts[0])
+	}
+	if d.Duration != 0 {
+		m["duration"] = d.Duration.String()
+	}
+	if d.MaxDepth != 0 {
+		m["depth"] = round(u.DepthValue(d.MaxDepth))
+	}
+	if d.MinTemperature != 0 {
+		m["temp"] = round(u.TemperatureValue(d.MinTemperature))
+	}
+	if d.Site != nil {
+		m["site"] = d.Site.Name
+	}
+	var names []string
+	for _, b := range d.Buddies {
+		names = append(names, b.Name)
+	}
+	m["buddy"] = strings.Join(names, ", ")
+	if len(d.Tanks) > 0 {
+		t := d.Tanks[0]
+		m["gas"] = t.Gas.String()
+		if t.StartPressure != 0 {
+			m["start-pressure"] = whole(u.PressureValue(t.StartPressure))
+		}
+		if t.EndPressure != 0 {
+			m["end-pressure"] = whole(u.PressureValue(t.EndPressure))
+		}
+	}
+	return m
+}
+
+var timeLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseTime parses a date and optional time of day in the local time zone.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD [HH:MM]", s)
+}
+
+// isTerminal reports whether r is an interactive terminal.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// parseNumber parses a dive number, accepting an optional leading '#'.
+func parseNumber(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "#"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid dive number %q", s)
+	}
+	return n, nil
+}
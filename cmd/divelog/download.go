@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog/dc"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdDownload = &command{
+	name:    "download",
+	args:    "[-driver name] [-transport serial|hid] [-all] [-n] [-record file] -port path | -replay file",
+	summary: "add the dives on a dive computer",
+	run:     runDownload,
+}
+
+func runDownload(e *env, fs *flag.FlagSet, args []string) error {
+	driver := fs.String("driver", "ostc", "dive computer `name`, one of "+strings.Join(dc.Drivers(), ", "))
+	port := fs.String("port", "", "`path` of the computer's serial port or hidraw device")
+	transport := fs.String("transport", "serial", "how the computer is connected: serial or hid")
+	baud := fs.Int("baud", dc.OSTCBaud, "serial port `speed`")
+	record := fs.String("record", "", "write a recording of the download to `file`, for bug reports")
+	replay := fs.String("replay", "", "download from a recording `file` instead of a computer")
+	all := fs.Bool("all", false, "read every dive, not just those since the last download")
+	dryRun := fs.Bool("n", false, "report what would be downloaded without changing the log")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || (*port == "") == (*replay == "") {
+		fs.Usage()
+		return errUsage
+	}
+	drv, err := dc.Lookup(*driver)
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// The fingerprint of the newest dive of the last download, kept per
+	// computer, stops this one there.
+	fps, keeps := s.(store.Fingerprints)
+	var known map[string]string
+	if keeps && !*all {
+		if known, err = fps.Fingerprints(); err != nil {
+			return err
+		}
+	}
+
+	var t dc.Transport
+	switch {
+	case *replay != "":
+		f, err := os.Open(*replay)
+		if err != nil {
+			return err
+		}
+		rp, err := dc.NewReplay(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *replay, err)
+		}
+		t = rp
+	case *transport == "serial":
+		if t, err = dc.OpenSerial(*port, *baud); err != nil {
+			return err
+		}
+	case *transport == "hid":
+		if t, err = dc.OpenHID(*port); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown transport %q, want serial or hid", *transport)
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			t.Close()
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(f, "# divelog download -driver %s\n", drv.Name())
+		t = dc.Record(t, f)
+	}
+
+	log, err := dc.Download(t, drv, time.Local, known)
+	if cerr := t.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	info := log.Info
+	fmt.Fprintf(e.stdout, "%s %s, serial %s, firmware %s: %s\n", info.Vendor, info.Model,
+		orDash(info.Serial != "", info.Serial), orDash(info.Firmware != "", info.Firmware), plural(len(log.Dives), "new dive"))
+	if err := importDives(e, s, log.Dives, false, *dryRun); err != nil {
+		return err
+	}
+	if keeps && !*dryRun && log.Fingerprint != "" {
+		return fps.SetFingerprint(info.Device(), log.Fingerprint)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/betonavab/divelog/sites"
+)
+
+var cmdEdit = &command{
+	name:    "edit",
+	args:    "<number> [-i] [flags]",
+	summary: "change fields of a dive",
+	run:     runEdit,
+}
+
+func runEdit(e *env, fs *flag.FlagSet, args []string) error {
+	var f diveFlags
+	f.register(fs, e.units)
+	interactive := fs.Bool("i", false, "prompt for each field")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	n, err := parseNumber(pos[0])
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := getDive(s, n)
+	if err != nil {
+		return err
+	}
+	signed := validSigners(d)
+	if *interactive || (fs.NFlag() == 0 && isTerminal(e.stdin)) {
+		if err := interact(e, fs, d); err != nil {
+			return err
+		}
+	}
+	if err := f.apply(fs, d, e.units); err != nil {
+		return err
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if err := sites.PutDive(s, d); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "updated dive #%d\n", d.Number)
+	warnInvalidated(e, d, signed)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+var cmdExport = &command{
+	name:    "export",
+	args:    "<format> [-o file]",
+	summary: "write the log in another program's format",
+	run:     runExport,
+}
+
+func runExport(e *env, fs *flag.FlagSet, args []string) error {
+	out := fs.String("o", "-", "output `file`, - for standard output")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	f, err := lookupFormat(pos[0])
+	if err != nil {
+		return err
+	}
+	if f.write == nil {
+		return fmt.Errorf("%s files cannot be exported", f.name)
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	dives, err := s.List()
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		return f.write(e.stdout, dives)
+	}
+	w, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := f.write(w, dives); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
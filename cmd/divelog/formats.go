@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/csvimport"
+	"github.com/betonavab/divelog/subsurface"
+	"github.com/betonavab/divelog/uddf"
+)
+
+// A format is a file format dives can be imported from or exported to.
+type format struct {
+	name string
+	desc string
+
+	// importer registers the format's import flags on fs and returns the
+	// function that reads a file once they have been parsed.
+	importer func(fs *flag.FlagSet) reader
+	write    func(w io.Writer, dives []*divelog.Dive) error
+}
+
+type reader func(e *env, r io.Reader) ([]*divelog.Dive, error)
+
+// noFlags adapts a package Read function to a format that takes no import
+// flags.
+func noFlags(read func(io.Reader, *time.Location) ([]*divelog.Dive, error)) func(*flag.FlagSet) reader {
+	return func(*flag.FlagSet) reader {
+		return func(_ *env, r io.Reader) ([]*divelog.Dive, error) { return read(r, time.Local) }
+	}
+}
+
+var formats = []*format{
+	{
+		name:     "ssrf",
+		desc:     "Subsurface XML",
+		importer: noFlags(subsurface.Read),
+		write:    subsurface.Write,
+	},
+	{
+		name:     "uddf",
+		desc:     "Universal Dive Data Format 3.2",
+		importer: noFlags(uddf.Read),
+		write:    uddf.Write,
+	},
+	{
+		name:     "csv",
+		desc:     "spreadsheet export, import only",
+		importer: csvImporter,
+	},
+}
+
+// csvImporter reads CSV files laid out as described by the -map file. Rows
+// that cannot be read are listed on stderr and left out.
+func csvImporter(fs *flag.FlagSet) reader {
+	mapPath := fs.String("map", "", "YAML `file` mapping columns to dive fields (required)")
+	return func(e *env, r io.Reader) ([]*divelog.Dive, error) {
+		if *mapPath == "" {
+			return nil, fmt.Errorf("csv import needs -map")
+		}
+		m, err := csvimport.LoadMapping(*mapPath)
+		if err != nil {
+			return nil, err
+		}
+		dives, rowErrs, err := csvimport.Read(r, m, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		for _, re := range rowErrs {
+			fmt.Fprintf(e.stderr, "skipping %v\n", re)
+		}
+		if len(rowErrs) > 0 {
+			fmt.Fprintf(e.stderr, "%d rows could not be read\n", len(rowErrs))
+		}
+		return dives, nil
+	}
+}
+
+func lookupFormat(name string) (*format, error) {
+	for _, f := range formats {
+		if f.name == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q; known formats: %s", name, formatNames())
+}
+
+func formatNames() string {
+	var names []string
+	for _, f := range formats {
+		names = append(names, fmt.Sprintf("%s (%s)", f.name, f.desc))
+	}
+	return strings.Join(names, ", ")
+}
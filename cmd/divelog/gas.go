@@ -0,0 +1,393 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/gas"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdGas = &command{
+	name:    "gas",
+	args:    "<calculation> [arguments]",
+	summary: "gas calculations: MOD, END, EAD, density, best mix and blending",
+	run:     runGas,
+}
+
+// gasCommands are the calculations under "divelog gas", in the order help
+// shows them.
+var gasCommands = []*command{
+	{"gas mod", "<mix>... [-ppo2 bar]", "maximum operating depth", runMOD},
+	{"gas end", "<mix>... -depth n", "equivalent narcotic depth; oxygen counts as narcotic", runEND},
+	{"gas ead", "<mix>... -depth n", "equivalent air depth", runEAD},
+	{"gas density", "<mix>... -depth n", "gas density, with the recommended and maximum limits", runDensity},
+	{"gas bestmix", "-depth n [-ppo2 bar] [-end n]", "best mix for a depth; nitrox unless -end is given", runBestMix},
+	{"gas blend", "<mix> -to p [-from p -from-mix mix] [-top-up mix] [-size n] [-dive n [-tank n]]",
+		"partial-pressure blend: drain, helium, oxygen and top-up", runBlend},
+	{"gas cflow", "<mix> -to p [-from p -from-mix mix] [-compressor n] [-size n] [-dive n [-tank n]]",
+		"continuous-flow nitrox fill", runContinuousFlow},
+	{"gas topup", "<mix> -from p -to p [-with mix] [-size n] [-dive n [-tank n]]",
+		"mix that results from topping up a cylinder", runTopUp},
+}
+
+func runGas(e *env, fs *flag.FlagSet, args []string) error {
+	return runSubcommand(e, "gas", "calculation", "", gasCommands, args)
+}
+
+// waterFlag registers -fresh and returns a function giving the conditions
+// depths are measured in.
+func waterFlag(fs *flag.FlagSet) func() gas.Conditions {
+	fresh := fs.Bool("fresh", false, "depths are in fresh water rather than sea water")
+	return func() gas.Conditions {
+		if *fresh {
+			return gas.Conditions{Water: divelog.FreshWater}
+		}
+		return gas.SeaLevel
+	}
+}
+
+// parseMixes parses the positional gas mixes of a calculation.
+func parseMixes(fs *flag.FlagSet, pos []string) ([]divelog.GasMix, error) {
+	if len(pos) == 0 {
+		fs.Usage()
+		return nil, errUsage
+	}
+	mixes := make([]divelog.GasMix, len(pos))
+	for i, s := range pos {
+		m, err := divelog.ParseGasMix(s)
+		if err != nil {
+			return nil, err
+		}
+		mixes[i] = m
+	}
+	return mixes, nil
+}
+
+func runMOD(e *env, fs *flag.FlagSet, args []string) error {
+	ppO2 := fs.Float64("ppo2", 1.4, "maximum oxygen partial pressure in bar")
+	water := waterFlag(fs)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	mixes, err := parseMixes(fs, pos)
+	if err != nil {
+		return err
+	}
+	for _, m := range mixes {
+		fmt.Fprintf(e.stdout, "%s: MOD %s at ppO2 %.2f bar\n", m, e.units.FormatDepth(water().MOD(m, *ppO2)), *ppO2)
+	}
+	return nil
+}
+
+// atDepth runs a calculation that takes mixes and a -depth, printing one
+// line per mix with what calc returns.
+func atDepth(e *env, fs *flag.FlagSet, args []string, calc func(gas.Conditions, divelog.GasMix, divelog.Depth) string) error {
+	depth := fs.Float64("depth", 0, "depth in "+e.units.DepthUnit())
+	water := waterFlag(fs)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *depth <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	mixes, err := parseMixes(fs, pos)
+	if err != nil {
+		return err
+	}
+	d := e.units.Depth(*depth)
+	for _, m := range mixes {
+		fmt.Fprintf(e.stdout, "%s at %s: %s\n", m, e.units.FormatDepth(d), calc(water(), m, d))
+	}
+	return nil
+}
+
+func runEND(e *env, fs *flag.FlagSet, args []string) error {
+	return atDepth(e, fs, args, func(c gas.Conditions, m divelog.GasMix, d divelog.Depth) string {
+		return "END " + e.units.FormatDepth(c.END(m, d))
+	})
+}
+
+func runEAD(e *env, fs *flag.FlagSet, args []string) error {
+	return atDepth(e, fs, args, func(c gas.Conditions, m divelog.GasMix, d divelog.Depth) string {
+		return "EAD " + e.units.FormatDepth(c.EAD(m, d))
+	})
+}
+
+func runDensity(e *env, fs *flag.FlagSet, args []string) error {
+	return atDepth(e, fs, args, func(c gas.Conditions, m divelog.GasMix, d divelog.Depth) string {
+		return formatDensity(c.Density(m, d))
+	})
+}
+
+// formatDensity formats a gas density and flags it against the limits.
+func formatDensity(rho float64) string {
+	s := fmt.Sprintf("density %.2f g/l", rho)
+	switch {
+	case rho > gas.MaxDensity:
+		s += fmt.Sprintf(" (above the %.1f g/l maximum)", gas.MaxDensity)
+	case rho > gas.RecommendedDensity:
+		s += fmt.Sprintf(" (above the recommended %.1f g/l)", gas.RecommendedDensity)
+	}
+	return s
+}
+
+func runBestMix(e *env, fs *flag.FlagSet, args []string) error {
+	u := e.units
+	depth := fs.Float64("depth", 0, "planned maximum depth in "+u.DepthUnit())
+	ppO2 := fs.Float64("ppo2", 1.4, "oxygen partial pressure at depth in bar")
+	end := fs.Float64("end", 0, "maximum equivalent narcotic depth in "+u.DepthUnit()+"; 0 for nitrox")
+	water := waterFlag(fs)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || *depth <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	c, d := water(), u.Depth(*depth)
+	m, ok := c.BestMix(d, *ppO2, u.Depth(*end))
+	if !ok {
+		return fmt.Errorf("no mix gives ppO2 %.2f bar and an END of %s at %s", *ppO2, u.FormatDepth(u.Depth(*end)), u.FormatDepth(d))
+	}
+	fmt.Fprintf(e.stdout, "Best mix for %s: %s\n", u.FormatDepth(d), m)
+	fmt.Fprintf(e.stdout, "ppO2 %.2f bar, END %s, MOD %s, %s\n", c.PPO2(m, d), u.FormatDepth(c.END(m, d)),
+		u.FormatDepth(c.MOD(m, *ppO2)), formatDensity(c.Density(m, d)))
+	return nil
+}
+
+// blendFlags are the flags shared by the blending calculations.
+type blendFlags struct {
+	to, from, size float64
+	fromMix        string
+	dive, tank     int
+}
+
+func (f *blendFlags) register(fs *flag.FlagSet, u divelog.UnitSystem) {
+	fs.Float64Var(&f.to, "to", 0, "pressure to fill to in "+u.PressureUnit())
+	fs.Float64Var(&f.from, "from", 0, "pressure in the cylinder before filling in "+u.PressureUnit())
+	fs.StringVar(&f.fromMix, "from-mix", "air", "mix in the cylinder before filling")
+	if u == divelog.Imperial {
+		fs.Float64Var(&f.size, "size", 0, "cylinder rated capacity in cuft at the -to pressure (default the dive's tank)")
+	} else {
+		fs.Float64Var(&f.size, "size", 0, "cylinder water capacity in l (default the dive's tank)")
+	}
+	fs.IntVar(&f.dive, "dive", 0, "record the fill on this dive's tank")
+	fs.IntVar(&f.tank, "tank", 1, "tank `number` on the dive, 1 for the first")
+}
+
+// blend builds the gas.Blend for a fill to target, taking the cylinder
+// size from the dive's tank when -size is not given.
+func (f *blendFlags) blend(fs *flag.FlagSet, u divelog.UnitSystem, pos []string, t *divelog.Tank) (gas.Blend, error) {
+	var b gas.Blend
+	if len(pos) != 1 || f.to <= 0 {
+		fs.Usage()
+		return b, errUsage
+	}
+	var err error
+	if b.TargetMix, err = divelog.ParseGasMix(pos[0]); err != nil {
+		return b, err
+	}
+	if b.StartMix, err = divelog.ParseGasMix(f.fromMix); err != nil {
+		return b, err
+	}
+	b.Target, b.Start = u.Pressure(f.to), u.Pressure(f.from)
+	switch {
+	case f.size != 0 && u == divelog.Imperial:
+		b.Volume = divelog.ImperialCylinder(divelog.CubicFeet(f.size), b.Target)
+	case f.size != 0:
+		b.Volume = divelog.Liters(f.size)
+	case t != nil:
+		b.Volume = t.Volume
+	}
+	return b, nil
+}
+
+// selected returns the dive and tank chosen with -dive and -tank. A tank
+// one past the dive's last is added as a new, empty one.
+func (f *blendFlags) selected(s store.Store) (*divelog.Dive, *divelog.Tank, error) {
+	d, err := getDive(s, f.dive)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.tank < 1 || f.tank > len(d.Tanks)+1 {
+		return nil, nil, fmt.Errorf("dive #%d has no tank %d", d.Number, f.tank)
+	}
+	if f.tank == len(d.Tanks)+1 {
+		d.Tanks = append(d.Tanks, divelog.Tank{})
+	}
+	return d, &d.Tanks[f.tank-1], nil
+}
+
+// prepare parses the arguments of a blending calculation, checking the
+// dive's tank exists before any calculation is shown.
+func (f *blendFlags) prepare(e *env, fs *flag.FlagSet, args []string) (gas.Blend, error) {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return gas.Blend{}, err
+	}
+	var t *divelog.Tank
+	if f.dive != 0 {
+		s, err := e.openStore()
+		if err != nil {
+			return gas.Blend{}, err
+		}
+		defer s.Close()
+		if _, t, err = f.selected(s); err != nil {
+			return gas.Blend{}, err
+		}
+	}
+	return f.blend(fs, e.units, pos, t)
+}
+
+// record stores a fill on the tank selected with -dive and -tank: the
+// tank then holds mix at the fill's final pressure.
+func (f *blendFlags) record(e *env, b gas.Blend, mix divelog.GasMix, fill *divelog.Fill) error {
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, t, err := f.selected(s)
+	if err != nil {
+		return err
+	}
+	t.Gas, t.StartPressure, t.Fill = mix, b.Target, fill
+	if t.Volume == 0 {
+		t.Volume = b.Volume
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if err := sites.PutDive(s, d); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "\nrecorded on tank %d of dive #%d\n", f.tank, d.Number)
+	return nil
+}
+
+func runBlend(e *env, fs *flag.FlagSet, args []string) error {
+	var f blendFlags
+	f.register(fs, e.units)
+	topUp := fs.String("top-up", "air", "gas the fill is finished with")
+	b, err := f.prepare(e, fs, args)
+	if err != nil {
+		return err
+	}
+	if b.TopUp, err = divelog.ParseGasMix(*topUp); err != nil {
+		return err
+	}
+	fill, err := gas.PartialPressure(b)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Partial-pressure blend of %s to %s, topped up with %s\n\n", b.TargetMix,
+		e.units.FormatPressure(b.Target), b.TopUp)
+	printFill(e, b, fill)
+	if f.dive == 0 {
+		return nil
+	}
+	return f.record(e, b, b.TargetMix, fillRecord(divelog.FillPartialPressure, b, fill))
+}
+
+func runContinuousFlow(e *env, fs *flag.FlagSet, args []string) error {
+	var f blendFlags
+	f.register(fs, e.units)
+	compressor := fs.Float64("compressor", 0, "compressor output in "+e.units.VolumeUnit()+"/min, to give the oxygen flow")
+	b, err := f.prepare(e, fs, args)
+	if err != nil {
+		return err
+	}
+	fill, err := gas.ContinuousFlow(b)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Continuous-flow fill of %s to %s\n\n", b.TargetMix, e.units.FormatPressure(b.Target))
+	printFill(e, b, fill)
+	if *compressor > 0 && len(fill.Steps) > 0 {
+		rate := gas.InjectionRate(fill.Steps[0].Gas, e.units.Volume(*compressor))
+		fmt.Fprintf(e.stdout, "\nOxygen flow %s/min for %s\n", e.units.FormatVolume(rate), fill.Steps[0].Gas)
+	}
+	if f.dive == 0 {
+		return nil
+	}
+	return f.record(e, b, b.TargetMix, fillRecord(divelog.FillContinuousFlow, b, fill))
+}
+
+func runTopUp(e *env, fs *flag.FlagSet, args []string) error {
+	var f blendFlags
+	f.register(fs, e.units)
+	with := fs.String("with", "air", "gas to top up with")
+	b, err := f.prepare(e, fs, args)
+	if err != nil {
+		return err
+	}
+	// The positional mix is what is in the cylinder, not a target.
+	b.StartMix = b.TargetMix
+	if b.Start <= 0 || b.Start > b.Target {
+		return errors.New("topup needs -from below -to")
+	}
+	top, err := divelog.ParseGasMix(*with)
+	if err != nil {
+		return err
+	}
+	b.TargetMix = gas.TopUp(b.Start, b.StartMix, top, b.Target)
+	fmt.Fprintf(e.stdout, "%s of %s topped up with %s to %s gives %s (%.1f%% O2, %.1f%% He)\n",
+		e.units.FormatPressure(b.Start), b.StartMix, top, e.units.FormatPressure(b.Target), b.TargetMix,
+		b.TargetMix.O2*100, b.TargetMix.He*100)
+	if f.dive == 0 {
+		return nil
+	}
+	fill := &gas.Fill{Drain: b.Start, Steps: []gas.Step{{Gas: top, To: b.Target}}}
+	return f.record(e, b, b.TargetMix, fillRecord(divelog.FillTopUp, b, fill))
+}
+
+func printFill(e *env, b gas.Blend, fill *gas.Fill) {
+	u := e.units
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tGAS\tTO\tVOLUME\t")
+	if fill.Drain < b.Start {
+		fmt.Fprintf(tw, "drain\t%s\t%s\t\t\n", b.StartMix, u.FormatPressure(fill.Drain))
+	}
+	for _, s := range fill.Steps {
+		vol := "-"
+		if s.Volume != 0 {
+			vol = u.FormatVolume(s.Volume)
+		}
+		fmt.Fprintf(tw, "add\t%s\t%s\t%s\t\n", s.Gas, u.FormatPressure(s.To), vol)
+	}
+	tw.Flush()
+}
+
+// fillRecord converts a gas.Fill into the record kept on a tank.
+func fillRecord(m divelog.FillMethod, b gas.Blend, f *gas.Fill) *divelog.Fill {
+	r := &divelog.Fill{Method: m, Start: b.Start, StartMix: b.StartMix, Drain: f.Drain}
+	for _, s := range f.Steps {
+		r.Steps = append(r.Steps, divelog.FillStep{Gas: s.Gas, To: s.To})
+	}
+	return r
+}
+
+// formatFill describes a tank's fill record for show.
+func formatFill(f *divelog.Fill, u divelog.UnitSystem) string {
+	var parts []string
+	if f.Start > 0 {
+		parts = append(parts, fmt.Sprintf("from %s %s", u.FormatPressure(f.Start), f.StartMix))
+	}
+	if f.Drain < f.Start {
+		parts = append(parts, "drain to "+u.FormatPressure(f.Drain))
+	}
+	for _, s := range f.Steps {
+		parts = append(parts, fmt.Sprintf("%s to %s", s.Gas, u.FormatPressure(s.To)))
+	}
+	return string(f.Method) + ": " + strings.Join(parts, ", ")
+}
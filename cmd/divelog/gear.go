@@ -0,0 +1,458 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/gear"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdGear = &command{
+	name:    "gear",
+	args:    "<command> [arguments]",
+	summary: "manage the equipment inventory",
+	run:     runGear,
+}
+
+// gearCommands are the commands under "divelog gear".
+var gearCommands = []*command{
+	{"gear list", "[-all]", "list the inventory with usage and what is due", runGearList},
+	{"gear add", "-kind kind -name name [item flags]", "add an item to the inventory", runGearAdd},
+	{"gear edit", "<id> [-force] [item flags]", "change an item and its record on past dives", runGearEdit},
+	{"gear show", "<id>", "show an item, its usage and the dives it was used on", runGearShow},
+	{"gear use", "<id> <dive>...", "record an item as used on dives", runGearUse},
+	{"gear service", "<id> [-date date] [-hydro] [-visual]", "record a service or cylinder test", runGearService},
+}
+
+func runGear(e *env, fs *flag.FlagSet, args []string) error {
+	return runSubcommand(e, "gear", "command", "", gearCommands, args)
+}
+
+// openInventory opens the log and its inventory.
+func openInventory(e *env) (store.Store, store.Inventory, error) {
+	s, err := e.openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	inv, ok := s.(store.Inventory)
+	if !ok {
+		s.Close()
+		return nil, nil, errors.New("this log has no equipment inventory")
+	}
+	return s, inv, nil
+}
+
+// getItem fetches an item, turning store.ErrItemNotFound into a message
+// that names it.
+func getItem(inv store.Inventory, arg string) (*divelog.Item, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid item ID %q", arg)
+	}
+	it, err := inv.GetItem(id)
+	if errors.Is(err, store.ErrItemNotFound) {
+		return nil, fmt.Errorf("no item %d", id)
+	}
+	return it, err
+}
+
+// itemFlags are the flags gear add and edit use to describe an item.
+type itemFlags struct {
+	kind, name, serial string
+	rental, retired    bool
+	purchased          string
+	lastService        string
+	serviceMonths      int
+	serviceDives       int
+	lastHydro          string
+	lastVisual         string
+	notes              string
+}
+
+func (f *itemFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.kind, "kind", "", "`kind`: regulator, bcd, computer, cylinder, drysuit, wetsuit, light or other")
+	fs.StringVar(&f.name, "name", "", "item `name`, e.g. \"Mk25\" or \"AL80 #3\"")
+	fs.StringVar(&f.serial, "serial", "", "serial `number`")
+	fs.BoolVar(&f.rental, "rental", false, "shop rental gear")
+	fs.BoolVar(&f.retired, "retired", false, "no longer in use")
+	fs.StringVar(&f.purchased, "purchased", "", "purchase `date`")
+	fs.StringVar(&f.lastService, "last-service", "", "`date` of the last service")
+	fs.IntVar(&f.serviceMonths, "service-months", 0, "months between services, 0 for no limit")
+	fs.IntVar(&f.serviceDives, "service-dives", 0, "dives between services, 0 for no limit")
+	fs.StringVar(&f.lastHydro, "last-hydro", "", "`date` of a cylinder's last hydrostatic test")
+	fs.StringVar(&f.lastVisual, "last-visual", "", "`date` of a cylinder's last visual inspection")
+	fs.StringVar(&f.notes, "notes", "", "free-form notes")
+}
+
+// apply copies the flags that were set on the command line into it.
+func (f *itemFlags) apply(fs *flag.FlagSet, it *divelog.Item) error {
+	var err error
+	date := func(s string) time.Time {
+		if s == "" || err != nil {
+			return time.Time{}
+		}
+		var t time.Time
+		t, err = parseTime(s)
+		return t
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "kind":
+			it.Kind = divelog.EquipmentKind(strings.ToLower(f.kind))
+		case "name":
+			it.Name = f.name
+		case "serial":
+			it.Serial = f.serial
+		case "rental":
+			it.Rental = f.rental
+		case "retired":
+			it.Retired = f.retired
+		case "purchased":
+			it.Purchased = date(f.purchased)
+		case "last-service":
+			it.LastService = date(f.lastService)
+		case "service-months":
+			it.ServiceMonths = f.serviceMonths
+		case "service-dives":
+			it.ServiceDives = f.serviceDives
+		case "last-hydro":
+			it.LastHydro = date(f.lastHydro)
+		case "last-visual":
+			it.LastVisual = date(f.lastVisual)
+		case "notes":
+			it.Notes = f.notes
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return it.Validate()
+}
+
+func runGearList(e *env, fs *flag.FlagSet, args []string) error {
+	all := fs.Bool("all", false, "include retired items")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, inv, err := openInventory(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	items, err := inv.Items()
+	if err != nil {
+		return err
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	usage := gear.Tally(items, dives)
+	due := map[int][]string{}
+	for _, r := range gear.Reminders(items, usage, time.Now()) {
+		due[r.Item.ID] = append(due[r.Item.ID], string(r.Check)+" "+describeReminder(r, time.Now()))
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tNAME\tSERIAL\tDIVES\tHOURS\tDUE\t")
+	listed := 0
+	for _, it := range items {
+		if it.Retired && !*all {
+			continue
+		}
+		name := it.Name
+		switch {
+		case it.Retired:
+			name += " (retired)"
+		case it.Rental:
+			name += " (rental)"
+		}
+		u := usage[it.ID]
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%.1f\t%s\t\n", it.ID, it.Kind, name, orDash(it.Serial != "", it.Serial),
+			u.Dives, u.Time.Hours(), orDash(len(due[it.ID]) > 0, strings.Join(due[it.ID], "; ")))
+		listed++
+	}
+	if listed == 0 {
+		fmt.Fprintln(e.stdout, "No equipment in the inventory.")
+		return nil
+	}
+	return tw.Flush()
+}
+
+func runGearAdd(e *env, fs *flag.FlagSet, args []string) error {
+	var f itemFlags
+	f.register(fs)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || f.kind == "" || f.name == "" {
+		fs.Usage()
+		return errUsage
+	}
+	it := &divelog.Item{}
+	if err := f.apply(fs, it); err != nil {
+		return err
+	}
+	s, inv, err := openInventory(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := inv.PutItem(it); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "added item %d\n", it.ID)
+	return nil
+}
+
+func runGearEdit(e *env, fs *flag.FlagSet, args []string) error {
+	var f itemFlags
+	f.register(fs)
+	force := fs.Bool("force", false, "change the item even if that invalidates signed dives")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || fs.NFlag() == 0 || fs.NFlag() == 1 && *force {
+		fs.Usage()
+		return errUsage
+	}
+	s, inv, err := openInventory(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	it, err := getItem(inv, pos[0])
+	if err != nil {
+		return err
+	}
+	was := *it
+	if err := f.apply(fs, it); err != nil {
+		return err
+	}
+	if was.Equipment() != it.Equipment() {
+		if err := checkSigned(e, s, *force, func(d *divelog.Dive) bool { return gear.Used(&was, d) }); err != nil {
+			return err
+		}
+	}
+	n, err := gear.Update(s, it)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "updated item %d", it.ID)
+	if n > 0 {
+		fmt.Fprintf(e.stdout, " and its record on %s", plural(n, "dive"))
+	}
+	fmt.Fprintln(e.stdout)
+	return nil
+}
+
+func runGearShow(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	s, inv, err := openInventory(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	it, err := getItem(inv, pos[0])
+	if err != nil {
+		return err
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	used := gear.Dives(it, dives)
+	u := gear.Tally([]*divelog.Item{it}, used)[it.ID]
+	now := time.Now()
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	row := func(label, format string, args ...any) {
+		fmt.Fprintf(tw, "%s:\t"+format+"\n", append([]any{label}, args...)...)
+	}
+	date := func(label string, t time.Time) {
+		if !t.IsZero() {
+			row(label, "%s", t.Format("2006-01-02"))
+		}
+	}
+	fmt.Fprintf(tw, "Item %d\n", it.ID)
+	row("Kind", "%s", it.Kind)
+	row("Name", "%s", it.Name)
+	if it.Serial != "" {
+		row("Serial", "%s", it.Serial)
+	}
+	switch {
+	case it.Retired:
+		row("Status", "retired")
+	case it.Rental:
+		row("Status", "rental")
+	}
+	date("Purchased", it.Purchased)
+	date("Last service", it.LastService)
+	if it.ServiceMonths > 0 || it.ServiceDives > 0 {
+		var every []string
+		if it.ServiceMonths > 0 {
+			every = append(every, plural(it.ServiceMonths, "month"))
+		}
+		if it.ServiceDives > 0 {
+			every = append(every, plural(it.ServiceDives, "dive"))
+		}
+		row("Service every", "%s", strings.Join(every, " or "))
+	}
+	date("Hydro test", it.LastHydro)
+	date("Visual", it.LastVisual)
+	row("Usage", "%s, %.1f h underwater", plural(u.Dives, "dive"), u.Time.Hours())
+	if u.Dives > 0 {
+		row("Used", "%s to %s", u.First.Format("2006-01-02"), u.Last.Format("2006-01-02"))
+	}
+	for _, r := range gear.Reminders([]*divelog.Item{it}, map[int]*gear.Usage{it.ID: u}, now) {
+		row("Due", "%s %s", r.Check, describeReminder(r, now))
+	}
+	if it.Notes != "" {
+		row("Notes", "%s", it.Notes)
+	}
+	if len(used) > 0 {
+		var numbers []string
+		for _, d := range used {
+			numbers = append(numbers, "#"+strconv.Itoa(d.Number))
+		}
+		row("Dives", "%s", strings.Join(numbers, " "))
+	}
+	return tw.Flush()
+}
+
+func runGearUse(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	var numbers []int
+	for _, p := range pos[1:] {
+		n, err := parseNumber(p)
+		if err != nil {
+			return err
+		}
+		numbers = append(numbers, n)
+	}
+	s, inv, err := openInventory(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	it, err := getItem(inv, pos[0])
+	if err != nil {
+		return err
+	}
+	for _, n := range numbers {
+		if _, err := getDive(s, n); err != nil {
+			return err
+		}
+	}
+	n, err := gear.Use(s, it, numbers...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "recorded %s on %s\n", it.Name, plural(n, "more dive"))
+	return nil
+}
+
+func runGearService(e *env, fs *flag.FlagSet, args []string) error {
+	date := fs.String("date", "", "`date` of the work; default today")
+	hydro := fs.Bool("hydro", false, "record a hydrostatic test instead of a service")
+	visual := fs.Bool("visual", false, "record a visual inspection instead of a service")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	when := time.Now()
+	if *date != "" {
+		if when, err = parseTime(*date); err != nil {
+			return err
+		}
+	}
+	s, inv, err := openInventory(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	it, err := getItem(inv, pos[0])
+	if err != nil {
+		return err
+	}
+	if (*hydro || *visual) && it.Kind != divelog.Cylinder {
+		return fmt.Errorf("item %d is a %s, not a cylinder", it.ID, it.Kind)
+	}
+	var done []string
+	if *hydro {
+		it.LastHydro = when
+		done = append(done, string(gear.Hydro))
+	}
+	if *visual {
+		it.LastVisual = when
+		done = append(done, string(gear.Visual))
+	}
+	if !*hydro && !*visual {
+		it.LastService = when
+		done = append(done, string(gear.Service))
+	}
+	if err := inv.PutItem(it); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "recorded %s of %s on %s\n", strings.Join(done, " and "), it.Name, when.Format("2006-01-02"))
+	return nil
+}
+
+// describeReminder says when a check is or was due.
+func describeReminder(r gear.Reminder, now time.Time) string {
+	var parts []string
+	switch {
+	case r.Never:
+		parts = append(parts, "never recorded")
+	case r.Due.IsZero():
+	case r.Overdue:
+		parts = append(parts, "overdue since "+r.Due.Format("2006-01-02"))
+	default:
+		days := int(math.Ceil(r.Due.Sub(now).Hours() / 24))
+		parts = append(parts, fmt.Sprintf("due %s, in %s", r.Due.Format("2006-01-02"), plural(days, "day")))
+	}
+	if r.ByDives {
+		switch {
+		case r.DivesLeft > 0:
+			parts = append(parts, "due in "+plural(r.DivesLeft, "dive"))
+		case r.DivesLeft == 0:
+			parts = append(parts, "due by dive count")
+		default:
+			parts = append(parts, "overdue by "+plural(-r.DivesLeft, "dive"))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdImport = &command{
+	name:    "import",
+	args:    "<format> [-keep-numbers] [-n] [-map mapping.yaml] <file>",
+	summary: "add dives from a file written by another program",
+	run:     runImport,
+}
+
+func runImport(e *env, fs *flag.FlagSet, args []string) error {
+	keep := fs.Bool("keep-numbers", false, "keep the dive numbers recorded in the file")
+	dryRun := fs.Bool("n", false, "report what would be imported without changing the log")
+	// The format comes first so its own flags can be registered before
+	// the rest of the arguments are parsed.
+	var read reader
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		f, err := lookupFormat(args[0])
+		if err != nil {
+			return err
+		}
+		if f.importer == nil {
+			return fmt.Errorf("%s files cannot be imported", f.name)
+		}
+		read = f.importer(fs)
+	}
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 || read == nil {
+		fs.Usage()
+		return errUsage
+	}
+	in, err := os.Open(pos[1])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dives, err := read(e, in)
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return importDives(e, s, dives, *keep, *dryRun)
+}
+
+// importDives adds dives to s in chronological order, skipping those that
+// fail validation and those already logged: recorded by the same computer,
+// or by none, at the same start time. Another computer's record of a
+// logged dive is added, for dedupe to merge.
+func importDives(e *env, s store.Store, dives []*divelog.Dive, keepNumbers, dryRun bool) error {
+	existing, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	logged := make(map[time.Time][]*divelog.Dive)
+	minute := func(d *divelog.Dive) time.Time { return d.Start.Truncate(time.Minute).UTC() }
+	for _, d := range existing {
+		logged[minute(d)] = append(logged[minute(d)], d)
+	}
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+
+	var added, skipped, invalid int
+	for _, d := range dives {
+		when := d.Start.Format("2006-01-02 15:04")
+		if slices.ContainsFunc(logged[minute(d)], func(o *divelog.Dive) bool { return sameRecord(d, o) }) {
+			skipped++
+			continue
+		}
+		if err := d.Validate(); err != nil {
+			fmt.Fprintf(e.stderr, "skipping dive at %s: %v\n", when, err)
+			invalid++
+			continue
+		}
+		if !keepNumbers {
+			d.Number = 0
+		} else if _, err := s.Get(d.Number); err == nil {
+			return fmt.Errorf("dive at %s: number %d is already in use", when, d.Number)
+		}
+		if !dryRun {
+			if err := sites.PutDive(s, d); err != nil {
+				return err
+			}
+		}
+		logged[minute(d)] = append(logged[minute(d)], d)
+		added++
+	}
+	verb := "imported"
+	if dryRun {
+		verb = "would import"
+	}
+	fmt.Fprintf(e.stdout, "%s %d dives", verb, added)
+	if skipped > 0 {
+		fmt.Fprintf(e.stdout, ", %d already in the log", skipped)
+	}
+	if invalid > 0 {
+		fmt.Fprintf(e.stdout, ", %d invalid", invalid)
+	}
+	fmt.Fprintln(e.stdout)
+	return nil
+}
+
+// sameRecord reports whether a and b, starting in the same minute, are the
+// same record of a dive rather than two computers' records of it.
+func sameRecord(a, b *divelog.Dive) bool {
+	if len(a.Computers()) == 0 && len(b.Computers()) == 0 {
+		return true
+	}
+	return sameComputer(a, b)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/query"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdList = &command{
+	name:    "list",
+	args:    "[-from date] [-to date] [-site name] [-min-depth n] [-max-depth n] [query]",
+	summary: "list dives, optionally filtered or searched",
+	run:     runList,
+}
+
+func runList(e *env, fs *flag.FlagSet, args []string) error {
+	var qf queryFlags
+	qf.register(fs, e.units)
+	pos, err := parseQuery(fs, args)
+	if err != nil {
+		return err
+	}
+	q, err := qf.query(e.units)
+	if err != nil {
+		return err
+	}
+	// The query may come as one argument or as several words.
+	expr, err := query.Parse(strings.Join(pos, " "), e.units)
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	q.OmitSamples = true
+	dives, err := query.Run(s, expr, q)
+	if err != nil {
+		return err
+	}
+	printDives(e, dives)
+	return nil
+}
+
+// queryFlags are the flags that select dives, shared by the commands that
+// work on a range of the log.
+type queryFlags struct {
+	from, to, site     string
+	minDepth, maxDepth float64
+}
+
+func (f *queryFlags) register(fs *flag.FlagSet, u divelog.UnitSystem) {
+	fs.StringVar(&f.from, "from", "", "only dives on or after `date`")
+	fs.StringVar(&f.to, "to", "", "only dives on or before `date`")
+	fs.StringVar(&f.site, "site", "", "only dives at sites whose name contains `text`")
+	fs.Float64Var(&f.minDepth, "min-depth", 0, "only dives at least this deep, in "+u.DepthUnit())
+	fs.Float64Var(&f.maxDepth, "max-depth", 0, "only dives at most this deep, in "+u.DepthUnit())
+}
+
+func (f *queryFlags) query(u divelog.UnitSystem) (store.Query, error) {
+	q := store.Query{Site: f.site}
+	var err error
+	if f.from != "" {
+		if q.From, err = parseTime(f.from); err != nil {
+			return q, err
+		}
+	}
+	if f.to != "" {
+		if q.To, err = parseTime(f.to); err != nil {
+			return q, err
+		}
+		if !strings.Contains(f.to, ":") {
+			q.To = q.To.AddDate(0, 0, 1) // include the whole day
+		}
+	}
+	if f.minDepth != 0 {
+		q.MinDepth = u.Depth(f.minDepth)
+	}
+	if f.maxDepth != 0 {
+		q.MaxDepth = u.Depth(f.maxDepth)
+	}
+	return q, nil
+}
+
+func printDives(e *env, dives []*divelog.Dive) {
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tDATE\tSITE\tDEPTH\tTIME")
+	for _, d := range dives {
+		site := ""
+		if d.Site != nil {
+			site = d.Site.Name
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", d.Number, d.Start.Format("2006-01-02 15:04"),
+			site, e.units.FormatDepth(d.MaxDepth), formatDuration(d.Duration))
+	}
+	tw.Flush()
+}
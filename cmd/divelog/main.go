@@ -0,0 +1,276 @@
+// Command divelog manages a personal dive log from the terminal.
+//
+// Usage:
+//
+//	divelog [-log file] [-units metric|imperial] <command> [arguments]
+//
+// Run "divelog help" for the list of commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/betonavab/divelog"
+)
+
+// A command is one divelog subcommand.
+type command struct {
+	name    string
+	args    string // argument synopsis shown in help
+	summary string
+	run     func(e *env, fs *flag.FlagSet, args []string) error
+}
+
+// commands lists the subcommands in the order help shows them.
+var commands = []*command{
+	cmdAdd,
+	cmdList,
+	cmdShow,
+	cmdEdit,
+	cmdDelete,
+	cmdImport,
+	cmdDownload,
+	cmdDedupe,
+	cmdProfiles,
+	cmdExport,
+	cmdMigrate,
+	cmdPlan,
+	cmdGas,
+	cmdStats,
+	cmdSites,
+	cmdGear,
+	cmdCerts,
+	cmdStatus,
+	cmdKeygen,
+	cmdSign,
+	cmdVerify,
+	cmdPlot,
+	cmdServe,
+}
+
+// env carries the global options and I/O streams into each command.
+type env struct {
+	logPath string
+	units   divelog.UnitSystem
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// errUsage is returned by commands when their arguments are wrong; the
+// command's flag set has already printed the details.
+var errUsage = errors.New("usage")
+
+func main() {
+	e := &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	if err := run(e, os.Args[1:]); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "divelog:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(e *env, args []string) error {
+	fs := flag.NewFlagSet("divelog", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&e.logPath, "log", defaultLogPath(), "dive log `file`; .db, .sqlite or .sqlite3 selects SQLite")
+	units := fs.String("units", envOr("DIVELOG_UNITS", "metric"), "unit system: metric or imperial")
+	fs.Usage = func() { usage(e.stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	var err error
+	if e.units, err = divelog.ParseUnitSystem(*units); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	name, rest := fs.Arg(0), fs.Args()[1:]
+	if name == "help" {
+		if len(rest) == 0 {
+			usage(e.stdout, fs)
+			return nil
+		}
+		name, rest = rest[0], []string{"-h"}
+	}
+	for _, c := range commands {
+		if c.name == name {
+			err := c.run(e, c.flagSet(e), rest)
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("unknown command %q; run \"divelog help\"", name)
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: divelog [options] <command> [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nOptions:\n")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nRun \"divelog help <command>\" for details on a command.\n")
+}
+
+// flagSet returns a flag set for c whose usage message shows the
+// command's synopsis.
+func (c *command) flagSet(e *env) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: divelog %s %s\n\n%s\n", c.name, c.args, c.summary)
+		if hasFlags(fs) {
+			fmt.Fprintf(e.stderr, "\nOptions:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// runSubcommand runs the command in cmds named by args[0], for commands
+// such as "gas" that group several others. Without a known name it runs
+// def, if the group has a default, with all of args; otherwise it prints
+// the list of them.
+func runSubcommand(e *env, group, what, def string, cmds []*command, args []string) error {
+	help := len(args) == 1 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help")
+	if len(args) > 0 {
+		for _, c := range cmds {
+			if c.name == group+" "+args[0] {
+				return c.run(e, c.flagSet(e), args[1:])
+			}
+		}
+	}
+	if def != "" && !help {
+		for _, c := range cmds {
+			if c.name == group+" "+def {
+				return c.run(e, c.flagSet(e), args)
+			}
+		}
+	}
+	synopsis := "<" + what + ">"
+	if def != "" {
+		synopsis = "[" + what + "]"
+	}
+	fmt.Fprintf(e.stderr, "Usage: divelog %s %s [arguments]\n\n%ss:\n", group, synopsis, strings.ToUpper(what[:1])+what[1:])
+	for _, c := range cmds {
+		fmt.Fprintf(e.stderr, "  %-8s %s\n", strings.TrimPrefix(c.name, group+" "), c.summary)
+	}
+	if def != "" {
+		fmt.Fprintf(e.stderr, "\nWithout a %s, divelog %s runs %s.\n", what, group, def)
+	}
+	fmt.Fprintf(e.stderr, "\nRun \"divelog %s <%s> -h\" for details.\n", group, what)
+	if help {
+		return flag.ErrHelp
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("unknown %s %s %q", group, what, args[0])
+	}
+	return errUsage
+}
+
+// parse parses args with fs. Unlike flag.FlagSet.Parse it accepts flags
+// after the positional arguments, so "divelog edit 12 -depth 30" works.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			return pos, nil
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseQuery is parse for commands whose positional arguments are a
+// query. A negated term such as -tag:night or -wreck reads like a flag, so
+// arguments that name no flag of fs are kept as query words, in order.
+func parseQuery(fs *flag.FlagSet, args []string) ([]string, error) {
+	var flags, words []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			words = append(words, args[i+1:]...)
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-"), "=")
+		if len(a) < 2 || a[0] != '-' || name == "" {
+			words = append(words, a)
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil && name != "h" && name != "help" {
+			words = append(words, a)
+			continue
+		}
+		flags = append(flags, a)
+		if f == nil || hasValue || i+1 == len(args) {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	if _, err := parse(fs, flags); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+func defaultLogPath() string {
+	if p := os.Getenv("DIVELOG_LOG"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "divelog.json"
+	}
+	return filepath.Join(home, ".divelog", "log.json")
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// stringList is a flag.Value collecting a repeatable or comma-separated
+// string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
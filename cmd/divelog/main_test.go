@@ -0,0 +1,958 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/uddf"
+)
+
+// runCmd runs divelog with args against the log in dir and returns
+// its standard output.
+func runCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: &out, stderr: &errOut}
+	args = append([]string{"-log", filepath.Join(dir, "log.json")}, args...)
+	if err := run(e, args); err != nil {
+		t.Fatalf("divelog %s: %v\n%s", strings.Join(args, " "), err, errOut.String())
+	}
+	return out.String()
+}
+
+func TestAddListShowEditDelete(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-05-01 09:30", "-duration", "45m", "-depth", "28.4",
+		"-site", "Blue Hole", "-buddy", "Ana", "-gas", "EAN32", "-start-pressure", "200", "-end-pressure", "60")
+	runCmd(t, dir, "add", "-date", "2024-05-02 10:00", "-duration", "50m", "-depth", "12", "-site", "Canyon")
+	runCmd(t, dir, "add", "-date", "2024-05-03 10:00", "-duration", "40m", "-depth", "18", "-site", "Reef")
+
+	list := runCmd(t, dir, "list", "-min-depth", "15")
+	if !strings.Contains(list, "Blue Hole") || strings.Contains(list, "Canyon") {
+		t.Errorf("list -min-depth 15:\n%s", list)
+	}
+	list = runCmd(t, dir, "list", "-from", "2024-05-02", "-to", "2024-05-02")
+	if strings.Contains(list, "Blue Hole") || !strings.Contains(list, "Canyon") || strings.Contains(list, "Reef") {
+		t.Errorf("list -from/-to:\n%s", list)
+	}
+
+	runCmd(t, dir, "edit", "2", "-depth", "14", "-notes", "current")
+	show := runCmd(t, dir, "show", "2")
+	if !strings.Contains(show, "14.0 m") || !strings.Contains(show, "current") {
+		t.Errorf("show after edit:\n%s", show)
+	}
+
+	// Either coordinate can be changed alone once the site is placed.
+	runCmd(t, dir, "add", "-date", "2024-05-04 10:00", "-depth", "20", "-site", "Wall", "-lat", "17.3157", "-lon", "-87.5346")
+	runCmd(t, dir, "edit", "4", "-lon", "-87.6")
+	if show := runCmd(t, dir, "show", "4"); !strings.Contains(show, "Wall (17.31570, -87.60000)") {
+		t.Errorf("show after -lon:\n%s", show)
+	}
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "edit", "1", "-lon", "-87.5"}); err == nil {
+		t.Error("edit -lon of a site without a position succeeded")
+	}
+
+	// Numbers stay put after a delete, and are not reused.
+	runCmd(t, dir, "delete", "2")
+	runCmd(t, dir, "add", "-depth", "5", "-site", "Pool")
+	list = runCmd(t, dir, "list")
+	if !strings.Contains(list, "3  ") || !strings.Contains(list, "4  ") || strings.Contains(list, "Canyon") {
+		t.Errorf("list after delete:\n%s", list)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-01-10 20:00", "-depth", "32", "-site", "Blue Hole", "-buddy", "Ana",
+		"-tag", "night", "-notes", "Turtles under the arch")
+	runCmd(t, dir, "add", "-date", "2024-02-03 10:00", "-depth", "35", "-site", "Blue Hole", "-buddy", "Joe")
+	runCmd(t, dir, "add", "-date", "2024-03-15 10:00", "-depth", "18", "-site", "Canyon", "-notes", "A turtle and a ray")
+
+	numbers := func(list string) string {
+		var ns []string
+		for _, line := range strings.Split(strings.TrimSpace(list), "\n")[1:] {
+			ns = append(ns, strings.Fields(line)[0])
+		}
+		return strings.Join(ns, " ")
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{`depth>30 site~"Blue Hole" buddy:ana after:2024-01 tag:night`}, "1"},
+		{[]string{"depth>30 -tag:night"}, "2"},
+		{[]string{"depth>30", "NOT", "tag:night"}, "2"},
+		{[]string{"TURTLE"}, "1 3"},
+		{[]string{"-min-depth", "20", "turtle OR buddy:joe"}, "1 2"},
+		{[]string{"turtle", "-site", "canyon"}, "3"},
+		// Negated terms given as separate arguments are query words, not flags.
+		{[]string{"depth>30", "-tag:night"}, "2"},
+		{[]string{"-buddy:joe", "-min-depth", "20"}, "1"},
+		{[]string{"-turtle", "--", "-site:canyon"}, "2"},
+	} {
+		if got := numbers(runCmd(t, dir, append([]string{"list"}, tt.args...)...)); got != tt.want {
+			t.Errorf("list %q: dives %s, want %s", tt.args, got, tt.want)
+		}
+	}
+
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "list", "dpeth>30"})
+	if err == nil || !strings.Contains(err.Error(), `unknown field "dpeth"`) {
+		t.Errorf("list with a misspelt field: %v", err)
+	}
+}
+
+func TestAddRejectsInvalidDive(t *testing.T) {
+	var out, errOut bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: &out, stderr: &errOut}
+	err := run(e, []string{"-log", filepath.Join(t.TempDir(), "log.json"), "add", "-gas", "60/50"})
+	if err == nil {
+		t.Fatal("add with 110% gas succeeded")
+	}
+}
+
+func TestInteractiveAdd(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	in := "2024-06-01 08:00\n55m\n22\nWreck\nAna, Bob\nEAN28\n210\n70\n19\nlots of fish\n"
+	e := &env{stdin: strings.NewReader(in), stdout: &out, stderr: &out}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "add", "-i"}); err != nil {
+		t.Fatalf("add -i: %v\n%s", err, out.String())
+	}
+	show := runCmd(t, dir, "show", "1")
+	for _, want := range []string{"Wreck", "22.0 m", "55 min", "Ana, Bob", "EAN28", "210 bar", "lots of fish"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("show missing %q:\n%s", want, show)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-05-01 09:30", "-depth", "28.4", "-site", "Blue Hole", "-gas", "EAN32")
+	runCmd(t, dir, "add", "-date", "2024-05-02 10:00", "-depth", "12", "-site", "Canyon")
+	runCmd(t, dir, "add", "-depth", "5")
+	runCmd(t, dir, "delete", "3")
+
+	db := filepath.Join(dir, "log.db")
+	runCmd(t, dir, "migrate", db)
+	var out bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: &out, stderr: &out}
+	if err := run(e, []string{"-log", db, "add", "-depth", "9"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "#4") {
+		t.Errorf("first dive added after migrate: %q, want #4", out.String())
+	}
+	out.Reset()
+	if err := run(e, []string{"-log", db, "show", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Blue Hole") || !strings.Contains(out.String(), "EAN32") {
+		t.Errorf("migrated dive:\n%s", out.String())
+	}
+
+	// Migrating onto a log that already has dives is refused.
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "migrate", db}); err == nil {
+		t.Error("migrate into non-empty destination succeeded")
+	}
+}
+
+func TestImportExportSubsurface(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-04-30 09:30", "-depth", "10", "-site", "Home reef")
+	out := runCmd(t, dir, "import", "ssrf", "../../subsurface/testdata/belize.ssrf")
+	if !strings.Contains(out, "imported 3 dives") {
+		t.Errorf("import: %q", out)
+	}
+	// Dives are numbered after the existing one, oldest first.
+	list := runCmd(t, dir, "list")
+	if !strings.Contains(list, "2  2019-08-17") || !strings.Contains(list, "4  2024-05-01 13:15") {
+		t.Errorf("list after import:\n%s", list)
+	}
+	out = runCmd(t, dir, "import", "ssrf", "../../subsurface/testdata/belize.ssrf")
+	if !strings.Contains(out, "imported 0 dives, 3 already in the log") {
+		t.Errorf("second import: %q", out)
+	}
+	xml := runCmd(t, dir, "export", "ssrf")
+	if !strings.Contains(xml, `name="Half Moon Caye Wall"`) || strings.Count(xml, "<dive ") != 4 {
+		t.Errorf("export:\n%s", xml)
+	}
+}
+
+func TestImportUDDF(t *testing.T) {
+	dir := t.TempDir()
+	out := runCmd(t, dir, "import", "uddf", "-keep-numbers", "../../uddf/testdata/vendor.uddf")
+	if !strings.Contains(out, "imported 2 dives") {
+		t.Errorf("import: %q", out)
+	}
+	show := runCmd(t, dir, "show", "412")
+	if !strings.Contains(show, "SS Thistlegorm") || !strings.Contains(show, "EAN50") {
+		t.Errorf("show 412:\n%s", show)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	dir := t.TempDir()
+	var out, errOut bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: &out, stderr: &errOut}
+	err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "import", "csv",
+		"-map", "../../csvimport/testdata/mapping.yaml", "../../csvimport/testdata/logbook.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "imported 3 dives") {
+		t.Errorf("import: %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "skipping line 6: column \"Max (ft)\"") ||
+		!strings.Contains(errOut.String(), "4 rows could not be read") {
+		t.Errorf("row errors:\n%s", errOut.String())
+	}
+	list := runCmd(t, dir, "list")
+	if !strings.Contains(list, "Half Moon Caye") {
+		t.Errorf("list after import:\n%s", list)
+	}
+
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "import", "csv",
+		"../../csvimport/testdata/logbook.csv"}); err == nil || !strings.Contains(err.Error(), "-map") {
+		t.Errorf("import csv without -map: %v", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	out := runCmd(t, t.TempDir(), "plan", "-depth", "60", "-time", "20m",
+		"-gas", "18/45:24/230", "-gas", "EAN50:11/200", "-gas", "O2:7/200", "-gf", "30/80")
+	for _, want := range []string{"60.0 m for 20 min on 18/45, GF 30/80", "21.0 m", "EAN50", "oxygen", "Runtime", "ok"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan output lacks %q:\n%s", want, out)
+		}
+	}
+	out = runCmd(t, t.TempDir(), "-units", "imperial", "plan", "-depth", "100", "-time", "30m", "-gas", "EAN32:80/3000")
+	if !strings.Contains(out, "10 ft") || !strings.Contains(out, "NOT ENOUGH GAS") {
+		t.Errorf("imperial plan:\n%s", out)
+	}
+}
+
+func TestGas(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"mod", "EAN32", "-ppo2", "1.4"}, "EAN32: MOD 33.4 m"},
+		{[]string{"end", "18/45", "-depth", "60"}, "END 28.5 m"},
+		{[]string{"ead", "EAN32", "-depth", "30"}, "EAD 24.4 m"},
+		{[]string{"density", "air", "-depth", "60"}, "above the 6.2 g/l maximum"},
+		{[]string{"bestmix", "-depth", "40", "-end", "30"}, "Best mix for 40.0 m: 27/20"},
+		{[]string{"topup", "EAN32", "-from", "100", "-to", "200"}, "gives EAN27"},
+		{[]string{"cflow", "EAN36", "-from", "100", "-to", "200"}, "EAN40"},
+	}
+	for _, tt := range tests {
+		out := runCmd(t, dir, append([]string{"gas"}, tt.args...)...)
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("gas %s:\n%s\nwant %q", strings.Join(tt.args, " "), out, tt.want)
+		}
+	}
+
+	runCmd(t, dir, "add", "-depth", "40", "-tank", "12")
+	out := runCmd(t, dir, "gas", "blend", "21/35", "-to", "200", "-dive", "1")
+	if !strings.Contains(out, "helium") || !strings.Contains(out, "recorded on tank 1 of dive #1") {
+		t.Errorf("gas blend:\n%s", out)
+	}
+	show := runCmd(t, dir, "show", "1")
+	for _, want := range []string{"12.0 l 21/35, 200 bar", "partial-pressure: helium to"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("show lacks %q:\n%s", want, show)
+		}
+	}
+}
+
+func TestShowOxygen(t *testing.T) {
+	dir := t.TempDir()
+	for _, at := range []string{"2024-06-01 08:00", "2024-06-01 10:00", "2024-06-01 12:00"} {
+		runCmd(t, dir, "add", "-date", at, "-duration", "60m", "-depth", "34", "-gas", "EAN32")
+	}
+	runCmd(t, dir, "add", "-date", "2024-06-10 09:00", "-duration", "30m", "-depth", "20", "-gas", "EAN32")
+	show := runCmd(t, dir, "show", "3")
+	for _, want := range []string{"Max ppO2:   1.42 bar", "(43% carried over)  above 80%", "on the trip, day 1, limit 850)"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("show 3 lacks %q:\n%s", want, show)
+		}
+	}
+	// A week later the loading has cleared and a new trip begins.
+	show = runCmd(t, dir, "show", "4")
+	if strings.Contains(show, "carried over") || strings.Contains(show, "ABOVE") {
+		t.Errorf("show 4:\n%s", show)
+	}
+}
+
+func TestShowRepetitive(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-06-01 08:00", "-duration", "40m", "-depth", "18")
+	runCmd(t, dir, "add", "-date", "2024-06-01 09:40", "-duration", "40m", "-depth", "18")
+	if show := runCmd(t, dir, "show", "1"); strings.Contains(show, "Interval") || !strings.Contains(show, "Start NDL:  42 min at 18.0 m\n") {
+		t.Errorf("show 1:\n%s", show)
+	}
+	show := runCmd(t, dir, "show", "2")
+	for _, want := range []string{"Interval:   60 min", "Residual:   compartment", "Start NDL:  39 min at 18.0 m (42 min on a first dive)"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("show 2 lacks %q:\n%s", want, show)
+		}
+	}
+}
+
+func TestStatsSAC(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []struct{ date, site, end string }{
+		{"2024-05-01 09:00", "Reef", "60"},
+		{"2024-05-20 09:00", "Wall", "80"},
+		{"2024-06-10 09:00", "Reef", "100"},
+	} {
+		runCmd(t, dir, "add", "-date", d.date, "-duration", "45m", "-depth", "20", "-avg-depth", "14",
+			"-site", d.site, "-tank", "12", "-start-pressure", "200", "-end-pressure", d.end)
+	}
+	runCmd(t, dir, "add", "-date", "2024-06-11 09:00", "-depth", "20", "-site", "Reef")
+
+	out := runCmd(t, dir, "stats", "sac")
+	for _, want := range []string{"2024-05  2", "2024-06  1", "RMV trend: falling", "1 dive left out"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stats sac lacks %q:\n%s", want, out)
+		}
+	}
+	out = runCmd(t, dir, "stats", "sac", "-by", "site", "-from", "2024-05-10")
+	if !strings.Contains(out, "Wall   1") || !strings.Contains(out, "Reef   1") {
+		t.Errorf("stats sac -by site:\n%s", out)
+	}
+	if show := runCmd(t, dir, "show", "1"); !strings.Contains(show, "SAC:        1.2 bar/min, RMV 14.6 l/min") {
+		t.Errorf("show 1:\n%s", show)
+	}
+}
+
+func TestStatsSummary(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2023-12-30 09:00", "-duration", "40m", "-depth", "18", "-temp", "22",
+		"-site", "Blue Hole", "-buddy", "Ana", "-gas", "air")
+	runCmd(t, dir, "add", "-date", "2023-12-31 09:00", "-duration", "55m", "-depth", "31", "-temp", "19",
+		"-site", "Canyon", "-buddy", "Ana", "-buddy", "Joe", "-gas", "EAN32")
+	runCmd(t, dir, "add", "-date", "2024-01-01 14:00", "-duration", "35m", "-depth", "5")
+	runCmd(t, dir, "add", "-date", "2024-03-02 09:00", "-duration", "50m", "-depth", "12", "-site", "Blue Hole",
+		"-gas", "EAN32", "-tag", "night")
+
+	if bare, out := runCmd(t, dir, "stats"), runCmd(t, dir, "stats", "summary"); bare != out {
+		t.Errorf("stats without a report:\n%s\nwant the summary:\n%s", bare, out)
+	}
+	out := runCmd(t, dir, "stats", "summary", "-top", "1")
+	for _, want := range []string{
+		"Dives:           4 on 4 days, 2023-12-30 to 2024-03-02",
+		"Bottom time:     3.0 h",
+		"Deepest:         31.0 m, #2 on 2023-12-31 at Canyon",
+		"Coldest:         19.0 °C, #2 on 2023-12-31 at Canyon",
+		"Longest streak:  3 days, 2023-12-30 to 2024-01-01 (3 dives)",
+		"30-35 m  1      ####",
+		"2024-02  0      0.0 h",
+		"Blue Hole  2      1.5 h  18.0 m   2024-03-02",
+		"(1 more)",
+		"EAN32     2      1.8 h",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stats summary lacks %q:\n%s", want, out)
+		}
+	}
+
+	var sum struct {
+		Dives   int
+		Deepest struct{ Number int }
+	}
+	out = runCmd(t, dir, "stats", "summary", "-format", "json", "-from", "2024-01-01", "-site", "blue")
+	if err := json.Unmarshal([]byte(out), &sum); err != nil || sum.Dives != 1 || sum.Deepest.Number != 4 {
+		t.Errorf("stats summary -format json (%v):\n%s", err, out)
+	}
+	// Without a report, flags and queries go to the summary.
+	out = runCmd(t, dir, "stats", "-format", "json", "-from", "2024-01-01", "site:blue")
+	if err := json.Unmarshal([]byte(out), &sum); err != nil || sum.Dives != 1 || sum.Deepest.Number != 4 {
+		t.Errorf("stats -format json (%v):\n%s", err, out)
+	}
+	var errOut bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: &errOut}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "stats", "-h"}); err != nil ||
+		!strings.Contains(errOut.String(), "Usage: divelog stats [report] [arguments]") {
+		t.Errorf("stats -h (%v):\n%s", err, errOut.String())
+	}
+	out = runCmd(t, dir, "stats", "summary", "-format", "json", "-tag:night", "-site:canyon")
+	if err := json.Unmarshal([]byte(out), &sum); err != nil || sum.Dives != 2 || sum.Deepest.Number != 1 {
+		t.Errorf("stats summary with negated terms (%v):\n%s", err, out)
+	}
+	if out := runCmd(t, dir, "stats", "summary", "depth>40"); out != "No dives.\n" {
+		t.Errorf("stats summary of no dives: %q", out)
+	}
+
+	path := filepath.Join(dir, "stats.svg")
+	runCmd(t, dir, "stats", "summary", "-format", "svg", "-o", path, "tag:night OR buddy:ana")
+	svg, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(svg), ">3 dives  2.4 h underwater  2023-12-30 to 2024-03-02</text>") {
+		t.Errorf("SVG (%v):\n%.600s", err, svg)
+	}
+}
+
+func TestPlot(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "import", "ssrf", "../../subsurface/testdata/belize.ssrf")
+	base := filepath.Join(dir, "profile")
+	out := runCmd(t, dir, "plot", "2", "-o", base, "-ceiling", "-width", "400", "-height", "250")
+	if out != "wrote "+base+".svg\nwrote "+base+".png\n" {
+		t.Errorf("plot: %q", out)
+	}
+	svg, err := os.ReadFile(base + ".svg")
+	if err != nil || !strings.Contains(string(svg), `<svg xmlns="http://www.w3.org/2000/svg" width="400" height="250"`) {
+		t.Errorf("SVG (%v):\n%.300s", err, svg)
+	}
+	f, err := os.Open(base + ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if cfg, err := png.DecodeConfig(f); err != nil || cfg.Width != 400 || cfg.Height != 250 {
+		t.Errorf("PNG is %dx%d (%v)", cfg.Width, cfg.Height, err)
+	}
+
+	out = runCmd(t, dir, "plot", "3", "-o", filepath.Join(dir, "only.png"))
+	if _, err := os.Stat(filepath.Join(dir, "only.svg")); err == nil || !strings.HasSuffix(out, "only.png\n") {
+		t.Errorf("plot -o only.png: %q", out)
+	}
+
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	err = run(e, []string{"-log", filepath.Join(dir, "log.json"), "plot", "1", "-o", filepath.Join(dir, "none")})
+	if err == nil || !strings.Contains(err.Error(), "no profile") {
+		t.Errorf("plot of a dive without samples: %v", err)
+	}
+}
+
+func TestServeNeedsPassword(t *testing.T) {
+	t.Setenv("DIVELOG_PASSWORD", "")
+	dir := t.TempDir()
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "serve", "-user", "ana"})
+	if err == nil || !strings.Contains(err.Error(), "DIVELOG_PASSWORD") {
+		t.Errorf("serve -user without a password: %v", err)
+	}
+}
+
+func TestSites(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-05-01 09:30", "-duration", "45m", "-depth", "28", "-site", "Blue Hole",
+		"-lat", "17.3157", "-lon", "-87.5346")
+	runCmd(t, dir, "add", "-date", "2024-05-02 09:30", "-duration", "45m", "-depth", "30", "-site", "Blu Hole",
+		"-lat", "17.3160", "-lon", "-87.5350")
+	runCmd(t, dir, "add", "-date", "2024-05-03 09:30", "-duration", "45m", "-depth", "12", "-site", "blue hole")
+	runCmd(t, dir, "sites", "add", "-name", "Half Moon Caye Wall", "-lat", "17.2050", "-lon", "-87.5460",
+		"-country", "Belize", "-entry", "boat")
+
+	list := runCmd(t, dir, "sites", "list")
+	for _, want := range []string{"Blue Hole", "Blu Hole", "Half Moon Caye Wall", "Belize"} {
+		if !strings.Contains(list, want) {
+			t.Errorf("sites list lacks %q:\n%s", want, list)
+		}
+	}
+	near := runCmd(t, dir, "sites", "near", "17.3157,-87.5346", "-radius", "1km")
+	if !strings.Contains(near, "Blue Hole") || !strings.Contains(near, "Blu Hole") || strings.Contains(near, "Half Moon") {
+		t.Errorf("sites near -radius 1km:\n%s", near)
+	}
+	if near := runCmd(t, dir, "sites", "near", "-radius", "20km", "17.3157,-87.5346"); !strings.Contains(near, "Half Moon") {
+		t.Errorf("sites near -radius 20km:\n%s", near)
+	}
+
+	dupes := runCmd(t, dir, "sites", "dupes")
+	if !strings.Contains(dupes, "Blue Hole") || !strings.Contains(dupes, "Blu Hole") {
+		t.Errorf("sites dupes:\n%s", dupes)
+	}
+	if out := runCmd(t, dir, "sites", "merge", "1", "2"); !strings.Contains(out, "updating 1 dive") {
+		t.Errorf("sites merge: %s", out)
+	}
+	if out := runCmd(t, dir, "sites", "edit", "1", "-region", "Lighthouse Reef"); !strings.Contains(out, "3 dives") {
+		t.Errorf("sites edit: %s", out)
+	}
+	show := runCmd(t, dir, "show", "2")
+	if !strings.Contains(show, "Blue Hole") {
+		t.Errorf("dive #2 not moved to the merged site:\n%s", show)
+	}
+	if dupes := runCmd(t, dir, "sites", "dupes"); !strings.Contains(dupes, "No likely duplicates") {
+		t.Errorf("sites dupes after merge:\n%s", dupes)
+	}
+	runCmd(t, dir, "sites", "edit", "3", "-lon", "-87.55")
+	if list := runCmd(t, dir, "sites", "list"); !strings.Contains(list, "17.20500,-87.55000") {
+		t.Errorf("sites list after -lon:\n%s", list)
+	}
+
+	for _, args := range [][]string{
+		{"sites", "near", "north"},
+		{"sites", "near", "17,-87", "-radius", "far"},
+		{"sites", "merge", "1", "9"},
+		{"sites", "edit", "1", "-entry", "jetty"},
+		{"sites", "add", "-name", "Aquarium", "-lat", "17.2"},
+		{"sites", "sync", "1"},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		if err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...)); err == nil {
+			t.Errorf("divelog %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestSitesSync(t *testing.T) {
+	// A log written before the site registry.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.json")
+	d := &divelog.Dive{Number: 1, Start: time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local), MaxDepth: 20,
+		Site: &divelog.Site{Name: "Blue Hole", Coords: &divelog.Coordinates{Lat: 17.3157, Lon: -87.5346}}}
+	data, err := json.Marshal(map[string]any{"next_number": 2, "dives": []*divelog.Dive{d}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list := runCmd(t, dir, "sites", "list")
+	if !strings.Contains(list, "No sites.") || !strings.Contains(list, "1 dive not in the registry") {
+		t.Errorf("sites list before sync:\n%s", list)
+	}
+	runCmd(t, dir, "sites", "near", "17.3157,-87.5346")
+	if after, err := os.ReadFile(path); err != nil || !bytes.Equal(after, data) {
+		t.Errorf("listing sites changed the log: %v", err)
+	}
+
+	if out := runCmd(t, dir, "sites", "sync"); !strings.Contains(out, "linked 1 dive") {
+		t.Errorf("sites sync: %s", out)
+	}
+	if out := runCmd(t, dir, "sites", "sync"); !strings.Contains(out, "linked 0 dives") {
+		t.Errorf("second sites sync: %s", out)
+	}
+	list = runCmd(t, dir, "sites", "list")
+	if !strings.Contains(list, "Blue Hole") || strings.Contains(list, "not in the registry") {
+		t.Errorf("sites list after sync:\n%s", list)
+	}
+}
+
+func TestParseDistance(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"500m", 500},
+		{"5km", 5000},
+		{"2.5 km", 2500},
+		{"3", 3000},
+		{"1mi", 1609.344},
+		{"1000ft", 304.8},
+	}
+	for _, tt := range tests {
+		if got, err := parseDistance(tt.in); err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseDistance(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "km", "5 leagues", "-1km"} {
+		if _, err := parseDistance(in); err == nil {
+			t.Errorf("parseDistance(%q) succeeded", in)
+		}
+	}
+}
+
+func TestGearStatus(t *testing.T) {
+	dir := t.TempDir()
+	if out := runCmd(t, dir, "status"); !strings.Contains(out, "Dives:") || strings.Contains(out, "Gear") {
+		t.Errorf("status of an empty log:\n%s", out)
+	}
+	recent := time.Now().AddDate(0, -1, 0).Format("2006-01-02")
+	old := time.Now().AddDate(-5, 0, 10).Format("2006-01-02")
+	runCmd(t, dir, "add", "-date", recent+" 09:00", "-duration", "45m", "-depth", "20", "-site", "Reef")
+	runCmd(t, dir, "add", "-date", recent+" 12:00", "-duration", "30m", "-depth", "12", "-site", "Reef")
+	runCmd(t, dir, "gear", "add", "-kind", "regulator", "-name", "Mk25", "-serial", "R1", "-last-service", old,
+		"-service-months", "12")
+	runCmd(t, dir, "gear", "add", "-kind", "cylinder", "-name", "AL80 #3", "-rental", "-last-hydro", old,
+		"-last-visual", recent)
+	runCmd(t, dir, "gear", "add", "-kind", "bcd", "-name", "Wing", "-last-service", recent, "-service-dives", "50")
+	if out := runCmd(t, dir, "gear", "use", "1", "1", "2"); !strings.Contains(out, "2 more dives") {
+		t.Errorf("gear use: %s", out)
+	}
+	runCmd(t, dir, "gear", "use", "2", "2")
+
+	list := runCmd(t, dir, "gear", "list")
+	for _, want := range []string{"Mk25", "AL80 #3 (rental)", "1.2", "service overdue since", "hydrostatic test due"} {
+		if !strings.Contains(list, want) {
+			t.Errorf("gear list lacks %q:\n%s", want, list)
+		}
+	}
+	status := runCmd(t, dir, "status")
+	for _, want := range []string{"Dives:", "2, 1.2 h", "Reef", "regulator Mk25: service overdue", "cylinder AL80 #3: hydrostatic test due"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("status lacks %q:\n%s", want, status)
+		}
+	}
+	if strings.Contains(status, "Wing") {
+		t.Errorf("status warns of gear not due:\n%s", status)
+	}
+
+	runCmd(t, dir, "gear", "service", "1")
+	runCmd(t, dir, "gear", "service", "2", "-hydro")
+	if status := runCmd(t, dir, "status"); !strings.Contains(status, "Gear:") || !strings.Contains(status, "nothing due") {
+		t.Errorf("status after servicing:\n%s", status)
+	}
+
+	// Renaming an item keeps its dives.
+	if out := runCmd(t, dir, "gear", "edit", "1", "-name", "Mk25 EVO"); !strings.Contains(out, "2 dives") {
+		t.Errorf("gear edit: %s", out)
+	}
+	show := runCmd(t, dir, "gear", "show", "1")
+	for _, want := range []string{"Mk25 EVO", "2 dives", "#1 #2", "Service every:"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("gear show lacks %q:\n%s", want, show)
+		}
+	}
+	if show := runCmd(t, dir, "show", "1"); !strings.Contains(show, "Mk25 EVO") {
+		t.Errorf("dive #1 does not list the renamed regulator:\n%s", show)
+	}
+
+	for _, args := range [][]string{
+		{"gear", "add", "-kind", "snorkel", "-name", "x"},
+		{"gear", "use", "9", "1"},
+		{"gear", "use", "1", "7"},
+		{"gear", "service", "1", "-hydro"},
+		{"gear", "edit", "1", "-purchased", "someday"},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		if err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...)); err == nil {
+			t.Errorf("divelog %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestCerts(t *testing.T) {
+	dir := t.TempDir()
+	if out := runCmd(t, dir, "certs", "list"); !strings.Contains(out, "No certifications") {
+		t.Errorf("certs list of an empty log: %s", out)
+	}
+	runCmd(t, dir, "certs", "add", "-agency", "SSI", "-level", "Open Water Diver", "-number", "OW-1", "-date", "2020-03-01",
+		"-instructor", "Ana", "-instructor-number", "4711", "-card", "cards/ow.jpg")
+	for i, dive := range []string{"deep", "navigation", "wreck", ""} {
+		runCmd(t, dir, "add", "-date", fmt.Sprintf("2021-05-1%d 09:00", i), "-duration", "40m", "-depth", "20",
+			"-training", "AOW:"+dive)
+	}
+	if show := runCmd(t, dir, "show", "1"); !strings.Contains(show, "Training:") || !strings.Contains(show, "AOW (deep)") {
+		t.Errorf("show lacks the training dive:\n%s", show)
+	}
+
+	check := runCmd(t, dir, "certs", "check", "aow")
+	for _, want := range []string{"Advanced Open Water Diver", "OW certification", "SSI Open Water Diver no. OW-1, 2020-03-01, instructor Ana (4711)",
+		"#1 #2 #3 #4", "Ready to begin AOW; training dives are outstanding."} {
+		if !strings.Contains(check, want) {
+			t.Errorf("certs check lacks %q:\n%s", want, check)
+		}
+	}
+	runCmd(t, dir, "add", "-date", "2021-05-15 09:00", "-duration", "40m", "-depth", "25", "-training", "AOW")
+	if check := runCmd(t, dir, "certs", "check", "AOW"); !strings.Contains(check, "All requirements for AOW are met.") {
+		t.Errorf("certs check after the fifth dive:\n%s", check)
+	}
+	if check := runCmd(t, dir, "certs", "check", "Rescue"); !strings.Contains(check, "Not ready to begin Rescue.") {
+		t.Errorf("certs check for Rescue without AOW:\n%s", check)
+	}
+	runCmd(t, dir, "certs", "add", "-agency", "PADI", "-level", "AOW", "-date", "2021-05-16")
+	if check := runCmd(t, dir, "certs", "check", "Rescue"); !strings.Contains(check, "PADI AOW, 2021-05-16") {
+		t.Errorf("certs check for Rescue with AOW:\n%s", check)
+	}
+
+	if out := runCmd(t, dir, "certs", "edit", "2", "-number", "A-2"); !strings.Contains(out, "updated certification 2") {
+		t.Errorf("certs edit: %s", out)
+	}
+	list := runCmd(t, dir, "certs", "list")
+	for _, want := range []string{"Open Water Diver", "A-2", "Ana (4711)"} {
+		if !strings.Contains(list, want) {
+			t.Errorf("certs list lacks %q:\n%s", want, list)
+		}
+	}
+	csv := runCmd(t, dir, "certs", "export")
+	if !strings.HasPrefix(csv, "id,agency,level,number,date,") || !strings.Contains(csv, "2,PADI,AOW,A-2,2021-05-16") {
+		t.Errorf("certs export:\n%s", csv)
+	}
+	var certs []divelog.Certification
+	if err := json.Unmarshal([]byte(runCmd(t, dir, "certs", "export", "-format", "json")), &certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || certs[0].CardImage != "cards/ow.jpg" {
+		t.Errorf("certs export -format json: %+v", certs)
+	}
+
+	path := filepath.Join(dir, "standards.yaml")
+	if err := os.WriteFile(path, []byte("- course: OW\n- course: Cave\n  requires: [OW]\n  min_dives: 100\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out := runCmd(t, dir, "certs", "standards", "-standards", path); !strings.Contains(out, "Cave") || strings.Contains(out, "AOW") {
+		t.Errorf("certs standards -standards:\n%s", out)
+	}
+	if check := runCmd(t, dir, "certs", "check", "cave", "-standards", path); !strings.Contains(check, "100 logged dives  no") {
+		t.Errorf("certs check cave:\n%s", check)
+	}
+	runCmd(t, dir, "certs", "delete", "1")
+
+	for _, args := range [][]string{
+		{"certs", "add", "-agency", "PADI", "-level", "OW"},
+		{"certs", "add", "-agency", "PADI", "-level", "OW", "-date", "someday"},
+		{"certs", "edit", "1", "-number", "x"},
+		{"certs", "delete", "1"},
+		{"certs", "check", "basket weaving"},
+		{"certs", "export", "-format", "xml"},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		if err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...)); err == nil {
+			t.Errorf("divelog %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "ana.pem")
+	out := runCmd(t, dir, "keygen", key)
+	_, fp, ok := strings.Cut(out, "key fingerprint: ")
+	if !ok {
+		t.Fatalf("keygen: %s", out)
+	}
+	fp = strings.TrimSpace(fp)
+	runCmd(t, dir, "add", "-date", "2024-05-01 09:30", "-duration", "45m", "-depth", "28", "-site", "Blue Hole")
+	runCmd(t, dir, "add", "-date", "2024-05-01 13:00", "-duration", "50m", "-depth", "14", "-site", "Reef")
+	runCmd(t, dir, "gear", "add", "-kind", "regulator", "-name", "Mk25")
+	runCmd(t, dir, "gear", "use", "1", "1", "2")
+	if out := runCmd(t, dir, "verify"); !strings.Contains(out, "No signed dives") {
+		t.Errorf("verify of an unsigned log: %s", out)
+	}
+	if out := runCmd(t, dir, "sign", "1", "-key", key, "-name", "Ana", "-role", "instructor"); !strings.Contains(out, fp) {
+		t.Errorf("sign: %s", out)
+	}
+	// Keeping the site registry in step leaves the signed dive alone.
+	runCmd(t, dir, "sites", "list")
+	if out := runCmd(t, dir, "verify", "1"); !strings.Contains(out, "Ana (instructor)") || !strings.Contains(out, "ok") {
+		t.Errorf("verify 1: %s", out)
+	}
+	if show := runCmd(t, dir, "show", "1"); !strings.Contains(show, "Signed:") || !strings.Contains(show, fp+": ok") {
+		t.Errorf("show of a signed dive:\n%s", show)
+	}
+
+	// Changes to many dives at once refuse to break a signature without
+	// -force.
+	for _, args := range [][]string{
+		{"sites", "edit", "1", "-region", "Lighthouse Reef"},
+		{"sites", "merge", "2", "1"},
+		{"gear", "edit", "1", "-name", "Mk25 EVO"},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...))
+		if err == nil || !strings.Contains(err.Error(), "invalidates the signatures on dive #1; use -force") {
+			t.Errorf("divelog %s: %v", strings.Join(args, " "), err)
+		}
+	}
+	runCmd(t, dir, "sites", "edit", "2", "-region", "Lighthouse Reef")
+	runCmd(t, dir, "gear", "edit", "1", "-notes", "serviced yearly")
+	if out := runCmd(t, dir, "verify", "1"); !strings.Contains(out, "ok") {
+		t.Errorf("verify 1 after changes that leave it alone: %s", out)
+	}
+	var errOut bytes.Buffer
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: &errOut}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "gear", "edit", "1", "-force", "-name", "Mk25 EVO"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(errOut.String(), "invalidates the signatures on dive #1; it must be signed again") {
+		t.Errorf("gear edit -force did not warn: %q", errOut.String())
+	}
+	runCmd(t, dir, "sign", "1", "-key", key, "-name", "Ana", "-role", "instructor")
+
+	var out2 bytes.Buffer
+	errOut.Reset()
+	e = &env{stdin: strings.NewReader(""), stdout: &out2, stderr: &errOut}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "edit", "1", "-notes", "Sharks"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(errOut.String(), "invalidates the signatures of Ana on dive #1") {
+		t.Errorf("edit of a signed dive did not warn: %q", errOut.String())
+	}
+	if show := runCmd(t, dir, "show", "1"); !strings.Contains(show, "INVALID: dive changed after signing") {
+		t.Errorf("show of an edited signed dive:\n%s", show)
+	}
+	out2.Reset()
+	e = &env{stdin: strings.NewReader(""), stdout: &out2, stderr: io.Discard}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "verify"}); err == nil ||
+		!strings.Contains(out2.String(), "INVALID") {
+		t.Errorf("verify after an edit: %v\n%s", err, out2.String())
+	}
+
+	runCmd(t, dir, "sign", "1", "-key", key, "-name", "Ana", "-role", "instructor")
+	if out := runCmd(t, dir, "verify"); strings.Count(out, "ok") != 1 || strings.Contains(out, "#2") {
+		t.Errorf("verify after signing again: %s", out)
+	}
+	for _, args := range [][]string{
+		{"verify", "2"},
+		{"sign", "1", "-key", filepath.Join(dir, "missing.pem"), "-name", "Ana"},
+		{"sign", "1", "-key", key},
+		{"sign", "9", "-key", key, "-name", "Ana"},
+		{"keygen", key},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		if err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...)); err == nil {
+			t.Errorf("divelog %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	dir := t.TempDir()
+	replay := filepath.Join("..", "..", "dc", "testdata", "ostc.txt")
+	rec := filepath.Join(dir, "rec.txt")
+	out := runCmd(t, dir, "download", "-replay", replay, "-record", rec)
+	if !strings.Contains(out, "OSTC, serial 12345, firmware 3.8: 3 new dives") || !strings.Contains(out, "imported 3 dives") {
+		t.Errorf("download:\n%s", out)
+	}
+	if list := runCmd(t, dir, "list"); strings.Count(list, "2024-05-0") != 3 {
+		t.Errorf("list after download:\n%s", list)
+	}
+	if show := runCmd(t, dir, "show", "2"); !strings.Contains(show, "30.5") || !strings.Contains(show, "OSTC") {
+		t.Errorf("show of a downloaded dive:\n%s", show)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "log.json"))
+	if err != nil || !strings.Contains(string(data), `"Heinrichs Weikamp OSTC 12345"`) {
+		t.Errorf("log has no fingerprint for the computer: %v", err)
+	}
+	// The recording of a replay replays the same download, which reads
+	// every dive again only with -all.
+	if out := runCmd(t, dir, "download", "-replay", rec, "-all"); !strings.Contains(out, "imported 0 dives, 3 already in the log") {
+		t.Errorf("second download:\n%s", out)
+	}
+	for _, args := range [][]string{
+		{"download"},
+		{"download", "-replay", replay, "-port", "/dev/ttyUSB0"},
+		{"download", "-replay", replay, "-driver", "nemo"},
+		{"download", "-replay", filepath.Join(dir, "missing.txt")},
+		{"download", "-port", filepath.Join(dir, "missing"), "-transport", "usb"},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		if err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...)); err == nil {
+			t.Errorf("divelog %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, dir, "add", "-date", "2024-05-01 13:04", "-duration", "45m", "-depth", "30", "-site", "Canyon", "-buddy", "Ana")
+	runCmd(t, dir, "add", "-date", "2024-05-01 15:00", "-duration", "40m", "-depth", "12", "-site", "Reef")
+	runCmd(t, dir, "download", "-replay", filepath.Join("..", "..", "dc", "testdata", "ostc.txt"))
+	if out := runCmd(t, dir, "dedupe", "-n"); !strings.Contains(out, "merged #4 into #1 (OSTC)") || !strings.Contains(out, "would merge 1 dive") {
+		t.Errorf("dedupe -n:\n%s", out)
+	}
+	// Merging deletes the downloaded record, and its signature with it.
+	key := filepath.Join(dir, "key.pem")
+	runCmd(t, dir, "keygen", key)
+	runCmd(t, dir, "sign", "4", "-key", key, "-name", "Ana", "-role", "instructor")
+	e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	if err := run(e, []string{"-log", filepath.Join(dir, "log.json"), "dedupe"}); err == nil ||
+		!strings.Contains(err.Error(), "invalidates the signatures on dive #4; use -force") {
+		t.Errorf("dedupe of a signed dive: %v", err)
+	}
+	if out := runCmd(t, dir, "dedupe", "-force"); !strings.Contains(out, "merged 1 dive") {
+		t.Errorf("dedupe -force:\n%s", out)
+	}
+	show := runCmd(t, dir, "show", "1")
+	for _, want := range []string{"Canyon", "Ana", "30.5", "OSTC"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("merged dive lacks %q:\n%s", want, show)
+		}
+	}
+	if list := runCmd(t, dir, "list"); strings.Contains(list, "#4") || strings.Count(list, "2024-05-0") != 4 {
+		t.Errorf("list after dedupe:\n%s", list)
+	}
+	if out := runCmd(t, dir, "dedupe"); !strings.Contains(out, "No overlapping dives") {
+		t.Errorf("second dedupe:\n%s", out)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	// A 30 m dive recorded by two computers. The Zoop's clock runs 45 s
+	// fast and it reads 0.2 m deeper; it samples more often.
+	depth := func(t time.Duration) float64 {
+		m := t.Minutes()
+		return math.Max(0, math.Min(math.Min(m*15, 30), math.Min(30-(m-10)*2, (40-m)*2)))
+	}
+	record := func(name string, start time.Time, rate time.Duration, bias float64) *divelog.Dive {
+		d := &divelog.Dive{Start: start, Equipment: []divelog.Equipment{{Kind: divelog.Computer, Name: name}}}
+		for at := rate; at <= 40*time.Minute; at += rate {
+			d.Samples = append(d.Samples, divelog.Sample{Time: at, Depth: divelog.Depth(depth(at) + bias)})
+		}
+		d.Summarize()
+		return d
+	}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	// Both computers put the dive in the same minute; each is imported,
+	// and dedupe merges them.
+	for _, d := range []*divelog.Dive{
+		record("OSTC", start, 10*time.Second, 0),
+		record("Zoop", start.Add(45*time.Second), 5*time.Second, 0.2),
+	} {
+		var buf bytes.Buffer
+		if err := uddf.Write(&buf, []*divelog.Dive{d}); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, d.Equipment[0].Name+".uddf")
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if out := runCmd(t, dir, "import", "uddf", path); out != "imported 1 dives\n" {
+			t.Fatalf("import of the %s record: %q", d.Equipment[0].Name, out)
+		}
+		// The same computer's record is already in the log.
+		if out := runCmd(t, dir, "import", "uddf", path); !strings.Contains(out, "1 already in the log") {
+			t.Errorf("second import of the %s record: %q", d.Equipment[0].Name, out)
+		}
+	}
+
+	if out := runCmd(t, dir, "dedupe"); !strings.Contains(out, "merged #2 into #1") {
+		t.Fatalf("dedupe:\n%s", out)
+	}
+	out := runCmd(t, dir, "profiles", "1")
+	for _, want := range []string{"Zoop (primary) 480", "OSTC 240 0s 1.000 -0.20 m 0.20 m 0.20 m"} {
+		if !strings.Contains(strings.Join(strings.Fields(out), " "), want) {
+			t.Errorf("profiles lacks %q:\n%s", want, out)
+		}
+	}
+	if show := runCmd(t, dir, "show", "1"); !strings.Contains(show, "480 from Zoop") || !strings.Contains(show, "240 samples from OSTC, offset 0s") ||
+		!strings.Contains(show, "30.2 m") {
+		t.Errorf("show of a dive with two profiles:\n%s", show)
+	}
+
+	runCmd(t, dir, "profiles", "1", "-primary", "ostc")
+	show := runCmd(t, dir, "show", "1")
+	if !strings.Contains(show, "240 from OSTC") || !strings.Contains(show, "Max depth:  30.0 m") {
+		t.Errorf("show after -primary ostc:\n%s", show)
+	}
+	if out := runCmd(t, dir, "profiles", "1", "-align"); !strings.Contains(out, "more samples") {
+		t.Errorf("profiles -align:\n%s", out)
+	}
+	for _, args := range [][]string{
+		{"profiles"},
+		{"profiles", "1", "-primary", "Perdix"},
+		{"profiles", "9"},
+	} {
+		e := &env{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+		if err := run(e, append([]string{"-log", filepath.Join(dir, "log.json")}, args...)); err == nil {
+			t.Errorf("divelog %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
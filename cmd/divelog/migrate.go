@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdMigrate = &command{
+	name:    "migrate",
+	args:    "<destination>",
+	summary: "copy the log into a new file, converting between backends",
+	run:     runMigrate,
+}
+
+func runMigrate(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	dstPath := pos[0]
+	src, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := openStoreAt(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if existing, err := dst.Query(store.Query{OmitSamples: true}); err != nil {
+		return err
+	} else if len(existing) > 0 {
+		return fmt.Errorf("%s already holds %d dives; migrate needs an empty destination", dstPath, len(existing))
+	}
+	n, err := store.Copy(dst, src)
+	if err != nil {
+		return err
+	}
+	if err := verifyCopy(dst, src); err != nil {
+		return fmt.Errorf("verifying %s: %w", dstPath, err)
+	}
+	fmt.Fprintf(e.stdout, "copied %d dives to %s (%s); use -log %s to switch to it\n",
+		n, dstPath, backendName(dstPath), dstPath)
+	return nil
+}
+
+// verifyCopy reads every dive back from dst and checks that it encodes to
+// the same JSON as the original in src.
+func verifyCopy(dst, src store.Store) error {
+	dives, err := src.List()
+	if err != nil {
+		return err
+	}
+	for _, want := range dives {
+		got, err := dst.Get(want.Number)
+		if err != nil {
+			return fmt.Errorf("dive #%d: %w", want.Number, err)
+		}
+		a, err := json.Marshal(want)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(got)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(a, b) {
+			return fmt.Errorf("dive #%d differs after copying", want.Number)
+		}
+	}
+	copied, err := dst.List()
+	if err != nil {
+		return err
+	}
+	if len(copied) != len(dives) {
+		return fmt.Errorf("copied %d dives, destination holds %d", len(dives), len(copied))
+	}
+	return nil
+}
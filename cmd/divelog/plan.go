@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/deco"
+	"github.com/betonavab/divelog/plan"
+)
+
+var cmdPlan = &command{
+	name:    "plan",
+	args:    "-depth n -time duration [-gas mix[@switch][:size/fill]]... [options]",
+	summary: "plan a dive: stops, runtime, gas and reserve",
+	run:     runPlan,
+}
+
+func runPlan(e *env, fs *flag.FlagSet, args []string) error {
+	u := e.units
+	// Defaults in round numbers of the unit system in use.
+	rates := struct{ descent, ascent, stop, sac float64 }{18, 9, 3, 20}
+	if u == divelog.Imperial {
+		rates.descent, rates.ascent, rates.stop, rates.sac = 60, 30, 10, 0.7
+	}
+	depth := fs.Float64("depth", 0, "bottom depth in "+u.DepthUnit())
+	bottom := fs.Duration("time", 0, "bottom time, from leaving the surface, e.g. 25m")
+	var gases stringList
+	fs.Var(&gases, "gas", "cylinder as `mix[@switch][:size/fill]`, bottom gas first (repeatable); "+
+		"the switch defaults to the deepest stop within 1.6 bar ppO2; "+sizeHelp(u))
+	descent := fs.Float64("descent", rates.descent, "descent rate in "+u.DepthUnit()+"/min")
+	ascent := fs.Float64("ascent", rates.ascent, "ascent rate in "+u.DepthUnit()+"/min")
+	gf := fs.String("gf", "30/85", "gradient factors `low/high` in percent")
+	lastStop := fs.Float64("last-stop", rates.stop, "depth of the last stop in "+u.DepthUnit())
+	sac := fs.Float64("sac", rates.sac, "surface consumption on the bottom in "+u.VolumeUnit()+"/min")
+	decoSAC := fs.Float64("deco-sac", 0, "surface consumption on stops in "+u.VolumeUnit()+"/min (default -sac)")
+	reserve := fs.String("reserve", string(plan.RockBottom), "reserve rule: rockbottom, thirds or none")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || *depth == 0 || *bottom == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	p := plan.Plan{
+		Depth:       u.Depth(*depth),
+		BottomTime:  *bottom,
+		DescentRate: u.Depth(*descent),
+		Deco: deco.Params{
+			AscentRate:   u.Depth(*ascent),
+			StopInterval: u.Depth(rates.stop),
+			LastStop:     u.Depth(*lastStop),
+		},
+		SAC:     u.Volume(*sac),
+		DecoSAC: u.Volume(*decoSAC),
+		Reserve: plan.Reserve(strings.ToLower(*reserve)),
+	}
+	if p.Deco.GFLow, p.Deco.GFHigh, err = parseGF(*gf); err != nil {
+		return err
+	}
+	if len(gases) == 0 {
+		gases = stringList{"air"}
+	}
+	for i, g := range gases {
+		c, err := parseCylinder(g, u)
+		if err != nil {
+			return err
+		}
+		if i > 0 && c.Switch == 0 {
+			c.Switch = plan.SwitchDepth(c.Gas, p.Deco.StopInterval)
+		}
+		p.Cylinders = append(p.Cylinders, c)
+	}
+	res, err := plan.Make(p)
+	if err != nil {
+		return err
+	}
+	printPlan(e, p, res)
+	return nil
+}
+
+func sizeHelp(u divelog.UnitSystem) string {
+	if u == divelog.Imperial {
+		return "size is the rated capacity in cuft at the fill pressure in psi, e.g. EAN50@70:40/3000"
+	}
+	return "size is the water capacity in l and fill in bar, e.g. EAN50@21:11/200"
+}
+
+// parseGF parses gradient factors written as "30/85".
+func parseGF(s string) (low, high float64, err error) {
+	l, h, ok := strings.Cut(s, "/")
+	if ok {
+		low, err = strconv.ParseFloat(strings.TrimSpace(l), 64)
+	}
+	if ok && err == nil {
+		high, err = strconv.ParseFloat(strings.TrimSpace(h), 64)
+	}
+	if !ok || err != nil || low <= 0 || high <= 0 {
+		return 0, 0, fmt.Errorf("invalid gradient factors %q, want low/high such as 30/85", s)
+	}
+	return low / 100, high / 100, nil
+}
+
+// parseCylinder parses a -gas value: a gas mix, optionally followed by
+// "@" and a switch depth and by ":" and the cylinder size and fill
+// pressure.
+func parseCylinder(s string, u divelog.UnitSystem) (plan.Cylinder, error) {
+	var c plan.Cylinder
+	bad := func() (plan.Cylinder, error) {
+		return c, fmt.Errorf("invalid -gas %q, want mix[@switch][:size/fill]", s)
+	}
+	spec, size, hasSize := strings.Cut(s, ":")
+	mix, sw, hasSwitch := strings.Cut(spec, "@")
+	var err error
+	if c.Gas, err = divelog.ParseGasMix(mix); err != nil {
+		return c, err
+	}
+	if hasSwitch {
+		d, err := strconv.ParseFloat(sw, 64)
+		if err != nil || d <= 0 {
+			return bad()
+		}
+		c.Switch = u.Depth(d)
+	}
+	if hasSize {
+		v, f, ok := strings.Cut(size, "/")
+		vol, err1 := strconv.ParseFloat(v, 64)
+		fill, err2 := strconv.ParseFloat(f, 64)
+		if !ok || err1 != nil || err2 != nil || vol <= 0 || fill <= 0 {
+			return bad()
+		}
+		c.Pressure = u.Pressure(fill)
+		if u == divelog.Imperial {
+			c.Volume = divelog.ImperialCylinder(divelog.CubicFeet(vol), c.Pressure)
+		} else {
+			c.Volume = divelog.Liters(vol)
+		}
+	}
+	return c, nil
+}
+
+func printPlan(e *env, p plan.Plan, res *plan.Result) {
+	u := e.units
+	bottom := p.Cylinders[0].Gas
+	fmt.Fprintf(e.stdout, "%s for %s on %s, GF %.0f/%.0f\n\n", u.FormatDepth(p.Depth),
+		formatDuration(p.BottomTime), bottom, p.Deco.GFLow*100, p.Deco.GFHigh*100)
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "DEPTH\tSTOP\tRUNTIME\tGAS\t")
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", u.FormatDepth(p.Depth), "-", formatDuration(res.Legs[1].Runtime), bottom)
+	for _, l := range res.Stops() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", u.FormatDepth(l.From), formatDuration(l.Duration),
+			formatDuration(l.Runtime), l.Gas)
+	}
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", u.FormatDepth(0), "-", formatDuration(res.Runtime), "")
+	tw.Flush()
+	fmt.Fprintf(e.stdout, "\nRuntime %s, time to surface %s\n\n", formatDuration(res.Runtime), formatDuration(res.TTS))
+
+	tw = tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CYLINDER\tGAS\tUSED\tRESERVE\tNEEDED\tAVAILABLE\t")
+	for i, g := range res.Gas {
+		c := p.Cylinders[i]
+		avail, status := "-", ""
+		if c.Volume != 0 {
+			avail = u.FormatVolume(c.Available())
+			status = "ok"
+			if !g.Enough {
+				status = "NOT ENOUGH GAS"
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, c.Gas, u.FormatVolume(g.Used),
+			u.FormatVolume(g.Reserve), u.FormatVolume(g.Used+g.Reserve), avail, status)
+	}
+	tw.Flush()
+	for _, w := range res.Warnings {
+		c := p.Cylinders[w.Cylinder]
+		if w.PPO2 < w.Limit {
+			fmt.Fprintf(e.stdout, "warning: %s is hypoxic at %s (ppO2 %.2f bar)\n", c.Gas, u.FormatDepth(w.Depth), w.PPO2)
+		} else {
+			fmt.Fprintf(e.stdout, "warning: %s at %s: ppO2 %.2f bar is above %.1f\n", c.Gas, u.FormatDepth(w.Depth), w.PPO2, w.Limit)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/render"
+)
+
+var cmdPlot = &command{
+	name:    "plot",
+	args:    "<number> [-o file]",
+	summary: "draw a dive's profile as SVG and PNG",
+	run:     runPlot,
+}
+
+func runPlot(e *env, fs *flag.FlagSet, args []string) error {
+	u := e.units
+	out := fs.String("o", "", "output `file`; .svg or .png writes only that format, any other name is a base for both (default dive-N)")
+	width := fs.Int("width", 900, "image width in pixels")
+	height := fs.Int("height", 500, "image height in pixels")
+	ceiling := fs.Bool("ceiling", false, "overlay the decompression ceiling")
+	gf := fs.String("gf", "30/85", "gradient factors `low/high` in percent for the ceiling")
+	noTemp := fs.Bool("no-temp", false, "leave out the temperature trace")
+	noPressure := fs.Bool("no-pressure", false, "leave out the tank pressure traces")
+	maxAscent := fs.Float64("max-ascent", u.DepthValue(10), "ascent rate in "+u.DepthUnit()+"/min above which the profile is drawn in red")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || *width <= 0 || *height <= 0 || *maxAscent <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	n, err := parseNumber(pos[0])
+	if err != nil {
+		return err
+	}
+	o := render.Options{
+		Width:         *width,
+		Height:        *height,
+		Units:         u,
+		Ceiling:       *ceiling,
+		NoPressure:    *noPressure,
+		NoTemperature: *noTemp,
+		MaxAscentRate: u.Depth(*maxAscent),
+	}
+	if o.Deco.GFLow, o.Deco.GFHigh, err = parseGF(*gf); err != nil {
+		return err
+	}
+
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := getDive(s, n)
+	if err != nil {
+		return err
+	}
+	if len(d.Samples) == 0 {
+		return fmt.Errorf("dive #%d has no profile to plot", d.Number)
+	}
+
+	type output struct {
+		path string
+		draw func(io.Writer, *divelog.Dive, render.Options) error
+	}
+	var outputs []output
+	switch base := *out; strings.ToLower(filepath.Ext(base)) {
+	case ".svg":
+		outputs = []output{{base, render.SVG}}
+	case ".png":
+		outputs = []output{{base, render.PNG}}
+	default:
+		if base == "" {
+			base = fmt.Sprintf("dive-%d", d.Number)
+		}
+		outputs = []output{{base + ".svg", render.SVG}, {base + ".png", render.PNG}}
+	}
+	for _, f := range outputs {
+		if err := writePlot(f.path, func(w io.Writer) error { return f.draw(w, d, o) }); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "wrote %s\n", f.path)
+	}
+	return nil
+}
+
+// writePlot creates path and writes to it with draw, removing the file
+// again if drawing fails.
+func writePlot(path string, draw func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := draw(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/align"
+)
+
+var cmdProfiles = &command{
+	name:    "profiles",
+	args:    "<number> [-align] [-primary computer]",
+	summary: "compare the profiles of a dive's computers",
+	run:     runProfiles,
+}
+
+func runProfiles(e *env, fs *flag.FlagSet, args []string) error {
+	realign := fs.Bool("align", false, "line the profiles up again by their depth curves")
+	primary := fs.String("primary", "", "make the `computer`'s profile, by name or serial, the one used for the dive's figures")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	n, err := parseNumber(pos[0])
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := getDive(s, n)
+	if err != nil {
+		return err
+	}
+	signed := validSigners(d)
+	changed := false
+	if *primary != "" {
+		i, err := findProfile(d, *primary)
+		if err != nil {
+			return err
+		}
+		if i >= 0 {
+			d.SetPrimary(i)
+			changed = true
+		}
+	}
+	var divs []align.Divergence
+	if *realign {
+		offsets := make([]time.Duration, len(d.Profiles))
+		for i, p := range d.Profiles {
+			offsets[i] = p.Offset
+		}
+		divs = align.Align(d)
+		for i, p := range d.Profiles {
+			changed = changed || p.Offset != offsets[i]
+		}
+	} else {
+		divs = align.Stats(d)
+	}
+	if changed {
+		warnInvalidated(e, d, signed)
+		if err := s.Put(d); err != nil {
+			return err
+		}
+	}
+
+	if len(d.Profiles) == 0 {
+		fmt.Fprintf(e.stdout, "Dive #%d has the profile of one computer only.\n", d.Number)
+		return nil
+	}
+	u := e.units
+	diff := func(v float64, unit string) string { return fmt.Sprintf("%+.2f %s", v, unit) }
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPUTER\tSAMPLES\tOFFSET\tCORRELATION\tMEAN DIFF\tRMS DIFF\tMAX DIFF\tTEMP DIFF\t")
+	fmt.Fprintf(tw, "%s (primary)\t%d\t-\t-\t-\t-\t-\t-\t\n", describeComputer(d.Primary().Computer), len(d.Samples))
+	for i, p := range d.Profiles {
+		div := divs[i]
+		if div.Overlap == 0 {
+			fmt.Fprintf(tw, "%s\t%d\t%s\tno overlap\t-\t-\t-\t-\t\n", describeComputer(p.Computer), len(p.Samples), formatOffset(p.Offset))
+			continue
+		}
+		temp := "-"
+		if div.Temperature != 0 {
+			// A difference converts without the scale's zero.
+			temp = diff(u.TemperatureValue(divelog.Celsius(div.Temperature))-u.TemperatureValue(divelog.Celsius(0)), u.TemperatureUnit())
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.3f\t%s\t%.2f %s\t%.2f %s\t%s\t\n", describeComputer(p.Computer), len(p.Samples),
+			formatOffset(p.Offset), div.Correlation, diff(u.DepthValue(div.MeanDepth), u.DepthUnit()),
+			u.DepthValue(div.RMSDepth), u.DepthUnit(), u.DepthValue(div.MaxDepth), u.DepthUnit(), temp)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if best := align.Best(d); best >= 0 {
+		fmt.Fprintf(e.stdout, "The %s profile has more samples; -primary makes it the primary one.\n", describeComputer(d.Profiles[best].Computer))
+	}
+	return nil
+}
+
+// findProfile returns the index in d.Profiles of the profile of the
+// computer named name, by its name, serial number or both, or -1 if that
+// is the primary profile.
+func findProfile(d *divelog.Dive, name string) (int, error) {
+	match := func(c divelog.Equipment) bool {
+		return c != (divelog.Equipment{}) && (strings.EqualFold(c.Name, name) || strings.EqualFold(c.Serial, name) ||
+			strings.EqualFold(describeComputer(c), name))
+	}
+	if match(d.Primary().Computer) {
+		return -1, nil
+	}
+	for i, p := range d.Profiles {
+		if match(p.Computer) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("dive #%d has no profile from %q", d.Number, name)
+}
+
+func describeComputer(c divelog.Equipment) string {
+	switch {
+	case c.Name == "":
+		return "unknown computer"
+	case c.Serial == "":
+		return c.Name
+	}
+	return c.Name + " " + c.Serial
+}
+
+// formatOffset formats a profile's clock offset, such as "+37s".
+func formatOffset(d time.Duration) string {
+	if d > 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
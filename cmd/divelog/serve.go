@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/betonavab/divelog/web"
+)
+
+var cmdServe = &command{
+	name:    "serve",
+	args:    "[-addr host:port] [-user name]",
+	summary: "browse and edit the log in a web browser or over a JSON API",
+	run:     runServe,
+}
+
+func runServe(e *env, fs *flag.FlagSet, args []string) error {
+	addr := fs.String("addr", "localhost:8080", "`address` to listen on")
+	user := fs.String("user", "", "require basic authentication as `name`, with the password in $DIVELOG_PASSWORD")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	password := os.Getenv("DIVELOG_PASSWORD")
+	if *user != "" && password == "" {
+		return errors.New("-user needs a password in DIVELOG_PASSWORD")
+	}
+
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           web.New(s, web.Options{Units: e.units, Username: *user, Password: password}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if tcp, ok := ln.Addr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() && *user == "" {
+		fmt.Fprintln(e.stderr, "divelog: warning: the log can be changed by anyone who can reach", ln.Addr())
+	}
+	fmt.Fprintf(e.stdout, "serving %s at http://%s/, API at http://%[2]s/api/v1/\n", e.logPath, ln.Addr())
+
+	// Stop cleanly on an interrupt so that the log is closed and its lock
+	// released.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/deco"
+	"github.com/betonavab/divelog/gas"
+	"github.com/betonavab/divelog/oxtox"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdShow = &command{
+	name:    "show",
+	args:    "<number>",
+	summary: "print the details of a dive",
+	run:     runShow,
+}
+
+func runShow(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	n, err := parseNumber(pos[0])
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := getDive(s, n)
+	if err != nil {
+		return err
+	}
+	// Oxygen and nitrogen loading carry over from the dives of the same
+	// trip and dive day before this one.
+	earlier, err := store.Before(s, d.Start, max(oxtox.TripBreak, deco.DayBreak))
+	if err != nil {
+		return err
+	}
+	ox, _ := oxtox.Find(oxtox.Track(earlier), d.Number)
+	days := deco.Days(earlier)
+	chain, err := deco.Starts(days[len(days)-1], deco.Params{})
+	if err != nil {
+		return err
+	}
+	var rep *deco.Repetitive
+	for i := range chain {
+		if chain[i].Dive.Number == d.Number {
+			rep = &chain[i]
+		}
+	}
+	printDive(e, d, ox, rep)
+	return nil
+}
+
+func printDive(e *env, d *divelog.Dive, ox oxtox.Status, rep *deco.Repetitive) {
+	u := e.units
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	row := func(label, format string, args ...any) {
+		fmt.Fprintf(tw, "%s:\t"+format+"\n", append([]any{label}, args...)...)
+	}
+	fmt.Fprintf(tw, "Dive #%d\n", d.Number)
+	row("Date", "%s", d.Start.Format("Mon 2006-01-02 15:04"))
+	row("Duration", "%s", formatDuration(d.Duration))
+	row("Max depth", "%s", u.FormatDepth(d.MaxDepth))
+	if d.AvgDepth != 0 {
+		row("Avg depth", "%s", u.FormatDepth(d.AvgDepth))
+	}
+	if d.MinTemperature != 0 {
+		row("Water temp", "%s", u.FormatTemperature(d.MinTemperature))
+	}
+	if d.Site != nil {
+		site := d.Site.Name
+		if c := d.Site.Coords; c != nil {
+			site += fmt.Sprintf(" (%.5f, %.5f)", c.Lat, c.Lon)
+		}
+		row("Site", "%s", site)
+	}
+	if len(d.Buddies) > 0 {
+		var names []string
+		for _, b := range d.Buddies {
+			if b.Role != "" && b.Role != divelog.RoleBuddy {
+				names = append(names, fmt.Sprintf("%s (%s)", b.Name, b.Role))
+			} else {
+				names = append(names, b.Name)
+			}
+		}
+		row("Buddies", "%s", strings.Join(names, ", "))
+	}
+	for i, t := range d.Tanks {
+		desc := t.Gas.String()
+		switch {
+		case u == divelog.Imperial && t.RatedCapacity() != 0:
+			desc = u.FormatVolume(t.RatedCapacity()) + " " + desc
+		case t.Volume != 0:
+			desc = u.FormatVolume(t.Volume) + " " + desc
+		}
+		if t.StartPressure != 0 || t.EndPressure != 0 {
+			desc += fmt.Sprintf(", %s → %s", u.FormatPressure(t.StartPressure), u.FormatPressure(t.EndPressure))
+		}
+		row(fmt.Sprintf("Tank %d", i+1), "%s", desc)
+		if f := t.Fill; f != nil {
+			row("Fill", "%s", formatFill(f, u))
+		}
+	}
+	if c, err := gas.DiveConsumption(d); err == nil {
+		row("SAC", "%.1f %s/min, RMV %s/min", u.PressureValue(c.SAC), u.PressureUnit(), u.FormatVolume(c.RMV))
+	}
+	if rep != nil && d.MaxDepth > 0 {
+		printRepetitive(row, rep, u)
+	}
+	if ox.MaxPPO2 > 0 {
+		printOxygen(row, ox)
+	}
+	for _, eq := range d.Equipment {
+		row("Equipment", "%s %s", eq.Kind, eq.Name)
+	}
+	if t := d.Training; t != nil {
+		if t.Dive != "" {
+			row("Training", "%s (%s)", t.Course, t.Dive)
+		} else {
+			row("Training", "%s", t.Course)
+		}
+	}
+	if len(d.Tags) > 0 {
+		row("Tags", "%s", strings.Join(d.Tags, ", "))
+	}
+	if d.Rating > 0 {
+		row("Rating", "%s", strings.Repeat("*", d.Rating))
+	}
+	if len(d.Samples) > 0 {
+		if len(d.Profiles) > 0 {
+			row("Samples", "%d from %s", len(d.Samples), describeComputer(d.Primary().Computer))
+		} else {
+			row("Samples", "%d", len(d.Samples))
+		}
+	}
+	for _, p := range d.Profiles {
+		row("Profile", "%d samples from %s, offset %s", len(p.Samples), describeComputer(p.Computer), formatOffset(p.Offset))
+	}
+	for i := range d.Signatures {
+		sig := &d.Signatures[i]
+		status := "ok"
+		if err := sign.Verify(d, sig); err != nil {
+			status = describeBadSignature(err)
+		}
+		row("Signed", "%s on %s, key %s: %s", describeSigner(sig), sig.Signed.Local().Format("2006-01-02"),
+			sign.Fingerprint(sig.PublicKey), status)
+	}
+	tw.Flush()
+	if d.Notes != "" {
+		fmt.Fprintf(e.stdout, "\n%s\n", d.Notes)
+	}
+}
+
+// printRepetitive adds the residual nitrogen a dive started with and its
+// no-decompression limit to show's output.
+func printRepetitive(row func(label, format string, args ...any), r *deco.Repetitive, u divelog.UnitSystem) {
+	ndl := func(t time.Duration) string {
+		if t >= deco.MaxNDL {
+			return "unlimited"
+		}
+		return formatDuration(t)
+	}
+	if r.Interval > 0 {
+		row("Interval", "%s", formatDuration(r.Interval))
+		c, l := r.Leading()
+		row("Residual", "compartment %d at %.0f%% of its surface M-value", c+1, l*100)
+		row("Start NDL", "%s at %s (%s on a first dive)", ndl(r.NDL), u.FormatDepth(r.Dive.MaxDepth), ndl(r.CleanNDL))
+		return
+	}
+	row("Start NDL", "%s at %s", ndl(r.NDL), u.FormatDepth(r.Dive.MaxDepth))
+}
+
+// printOxygen adds the oxygen toxicity rows to show's output, flagging
+// the limits exceeded.
+func printOxygen(row func(label, format string, args ...any), ox oxtox.Status) {
+	ppO2 := fmt.Sprintf("%.2f bar", ox.MaxPPO2)
+	if ox.PPO2Exceeded() {
+		ppO2 += fmt.Sprintf("  ABOVE %.1f BAR", oxtox.MaxPPO2)
+	}
+	row("Max ppO2", "%s", ppO2)
+
+	cns := fmt.Sprintf("%.0f%%", ox.EndCNS)
+	if ox.StartCNS >= 0.5 {
+		cns += fmt.Sprintf(" (%.0f%% carried over)", ox.StartCNS)
+	}
+	switch {
+	case ox.CNSExceeded():
+		cns += fmt.Sprintf("  ABOVE %.0f%%", oxtox.CNSLimit)
+	case ox.EndCNS >= oxtox.CNSWarning:
+		cns += fmt.Sprintf("  above %.0f%%", oxtox.CNSWarning)
+	}
+	row("CNS", "%s", cns)
+
+	otu := fmt.Sprintf("%.0f (%.0f on the trip, day %d, limit %.0f)", ox.OTU, ox.TripOTU, ox.TripDay, ox.TripLimit())
+	if ox.OTUExceeded() {
+		otu += "  ABOVE LIMIT"
+	}
+	row("OTU", "%s", otu)
+}
+
+// formatDuration formats a dive time as minutes, or minutes and seconds
+// when it is not a whole number of minutes.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%d min", d/time.Minute)
+	}
+	return fmt.Sprintf("%d:%02d min", d/time.Minute, d%time.Minute/time.Second)
+}
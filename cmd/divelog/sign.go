@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdKeygen = &command{
+	name:    "keygen",
+	args:    "<file>",
+	summary: "create an ed25519 key for signing dives",
+	run:     runKeygen,
+}
+
+var cmdSign = &command{
+	name:    "sign",
+	args:    "<number> -key file -name name [-role role]",
+	summary: "sign a dive as its buddy or instructor",
+	run:     runSign,
+}
+
+var cmdVerify = &command{
+	name:    "verify",
+	args:    "[number...]",
+	summary: "check the signatures of dives",
+	run:     runVerify,
+}
+
+func runKeygen(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	key, err := sign.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := sign.WriteKey(pos[0], key); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "wrote private key to %s\n", pos[0])
+	fmt.Fprintf(e.stdout, "key fingerprint: %s\n", sign.Fingerprint(key.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+func runSign(e *env, fs *flag.FlagSet, args []string) error {
+	keyPath := fs.String("key", "", "private key `file`, as written by divelog keygen")
+	name := fs.String("name", "", "signer's `name`")
+	role := fs.String("role", "buddy", "signer's `role` on the dive, e.g. buddy or instructor")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || *keyPath == "" || *name == "" {
+		fs.Usage()
+		return errUsage
+	}
+	n, err := parseNumber(pos[0])
+	if err != nil {
+		return err
+	}
+	key, err := sign.ReadKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := getDive(s, n)
+	if err != nil {
+		return err
+	}
+	// Link the site first, so that keeping the registry in step later
+	// does not change the signed dive.
+	if reg, ok := s.(store.SiteRegistry); ok {
+		if err := sites.Link(reg, d); err != nil {
+			return err
+		}
+	}
+	sig, err := sign.Sign(d, key, *name, *role, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := s.Put(d); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "dive #%d signed by %s, key %s\n", d.Number, describeSigner(sig), sign.Fingerprint(sig.PublicKey))
+	return nil
+}
+
+func runVerify(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	var numbers []int
+	for _, p := range pos {
+		n, err := parseNumber(p)
+		if err != nil {
+			return err
+		}
+		numbers = append(numbers, n)
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if len(numbers) == 0 {
+		dives, err := s.Query(store.Query{OmitSamples: true})
+		if err != nil {
+			return err
+		}
+		for _, d := range dives {
+			if len(d.Signatures) > 0 {
+				numbers = append(numbers, d.Number)
+			}
+		}
+		if len(numbers) == 0 {
+			fmt.Fprintln(e.stdout, "No signed dives.")
+			return nil
+		}
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIVE\tSIGNER\tSIGNED\tKEY\tSTATUS\t")
+	bad := 0
+	for _, n := range numbers {
+		// Signatures cover the profile, so read each dive in full.
+		d, err := getDive(s, n)
+		if err != nil {
+			return err
+		}
+		if len(d.Signatures) == 0 {
+			fmt.Fprintf(tw, "#%d\t-\t-\t-\tnot signed\t\n", d.Number)
+			bad++
+			continue
+		}
+		for i := range d.Signatures {
+			sig := &d.Signatures[i]
+			status := "ok"
+			if err := sign.Verify(d, sig); err != nil {
+				status = describeBadSignature(err)
+				bad++
+			}
+			fmt.Fprintf(tw, "#%d\t%s\t%s\t%s\t%s\t\n", d.Number, describeSigner(sig),
+				sig.Signed.Local().Format("2006-01-02 15:04"), sign.Fingerprint(sig.PublicKey), status)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if bad > 0 {
+		return fmt.Errorf("%s failed to verify", plural(bad, "signature"))
+	}
+	return nil
+}
+
+func describeSigner(sig *divelog.Signature) string {
+	if sig.Role == "" {
+		return sig.Signer
+	}
+	return sig.Signer + " (" + sig.Role + ")"
+}
+
+func describeBadSignature(err error) string {
+	if errors.Is(err, sign.ErrInvalid) {
+		return "INVALID: dive changed after signing"
+	}
+	return "INVALID: " + err.Error()
+}
+
+// validSigners returns the signers whose signatures of d verify.
+func validSigners(d *divelog.Dive) []string {
+	var names []string
+	for i := range d.Signatures {
+		if sign.Verify(d, &d.Signatures[i]) == nil {
+			names = append(names, d.Signatures[i].Signer)
+		}
+	}
+	return names
+}
+
+// warnInvalidated tells the user when a change to a dive broke signatures
+// that were good before it. signed are the signers validSigners returned
+// before the change.
+func warnInvalidated(e *env, d *divelog.Dive, signed []string) {
+	if len(signed) > len(validSigners(d)) {
+		fmt.Fprintf(e.stderr, "warning: the change invalidates the signatures of %s on dive #%d; it must be signed again\n",
+			strings.Join(signed, ", "), d.Number)
+	}
+}
+
+// checkSigned guards a change that rewrites many dives at once, such as a
+// site or item edit, against silently breaking signatures: rewrites
+// reports whether the change alters a dive. Dives it alters whose
+// signatures still verify are refused unless force is set; with it, the
+// user is told to sign them again.
+func checkSigned(e *env, s store.Store, force bool, rewrites func(d *divelog.Dive) bool) error {
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	var signed []string
+	for _, d := range dives {
+		if len(d.Signatures) == 0 || !rewrites(d) {
+			continue
+		}
+		// Signatures cover the profile, so verify the dive in full.
+		full, err := s.Get(d.Number)
+		if err != nil {
+			return err
+		}
+		if len(validSigners(full)) > 0 {
+			signed = append(signed, fmt.Sprintf("#%d", d.Number))
+		}
+	}
+	if len(signed) == 0 {
+		return nil
+	}
+	which, pronoun := "dive "+signed[0], "it"
+	if len(signed) > 1 {
+		which, pronoun = "dives "+strings.Join(signed, ", "), "they"
+	}
+	if !force {
+		return fmt.Errorf("the change invalidates the signatures on %s; use -force to make it anyway", which)
+	}
+	fmt.Fprintf(e.stderr, "warning: the change invalidates the signatures on %s; %s must be signed again\n", which, pronoun)
+	return nil
+}
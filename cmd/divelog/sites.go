@@ -0,0 +1,492 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdSites = &command{
+	name:    "sites",
+	args:    "<command> [arguments]",
+	summary: "manage the dive site registry",
+	run:     runSites,
+}
+
+// sitesCommands are the commands under "divelog sites".
+var sitesCommands = []*command{
+	{"sites list", "[-country name]", "list registered sites", runSitesList},
+	{"sites add", "-name name [site flags]", "register a site", runSitesAdd},
+	{"sites edit", "<id> [-force] [site flags]", "change a site and the dives at it", runSitesEdit},
+	{"sites near", "<lat,lon> [-radius 5km]", "find sites near a position", runSitesNear},
+	{"sites dupes", "[-distance 500m] [-similarity 0.8]", "find sites entered twice", runSitesDupes},
+	{"sites merge", "[-force] <keep> <drop>...", "merge duplicate sites into one", runSitesMerge},
+	{"sites sync", "[-force]", "register the sites of dives logged without the registry", runSitesSync},
+}
+
+func runSites(e *env, fs *flag.FlagSet, args []string) error {
+	return runSubcommand(e, "sites", "command", "", sitesCommands, args)
+}
+
+// openRegistry opens the log and its site registry. Dives logged before
+// the registry existed, or imported without it, are only linked by
+// "divelog sites sync".
+func openRegistry(e *env) (store.Store, store.SiteRegistry, error) {
+	s, err := e.openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	reg, ok := s.(store.SiteRegistry)
+	if !ok {
+		s.Close()
+		return nil, nil, errors.New("this log has no site registry")
+	}
+	return s, reg, nil
+}
+
+// getSite fetches a site, turning store.ErrSiteNotFound into a message that
+// names it.
+func getSite(reg store.SiteRegistry, id int) (*divelog.Site, error) {
+	site, err := reg.GetSite(id)
+	if errors.Is(err, store.ErrSiteNotFound) {
+		return nil, fmt.Errorf("no site %d", id)
+	}
+	return site, err
+}
+
+func parseSiteID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid site ID %q", s)
+	}
+	return id, nil
+}
+
+// siteFlags are the flags sites add and edit use to describe a site.
+type siteFlags struct {
+	name     string
+	lat, lon float64
+	country  string
+	region   string
+	depth    float64
+	entry    string
+	notes    string
+}
+
+func (f *siteFlags) register(fs *flag.FlagSet, u divelog.UnitSystem) {
+	fs.StringVar(&f.name, "name", "", "site `name`")
+	fs.Float64Var(&f.lat, "lat", 0, "latitude in decimal degrees")
+	fs.Float64Var(&f.lon, "lon", 0, "longitude in decimal degrees")
+	fs.StringVar(&f.country, "country", "", "`country`")
+	fs.StringVar(&f.region, "region", "", "`region` within the country")
+	fs.Float64Var(&f.depth, "depth", 0, "deepest point of the site in "+u.DepthUnit())
+	fs.StringVar(&f.entry, "entry", "", "entry: shore or boat")
+	fs.StringVar(&f.notes, "notes", "", "free-form notes")
+}
+
+// apply copies the flags that were set on the command line into site.
+func (f *siteFlags) apply(fs *flag.FlagSet, site *divelog.Site, u divelog.UnitSystem) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "name":
+			site.Name = f.name
+		case "lat":
+			var c *divelog.Coordinates
+			if c, err = position(fs, site); err == nil {
+				c.Lat = f.lat
+			}
+		case "lon":
+			var c *divelog.Coordinates
+			if c, err = position(fs, site); err == nil {
+				c.Lon = f.lon
+			}
+		case "country":
+			site.Country = f.country
+		case "region":
+			site.Region = f.region
+		case "depth":
+			site.MaxDepth = u.Depth(f.depth)
+		case "entry":
+			site.Entry = divelog.EntryType(f.entry)
+		case "notes":
+			site.Notes = f.notes
+		}
+	})
+	return err
+}
+
+func runSitesList(e *env, fs *flag.FlagSet, args []string) error {
+	country := fs.String("country", "", "only sites in this `country`")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	registered, err := reg.Sites()
+	if err != nil {
+		return err
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	count := map[int]int{}
+	unlinked := 0
+	for _, d := range dives {
+		switch {
+		case d.Site == nil || d.Site.Name == "":
+		case d.Site.ID == 0:
+			unlinked++
+		default:
+			count[d.Site.ID]++
+		}
+	}
+	var listed []*divelog.Site
+	for _, site := range registered {
+		if *country == "" || strings.EqualFold(site.Country, *country) {
+			listed = append(listed, site)
+		}
+	}
+	if len(listed) == 0 {
+		fmt.Fprintln(e.stdout, "No sites.")
+	} else {
+		tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tWHERE\tPOSITION\tDEPTH\tENTRY\tDIVES\t")
+		for _, site := range listed {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t\n", site.ID, site.Name, siteRegion(site), formatPosition(site.Coords),
+				orDash(site.MaxDepth != 0, e.units.FormatDepth(site.MaxDepth)), orDash(site.Entry != "", string(site.Entry)), count[site.ID])
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if unlinked > 0 {
+		fmt.Fprintf(e.stdout, "\n%s not in the registry; link them with \"divelog sites sync\".\n", plural(unlinked, "dive"))
+	}
+	return nil
+}
+
+func runSitesAdd(e *env, fs *flag.FlagSet, args []string) error {
+	var f siteFlags
+	f.register(fs, e.units)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || f.name == "" {
+		fs.Usage()
+		return errUsage
+	}
+	site := &divelog.Site{}
+	if err := f.apply(fs, site, e.units); err != nil {
+		return err
+	}
+	if err := site.Validate(); err != nil {
+		return err
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := reg.PutSite(site); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "added site %d\n", site.ID)
+	return nil
+}
+
+func runSitesEdit(e *env, fs *flag.FlagSet, args []string) error {
+	var f siteFlags
+	f.register(fs, e.units)
+	force := fs.Bool("force", false, "change the site even if that invalidates signed dives")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || fs.NFlag() == 0 || fs.NFlag() == 1 && *force {
+		fs.Usage()
+		return errUsage
+	}
+	id, err := parseSiteID(pos[0])
+	if err != nil {
+		return err
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	site, err := getSite(reg, id)
+	if err != nil {
+		return err
+	}
+	if err := f.apply(fs, site, e.units); err != nil {
+		return err
+	}
+	if site.Name == "" {
+		return errors.New("a site needs a name")
+	}
+	if err := checkSigned(e, s, *force, func(d *divelog.Dive) bool { return sites.Relinks(d, site, id) }); err != nil {
+		return err
+	}
+	n, err := sites.Update(s, site)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "updated site %d and %s\n", id, plural(n, "dive"))
+	return nil
+}
+
+func runSitesNear(e *env, fs *flag.FlagSet, args []string) error {
+	radius := fs.String("radius", "5km", "search `distance`, e.g. 500m, 5km, 3mi")
+	// A southern or western position starts with a minus sign, which the
+	// flag package would take for a flag.
+	var at []string
+	var rest []string
+	for _, a := range args {
+		if _, err := divelog.ParseCoordinates(a); err == nil && len(at) == 0 {
+			at = append(at, a)
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	pos, err := parse(fs, rest)
+	if err != nil {
+		return err
+	}
+	pos = append(at, pos...)
+	if len(pos) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	c, err := divelog.ParseCoordinates(pos[0])
+	if err != nil {
+		return err
+	}
+	r, err := parseDistance(*radius)
+	if err != nil {
+		return err
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	registered, err := reg.Sites()
+	if err != nil {
+		return err
+	}
+	matches := sites.NewIndex(registered).Near(c, r)
+	if len(matches) == 0 {
+		fmt.Fprintf(e.stdout, "No sites within %s.\n", formatDistance(r, e.units))
+		return nil
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tWHERE\tDISTANCE\t")
+	for _, m := range matches {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t\n", m.Site.ID, m.Site.Name, siteRegion(m.Site), formatDistance(m.Distance, e.units))
+	}
+	return tw.Flush()
+}
+
+func runSitesDupes(e *env, fs *flag.FlagSet, args []string) error {
+	distance := fs.String("distance", "500m", "farthest apart two entries of one site can be")
+	similarity := fs.Float64("similarity", 0.8, "least name similarity, from 0 to 1")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || *similarity < 0 || *similarity > 1 {
+		fs.Usage()
+		return errUsage
+	}
+	d, err := parseDistance(*distance)
+	if err != nil {
+		return err
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	registered, err := reg.Sites()
+	if err != nil {
+		return err
+	}
+	dups := sites.Duplicates(registered, d, *similarity)
+	if len(dups) == 0 {
+		fmt.Fprintln(e.stdout, "No likely duplicates.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SITE\t\tSITE\t\tSIMILARITY\tAPART\t")
+	for _, dup := range dups {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%.0f%%\t%s\t\n", dup.A.ID, dup.A.Name, dup.B.ID, dup.B.Name, dup.Similarity*100,
+			orDash(dup.Distance >= 0, formatDistance(dup.Distance, e.units)))
+	}
+	tw.Flush()
+	fmt.Fprintln(e.stdout, "\nMerge with \"divelog sites merge <keep> <drop>...\".")
+	return nil
+}
+
+func runSitesMerge(e *env, fs *flag.FlagSet, args []string) error {
+	force := fs.Bool("force", false, "merge even if that invalidates signed dives")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	var ids []int
+	for _, p := range pos {
+		id, err := parseSiteID(p)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	merged, err := sites.Merged(reg, ids[0], ids[1:]...)
+	if errors.Is(err, store.ErrSiteNotFound) {
+		return fmt.Errorf("%w; see \"divelog sites list\"", err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkSigned(e, s, *force, func(d *divelog.Dive) bool { return sites.Relinks(d, merged, ids...) }); err != nil {
+		return err
+	}
+	site, n, err := sites.Merge(s, ids[0], ids[1:]...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "merged %s into site %d %q, updating %s\n", plural(len(ids)-1, "site"), site.ID, site.Name, plural(n, "dive"))
+	return nil
+}
+
+func runSitesSync(e *env, fs *flag.FlagSet, args []string) error {
+	force := fs.Bool("force", false, "link dives even if that invalidates their signatures")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, reg, err := openRegistry(e)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	registered, err := reg.Sites()
+	if err != nil {
+		return err
+	}
+	if err := checkSigned(e, s, *force, func(d *divelog.Dive) bool { return sites.Unsynced(registered, d) }); err != nil {
+		return err
+	}
+	n, err := sites.Sync(s)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "linked %s to the registry\n", plural(n, "dive"))
+	return nil
+}
+
+// siteRegion describes where a site is, as its region and country.
+func siteRegion(site *divelog.Site) string {
+	var parts []string
+	for _, p := range []string{site.Region, site.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return orDash(len(parts) > 0, strings.Join(parts, ", "))
+}
+
+func formatPosition(c *divelog.Coordinates) string {
+	if c == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.5f,%.5f", c.Lat, c.Lon)
+}
+
+func orDash(ok bool, s string) string {
+	if !ok {
+		return "-"
+	}
+	return s
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// distanceUnits are the units parseDistance accepts, in metres.
+var distanceUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.344,
+}
+
+// parseDistance parses a distance such as "500m" or "5km" into metres. A
+// bare number is in kilometres.
+func parseDistance(s string) (float64, error) {
+	num := strings.TrimRight(strings.TrimSpace(s), "abcdefghijklmnopqrstuvwxyz")
+	unit := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), num))
+	scale, ok := distanceUnits[unit]
+	if unit == "" {
+		scale, ok = 1000, true
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || !ok || v <= 0 {
+		return 0, fmt.Errorf("invalid distance %q, want a number with m, km, ft or mi", s)
+	}
+	return v * scale, nil
+}
+
+// formatDistance formats a distance in metres, switching to kilometres or
+// miles when it is large.
+func formatDistance(m float64, u divelog.UnitSystem) string {
+	if u == divelog.Imperial {
+		if ft := m / distanceUnits["ft"]; ft < 1000 {
+			return fmt.Sprintf("%.0f ft", ft)
+		}
+		return fmt.Sprintf("%.1f mi", m/distanceUnits["mi"])
+	}
+	if m < 1000 {
+		return fmt.Sprintf("%.0f m", m)
+	}
+	return fmt.Sprintf("%.1f km", m/1000)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/gas"
+	"github.com/betonavab/divelog/query"
+	"github.com/betonavab/divelog/render"
+	"github.com/betonavab/divelog/stats"
+)
+
+var cmdStats = &command{
+	name:    "stats",
+	args:    "[report] [arguments]",
+	summary: "statistics over the log, the summary by default",
+	run:     runStats,
+}
+
+// statsCommands are the reports under "divelog stats".
+var statsCommands = []*command{
+	{"stats sac", "[-by month|year|dive|site|equipment] [filters]", "gas consumption (SAC and RMV) and its trend", runStatsSAC},
+	{"stats summary", "[-format table|json|svg] [-o file] [-top n] [filters] [query]", "totals, records, distributions, breakdowns and streaks", runStatsSummary},
+}
+
+func runStats(e *env, fs *flag.FlagSet, args []string) error {
+	return runSubcommand(e, "stats", "report", "summary", statsCommands, args)
+}
+
+func runStatsSummary(e *env, fs *flag.FlagSet, args []string) error {
+	u := e.units
+	var qf queryFlags
+	qf.register(fs, u)
+	format := fs.String("format", "table", "output `format`: table, json or svg")
+	out := fs.String("o", "-", "output `file`, - for standard output")
+	top := fs.Int("top", 10, "list at most `n` sites, buddies and gases in the table")
+	defaultBin := 5.0
+	if u == divelog.Imperial {
+		defaultBin = 10
+	}
+	bin := fs.Float64("bin", defaultBin, "depth histogram bin width in "+u.DepthUnit())
+	width := fs.Int("width", 900, "chart width in pixels")
+	height := fs.Int("height", 600, "chart height in pixels")
+	pos, err := parseQuery(fs, args)
+	if err != nil {
+		return err
+	}
+	if *top < 0 || *bin <= 0 || *width <= 0 || *height <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	var write func(io.Writer, *stats.Summary) error
+	switch *format = strings.ToLower(*format); *format {
+	case "table":
+		write = func(w io.Writer, sum *stats.Summary) error { return writeStatsTable(w, sum, u, *top) }
+	case "json":
+		write = func(w io.Writer, sum *stats.Summary) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(sum)
+		}
+	case "svg":
+		write = func(w io.Writer, sum *stats.Summary) error {
+			return render.StatsSVG(w, sum, render.Options{Width: *width, Height: *height, Units: u})
+		}
+	default:
+		return fmt.Errorf("unknown format %q (want table, json or svg)", *format)
+	}
+	q, err := qf.query(u)
+	if err != nil {
+		return err
+	}
+	expr, err := query.Parse(strings.Join(pos, " "), u)
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	q.OmitSamples = true
+	dives, err := query.Run(s, expr, q)
+	if err != nil {
+		return err
+	}
+	sum := stats.Compute(dives, stats.Options{BinWidth: u.Depth(*bin)})
+	if sum.Dives == 0 && *format == "table" {
+		fmt.Fprintln(e.stdout, "No dives.")
+		return nil
+	}
+	if *out == "-" {
+		return write(e.stdout, sum)
+	}
+	w, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := write(w, sum); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeStatsTable writes the summary as text: the totals and records,
+// then a table for each distribution and breakdown, listing top groups at
+// most.
+func writeStatsTable(w io.Writer, s *stats.Summary, u divelog.UnitSystem, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	row := func(label, format string, args ...any) {
+		fmt.Fprintf(tw, "%s:\t"+format+"\n", append([]any{label}, args...)...)
+	}
+	record := func(r *stats.Record, value string) {
+		where := ""
+		if r.Site != "" {
+			where = " at " + r.Site
+		}
+		fmt.Fprintf(tw, "%s, #%d on %s%s\n", value, r.Number, r.Start.Format("2006-01-02"), where)
+	}
+	row("Dives", "%d on %s, %s to %s", s.Dives, plural(s.DivingDays, "day"),
+		s.First.Start.Format("2006-01-02"), s.Last.Start.Format("2006-01-02"))
+	row("Bottom time", "%.1f h", s.BottomTime.Hours())
+	fmt.Fprint(tw, "Deepest:\t")
+	record(s.Deepest, u.FormatDepth(s.Deepest.MaxDepth))
+	fmt.Fprint(tw, "Longest:\t")
+	record(s.Longest, formatDuration(s.Longest.Duration))
+	if s.Coldest != nil {
+		fmt.Fprint(tw, "Coldest:\t")
+		record(s.Coldest, u.FormatTemperature(s.Coldest.MinTemperature))
+	}
+	row("Longest streak", "%s, %s to %s (%s)", plural(s.Streak.Length, "day"), s.Streak.From, s.Streak.To, plural(s.Streak.Dives, "dive"))
+	row("Month streak", "%s, %s to %s (%s)", plural(s.MonthStreak.Length, "month"), s.MonthStreak.From, s.MonthStreak.To,
+		plural(s.MonthStreak.Dives, "dive"))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	most := 0
+	for _, b := range s.Depths {
+		most = max(most, b.Dives)
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEPTH\tDIVES\t\t")
+	for _, b := range s.Depths {
+		// The bars scale so that the most common depth gets 30 marks.
+		bar := strings.Repeat("#", (b.Dives*30+most-1)/max(most, 1))
+		fmt.Fprintf(tw, "%.0f-%.0f %s\t%d\t%s\t\n", u.DepthValue(b.From), u.DepthValue(b.To), u.DepthUnit(), b.Dives, bar)
+	}
+	tw.Flush()
+
+	for _, p := range []struct {
+		title   string
+		periods []stats.Period
+	}{{"YEAR", s.Years}, {"MONTH", s.Months}} {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tDIVES\tTIME\t\n", p.title)
+		for _, p := range p.periods {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f h\t\n", p.Period, p.Dives, p.BottomTime.Hours())
+		}
+		tw.Flush()
+	}
+
+	for _, b := range []struct {
+		title  string
+		groups []stats.Group
+	}{{"SITE", s.Sites}, {"BUDDY", s.Buddies}, {"GAS", s.Gases}} {
+		if len(b.groups) == 0 {
+			continue
+		}
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\tDIVES\tTIME\tDEEPEST\tLAST\t\n", b.title)
+		for _, g := range b.groups[:min(len(b.groups), top)] {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f h\t%s\t%s\t\n", g.Name, g.Dives, g.BottomTime.Hours(),
+				u.FormatDepth(g.MaxDepth), g.Last.Format("2006-01-02"))
+		}
+		if more := len(b.groups) - top; more > 0 {
+			fmt.Fprintf(tw, "(%d more)\t\t\t\t\t\n", more)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sacKey returns the function that gives a dive's group for the -by value
+// of stats sac.
+func sacKey(by string, u divelog.UnitSystem) (func(d *divelog.Dive) string, bool) {
+	switch by {
+	case "dive":
+		return func(d *divelog.Dive) string { return fmt.Sprintf("#%d %s", d.Number, d.Start.Format("2006-01-02")) }, true
+	case "month":
+		return func(d *divelog.Dive) string { return d.Start.Format("2006-01") }, true
+	case "year":
+		return func(d *divelog.Dive) string { return d.Start.Format("2006") }, true
+	case "site":
+		return func(d *divelog.Dive) string {
+			if d.Site == nil || d.Site.Name == "" {
+				return "(no site)"
+			}
+			return d.Site.Name
+		}, true
+	case "equipment":
+		return func(d *divelog.Dive) string { return equipmentConfig(d, u) }, true
+	}
+	return nil, false
+}
+
+// equipmentConfig describes the gear a dive was made with: the tanks
+// breathed from and the equipment logged, in a fixed order so dives with
+// the same gear share a key.
+func equipmentConfig(d *divelog.Dive, u divelog.UnitSystem) string {
+	var parts []string
+	for _, t := range d.Tanks {
+		switch {
+		case t.StartPressure == 0:
+		case t.Description != "":
+			parts = append(parts, t.Description)
+		case u == divelog.Imperial && t.RatedCapacity() != 0:
+			parts = append(parts, u.FormatVolume(t.RatedCapacity()))
+		default:
+			parts = append(parts, u.FormatVolume(t.Volume))
+		}
+	}
+	var gear []string
+	for _, eq := range d.Equipment {
+		gear = append(gear, strings.TrimSpace(string(eq.Kind)+" "+eq.Name))
+	}
+	slices.Sort(gear)
+	return strings.Join(append(parts, gear...), ", ")
+}
+
+// sacDive is one dive's consumption.
+type sacDive struct {
+	dive *divelog.Dive
+	gas.Consumption
+}
+
+func runStatsSAC(e *env, fs *flag.FlagSet, args []string) error {
+	var qf queryFlags
+	qf.register(fs, e.units)
+	by := fs.String("by", "month", "group by month, year, dive, site or equipment")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	key, ok := sacKey(*by, e.units)
+	if len(pos) != 0 || !ok {
+		fs.Usage()
+		return errUsage
+	}
+	q, err := qf.query(e.units)
+	if err != nil {
+		return err
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	dives, err := s.Query(q)
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+
+	var rates []sacDive
+	skipped := 0
+	for _, d := range dives {
+		c, err := gas.DiveConsumption(d)
+		if errors.Is(err, gas.ErrNoConsumption) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rates = append(rates, sacDive{d, c})
+	}
+	if len(rates) == 0 {
+		fmt.Fprintln(e.stdout, "No dives with tank pressures, volume and average depth.")
+		return nil
+	}
+	printSAC(e, rates, key, *by != "dive" && *by != "month" && *by != "year")
+	if slope, ok := rmvTrend(rates); ok {
+		direction := "rising"
+		if slope < 0 {
+			direction = "falling"
+		}
+		fmt.Fprintf(e.stdout, "\nRMV trend: %s %s/min per month over %d dives\n", direction,
+			e.units.FormatVolume(divelog.Volume(max(slope, -slope))), len(rates))
+	}
+	if skipped > 0 {
+		dives := "dives"
+		if skipped == 1 {
+			dives = "dive"
+		}
+		fmt.Fprintf(e.stdout, "%d %s left out for lack of tank pressures, volume or average depth\n", skipped, dives)
+	}
+	return nil
+}
+
+// printSAC prints the mean consumption of each group of rates, in order of
+// the groups' first dives or, if byValue, from the lowest RMV.
+func printSAC(e *env, rates []sacDive, key func(*divelog.Dive) string, byValue bool) {
+	u := e.units
+	type group struct {
+		name     string
+		rmv, sac float64
+		min, max divelog.Volume
+		n        int
+	}
+	var groups []*group
+	index := map[string]*group{}
+	for _, r := range rates {
+		k := key(r.dive)
+		g := index[k]
+		if g == nil {
+			g = &group{name: k, min: r.RMV, max: r.RMV}
+			index[k] = g
+			groups = append(groups, g)
+		}
+		g.n++
+		g.rmv += float64(r.RMV)
+		g.sac += float64(r.SAC)
+		g.min, g.max = min(g.min, r.RMV), max(g.max, r.RMV)
+	}
+	if byValue {
+		slices.SortStableFunc(groups, func(a, b *group) int { return cmp.Compare(a.rmv/float64(a.n), b.rmv/float64(b.n)) })
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tDIVES\tRMV\tSAC\tRMV RANGE\t")
+	for _, g := range groups {
+		n := float64(g.n)
+		rng := "-"
+		if g.n > 1 {
+			rng = u.FormatVolume(g.min) + " - " + u.FormatVolume(g.max)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s/min\t%.1f %s/min\t%s\t\n", g.name, g.n, u.FormatVolume(divelog.Volume(g.rmv/n)),
+			u.PressureValue(divelog.Pressure(g.sac/n)), u.PressureUnit(), rng)
+	}
+	tw.Flush()
+}
+
+// rmvTrend fits a straight line to RMV over time and returns its slope in
+// volume per month. ok is false without at least two dives on different
+// days.
+func rmvTrend(rates []sacDive) (slope float64, ok bool) {
+	const month = 30.44 * 24 * float64(time.Hour)
+	t0 := rates[0].dive.Start
+	var sx, sy, sxx, sxy float64
+	for _, r := range rates {
+		x := float64(r.dive.Start.Sub(t0)) / month
+		y := float64(r.RMV)
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	n := float64(len(rates))
+	den := n*sxx - sx*sx
+	if len(rates) < 2 || rates[len(rates)-1].dive.Start.Sub(t0) < 24*time.Hour || den == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / den, true
+}
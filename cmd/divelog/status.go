@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/betonavab/divelog/gear"
+	"github.com/betonavab/divelog/store"
+)
+
+var cmdStatus = &command{
+	name:    "status",
+	args:    "",
+	summary: "summarize the log and warn of anything due",
+	run:     runStatus,
+}
+
+func runStatus(e *env, fs *flag.FlagSet, args []string) error {
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	s, err := e.openStore()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	row := func(label, format string, args ...any) {
+		fmt.Fprintf(tw, "%s:\t"+format+"\n", append([]any{label}, args...)...)
+	}
+	var total time.Duration
+	last := -1
+	for i, d := range dives {
+		total += d.Duration
+		if last < 0 || d.Start.After(dives[last].Start) {
+			last = i
+		}
+	}
+	row("Dives", "%d, %.1f h underwater", len(dives), total.Hours())
+	if last >= 0 {
+		d := dives[last]
+		where := ""
+		if d.Site != nil && d.Site.Name != "" {
+			where = " at " + d.Site.Name
+		}
+		row("Last dive", "#%d on %s%s", d.Number, d.Start.Format("2006-01-02"), where)
+	}
+
+	if inv, ok := s.(store.Inventory); ok {
+		items, err := inv.Items()
+		if err != nil {
+			return err
+		}
+		due := gear.Reminders(items, gear.Tally(items, dives), now)
+		switch {
+		case len(items) == 0:
+		case len(due) == 0:
+			row("Gear", "nothing due")
+		default:
+			for _, r := range due {
+				row("Gear", "%s %s: %s %s", r.Item.Kind, r.Item.Name, r.Check, describeReminder(r, now))
+			}
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+	"github.com/betonavab/divelog/store/sqlite"
+)
+
+// openStore opens the dive log selected with -log.
+func (e *env) openStore() (store.Store, error) {
+	return openStoreAt(e.logPath)
+}
+
+// openStoreAt opens the log at path with the backend its extension names:
+// .db, .sqlite or .sqlite3 for SQLite and anything else for a JSON file.
+func openStoreAt(path string) (store.Store, error) {
+	if backendName(path) == "sqlite" {
+		return sqlite.Open(path)
+	}
+	return store.OpenJSON(path)
+}
+
+func backendName(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return "sqlite"
+	}
+	return "json"
+}
+
+// getDive fetches a dive, turning store.ErrNotFound into a message that
+// names the dive.
+func getDive(s store.Store, number int) (*divelog.Dive, error) {
+	d, err := s.Get(number)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("no dive #%d", number)
+	}
+	return d, err
+}
@@ -0,0 +1,397 @@
+// Package csvimport reads dives from spreadsheet exports using a Mapping
+// that says which column holds which dive field, in which unit and, for
+// dates and times, in which format.
+//
+// The fields a column can fill, with the units each accepts (the first is
+// the default), are:
+//
+//	number                                 dive number
+//	date, time, datetime                   start of the dive; see Column.Format
+//	duration                               min, s, h; or h:mm / mm:ss text
+//	max_depth, avg_depth                   m, ft
+//	temperature                            c, f, k
+//	site, lat, lon                         site name and decimal degrees
+//	buddy                                  names separated by , or ;
+//	gas                                    mix name: air, EAN32, 18/45
+//	o2, he                                 %, fraction
+//	tank_volume                            l (water capacity), cuft (rated capacity)
+//	working_pressure, start_pressure,
+//	end_pressure                           bar, psi
+//	rating                                 0 to 5
+//	tags                                   separated by , or ;
+//	notes                                  free text
+//
+// A cell that is empty leaves its field unset. Rows that cannot be read
+// are reported with their line number and skipped; they do not stop the
+// rest of the file from importing.
+package csvimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/betonavab/divelog"
+)
+
+// RowError reports a row that could not be imported.
+type RowError struct {
+	Line   int    // line of the file the row starts on
+	Column string // column at fault, if the problem is in one cell
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("line %d: column %q: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error { return e.Err }
+
+// Read reads the dives in r. Rows that cannot be converted are skipped and
+// returned as RowErrors; err is set only when the file cannot be read at
+// all, such as when a mapped column is missing from the header. Dates and
+// times are interpreted in loc.
+func Read(r io.Reader, m *Mapping, loc *time.Location) (dives []*divelog.Dive, rowErrs []*RowError, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	if m.Delimiter != "" {
+		cr.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	}
+
+	var header []string
+	if m.Header {
+		header, err = cr.Read()
+		if err == io.EOF {
+			return nil, nil, errors.New("empty file")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+	}
+	index, err := m.resolve(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				rowErrs = append(rowErrs, &RowError{Line: pe.StartLine, Err: pe.Err})
+				continue
+			}
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if blank(record) {
+			continue
+		}
+		d, rerr := m.convert(record, index, loc)
+		if rerr != nil {
+			rerr.Line = line
+			rowErrs = append(rowErrs, rerr)
+			continue
+		}
+		dives = append(dives, d)
+	}
+	return dives, rowErrs, nil
+}
+
+// resolve returns the record index of each mapped column.
+func (m *Mapping) resolve(header []string) ([]int, error) {
+	index := make([]int, len(m.Columns))
+	for i, c := range m.Columns {
+		index[i] = -1
+		for j, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(c.Column)) {
+				index[i] = j
+				break
+			}
+		}
+		if index[i] < 0 {
+			n, err := strconv.Atoi(c.Column)
+			if err != nil || n < 1 || (header != nil && n > len(header)) {
+				return nil, fmt.Errorf("column %q not found in header", c.Column)
+			}
+			index[i] = n - 1
+		}
+	}
+	return index, nil
+}
+
+// row collects the values of one record before they are combined into a
+// dive.
+type row struct {
+	d        divelog.Dive
+	date     time.Time
+	clock    time.Duration
+	datetime time.Time
+	cuft     float64 // tank rated capacity awaiting the working pressure
+}
+
+func (m *Mapping) convert(record []string, index []int, loc *time.Location) (*divelog.Dive, *RowError) {
+	var r row
+	for i, c := range m.Columns {
+		if index[i] >= len(record) {
+			continue
+		}
+		v := strings.TrimSpace(record[index[i]])
+		if v == "" {
+			continue
+		}
+		if err := r.set(c, v, loc); err != nil {
+			return nil, &RowError{Column: c.Column, Err: err}
+		}
+	}
+
+	d := &r.d
+	switch {
+	case !r.datetime.IsZero():
+		d.Start = r.datetime
+	case !r.date.IsZero():
+		d.Start = r.date.Add(r.clock)
+	default:
+		return nil, &RowError{Err: errors.New("no date")}
+	}
+	if r.cuft != 0 {
+		t := tank(d)
+		if t.WorkingPressure == 0 {
+			return nil, &RowError{Err: errors.New("tank volume in cuft needs a working_pressure column")}
+		}
+		t.Volume = divelog.ImperialCylinder(divelog.CubicFeet(r.cuft), t.WorkingPressure)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, &RowError{Err: err}
+	}
+	return d, nil
+}
+
+func (r *row) set(c Column, v string, loc *time.Location) error {
+	d := &r.d
+	var err error
+	switch c.Field {
+	case "number":
+		d.Number, err = strconv.Atoi(v)
+	case "date":
+		r.date, err = time.ParseInLocation(goLayout(c.Format), v, loc)
+	case "time":
+		var t time.Time
+		if t, err = time.Parse(goLayout(c.Format), v); err == nil {
+			r.clock = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second
+		}
+	case "datetime":
+		r.datetime, err = time.ParseInLocation(goLayout(c.Format), v, loc)
+	case "duration":
+		d.Duration, err = parseDuration(v, c)
+	case "max_depth", "avg_depth":
+		var n float64
+		if n, err = number(v); err == nil {
+			depth := divelog.Depth(n)
+			if c.Unit == "ft" {
+				depth = divelog.Feet(n)
+			}
+			if c.Field == "max_depth" {
+				d.MaxDepth = depth
+			} else {
+				d.AvgDepth = depth
+			}
+		}
+	case "temperature":
+		var n float64
+		if n, err = number(v); err == nil {
+			switch c.Unit {
+			case "c":
+				d.MinTemperature = divelog.Celsius(n)
+			case "f":
+				d.MinTemperature = divelog.Fahrenheit(n)
+			case "k":
+				d.MinTemperature = divelog.Temperature(n)
+			}
+		}
+	case "site":
+		site(d).Name = v
+	case "lat", "lon":
+		var n float64
+		if n, err = number(v); err == nil {
+			s := site(d)
+			if s.Coords == nil {
+				s.Coords = &divelog.Coordinates{}
+			}
+			if c.Field == "lat" {
+				s.Coords.Lat = n
+			} else {
+				s.Coords.Lon = n
+			}
+		}
+	case "buddy":
+		for _, name := range splitList(v) {
+			d.Buddies = append(d.Buddies, divelog.Buddy{Name: name})
+		}
+	case "gas":
+		tank(d).Gas, err = divelog.ParseGasMix(v)
+	case "o2", "he":
+		var n float64
+		if n, err = number(strings.TrimSuffix(v, "%")); err == nil {
+			if c.Unit == "%" {
+				n /= 100
+			}
+			if c.Field == "o2" {
+				tank(d).Gas.O2 = n
+			} else {
+				tank(d).Gas.He = n
+			}
+		}
+	case "tank_volume":
+		var n float64
+		if n, err = number(v); err == nil {
+			if c.Unit == "cuft" {
+				r.cuft = n
+				tank(d)
+			} else {
+				tank(d).Volume = divelog.Liters(n)
+			}
+		}
+	case "working_pressure", "start_pressure", "end_pressure":
+		var n float64
+		if n, err = number(v); err == nil {
+			p := divelog.Bar(n)
+			if c.Unit == "psi" {
+				p = divelog.PSI(n)
+			}
+			t := tank(d)
+			switch c.Field {
+			case "working_pressure":
+				t.WorkingPressure = p
+			case "start_pressure":
+				t.StartPressure = p
+			default:
+				t.EndPressure = p
+			}
+		}
+	case "rating":
+		d.Rating, err = strconv.Atoi(v)
+	case "tags":
+		d.Tags = append(d.Tags, splitList(v)...)
+	case "notes":
+		if d.Notes != "" {
+			d.Notes += "\n"
+		}
+		d.Notes += v
+	}
+	if ne := (*strconv.NumError)(nil); errors.As(err, &ne) {
+		return fmt.Errorf("invalid number %q", v)
+	}
+	var pe *time.ParseError
+	if errors.As(err, &pe) {
+		return fmt.Errorf("%q does not match format %q", v, c.Format)
+	}
+	return err
+}
+
+// tank returns the dive's tank, adding one filled with air if needed.
+func tank(d *divelog.Dive) *divelog.Tank {
+	if len(d.Tanks) == 0 {
+		d.Tanks = []divelog.Tank{{Gas: divelog.Air}}
+	}
+	return &d.Tanks[0]
+}
+
+func site(d *divelog.Dive) *divelog.Site {
+	if d.Site == nil {
+		d.Site = &divelog.Site{}
+	}
+	return d.Site
+}
+
+// number parses a decimal number, accepting a decimal comma as written by
+// spreadsheets in many locales.
+func number(s string) (float64, error) {
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseDuration parses a dive time in c's unit, or as clock text: "h:mm"
+// unless c.Format is "mm:ss", and "h:mm:ss" for three parts.
+func parseDuration(v string, c Column) (time.Duration, error) {
+	if strings.Contains(v, ":") {
+		parts := strings.Split(v, ":")
+		var n [3]int
+		for i, p := range parts {
+			var err error
+			if i >= 3 {
+				return 0, fmt.Errorf("invalid duration %q", v)
+			}
+			if n[i], err = strconv.Atoi(p); err != nil || n[i] < 0 {
+				return 0, fmt.Errorf("invalid duration %q", v)
+			}
+		}
+		switch {
+		case len(parts) == 3:
+			return time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute + time.Duration(n[2])*time.Second, nil
+		case strings.EqualFold(c.Format, "mm:ss"):
+			return time.Duration(n[0])*time.Minute + time.Duration(n[1])*time.Second, nil
+		}
+		return time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute, nil
+	}
+	n, err := number(v)
+	if err != nil {
+		return 0, err
+	}
+	unit := map[string]time.Duration{"min": time.Minute, "s": time.Second, "h": time.Hour}[c.Unit]
+	return time.Duration(n * float64(unit)), nil
+}
+
+// strftime maps strftime directives to Go layout elements.
+var strftime = strings.NewReplacer(
+	"%Y", "2006", "%y", "06", "%m", "01", "%d", "02", "%e", "_2",
+	"%H", "15", "%I", "03", "%M", "04", "%S", "05", "%p", "PM",
+	"%b", "Jan", "%B", "January", "%a", "Mon", "%A", "Monday",
+	"%z", "-0700", "%%", "%",
+)
+
+// goLayout turns a strftime format into a Go time layout. Formats without
+// a % directive are taken to be Go layouts already.
+func goLayout(format string) string {
+	if !strings.Contains(format, "%") {
+		return format
+	}
+	return strftime.Replace(format)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func blank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
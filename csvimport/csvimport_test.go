@@ -0,0 +1,172 @@
+package csvimport
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func TestRead(t *testing.T) {
+	m, err := LoadMapping("testdata/mapping.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/logbook.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dives, rowErrs, err := Read(f, m, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dives) != 3 {
+		t.Fatalf("read %d dives, want 3", len(dives))
+	}
+	d := dives[0]
+	if want := time.Date(2024, 3, 14, 8, 45, 0, 0, time.UTC); !d.Start.Equal(want) {
+		t.Errorf("Start = %v, want %v", d.Start, want)
+	}
+	if d.Duration != 52*time.Minute {
+		t.Errorf("Duration = %v, want 52m", d.Duration)
+	}
+	if math.Abs(d.MaxDepth.Feet()-92) > 1e-9 {
+		t.Errorf("MaxDepth = %.2f ft, want 92", d.MaxDepth.Feet())
+	}
+	if math.Abs(d.MinTemperature.Fahrenheit()-78) > 1e-9 {
+		t.Errorf("MinTemperature = %.2f °F, want 78", d.MinTemperature.Fahrenheit())
+	}
+	if d.Site == nil || d.Site.Name != "Blue Hole" {
+		t.Errorf("Site = %+v", d.Site)
+	}
+	if len(d.Buddies) != 2 || d.Buddies[1].Name != "Ben" {
+		t.Errorf("Buddies = %+v", d.Buddies)
+	}
+	if d.Notes != "Shark at 30 m;\ngreat vis" {
+		t.Errorf("Notes = %q", d.Notes)
+	}
+	tank := d.Tanks[0]
+	if tank.Gas.O2 != 0.32 {
+		t.Errorf("O2 = %v, want 0.32", tank.Gas.O2)
+	}
+	if got := tank.RatedCapacity().CubicFeet(); math.Abs(got-80) > 1e-6 {
+		t.Errorf("rated capacity = %.3f cuft, want 80", got)
+	}
+	if got := tank.EndPressure.PSI(); math.Abs(got-700) > 1e-6 {
+		t.Errorf("EndPressure = %.1f psi, want 700", got)
+	}
+	if got := dives[1].MaxDepth.Feet(); math.Abs(got-45.5) > 1e-9 {
+		t.Errorf("decimal comma depth = %.2f ft, want 45.5", got)
+	}
+	if dives[2].Number != 5 || dives[2].Tanks[0].Volume != 0 {
+		t.Errorf("third dive = #%d %+v", dives[2].Number, dives[2].Tanks)
+	}
+
+	want := []struct {
+		line   int
+		column string
+		text   string
+	}{
+		{5, "Date", `does not match format "%d/%m/%Y"`},
+		{6, "Max (ft)", `invalid number "deep"`},
+		{10, "O2 %", `invalid number "60/50"`},
+		{11, "", "tanks[0].gas"},
+	}
+	if len(rowErrs) != len(want) {
+		t.Fatalf("row errors = %v, want %d", rowErrs, len(want))
+	}
+	for i, w := range want {
+		re := rowErrs[i]
+		if re.Line != w.line || re.Column != w.column || !strings.Contains(re.Error(), w.text) {
+			t.Errorf("row error %d = %v (line %d, column %q), want line %d, column %q, containing %q",
+				i, re, re.Line, re.Column, w.line, w.column, w.text)
+		}
+	}
+}
+
+func TestReadWithoutHeader(t *testing.T) {
+	m, err := ParseMapping([]byte(`
+header: false
+columns:
+  - {column: 1, field: datetime, format: "2006-01-02T15:04"}
+  - {column: 2, field: max_depth}
+  - {column: 3, field: duration, unit: s}
+  - {column: 4, field: gas}
+  - {column: 5, field: tags}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "2024-06-01T10:00,18.5,2400,EAN32,night;wreck\n"
+	dives, rowErrs, err := Read(strings.NewReader(in), m, time.UTC)
+	if err != nil || len(rowErrs) != 0 || len(dives) != 1 {
+		t.Fatalf("Read = %d dives, %v, %v", len(dives), rowErrs, err)
+	}
+	d := dives[0]
+	if d.MaxDepth != 18.5 || d.Duration != 40*time.Minute {
+		t.Errorf("dive = %v deep, %v long", d.MaxDepth, d.Duration)
+	}
+	if d.Tanks[0].Gas != (divelog.GasMix{O2: 0.32}) {
+		t.Errorf("gas = %v", d.Tanks[0].Gas)
+	}
+	if !d.HasTag("night") || !d.HasTag("wreck") {
+		t.Errorf("tags = %v", d.Tags)
+	}
+}
+
+func TestMissingColumn(t *testing.T) {
+	m, err := ParseMapping([]byte(`columns: [{column: When, field: datetime}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Read(strings.NewReader("Date,Depth\n2024-01-01 10:00,10\n"), m, time.UTC)
+	if err == nil || !strings.Contains(err.Error(), `"When"`) {
+		t.Errorf("Read with missing column: %v", err)
+	}
+}
+
+func TestParseMappingErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"unknown field", `columns: [{column: A, field: date}, {column: B, field: colour}]`, "unknown field"},
+		{"bad unit", `columns: [{column: A, field: date}, {column: B, field: max_depth, unit: fathoms}]`, "does not take unit"},
+		{"no date", `columns: [{column: A, field: site}]`, "no column mapped to date"},
+		{"named column without header", "header: false\ncolumns: [{column: A, field: date}]", "by number"},
+		{"long delimiter", "delimiter: ';;'\ncolumns: [{column: A, field: date}]", "single character"},
+		{"no columns", `delimiter: ","`, "no columns"},
+	}
+	for _, tt := range tests {
+		_, err := ParseMapping([]byte(tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ParseMapping = %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in     string
+		unit   string
+		format string
+		want   time.Duration
+	}{
+		{"45", "min", "", 45 * time.Minute},
+		{"45,5", "min", "", 45*time.Minute + 30*time.Second},
+		{"1.5", "h", "", 90 * time.Minute},
+		{"1:05", "min", "", 65 * time.Minute},
+		{"45:30", "min", "mm:ss", 45*time.Minute + 30*time.Second},
+		{"0:45:30", "min", "", 45*time.Minute + 30*time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in, Column{Unit: tt.unit, Format: tt.format})
+		if err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q, %s) = %v, %v, want %v", tt.in, tt.unit, got, err, tt.want)
+		}
+	}
+}
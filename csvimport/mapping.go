@@ -0,0 +1,149 @@
+package csvimport
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mapping describes how the columns of a spreadsheet export map onto dive
+// fields. It is usually loaded from YAML:
+//
+//	delimiter: ";"
+//	columns:
+//	  - {column: Date, field: date, format: "%d/%m/%Y"}
+//	  - {column: Time, field: time, format: "%H:%M"}
+//	  - {column: "Max (ft)", field: max_depth, unit: ft}
+//	  - {column: Bottom time, field: duration, unit: min}
+//	  - {column: 5, field: site}
+type Mapping struct {
+	// Delimiter separates fields; the default is a comma.
+	Delimiter string `yaml:"delimiter"`
+
+	// Header says whether the first row names the columns. It defaults
+	// to true; without a header, columns must be given by number.
+	Header bool `yaml:"header"`
+
+	Columns []Column `yaml:"columns"`
+}
+
+// Column maps one spreadsheet column to a dive field.
+type Column struct {
+	// Column is the header text of the column or its 1-based number.
+	Column string `yaml:"column"`
+
+	// Field is the dive field the column fills; see the package
+	// documentation for the list.
+	Field string `yaml:"field"`
+
+	// Unit is the unit the column's values are written in. Fields that
+	// take units default to the first one listed for them.
+	Unit string `yaml:"unit"`
+
+	// Format is the layout of date and time columns, written either with
+	// strftime directives ("%d/%m/%Y %H:%M") or as a Go reference time
+	// ("02/01/2006 15:04"). Duration columns accept "h:mm" or "mm:ss".
+	Format string `yaml:"format"`
+}
+
+// fieldSpec describes a dive field a column can fill.
+type fieldSpec struct {
+	units  []string // accepted units, the default first
+	format string   // default format, for date and time fields
+}
+
+// fields lists the fields a column can map to, with their units.
+var fields = map[string]fieldSpec{
+	"number":           {},
+	"date":             {format: "%Y-%m-%d"},
+	"time":             {format: "%H:%M"},
+	"datetime":         {format: "%Y-%m-%d %H:%M"},
+	"duration":         {units: []string{"min", "s", "h"}},
+	"max_depth":        {units: []string{"m", "ft"}},
+	"avg_depth":        {units: []string{"m", "ft"}},
+	"temperature":      {units: []string{"c", "f", "k"}},
+	"site":             {},
+	"lat":              {},
+	"lon":              {},
+	"buddy":            {},
+	"gas":              {},
+	"o2":               {units: []string{"%", "fraction"}},
+	"he":               {units: []string{"%", "fraction"}},
+	"tank_volume":      {units: []string{"l", "cuft"}},
+	"working_pressure": {units: []string{"bar", "psi"}},
+	"start_pressure":   {units: []string{"bar", "psi"}},
+	"end_pressure":     {units: []string{"bar", "psi"}},
+	"rating":           {},
+	"tags":             {},
+	"notes":            {},
+}
+
+// LoadMapping reads a YAML mapping file.
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseMapping(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseMapping parses and checks a YAML mapping.
+func ParseMapping(data []byte) (*Mapping, error) {
+	m := &Mapping{Header: true}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// check validates the mapping and fills in default units and formats.
+func (m *Mapping) check() error {
+	if len([]rune(m.Delimiter)) > 1 {
+		return fmt.Errorf("delimiter %q is not a single character", m.Delimiter)
+	}
+	if len(m.Columns) == 0 {
+		return fmt.Errorf("no columns mapped")
+	}
+	hasDate := false
+	for i := range m.Columns {
+		c := &m.Columns[i]
+		c.Unit = strings.ToLower(strings.TrimSpace(c.Unit))
+		spec, ok := fields[c.Field]
+		if !ok {
+			return fmt.Errorf("column %q: unknown field %q", c.Column, c.Field)
+		}
+		if c.Column == "" {
+			return fmt.Errorf("field %s: no column given", c.Field)
+		}
+		if !m.Header {
+			if n, err := strconv.Atoi(c.Column); err != nil || n < 1 {
+				return fmt.Errorf("column %q: without a header columns are given by number", c.Column)
+			}
+		}
+		switch {
+		case c.Unit == "" && len(spec.units) > 0:
+			c.Unit = spec.units[0]
+		case c.Unit != "" && !slices.Contains(spec.units, c.Unit):
+			return fmt.Errorf("column %q: field %s does not take unit %q", c.Column, c.Field, c.Unit)
+		}
+		if c.Format == "" {
+			c.Format = spec.format
+		}
+		hasDate = hasDate || c.Field == "date" || c.Field == "datetime"
+	}
+	if !hasDate {
+		return fmt.Errorf("no column mapped to date or datetime")
+	}
+	return nil
+}
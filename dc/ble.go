@@ -0,0 +1,79 @@
+package dc
+
+import (
+	"io"
+	"time"
+)
+
+// GATT is what a Bluetooth LE transport needs of a BLE stack: a connection
+// to a computer's serial port service, with one characteristic the host
+// writes to and one the computer sends notifications on. Go has no
+// standard Bluetooth stack, so programs supply their own, built on BlueZ
+// over D-Bus or on CoreBluetooth.
+type GATT interface {
+	// Write writes p, at most MTU bytes, to the receive characteristic.
+	Write(p []byte) error
+
+	// Notifications delivers the values of the transmit characteristic's
+	// notifications. It is closed when the connection drops.
+	Notifications() <-chan []byte
+
+	// MTU is the largest value Write accepts.
+	MTU() int
+
+	Close() error
+}
+
+// BLE is a Transport over a Bluetooth LE serial service.
+type BLE struct {
+	g       GATT
+	timeout time.Duration
+	pending []byte
+}
+
+// NewBLE returns a Transport over a connected GATT service.
+func NewBLE(g GATT) *BLE { return &BLE{g: g} }
+
+func (b *BLE) Read(p []byte) (int, error) {
+	if len(b.pending) == 0 {
+		var expired <-chan time.Time
+		if b.timeout > 0 {
+			timer := time.NewTimer(b.timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case v, ok := <-b.g.Notifications():
+			if !ok {
+				return 0, io.EOF
+			}
+			b.pending = v
+		case <-expired:
+			return 0, ErrTimeout
+		}
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+// Write sends p in pieces of at most the connection's MTU.
+func (b *BLE) Write(p []byte) (int, error) {
+	mtu := max(b.g.MTU(), 1)
+	n := 0
+	for n < len(p) {
+		chunk := p[n:min(n+mtu, len(p))]
+		if err := b.g.Write(chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+func (b *BLE) SetTimeout(d time.Duration) error {
+	b.timeout = d
+	return nil
+}
+
+func (b *BLE) Close() error { return b.g.Close() }
@@ -0,0 +1,142 @@
+// Package dc downloads dives from dive computers.
+//
+// Downloading is split in three. A Transport carries bytes to and from the
+// computer: a serial port (most USB cables are serial adapters), a USB HID
+// device or a Bluetooth LE link. A Driver speaks one family of computers'
+// download protocol over a transport and hands back each dive as the raw
+// bytes the computer stores, and as a Parser it decodes those bytes into
+// a divelog.Dive. Keeping the raw bytes lets a dive be parsed again when
+// the parser improves, and keeping the protocol apart from the transport
+// lets a driver be tested against a recorded conversation replayed
+// through Replay, with no computer attached.
+package dc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// ErrTimeout is returned by Transport reads that see no data in time.
+var ErrTimeout = errors.New("timed out waiting for the dive computer")
+
+// Transport is a connection to a dive computer.
+type Transport interface {
+	io.ReadWriteCloser
+
+	// SetTimeout sets how long a Read waits for data before it fails with
+	// ErrTimeout. Zero waits forever.
+	SetTimeout(d time.Duration) error
+}
+
+// Parser decodes the dives of one family of computers.
+type Parser interface {
+	// Parse decodes a dive as the computer stores it. Computers keep
+	// local time without a zone; loc says which zone that was.
+	Parse(raw []byte, loc *time.Location) (*divelog.Dive, error)
+}
+
+// Info identifies a dive computer.
+type Info struct {
+	Vendor, Model string
+	Serial        string
+	Firmware      string
+}
+
+// Device names the computer for keeping its download fingerprint.
+func (i *Info) Device() string {
+	return strings.Join([]string{i.Vendor, i.Model, i.Serial}, " ")
+}
+
+// Equipment returns the dive log's record of the computer.
+func (i *Info) Equipment() divelog.Equipment {
+	return divelog.Equipment{Kind: divelog.Computer, Name: i.Model, Serial: i.Serial}
+}
+
+// Driver speaks the download protocol of one family of computers.
+type Driver interface {
+	Parser
+
+	// Name is the short name the driver is looked up by.
+	Name() string
+
+	// Fingerprint identifies a raw dive by a hash of what the computer
+	// never rewrites, usually its header.
+	Fingerprint(raw []byte) string
+
+	// Download identifies the computer on t and reads its dives, newest
+	// first, calling fn with the raw bytes of each. It stops, without
+	// reading it, at the dive whose fingerprint since returns for the
+	// computer, if since is not nil and the computer still has that dive.
+	// If fn returns an error the download stops and Download returns it.
+	Download(t Transport, since func(*Info) string, fn func(raw []byte) error) (*Info, error)
+}
+
+// drivers are the known drivers, by name.
+var drivers = []Driver{OSTC}
+
+// Drivers returns the names of the known drivers.
+func Drivers() []string {
+	var names []string
+	for _, d := range drivers {
+		names = append(names, d.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Lookup returns the driver with the given name.
+func Lookup(name string) (Driver, error) {
+	for _, d := range drivers {
+		if strings.EqualFold(d.Name(), name) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown dive computer %q (known: %s)", name, strings.Join(Drivers(), ", "))
+}
+
+// A Log is what Download read from a computer.
+type Log struct {
+	Info  *Info
+	Dives []*divelog.Dive // oldest first
+
+	// Fingerprint is that of the newest dive read, or "" if there were
+	// no new dives. Kept for the next download, it stops that one there.
+	Fingerprint string
+}
+
+// Download reads and parses the dives on the computer on t, oldest first.
+// known holds the fingerprints of earlier downloads by Info.Device; the
+// download stops at the dive the computer's fingerprint names, so only
+// dives made since are read. Each dive lists the computer among its
+// equipment and as the Computer that recorded its profile.
+func Download(t Transport, drv Driver, loc *time.Location, known map[string]string) (*Log, error) {
+	var raws [][]byte
+	info, err := drv.Download(t, func(info *Info) string { return known[info.Device()] }, func(raw []byte) error {
+		raws = append(raws, raw)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log := &Log{Info: info, Dives: make([]*divelog.Dive, 0, len(raws))}
+	if len(raws) > 0 {
+		log.Fingerprint = drv.Fingerprint(raws[0])
+	}
+	for i := len(raws) - 1; i >= 0; i-- {
+		d, err := drv.Parse(raws[i], loc)
+		if err != nil {
+			return nil, fmt.Errorf("dive %d of %d: %w", len(raws)-i, len(raws), err)
+		}
+		eq := info.Equipment()
+		d.Equipment = append(d.Equipment, eq)
+		d.Computer = &eq
+		log.Dives = append(log.Dives, d)
+	}
+	return log, nil
+}
@@ -0,0 +1,384 @@
+package dc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/ostc.txt from the fake computer")
+
+// ostcSample is a profile sample for ostcRaw: depth in metres and, every
+// sixth sample, temperature in °C. gas, when set, is a switch to that gas.
+type ostcSample struct {
+	depth, temp float64
+	gas         int
+}
+
+// ostcRaw builds a dive as an OSTC stores it, sampled every 10 s, on air
+// with 50% as the second gas.
+func ostcRaw(number int, start time.Time, samples []ostcSample) []byte {
+	var p []byte
+	p = append(p, 0, 0, 0, 10, 1, ostcTemperatureInfo, 2, 6)
+	maxDepth, sum, minTemp := 0.0, 0.0, math.Inf(1)
+	for i, s := range samples {
+		n := i + 1
+		var extra []byte
+		if s.gas != 0 {
+			extra = append(extra, ostcGasChange, byte(s.gas))
+		}
+		if n%6 == 0 {
+			extra = binary.LittleEndian.AppendUint16(extra, uint16(int16(s.temp*10)))
+			minTemp = min(minTemp, s.temp)
+		}
+		flags := byte(len(extra))
+		if s.gas != 0 {
+			flags |= 0x80
+		}
+		p = binary.LittleEndian.AppendUint16(p, uint16(math.Round(s.depth*100)))
+		p = append(p, flags)
+		p = append(p, extra...)
+		maxDepth = max(maxDepth, s.depth)
+		sum += s.depth
+	}
+	p = append(p, 0xfd, 0xfd)
+	p[0], p[1], p[2] = byte(len(p)), byte(len(p)>>8), byte(len(p)>>16)
+
+	h := make([]byte, ostcHeaderSize)
+	h[0], h[1], h[254], h[255] = 0xfa, 0xfa, 0xfb, 0xfb
+	h[ostcVersion] = 0x24
+	copy(h[ostcLength:], p[:3])
+	copy(h[ostcDate:], []byte{byte(start.Year() - 2000), byte(start.Month()), byte(start.Day()), byte(start.Hour()), byte(start.Minute())})
+	binary.LittleEndian.PutUint16(h[ostcMaxDepth:], uint16(math.Round(maxDepth*100)))
+	binary.LittleEndian.PutUint16(h[ostcDiveTime:], uint16(len(samples)/6))
+	h[ostcDiveTime+2] = byte(len(samples) % 6 * 10)
+	binary.LittleEndian.PutUint16(h[ostcTemperature:], uint16(int16(minTemp*10)))
+	binary.LittleEndian.PutUint16(h[ostcSurface:], 1013)
+	copy(h[ostcGasTable:], []byte{21, 0, 0, 1, 50, 0, 21, 2})
+	h[ostcSalinity] = 103
+	binary.LittleEndian.PutUint16(h[ostcAvgDepth:], uint16(math.Round(sum/float64(len(samples))*100)))
+	binary.LittleEndian.PutUint16(h[ostcNumber:], uint16(number))
+	return append(h, p...)
+}
+
+// square returns the samples of a square dive to depth for minutes, with
+// a switch to gas 2 for the last minute.
+func square(depth float64, minutes int) []ostcSample {
+	var s []ostcSample
+	for i := range minutes * 6 {
+		smp := ostcSample{depth: depth, temp: 26 - float64(i)/60}
+		switch i {
+		case 0, minutes*6 - 1:
+			smp.depth = depth / 3
+		case minutes*6 - 6:
+			smp.gas = 2
+		}
+		s = append(s, smp)
+	}
+	return s
+}
+
+// fakeOSTC plays an OSTC in download mode holding a logbook.
+type fakeOSTC struct {
+	slots   map[int][]byte // raw dives by logbook slot
+	fetched []int          // slots the host read
+	out     []byte         // bytes waiting to be read
+	command byte           // command waiting for its argument
+	closed  bool
+}
+
+func (f *fakeOSTC) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if f.command == ostcDive {
+			f.fetched = append(f.fetched, int(b))
+			f.out = append(f.out, f.slots[int(b)]...)
+			f.out = append(f.out, ostcReady)
+			f.command = 0
+			continue
+		}
+		f.out = append(f.out, b)
+		switch b {
+		case ostcInit:
+			f.out = append(f.out, ostcReady)
+		case ostcIdentity:
+			id := make([]byte, ostcIdentitySize)
+			copy(id, []byte{0x39, 0x30, 3, 8})
+			f.out = append(append(f.out, id...), ostcReady)
+		case ostcHeaders:
+			logbook := bytes.Repeat([]byte{0xff}, ostcSlots*ostcHeaderSize)
+			for slot, raw := range f.slots {
+				copy(logbook[slot*ostcHeaderSize:], raw[:ostcHeaderSize])
+			}
+			f.out = append(append(f.out, logbook...), ostcReady)
+		case ostcDive:
+			f.command = ostcDive
+		}
+	}
+	return len(p), nil
+}
+
+func (f *fakeOSTC) Read(p []byte) (int, error) {
+	if len(f.out) == 0 {
+		return 0, ErrTimeout
+	}
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+func (f *fakeOSTC) SetTimeout(time.Duration) error { return nil }
+func (f *fakeOSTC) Close() error                   { f.closed = true; return nil }
+
+func day(d, h, m int) time.Time { return time.Date(2024, 5, d, h, m, 0, 0, time.UTC) }
+
+// logbook is the fake computer's logbook, as recorded in testdata: dive 41
+// in the last slot and the two after it wrapped around to the first.
+func logbook() map[int][]byte {
+	return map[int][]byte{
+		255: ostcRaw(41, day(1, 9, 30), square(18, 3)),
+		0:   ostcRaw(42, day(1, 13, 5), square(30.5, 4)),
+		1:   ostcRaw(43, day(2, 8, 45), square(12, 2)),
+	}
+}
+
+func TestOSTCParse(t *testing.T) {
+	d, err := OSTC.Parse(ostcRaw(42, day(1, 13, 5), square(30.5, 4)), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Start.Equal(day(1, 13, 5)) || d.Duration != 4*time.Minute {
+		t.Errorf("Start, Duration = %v, %v", d.Start, d.Duration)
+	}
+	if d.MaxDepth != 30.5 || d.Salinity != 1030 || math.Abs(d.SurfacePressure.Bar()-1.013) > 1e-9 {
+		t.Errorf("MaxDepth, Salinity, SurfacePressure = %v, %v, %v", d.MaxDepth, d.Salinity, d.SurfacePressure)
+	}
+	if got := d.MinTemperature.Celsius(); math.Abs(got-25.6) > 1e-9 {
+		t.Errorf("MinTemperature = %.2f °C, want 25.6", got)
+	}
+	if len(d.Samples) != 24 || d.Samples[0].Time != 10*time.Second || d.Samples[0].Depth != 10.17 ||
+		d.Samples[23].Time != 4*time.Minute {
+		t.Fatalf("samples: %d, first %+v", len(d.Samples), d.Samples[0])
+	}
+	for i, s := range d.Samples {
+		if hasTemp := (i+1)%6 == 0; hasTemp != (s.Temperature != 0) {
+			t.Errorf("sample %d temperature %v", i, s.Temperature)
+		}
+	}
+	if got := d.Samples[5].Temperature.Celsius(); math.Abs(got-25.9) > 1e-9 {
+		t.Errorf("sample 5 temperature = %.2f °C, want 25.9", got)
+	}
+	wantTanks := []divelog.Tank{{Gas: mix(21, 0)}, {Gas: mix(50, 0)}}
+	if !reflect.DeepEqual(d.Tanks, wantTanks) {
+		t.Errorf("Tanks = %+v", d.Tanks)
+	}
+	wantEvents := []divelog.Event{{Time: 190 * time.Second, Kind: divelog.EventGasChange, Tank: 1}}
+	if !reflect.DeepEqual(d.Events, wantEvents) {
+		t.Errorf("Events = %+v, want %+v", d.Events, wantEvents)
+	}
+
+	raw := ostcRaw(42, day(1, 13, 5), square(30.5, 4))
+	bad := map[string][]byte{
+		"short":         raw[:100],
+		"no end marker": raw[:len(raw)-2],
+		"truncated":     raw[:len(raw)-20],
+		"bad version":   append([]byte(nil), raw...),
+		"bad gas":       append([]byte(nil), raw...),
+	}
+	bad["bad version"][ostcVersion] = 0x21
+	gasAt := bytes.Index(bad["bad gas"][ostcHeaderSize:], []byte{ostcGasChange, 2})
+	bad["bad gas"][ostcHeaderSize+gasAt+1] = 7
+	for name, raw := range bad {
+		if _, err := OSTC.Parse(raw, time.UTC); err == nil {
+			t.Errorf("%s: Parse succeeded", name)
+		}
+	}
+}
+
+// TestOSTCDownload downloads the recorded logbook. Run with -update to
+// record it again from the fake computer.
+func TestOSTCDownload(t *testing.T) {
+	if *update {
+		var rec bytes.Buffer
+		rec.WriteString("# ostc, serial 115200: dives 41 to 43, the logbook wrapped around\n")
+		if _, err := Download(Record(&fakeOSTC{slots: logbook()}, &rec), OSTC, time.UTC, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile("testdata/ostc.txt", rec.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open("testdata/ostc.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rp, err := NewReplay(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := Download(rp, OSTC, time.UTC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := log.Info
+	if rp.Remaining() != 0 {
+		t.Errorf("%d bytes of the recording left over", rp.Remaining())
+	}
+	if want := (&Info{Vendor: "Heinrichs Weikamp", Model: "OSTC", Serial: "12345", Firmware: "3.8"}); !reflect.DeepEqual(info, want) {
+		t.Errorf("Info = %+v, want %+v", info, want)
+	}
+	var starts []time.Time
+	for _, d := range log.Dives {
+		starts = append(starts, d.Start)
+		if len(d.Equipment) != 1 || d.Equipment[0] != info.Equipment() {
+			t.Errorf("dive at %v: Equipment = %+v", d.Start, d.Equipment)
+		}
+	}
+	if want := []time.Time{day(1, 9, 30), day(1, 13, 5), day(2, 8, 45)}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("dives start at %v, want oldest first %v", starts, want)
+	}
+	if want := OSTC.Fingerprint(logbook()[1]); log.Fingerprint != want {
+		t.Errorf("Fingerprint = %q, want dive 43's %q", log.Fingerprint, want)
+	}
+
+	// The next download reads only the dives after the last one.
+	f2 := &fakeOSTC{slots: logbook()}
+	f2.slots[2] = ostcRaw(44, day(3, 9, 0), square(20, 2))
+	known := map[string]string{info.Device(): log.Fingerprint}
+	log, err = Download(f2, OSTC, time.UTC, known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Dives) != 1 || !log.Dives[0].Start.Equal(day(3, 9, 0)) || !reflect.DeepEqual(f2.fetched, []int{2}) {
+		t.Errorf("incremental download read slots %v, got %d dives", f2.fetched, len(log.Dives))
+	}
+	if log.Fingerprint != OSTC.Fingerprint(f2.slots[2]) {
+		t.Errorf("incremental download Fingerprint = %q", log.Fingerprint)
+	}
+	log, err = Download(&fakeOSTC{slots: f2.slots}, OSTC, time.UTC, map[string]string{info.Device(): log.Fingerprint})
+	if err != nil || len(log.Dives) != 0 || log.Fingerprint != "" {
+		t.Errorf("download with nothing new: %v, %d dives, fingerprint %q", err, len(log.Dives), log.Fingerprint)
+	}
+	// A fingerprint the computer no longer has, overwritten when the
+	// logbook wrapped, reads everything.
+	log, err = Download(&fakeOSTC{slots: logbook()}, OSTC, time.UTC, map[string]string{info.Device(): "00"})
+	if err != nil || len(log.Dives) != 3 {
+		t.Errorf("download with an unknown fingerprint: %v, %d dives", err, len(log.Dives))
+	}
+
+	// A download that stops early hands back the callback's error.
+	stop := errors.New("stop")
+	n := 0
+	_, err = OSTC.Download(&fakeOSTC{slots: logbook()}, nil, func([]byte) error {
+		if n++; n == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 2 {
+		t.Errorf("stopped download: %v after %d dives", err, n)
+	}
+	silent, _ := NewReplay(strings.NewReader("> bb\n"))
+	if _, err := OSTC.Download(silent, nil, func([]byte) error { return nil }); !errors.Is(err, ErrTimeout) {
+		t.Errorf("download from a silent computer: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var rec bytes.Buffer
+	r := Record(&Replay{chunks: []chunk{
+		{host: true, data: []byte{1, 2}},
+		{data: append([]byte{9}, bytes.Repeat([]byte{0}, 40)...)},
+	}}, &rec)
+	r.Write([]byte{1})
+	r.Write([]byte{2})
+	buf := make([]byte, 100)
+	n, _ := r.Read(buf)
+	if err := r.Close(); err != nil || n != 41 {
+		t.Fatalf("recorded %d bytes: %v", n, err)
+	}
+	if want := "> 01\n> 02\n< 09 00*40\n"; rec.String() != want {
+		t.Errorf("recording:\n%s\nwant\n%s", rec.String(), want)
+	}
+
+	rp, err := NewReplay(strings.NewReader("# comment\n\n> 0102\n< 09 00*3\n< ff\n> 03\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.Read(buf); err != ErrTimeout {
+		t.Errorf("Read before the host wrote: %v, want ErrTimeout", err)
+	}
+	if _, err := rp.Write([]byte{1, 3}); err == nil {
+		t.Error("Write of the wrong bytes succeeded")
+	}
+	if _, err := rp.Write([]byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rp.Read(buf); !bytes.Equal(buf[:n], []byte{9, 0, 0, 0, 0xff}) {
+		t.Errorf("Read = %x", buf[:n])
+	}
+	if rp.Remaining() != 1 {
+		t.Errorf("Remaining = %d, want 1", rp.Remaining())
+	}
+
+	for _, bad := range []string{"? 01\n", "> 0g\n", "< 00*x\n", "< 0000*2\n"} {
+		if _, err := NewReplay(strings.NewReader(bad)); err == nil {
+			t.Errorf("NewReplay(%q) succeeded", bad)
+		}
+	}
+}
+
+// fakeGATT is a BLE connection that answers each write with notifications.
+type fakeGATT struct {
+	writes [][]byte
+	notify chan []byte
+}
+
+func (g *fakeGATT) Write(p []byte) error {
+	g.writes = append(g.writes, append([]byte(nil), p...))
+	return nil
+}
+func (g *fakeGATT) Notifications() <-chan []byte { return g.notify }
+func (g *fakeGATT) MTU() int                     { return 20 }
+func (g *fakeGATT) Close() error                 { close(g.notify); return nil }
+
+func TestBLE(t *testing.T) {
+	g := &fakeGATT{notify: make(chan []byte, 2)}
+	b := NewBLE(g)
+	b.SetTimeout(10 * time.Millisecond)
+	if n, err := b.Write(make([]byte, 45)); n != 45 || err != nil || len(g.writes) != 3 || len(g.writes[2]) != 5 {
+		t.Errorf("Write of 45 bytes: %d, %v in %d writes", n, err, len(g.writes))
+	}
+	g.notify <- []byte{1, 2, 3}
+	g.notify <- []byte{4}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(b, buf); err != nil || !bytes.Equal(buf, []byte{1, 2, 3, 4}) {
+		t.Errorf("read %x, %v", buf, err)
+	}
+	if _, err := b.Read(buf); err != ErrTimeout {
+		t.Errorf("Read with nothing sent: %v, want ErrTimeout", err)
+	}
+	b.Close()
+	if _, err := b.Read(buf); err == nil {
+		t.Error("Read after the connection dropped succeeded")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if d, err := Lookup("OSTC"); err != nil || d != OSTC {
+		t.Errorf("Lookup(OSTC) = %v, %v", d, err)
+	}
+	if _, err := Lookup("nemo"); err == nil || !strings.Contains(err.Error(), "ostc") {
+		t.Errorf("Lookup(nemo) error = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package dc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// HID is a Transport over a USB HID device, through a raw HID device
+// node such as Linux's /dev/hidraw0. Each Write goes out as one output
+// report; reads return the bytes of the input reports in turn.
+type HID struct {
+	f       *os.File
+	timeout time.Duration
+	pending []byte // the unread rest of the last input report
+
+	// ReportSize is the size of the device's reports, which writes are
+	// padded to. OpenHID sets it to 64, the size of full-speed USB
+	// interrupt transfers, which most computers use.
+	ReportSize int
+}
+
+// OpenHID opens the raw HID device node at path. FindHID finds the node
+// of a device by its USB IDs.
+func OpenHID(path string) (*HID, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &HID{f: f, ReportSize: 64}, nil
+}
+
+func (h *HID) Read(p []byte) (int, error) {
+	if len(h.pending) == 0 {
+		if h.timeout > 0 {
+			if err := h.f.SetReadDeadline(time.Now().Add(h.timeout)); err != nil {
+				return 0, err
+			}
+		}
+		report := make([]byte, h.ReportSize)
+		n, err := h.f.Read(report)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return 0, ErrTimeout
+		}
+		if err != nil {
+			return 0, err
+		}
+		h.pending = report[:n]
+	}
+	n := copy(p, h.pending)
+	h.pending = h.pending[n:]
+	return n, nil
+}
+
+// Write sends p as one output report. The device's reports are not
+// numbered, so the report goes out with report ID 0.
+func (h *HID) Write(p []byte) (int, error) {
+	if len(p) > h.ReportSize {
+		return 0, fmt.Errorf("%d bytes do not fit in a %d-byte report", len(p), h.ReportSize)
+	}
+	report := make([]byte, 1+h.ReportSize)
+	copy(report[1:], p)
+	if _, err := h.f.Write(report); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *HID) SetTimeout(d time.Duration) error {
+	h.timeout = d
+	if d == 0 {
+		return h.f.SetReadDeadline(time.Time{})
+	}
+	return nil
+}
+
+func (h *HID) Close() error { return h.f.Close() }
@@ -0,0 +1,36 @@
+package dc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindHID returns the hidraw device node of the first attached USB device
+// with the given vendor and product IDs.
+func FindHID(vendor, product uint16) (string, error) {
+	uevents, err := filepath.Glob("/sys/class/hidraw/*/device/uevent")
+	if err != nil {
+		return "", err
+	}
+	want := fmt.Sprintf("HID_ID=0003:%08X:%08X", vendor, product)
+	for _, path := range uevents {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		found := false
+		for sc.Scan() {
+			found = found || strings.EqualFold(sc.Text(), want)
+		}
+		f.Close()
+		if found {
+			// .../hidraw/hidrawN/device/uevent names /dev/hidrawN.
+			return "/dev/" + filepath.Base(filepath.Dir(filepath.Dir(path))), nil
+		}
+	}
+	return "", fmt.Errorf("no USB HID device %04x:%04x attached", vendor, product)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package dc
+
+import "errors"
+
+// FindHID would find a HID device node by USB IDs; it is only implemented
+// on Linux so far. Pass the node to OpenHID instead.
+func FindHID(vendor, product uint16) (string, error) { return "", errors.ErrUnsupported }
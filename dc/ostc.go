@@ -0,0 +1,369 @@
+package dc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// OSTC is the driver for heinrichs weikamp's OSTC computers running hwOS:
+// the OSTC 2, 3, 4, cR, Plus and Sport. They speak the same protocol over
+// their USB serial cable, at OSTCBaud, and over Bluetooth LE, and their
+// maker publishes both it and the logbook format.
+var OSTC Driver = ostc{}
+
+// OSTCBaud is the speed of an OSTC's serial port.
+const OSTCBaud = 115200
+
+// Commands. The computer echoes each command byte, then answers, then
+// sends ostcReady.
+const (
+	ostcInit     = 0xbb
+	ostcReady    = 0x4d
+	ostcExit     = 0xff
+	ostcIdentity = 0x69
+	ostcHeaders  = 0x61
+	ostcDive     = 0x66
+)
+
+// The logbook: ostcSlots headers of ostcHeaderSize bytes, framed by
+// 0xfafa and 0xfbfb. Unused slots are filled with 0xff. A dive is its
+// header followed by its profile, which ends with 0xfdfd.
+const (
+	ostcSlots        = 256
+	ostcHeaderSize   = 256
+	ostcIdentitySize = 64
+	ostcGases        = 5
+)
+
+// Offsets into a logbook header.
+const (
+	ostcVersion     = 8  // logbook format, 0x23 or 0x24
+	ostcLength      = 9  // profile length, 24 bits
+	ostcDate        = 12 // year-2000, month, day, hour, minute
+	ostcMaxDepth    = 17 // cm
+	ostcDiveTime    = 19 // minutes, 16 bits, then seconds
+	ostcTemperature = 22 // minimum, 0.1 °C, signed
+	ostcSurface     = 24 // mbar
+	ostcGasTable    = 28 // ostcGases × O2 %, He %, change depth, type
+	ostcSalinity    = 70 // water density, 100 to 104 for 1.00 to 1.04 kg/l
+	ostcAvgDepth    = 73 // cm
+	ostcNumber      = 80 // the computer's dive number, 16 bits
+)
+
+// Event flags of a profile sample.
+const (
+	ostcManualGas = 0x10 // followed by O2 % and He %
+	ostcGasChange = 0x20 // followed by the gas number, 1 to 5
+	ostcSetpoint  = 0x40 // followed by the setpoint
+	ostcEvent2    = 0x80 // followed by a second event byte
+	ostcBailout   = 0x01 // in the second byte: followed by O2 % and He %
+)
+
+// ostcTemperatureInfo is the kind of extended sample data that holds the
+// water temperature.
+const ostcTemperatureInfo = 0
+
+type ostc struct{}
+
+func (ostc) Name() string { return "ostc" }
+
+// Fingerprint hashes the dive's logbook header, which the computer keeps
+// in the logbook as well as at the start of the dive.
+func (ostc) Fingerprint(raw []byte) string {
+	sum := sha256.Sum256(raw[:min(len(raw), ostcHeaderSize)])
+	return hex.EncodeToString(sum[:])
+}
+
+func (o ostc) Download(t Transport, since func(*Info) string, fn func(raw []byte) error) (*Info, error) {
+	if err := t.SetTimeout(3 * time.Second); err != nil {
+		return nil, err
+	}
+	c := ostcConn{t}
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	id := make([]byte, ostcIdentitySize)
+	if err := c.command(ostcIdentity, nil, id); err != nil {
+		return nil, fmt.Errorf("reading identity: %w", err)
+	}
+	info := &Info{
+		Vendor:   "Heinrichs Weikamp",
+		Model:    "OSTC",
+		Serial:   strconv.Itoa(int(binary.LittleEndian.Uint16(id))),
+		Firmware: fmt.Sprintf("%d.%d", id[2], id[3]),
+	}
+
+	logbook := make([]byte, ostcSlots*ostcHeaderSize)
+	if err := c.command(ostcHeaders, nil, logbook); err != nil {
+		return info, fmt.Errorf("reading logbook: %w", err)
+	}
+	type entry struct {
+		slot, number int
+		header       []byte
+	}
+	var entries []entry
+	for slot := range ostcSlots {
+		h := logbook[slot*ostcHeaderSize:][:ostcHeaderSize]
+		if h[0] == 0xfa && h[1] == 0xfa {
+			entries = append(entries, entry{slot, int(binary.LittleEndian.Uint16(h[ostcNumber:])), h})
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return b.number - a.number })
+
+	var known string
+	if since != nil {
+		known = since(info)
+	}
+	for _, e := range entries {
+		if known != "" && o.Fingerprint(e.header) == known {
+			break
+		}
+		raw := make([]byte, ostcHeaderSize+int(le24(e.header[ostcLength:])))
+		if err := c.command(ostcDive, []byte{byte(e.slot)}, raw); err != nil {
+			return info, fmt.Errorf("reading dive %d: %w", e.number, err)
+		}
+		if !bytes.Equal(raw[:ostcHeaderSize], e.header) {
+			return info, fmt.Errorf("reading dive %d: header differs from the logbook's", e.number)
+		}
+		if err := fn(raw); err != nil {
+			return info, err
+		}
+	}
+	return info, c.exit()
+}
+
+// ostcConn frames the commands of an OSTC's protocol.
+type ostcConn struct{ t Transport }
+
+func (c ostcConn) init() error {
+	if _, err := c.t.Write([]byte{ostcInit}); err != nil {
+		return err
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(c.t, b[:]); err != nil {
+		return fmt.Errorf("no answer from the computer; is it in download mode? %w", err)
+	}
+	if b != [2]byte{ostcInit, ostcReady} {
+		return fmt.Errorf("computer answered %x to the handshake, want %x", b, []byte{ostcInit, ostcReady})
+	}
+	return nil
+}
+
+// command sends cmd and in, and reads the answer into out.
+func (c ostcConn) command(cmd byte, in, out []byte) error {
+	if _, err := c.t.Write([]byte{cmd}); err != nil {
+		return err
+	}
+	var b [1]byte
+	if _, err := io.ReadFull(c.t, b[:]); err != nil {
+		return err
+	}
+	if b[0] != cmd {
+		return fmt.Errorf("computer echoed %#x to command %#x", b[0], cmd)
+	}
+	if len(in) > 0 {
+		if _, err := c.t.Write(in); err != nil {
+			return err
+		}
+	}
+	if _, err := io.ReadFull(c.t, out); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c.t, b[:]); err != nil {
+		return err
+	}
+	if b[0] != ostcReady {
+		return fmt.Errorf("computer sent %#x after command %#x, want ready", b[0], cmd)
+	}
+	return nil
+}
+
+// exit ends the session, returning the computer to its surface mode.
+func (c ostcConn) exit() error {
+	if _, err := c.t.Write([]byte{ostcExit}); err != nil {
+		return err
+	}
+	var b [1]byte
+	_, err := io.ReadFull(c.t, b[:])
+	return err
+}
+
+var errOSTCShort = errors.New("profile ends early")
+
+func (ostc) Parse(raw []byte, loc *time.Location) (*divelog.Dive, error) {
+	if len(raw) < ostcHeaderSize+5 {
+		return nil, errors.New("dive too short")
+	}
+	h := raw[:ostcHeaderSize]
+	if h[0] != 0xfa || h[1] != 0xfa || h[254] != 0xfb || h[255] != 0xfb {
+		return nil, errors.New("not an OSTC logbook header")
+	}
+	if v := h[ostcVersion]; v != 0x23 && v != 0x24 {
+		return nil, fmt.Errorf("unsupported logbook format %#x", v)
+	}
+	date := h[ostcDate:]
+	if date[1] < 1 || date[1] > 12 || date[2] < 1 || date[2] > 31 || date[3] > 23 || date[4] > 59 {
+		return nil, fmt.Errorf("invalid date %x", date[:5])
+	}
+	d := &divelog.Dive{
+		Start:           time.Date(2000+int(date[0]), time.Month(date[1]), int(date[2]), int(date[3]), int(date[4]), 0, 0, loc),
+		Duration:        time.Duration(binary.LittleEndian.Uint16(h[ostcDiveTime:]))*time.Minute + time.Duration(h[ostcDiveTime+2])*time.Second,
+		MaxDepth:        divelog.Depth(float64(binary.LittleEndian.Uint16(h[ostcMaxDepth:])) / 100),
+		AvgDepth:        divelog.Depth(float64(binary.LittleEndian.Uint16(h[ostcAvgDepth:])) / 100),
+		MinTemperature:  divelog.Celsius(float64(int16(binary.LittleEndian.Uint16(h[ostcTemperature:]))) / 10),
+		SurfacePressure: divelog.Bar(float64(binary.LittleEndian.Uint16(h[ostcSurface:])) / 1000),
+	}
+	if s := h[ostcSalinity]; s >= 100 && s <= 104 {
+		d.Salinity = divelog.Salinity(float64(s) * 10)
+	}
+
+	// Tanks are added as the dive uses their gases, the first gas first.
+	tanks := map[divelog.GasMix]int{}
+	tank := func(mix divelog.GasMix) int {
+		if i, ok := tanks[mix]; ok {
+			return i
+		}
+		tanks[mix] = len(d.Tanks)
+		d.Tanks = append(d.Tanks, divelog.Tank{Gas: mix})
+		return tanks[mix]
+	}
+	gas := func(n int) (divelog.GasMix, error) {
+		if n < 1 || n > ostcGases {
+			return divelog.GasMix{}, fmt.Errorf("switch to gas %d", n)
+		}
+		g := h[ostcGasTable+4*(n-1):]
+		return mix(g[0], g[1]), nil
+	}
+	first := 1
+	for n := 1; n <= ostcGases; n++ {
+		if h[ostcGasTable+4*(n-1)+3] == 1 {
+			first = n
+		}
+	}
+	if m, err := gas(first); err == nil && m.O2 > 0 {
+		tank(m)
+	}
+
+	p := raw[ostcHeaderSize:]
+	if le24(p) != le24(h[ostcLength:]) {
+		return nil, errors.New("profile length differs from the header's")
+	}
+	rate := time.Duration(p[3]) * time.Second
+	if rate == 0 {
+		return nil, errors.New("sample rate of zero")
+	}
+	type info struct{ kind, size, divisor byte }
+	infos := make([]info, p[4])
+	off := 5
+	for i := range infos {
+		if off+3 > len(p) {
+			return nil, errOSTCShort
+		}
+		infos[i] = info{p[off], p[off+1], p[off+2]}
+		off += 3
+	}
+
+	for n := 1; ; n++ {
+		if off+2 > len(p) {
+			return nil, errOSTCShort
+		}
+		if p[off] == 0xfd && p[off+1] == 0xfd {
+			break
+		}
+		if off+3 > len(p) {
+			return nil, errOSTCShort
+		}
+		s := divelog.Sample{Time: time.Duration(n) * rate, Depth: divelog.Depth(float64(binary.LittleEndian.Uint16(p[off:])) / 100)}
+		flags := p[off+2]
+		extra := int(flags & 0x7f)
+		off += 3
+		if off+extra > len(p) {
+			return nil, errOSTCShort
+		}
+		b := &byteReader{b: p[off : off+extra]}
+		off += extra
+
+		if flags&0x80 != 0 {
+			ev := b.next()
+			switchTo := func(m divelog.GasMix) {
+				d.Events = append(d.Events, divelog.Event{Time: s.Time, Kind: divelog.EventGasChange, Tank: tank(m)})
+			}
+			if ev&ostcManualGas != 0 {
+				switchTo(mix(b.next(), b.next()))
+			}
+			if ev&ostcGasChange != 0 {
+				m, err := gas(int(b.next()))
+				if err != nil {
+					return nil, fmt.Errorf("sample %d: %w", n, err)
+				}
+				switchTo(m)
+			}
+			if ev&ostcSetpoint != 0 {
+				b.next()
+			}
+			if ev&ostcEvent2 != 0 && b.next()&ostcBailout != 0 {
+				switchTo(mix(b.next(), b.next()))
+			}
+		}
+		for _, in := range infos {
+			if in.divisor == 0 || n%int(in.divisor) != 0 {
+				continue
+			}
+			data := b.take(int(in.size))
+			if in.kind == ostcTemperatureInfo && len(data) >= 2 {
+				s.Temperature = divelog.Celsius(float64(int16(binary.LittleEndian.Uint16(data))) / 10)
+			}
+		}
+		if b.short {
+			return nil, fmt.Errorf("sample %d: %w", n, errOSTCShort)
+		}
+		d.Samples = append(d.Samples, s)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// mix returns the gas of oxygen and helium percentages.
+func mix(o2, he byte) divelog.GasMix {
+	return divelog.GasMix{O2: float64(o2) / 100, He: float64(he) / 100}
+}
+
+// byteReader reads a sample's extra bytes, noting when it runs out.
+type byteReader struct {
+	b     []byte
+	short bool
+}
+
+func (r *byteReader) next() byte {
+	if len(r.b) == 0 {
+		r.short = true
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *byteReader) take(n int) []byte {
+	if n > len(r.b) {
+		r.short = true
+		n = len(r.b)
+	}
+	data := r.b[:n]
+	r.b = r.b[n:]
+	return data
+}
+
+func le24(b []byte) uint32 { return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 }
@@ -0,0 +1,210 @@
+package dc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A recording is the conversation between a host and a dive computer as
+// text: lines starting with ">" hold bytes the host wrote, lines starting
+// with "<" bytes the computer sent. The bytes are written in hex, except
+// that "xx*n" stands for n bytes xx, which keeps dumps of mostly empty
+// memory short. Blank lines and lines starting with "#" are comments.
+// Recordings make bug reports from computers the developers do not have,
+// and tests.
+//
+//	# ostc, serial 115200
+//	> bb
+//	< bb4d
+//	> 61
+//	< 61 fafa0000 00*250 fbfb ff*65280
+
+// Recorder is a Transport that records the conversation on another.
+type Recorder struct {
+	t   Transport
+	w   io.Writer
+	err error
+}
+
+// Record returns a Transport that passes everything through to t and
+// writes a recording of it to w.
+func Record(t Transport, w io.Writer) *Recorder { return &Recorder{t: t, w: w} }
+
+func (r *Recorder) Read(p []byte) (int, error) {
+	n, err := r.t.Read(p)
+	r.log('<', p[:n])
+	return n, err
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.t.Write(p)
+	r.log('>', p[:n])
+	return n, err
+}
+
+// log writes b as lines of at most 32 bytes, writing runs of 16 or more
+// equal bytes as one.
+func (r *Recorder) log(dir byte, b []byte) {
+	var line []string
+	literal := 0
+	flush := func() {
+		if len(line) > 0 && r.err == nil {
+			_, r.err = fmt.Fprintf(r.w, "%c %s\n", dir, strings.Join(line, " "))
+		}
+		line, literal = nil, 0
+	}
+	for len(b) > 0 {
+		run := 1
+		for run < len(b) && b[run] == b[0] {
+			run++
+		}
+		if run >= 16 {
+			line = append(line, fmt.Sprintf("%02x*%d", b[0], run))
+			b = b[run:]
+			flush()
+			continue
+		}
+		// Take bytes up to the next long run.
+		n := 0
+		for n < len(b) && literal+n < 32 {
+			run := 1
+			for n+run < len(b) && b[n+run] == b[n] {
+				run++
+			}
+			if run >= 16 {
+				break
+			}
+			n += min(run, 32-literal-n)
+		}
+		line = append(line, hex.EncodeToString(b[:n]))
+		b = b[n:]
+		if literal += n; literal == 32 {
+			flush()
+		}
+	}
+	flush()
+}
+
+func (r *Recorder) SetTimeout(d time.Duration) error { return r.t.SetTimeout(d) }
+
+// Close closes the underlying transport. It reports a failure to write
+// the recording if there was one.
+func (r *Recorder) Close() error {
+	if err := r.t.Close(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// Replay is a Transport that plays the computer's part in a recorded
+// conversation. Writes must match what the host wrote in the recording;
+// reads return what the computer sent, and time out where the computer
+// was waiting for the host.
+type Replay struct {
+	chunks []chunk
+}
+
+type chunk struct {
+	host bool // written by the host, not the computer
+	data []byte
+}
+
+// NewReplay reads a recording.
+func NewReplay(r io.Reader) (*Replay, error) {
+	rp := &Replay{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] != '<' && line[0] != '>' {
+			return nil, fmt.Errorf("line %d: want < or >", n)
+		}
+		data, err := decodeLine(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		host := line[0] == '>'
+		// Join chunks going the same way: how the bytes were split into
+		// reads and writes does not matter.
+		if k := len(rp.chunks); k > 0 && rp.chunks[k-1].host == host {
+			rp.chunks[k-1].data = append(rp.chunks[k-1].data, data...)
+		} else {
+			rp.chunks = append(rp.chunks, chunk{host, data})
+		}
+	}
+	return rp, sc.Err()
+}
+
+// decodeLine decodes the bytes of a line of a recording.
+func decodeLine(s string) ([]byte, error) {
+	var data []byte
+	for _, field := range strings.Fields(s) {
+		if b, count, ok := strings.Cut(field, "*"); ok {
+			n, err := strconv.Atoi(count)
+			v, err2 := hex.DecodeString(b)
+			if err != nil || err2 != nil || n < 0 || len(v) != 1 {
+				return nil, fmt.Errorf("invalid run %q", field)
+			}
+			data = append(data, bytes.Repeat(v, n)...)
+			continue
+		}
+		b, err := hex.DecodeString(field)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+func (rp *Replay) Read(p []byte) (int, error) {
+	if len(rp.chunks) == 0 || rp.chunks[0].host {
+		return 0, ErrTimeout
+	}
+	c := &rp.chunks[0]
+	n := copy(p, c.data)
+	if c.data = c.data[n:]; len(c.data) == 0 {
+		rp.chunks = rp.chunks[1:]
+	}
+	return n, nil
+}
+
+func (rp *Replay) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(rp.chunks) == 0 || !rp.chunks[0].host {
+			return n, fmt.Errorf("replay: host wrote %x where the recording has the computer talking", p[n:])
+		}
+		c := &rp.chunks[0]
+		k := min(len(c.data), len(p)-n)
+		if !bytes.Equal(p[n:n+k], c.data[:k]) {
+			return n, fmt.Errorf("replay: host wrote %x, recording has %x", p[n:n+k], c.data[:k])
+		}
+		n += k
+		if c.data = c.data[k:]; len(c.data) == 0 {
+			rp.chunks = rp.chunks[1:]
+		}
+	}
+	return n, nil
+}
+
+// Remaining returns the number of bytes of the recording not yet played.
+func (rp *Replay) Remaining() int {
+	n := 0
+	for _, c := range rp.chunks {
+		n += len(c.data)
+	}
+	return n
+}
+
+func (rp *Replay) SetTimeout(time.Duration) error { return nil }
+
+func (rp *Replay) Close() error { return nil }
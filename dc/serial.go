@@ -0,0 +1,54 @@
+package dc
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// Serial is a Transport over a serial port, the way most dive computers
+// with a USB cable connect: the cable holds a USB to serial converter.
+type Serial struct {
+	f       *os.File
+	timeout time.Duration
+}
+
+// OpenSerial opens the serial port at path, such as /dev/ttyUSB0, and
+// sets it to baud bits per second, 8 data bits, no parity and one stop
+// bit.
+func OpenSerial(path string, baud int) (*Serial, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|oNoCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := configure(f, baud); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "configure", Path: path, Err: err}
+	}
+	return &Serial{f: f}, nil
+}
+
+func (s *Serial) Read(p []byte) (int, error) {
+	if s.timeout > 0 {
+		if err := s.f.SetReadDeadline(time.Now().Add(s.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.f.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = ErrTimeout
+	}
+	return n, err
+}
+
+func (s *Serial) Write(p []byte) (int, error) { return s.f.Write(p) }
+
+func (s *Serial) SetTimeout(d time.Duration) error {
+	s.timeout = d
+	if d == 0 {
+		return s.f.SetReadDeadline(time.Time{})
+	}
+	return nil
+}
+
+func (s *Serial) Close() error { return s.f.Close() }
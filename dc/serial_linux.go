@@ -0,0 +1,64 @@
+package dc
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const oNoCTTY = syscall.O_NOCTTY
+
+// cbaud masks the speed bits of the control flags. syscall does not
+// define it; this is its value on all but a few older architectures.
+const cbaud = 0x100f
+
+var baudRates = map[int]uint32{
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+	460800: syscall.B460800,
+}
+
+// configure puts the terminal f in raw mode at baud, 8N1. The descriptor
+// is reached through SyscallConn so that f stays non-blocking and read
+// deadlines keep working.
+func configure(f *os.File, baud int) error {
+	speed, ok := baudRates[baud]
+	if !ok {
+		return fmt.Errorf("unsupported speed %d", baud)
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = rc.Control(func(fd uintptr) {
+		var t syscall.Termios
+		if ioctlErr = ioctl(fd, syscall.TCGETS, &t); ioctlErr != nil {
+			return
+		}
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+			syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		t.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.CSTOPB | cbaud
+		t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL | speed
+		t.Cc[syscall.VMIN], t.Cc[syscall.VTIME] = 1, 0
+		ioctlErr = ioctl(fd, syscall.TCSETS, &t)
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func ioctl(fd uintptr, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
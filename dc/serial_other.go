@@ -0,0 +1,14 @@
+//go:build !linux
+
+package dc
+
+import (
+	"errors"
+	"os"
+)
+
+const oNoCTTY = 0
+
+// configure would set up the serial port; it is only implemented on
+// Linux so far.
+func configure(*os.File, int) error { return errors.ErrUnsupported }
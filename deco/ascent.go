@@ -0,0 +1,116 @@
+package deco
+
+import (
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// maxStop bounds the time spent at any one stop, so that a gas the tissues
+// cannot off-gas on does not hold the ascent forever.
+const maxStop = 24 * time.Hour
+
+// Gas is a gas that may be switched to on the ascent once the diver is at
+// or above Depth.
+type Gas struct {
+	Mix   divelog.GasMix
+	Depth divelog.Depth
+}
+
+// Ascent takes the model from depth to the surface, breathing gas and
+// switching to the richest of gases usable at each stop, and returns the
+// travel and stop segments. m is left in the state it would be on
+// surfacing.
+//
+// A diver still within the no-decompression limit ascends directly.
+// Otherwise the first stop is where the ceiling at GFLow is reached; the
+// gradient factor then rises along a straight line to GFHigh at the
+// surface. Each stop lasts until the ceiling at the next one clears.
+func (m *Model) Ascent(depth divelog.Depth, gas divelog.GasMix, gases []Gas) []Segment {
+	var segs []Segment
+	add := func(s Segment) {
+		m.Step(s)
+		if n := len(segs); n > 0 && s.IsStop() && segs[n-1].IsStop() &&
+			segs[n-1].From == s.From && segs[n-1].Source == s.Source {
+			segs[n-1].Duration += s.Duration
+			return
+		}
+		segs = append(segs, s)
+	}
+
+	deco := m.InDeco()
+	var stopped time.Duration
+	source := 0
+	for depth > 0 {
+		source = bestGas(gas, source, gases, depth)
+		if source > 0 {
+			gas = gases[source-1].Mix
+		}
+		next := m.nextStop(depth)
+		travel := Segment{From: depth, To: next, Duration: m.travel(depth, next), Gas: gas, Source: source}
+		if deco && stopped < maxStop && !m.clears(travel) {
+			if m.anchor <= m.surface {
+				m.anchorAt(m.ambient(depth))
+			}
+			add(Segment{From: depth, To: depth, Duration: time.Minute, Gas: gas, Source: source})
+			stopped += time.Minute
+			continue
+		}
+		add(travel)
+		depth, stopped = next, 0
+	}
+	return segs
+}
+
+// TTS returns the time the ascent from depth would take, stops included,
+// without changing m.
+func (m *Model) TTS(depth divelog.Depth, gas divelog.GasMix, gases []Gas) time.Duration {
+	var total time.Duration
+	for _, s := range m.Clone().Ascent(depth, gas, gases) {
+		total += s.Duration
+	}
+	return total
+}
+
+// clears reports whether the ceiling would be no deeper than the end of s
+// once it has been swum. Before the first stop is fixed the ceiling is
+// taken at GFLow.
+func (m *Model) clears(s Segment) bool {
+	c := m.Clone()
+	c.Step(s)
+	p := c.ambient(s.To)
+	gf := c.p.GFLow
+	if c.anchor > c.surface {
+		gf = c.gf(p)
+	}
+	return c.tolerated(gf) <= p
+}
+
+// nextStop returns the next stop depth above depth, or zero for the
+// surface.
+func (m *Model) nextStop(depth divelog.Depth) divelog.Depth {
+	const eps = 1e-6
+	n := divelog.Depth(int((depth-eps)/m.p.StopInterval)) * m.p.StopInterval
+	if n < m.p.LastStop-eps {
+		return 0
+	}
+	return n
+}
+
+// travel returns the time to ascend from one depth to another.
+func (m *Model) travel(from, to divelog.Depth) time.Duration {
+	return time.Duration(float64(from-to) / float64(m.p.AscentRate) * float64(time.Minute))
+}
+
+// bestGas returns the source, as in Segment, of the gas with the most
+// oxygen among current, breathed from source, and those of gases usable at
+// depth.
+func bestGas(current divelog.GasMix, source int, gases []Gas, depth divelog.Depth) int {
+	const eps = 1e-6
+	for i, g := range gases {
+		if g.Depth+eps >= depth && g.Mix.O2 > current.O2 {
+			current, source = g.Mix, i+1
+		}
+	}
+	return source
+}
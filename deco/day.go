@@ -0,0 +1,114 @@
+package deco
+
+import (
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// DayBreak is the surface interval that separates dive days. Dives closer
+// together than this are chained, each starting with the loading left by
+// the one before; after a longer interval the tissues are taken as
+// saturated at the surface again.
+const DayBreak = 24 * time.Hour
+
+// Days groups dives into dive days by their start times. The dives in
+// each day, and the days themselves, are in order of start time.
+func Days(dives []*divelog.Dive) [][]*divelog.Dive {
+	dives = slices.Clone(dives)
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+	var days [][]*divelog.Dive
+	for i, d := range dives {
+		if i == 0 || interval(dives[i-1], d) >= DayBreak {
+			days = append(days, nil)
+		}
+		days[len(days)-1] = append(days[len(days)-1], d)
+	}
+	return days
+}
+
+// interval returns the surface interval between the end of prev and the
+// start of d, zero if they overlap.
+func interval(prev, d *divelog.Dive) time.Duration {
+	return max(d.Start.Sub(prev.Start.Add(prev.Duration)), 0)
+}
+
+// Repetitive is a dive of a dive day replayed from the loading the dives
+// before it left.
+type Repetitive struct {
+	Dive *divelog.Dive
+
+	// Interval is the surface interval since the previous dive of the
+	// day, zero for the first.
+	Interval time.Duration
+
+	// Start and StartLoading are the tissues at the start of the dive, as
+	// returned by Model.Tissues and Model.Loading.
+	Start        [Compartments]Tissue
+	StartLoading [Compartments]float64
+
+	// NDL is the no-decompression limit at the start of the dive for its
+	// maximum depth on the gas of its first tank, and CleanNDL the same
+	// limit for a diver with no residual nitrogen.
+	NDL, CleanNDL time.Duration
+
+	// Result is the replayed dive. Starts leaves it nil.
+	Result *Result
+}
+
+// Leading returns the compartment with the highest loading at the start
+// of the dive, counting from 0, and that loading.
+func (r *Repetitive) Leading() (compartment int, loading float64) {
+	for i, l := range r.StartLoading {
+		if l > loading {
+			compartment, loading = i, l
+		}
+	}
+	return compartment, loading
+}
+
+// Chain replays dives in order of start time with a model using p,
+// carrying the tissues over surface intervals within each dive day.
+func Chain(dives []*divelog.Dive, p Params) ([]Repetitive, error) {
+	return chain(dives, p, true)
+}
+
+// Starts is Chain for callers that only need each dive's starting
+// tissues, NDL and interval: it carries the tissues through the dives
+// without working out the ceiling, NDL and TTS at every sample.
+func Starts(dives []*divelog.Dive, p Params) ([]Repetitive, error) {
+	return chain(dives, p, false)
+}
+
+func chain(dives []*divelog.Dive, p Params, replay bool) ([]Repetitive, error) {
+	clean, err := New(p)
+	if err != nil {
+		return nil, err
+	}
+	var res []Repetitive
+	for _, day := range Days(dives) {
+		m := clean.Clone()
+		for i, d := range day {
+			r := Repetitive{Dive: d}
+			if i > 0 {
+				r.Interval = interval(day[i-1], d)
+				m.SurfaceInterval(r.Interval)
+			}
+			m.SetConditions(d.Surface(), d.Water())
+			r.Start, r.StartLoading = m.Tissues(), m.Loading()
+			gas := tankGas(d, 0)
+			r.NDL = m.NDL(d.MaxDepth, gas)
+			fresh := clean.Clone()
+			fresh.SetConditions(d.Surface(), d.Water())
+			r.CleanNDL = fresh.NDL(d.MaxDepth, gas)
+			if replay {
+				r.Result = m.Replay(d)
+			} else {
+				m.walk(d, nil)
+			}
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,318 @@
+// Package deco implements the Bühlmann ZHL-16C decompression model with
+// gradient factors.
+//
+// A Model tracks the inert gas loading of the sixteen tissue compartments
+// as it is taken through a dive, either segment by segment with Step or
+// from a logged profile with Replay. From the loading it derives the
+// ceiling, the no-decompression limit and the time to surface.
+//
+// Everything in the package is deterministic: the same dive and Params
+// always give the same results. Stop times are whole minutes and stop
+// depths multiples of Params.StopInterval, as on a dive computer.
+package deco
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// waterVapour is the alveolar water vapour pressure, in bar, used by
+// Bühlmann.
+const waterVapour = 0.0627
+
+// MaxNDL is the longest no-decompression limit reported; dives that would
+// never need a stop get MaxNDL.
+const MaxNDL = 5 * time.Hour
+
+// Params configures a Model. Zero fields take their value from
+// DefaultParams.
+type Params struct {
+	// GFLow and GFHigh are the gradient factors, as fractions of the
+	// Bühlmann M-value. GFLow applies at the first stop and GFHigh at
+	// the surface.
+	GFLow, GFHigh float64
+
+	// AscentRate and DescentRate are in metres per minute. AscentRate is
+	// used when working out stops; DescentRate only when a dive without
+	// samples is replayed.
+	AscentRate  divelog.Depth
+	DescentRate divelog.Depth
+
+	// StopInterval is the spacing of stops and LastStop the depth of the
+	// shallowest one.
+	StopInterval divelog.Depth
+	LastStop     divelog.Depth
+
+	// MaxPPO2 is the oxygen partial pressure, in bar, below which a
+	// dive's other tanks are assumed usable on the ascent.
+	MaxPPO2 float64
+}
+
+// DefaultParams are the values used for zero Params fields.
+var DefaultParams = Params{
+	GFLow:        0.30,
+	GFHigh:       0.85,
+	AscentRate:   9,
+	DescentRate:  18,
+	StopInterval: 3,
+	LastStop:     3,
+	MaxPPO2:      1.6,
+}
+
+func (p Params) withDefaults() Params {
+	d := DefaultParams
+	if p.GFLow == 0 {
+		p.GFLow = d.GFLow
+	}
+	if p.GFHigh == 0 {
+		p.GFHigh = d.GFHigh
+	}
+	if p.AscentRate == 0 {
+		p.AscentRate = d.AscentRate
+	}
+	if p.DescentRate == 0 {
+		p.DescentRate = d.DescentRate
+	}
+	if p.StopInterval == 0 {
+		p.StopInterval = d.StopInterval
+	}
+	if p.LastStop == 0 {
+		p.LastStop = d.LastStop
+	}
+	if p.MaxPPO2 == 0 {
+		p.MaxPPO2 = d.MaxPPO2
+	}
+	return p
+}
+
+// Validate reports whether p describes a usable model.
+func (p Params) Validate() error {
+	var errs []error
+	if p.GFLow < 0 || p.GFLow > 1.5 || p.GFHigh < 0 || p.GFHigh > 1.5 {
+		errs = append(errs, fmt.Errorf("gradient factors must be between 0 and 150%%"))
+	}
+	if p.GFLow > p.GFHigh {
+		errs = append(errs, fmt.Errorf("GF low %.0f%% is above GF high %.0f%%", p.GFLow*100, p.GFHigh*100))
+	}
+	if p.AscentRate < 0 || p.DescentRate < 0 {
+		errs = append(errs, fmt.Errorf("rates must be positive"))
+	}
+	if p.StopInterval < 0 || p.LastStop < 0 {
+		errs = append(errs, fmt.Errorf("stop depths must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Tissue is the inert gas loading of one compartment.
+type Tissue struct {
+	N2 divelog.Pressure
+	He divelog.Pressure
+}
+
+// Segment is a stretch of a dive at a constant rate of depth change on one
+// gas. A stop is a segment whose From and To are equal.
+type Segment struct {
+	From, To divelog.Depth
+	Duration time.Duration
+	Gas      divelog.GasMix
+
+	// Source tells which gas an ascent breathes on s: zero for the gas it
+	// started on, i+1 for the gases[i] passed to Ascent. It tells apart
+	// gases with the same mix.
+	Source int
+}
+
+// IsStop reports whether s is spent at a constant depth.
+func (s Segment) IsStop() bool { return s.From == s.To }
+
+// Model is the state of the ZHL-16C tissues. The zero value is not usable;
+// create models with New.
+type Model struct {
+	p       Params
+	surface float64 // surface pressure in bar
+	water   divelog.Salinity
+	n2, he  [Compartments]float64
+
+	// anchor is the ambient pressure, in bar, at which GFLow applies: the
+	// deepest first stop or GFLow ceiling seen. It is zero until then.
+	anchor float64
+}
+
+// New returns a model for a diver who has been breathing air at sea level
+// long enough for the tissues to be saturated.
+func New(p Params) (*Model, error) {
+	p = p.withDefaults()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Model{p: p}
+	m.SetConditions(divelog.StandardAtmosphere, divelog.SaltWater)
+	for i := range m.n2 {
+		m.n2[i] = (m.surface - waterVapour) * divelog.Air.N2()
+	}
+	return m, nil
+}
+
+// Params returns the model's parameters, with defaults filled in.
+func (m *Model) Params() Params { return m.p }
+
+// SetConditions sets the surface pressure and water density used to turn
+// depths into ambient pressures. It does not change the tissues.
+func (m *Model) SetConditions(surface divelog.Pressure, water divelog.Salinity) {
+	m.surface = surface.Bar()
+	m.water = water
+}
+
+// Clone returns an independent copy of m.
+func (m *Model) Clone() *Model {
+	c := *m
+	return &c
+}
+
+// Tissues returns the current loading of each compartment.
+func (m *Model) Tissues() [Compartments]Tissue {
+	var t [Compartments]Tissue
+	for i := range t {
+		t[i] = Tissue{N2: divelog.Bar(m.n2[i]), He: divelog.Bar(m.he[i])}
+	}
+	return t
+}
+
+// Loading returns each compartment's inert gas pressure as a fraction of
+// its M-value at the surface. Values above 1 mean surfacing now would
+// exceed the unmodified Bühlmann limit.
+func (m *Model) Loading() [Compartments]float64 {
+	var l [Compartments]float64
+	for i := range l {
+		a, b := m.coefficients(i)
+		l[i] = (m.n2[i] + m.he[i]) / (m.surface/b + a)
+	}
+	return l
+}
+
+// ambient returns the ambient pressure at d in bar.
+func (m *Model) ambient(d divelog.Depth) float64 {
+	return m.water.AmbientPressure(max(d, 0), divelog.Bar(m.surface)).Bar()
+}
+
+// depth returns the depth at which the ambient pressure is p bar.
+func (m *Model) depth(p float64) divelog.Depth {
+	return max(m.water.DepthAt(divelog.Bar(p), divelog.Bar(m.surface)), 0)
+}
+
+// Step takes the tissues through s using the Schreiner equation, which is
+// exact for a linear change of depth.
+func (m *Model) Step(s Segment) {
+	t := s.Duration.Minutes()
+	if t <= 0 {
+		return
+	}
+	p0 := m.ambient(s.From) - waterVapour
+	rate := (m.ambient(s.To) - m.ambient(s.From)) / t
+	n2, he := s.Gas.N2(), s.Gas.He
+	for i, c := range zhl16c {
+		m.n2[i] = schreiner(m.n2[i], p0*n2, rate*n2, c.n2Half, t)
+		m.he[i] = schreiner(m.he[i], p0*he, rate*he, c.heHalf, t)
+	}
+}
+
+// schreiner returns the tissue pressure after t minutes, starting from p
+// with an inspired pressure of pi changing by r bar per minute.
+func schreiner(p, pi, r, half, t float64) float64 {
+	k := math.Ln2 / half
+	return pi + r*(t-1/k) - (pi-p-r/k)*math.Exp(-k*t)
+}
+
+// coefficients returns compartment i's a and b, weighted by the current
+// nitrogen and helium loadings.
+func (m *Model) coefficients(i int) (a, b float64) {
+	c := zhl16c[i]
+	n2, he := m.n2[i], m.he[i]
+	if n2+he == 0 {
+		return c.n2A, c.n2B
+	}
+	a = (c.n2A*n2 + c.heA*he) / (n2 + he)
+	b = (c.n2B*n2 + c.heB*he) / (n2 + he)
+	return a, b
+}
+
+// tolerated returns the lowest ambient pressure, in bar, every compartment
+// tolerates at gradient factor gf.
+func (m *Model) tolerated(gf float64) float64 {
+	var tol float64
+	for i := range zhl16c {
+		a, b := m.coefficients(i)
+		p := m.n2[i] + m.he[i]
+		tol = max(tol, (p-a*gf)/(gf/b+1-gf))
+	}
+	return tol
+}
+
+// gf returns the gradient factor that applies at ambient pressure p, on
+// the line from GFLow at the anchor to GFHigh at the surface.
+func (m *Model) gf(p float64) float64 {
+	switch {
+	case m.anchor <= m.surface:
+		return m.p.GFHigh
+	case p >= m.anchor:
+		return m.p.GFLow
+	}
+	return m.p.GFHigh + (m.p.GFLow-m.p.GFHigh)*(p-m.surface)/(m.anchor-m.surface)
+}
+
+// ceilingPressure returns the shallowest ambient pressure, in bar, the
+// tissues tolerate with the gradient factor varying along the GF line.
+func (m *Model) ceilingPressure() float64 {
+	if m.tolerated(m.p.GFHigh) <= m.surface {
+		return m.surface
+	}
+	lo, hi := m.surface, max(m.tolerated(m.p.GFLow), m.anchor)
+	// Bisect to well under a centimetre; the loop count is fixed so the
+	// result does not depend on the starting interval's rounding.
+	for range 40 {
+		mid := (lo + hi) / 2
+		if mid >= m.tolerated(m.gf(mid)) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
+
+// Ceiling returns the shallowest depth the diver may ascend to now.
+func (m *Model) Ceiling() divelog.Depth {
+	return m.depth(m.ceilingPressure())
+}
+
+// InDeco reports whether a direct ascent to the surface would break the
+// ceiling at GFHigh.
+func (m *Model) InDeco() bool {
+	return m.tolerated(m.p.GFHigh) > m.surface
+}
+
+// NDL returns how much longer the diver could stay at depth on gas and
+// still ascend directly to the surface. It is zero once a stop is needed
+// and MaxNDL if none ever would be. It is accurate to the minute.
+func (m *Model) NDL(depth divelog.Depth, gas divelog.GasMix) time.Duration {
+	if m.InDeco() {
+		return 0
+	}
+	c := m.Clone()
+	for t := time.Duration(0); t < MaxNDL; t += time.Minute {
+		c.Step(Segment{From: depth, To: depth, Duration: time.Minute, Gas: gas})
+		if c.InDeco() {
+			return t
+		}
+	}
+	return MaxNDL
+}
+
+// anchorAt moves the GFLow anchor down to ambient pressure p.
+func (m *Model) anchorAt(p float64) {
+	m.anchor = max(m.anchor, p)
+}
@@ -0,0 +1,371 @@
+package deco
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+var ean50 = divelog.GasMix{O2: 0.50}
+
+func newModel(t *testing.T, gfLow, gfHigh float64) *Model {
+	t.Helper()
+	m, err := New(Params{GFLow: gfLow, GFHigh: gfHigh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// closedFormNDL solves the Haldane equation for each compartment to find
+// when a diver breathing air at a constant depth, from saturation at the
+// surface, first reaches the surfacing limit at gf.
+func closedFormNDL(depth divelog.Depth, gf float64) time.Duration {
+	surface := divelog.StandardAtmosphere.Bar()
+	amb := divelog.SaltWater.AmbientPressure(depth, divelog.StandardAtmosphere).Bar()
+	p0 := (surface - waterVapour) * divelog.Air.N2()
+	pi := (amb - waterVapour) * divelog.Air.N2()
+	best := math.Inf(1)
+	for _, c := range zhl16c {
+		limit := surface*(gf/c.n2B+1-gf) + c.n2A*gf
+		if pi <= limit {
+			continue
+		}
+		k := math.Ln2 / c.n2Half
+		best = min(best, -math.Log((limit-pi)/(p0-pi))/k)
+	}
+	if math.IsInf(best, 1) {
+		return MaxNDL
+	}
+	return time.Duration(math.Floor(best)) * time.Minute
+}
+
+func TestNDL(t *testing.T) {
+	tests := []struct {
+		depth  divelog.Depth
+		gfHigh float64
+		want   time.Duration
+	}{
+		{6, 1, MaxNDL},
+		{12, 1, 177 * time.Minute},
+		{18, 1, 58 * time.Minute},
+		{21, 1, 40 * time.Minute},
+		{24, 1, 28 * time.Minute},
+		{30, 1, 16 * time.Minute},
+		{40, 1, 8 * time.Minute},
+		{18, 0.85, 42 * time.Minute},
+		{30, 0.85, 12 * time.Minute},
+		{30, 0.70, 8 * time.Minute},
+	}
+	for _, tt := range tests {
+		m := newModel(t, 0.3, tt.gfHigh)
+		got := m.NDL(tt.depth, divelog.Air)
+		if got != tt.want {
+			t.Errorf("NDL at %v m, GF high %.2f = %v, want %v", tt.depth, tt.gfHigh, got, tt.want)
+		}
+		if ref := closedFormNDL(tt.depth, tt.gfHigh); got != ref {
+			t.Errorf("NDL at %v m, GF high %.2f = %v, closed form gives %v", tt.depth, tt.gfHigh, got, ref)
+		}
+	}
+}
+
+func TestSchreinerMatchesSmallSteps(t *testing.T) {
+	gas := divelog.GasMix{O2: 0.21, He: 0.35}
+	exact := newModel(t, 1, 1)
+	exact.Step(Segment{From: 0, To: 60, Duration: 3 * time.Minute, Gas: gas})
+
+	// Approximate the descent with constant-depth Haldane steps.
+	steps := newModel(t, 1, 1)
+	const n = 3000
+	dt := 3 * time.Minute / n
+	for i := range n {
+		d := divelog.Depth(60 * (float64(i) + 0.5) / n)
+		steps.Step(Segment{From: d, To: d, Duration: dt, Gas: gas})
+	}
+	a, b := exact.Tissues(), steps.Tissues()
+	for i := range a {
+		if math.Abs(a[i].N2.Bar()-b[i].N2.Bar()) > 1e-4 || math.Abs(a[i].He.Bar()-b[i].He.Bar()) > 1e-4 {
+			t.Errorf("compartment %d: Schreiner %+v, small steps %+v", i+1, a[i], b[i])
+		}
+	}
+}
+
+// bottom takes m to depth at 18 m/min on gas and keeps it there until
+// runtime.
+func bottom(m *Model, depth divelog.Depth, runtime time.Duration, gas divelog.GasMix) {
+	down := time.Duration(float64(depth) / 18 * float64(time.Minute))
+	m.Step(Segment{From: 0, To: depth, Duration: down, Gas: gas})
+	m.Step(Segment{From: depth, To: depth, Duration: runtime - down, Gas: gas})
+}
+
+func TestAscent(t *testing.T) {
+	type stop struct {
+		depth divelog.Depth
+		min   int
+		gas   string
+	}
+	tests := []struct {
+		name          string
+		depth         divelog.Depth
+		runtime       time.Duration
+		gfLow, gfHigh float64
+		gases         []Gas
+		want          []stop
+	}{
+		{
+			name: "no stop", depth: 18, runtime: 30 * time.Minute, gfLow: 0.3, gfHigh: 0.85,
+			want: nil,
+		},
+		{
+			name: "air only", depth: 45, runtime: 25 * time.Minute, gfLow: 0.3, gfHigh: 0.85,
+			want: []stop{{21, 1, "air"}, {15, 2, "air"}, {12, 3, "air"}, {9, 5, "air"}, {6, 9, "air"}, {3, 21, "air"}},
+		},
+		{
+			name: "EAN50 from 21 m", depth: 45, runtime: 25 * time.Minute, gfLow: 0.3, gfHigh: 0.85,
+			gases: []Gas{{Mix: ean50, Depth: 21}},
+			want:  []stop{{21, 1, "EAN50"}, {15, 1, "EAN50"}, {12, 2, "EAN50"}, {9, 3, "EAN50"}, {6, 5, "EAN50"}, {3, 11, "EAN50"}},
+		},
+		{
+			name: "GF 100/100", depth: 45, runtime: 25 * time.Minute, gfLow: 1, gfHigh: 1,
+			want: []stop{{9, 2, "air"}, {6, 6, "air"}, {3, 16, "air"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newModel(t, tt.gfLow, tt.gfHigh)
+			bottom(m, tt.depth, tt.runtime, divelog.Air)
+			var got []stop
+			for _, s := range m.Ascent(tt.depth, divelog.Air, tt.gases) {
+				if s.IsStop() {
+					got = append(got, stop{s.From, int(s.Duration / time.Minute), s.Gas.String()})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stops = %v, want %v", got, tt.want)
+			}
+			if m.InDeco() {
+				t.Error("still in deco after the ascent")
+			}
+		})
+	}
+}
+
+func TestTTSFollowsGradientFactors(t *testing.T) {
+	tts := func(gfLow, gfHigh float64) time.Duration {
+		m := newModel(t, gfLow, gfHigh)
+		bottom(m, 40, 30*time.Minute, divelog.Air)
+		return m.TTS(40, divelog.Air, nil)
+	}
+	if a, b := tts(1, 1), tts(0.5, 0.8); a >= b {
+		t.Errorf("TTS at GF 100/100 = %v, not shorter than at 50/80 = %v", a, b)
+	}
+	if a, b := tts(0.5, 0.8), tts(0.3, 0.7); a >= b {
+		t.Errorf("TTS at GF 50/80 = %v, not shorter than at 30/70 = %v", a, b)
+	}
+}
+
+// diveFromSegments turns segments into a sampled dive, one sample every
+// ten seconds.
+func diveFromSegments(segs []Segment, tanks ...divelog.GasMix) *divelog.Dive {
+	d := &divelog.Dive{Start: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+	for _, g := range tanks {
+		d.Tanks = append(d.Tanks, divelog.Tank{Gas: g})
+	}
+	d.Samples = []divelog.Sample{{}}
+	var at time.Duration
+	for _, s := range segs {
+		if len(tanks) > 1 && s.Gas != d.Tanks[0].Gas && len(d.Events) == 0 {
+			d.Events = append(d.Events, divelog.Event{Time: at, Kind: divelog.EventGasChange, Tank: 1})
+		}
+		for t := 10 * time.Second; t <= s.Duration; t += 10 * time.Second {
+			f := float64(t) / float64(s.Duration)
+			d.Samples = append(d.Samples, divelog.Sample{
+				Time:  at + t,
+				Depth: s.From + divelog.Depth(f)*(s.To-s.From),
+			})
+		}
+		at += s.Duration
+	}
+	d.Summarize()
+	return d
+}
+
+func TestReplay(t *testing.T) {
+	descent := []Segment{
+		{From: 0, To: 45, Duration: 150 * time.Second, Gas: divelog.Air},
+		{From: 45, To: 45, Duration: 1350 * time.Second, Gas: divelog.Air},
+	}
+	m := newModel(t, 0.3, 0.85)
+	for _, s := range descent {
+		m.Step(s)
+	}
+	planned := append(descent, m.Ascent(45, divelog.Air, []Gas{{Mix: ean50, Depth: 21}})...)
+	rushed := append(descent, Segment{From: 45, To: 0, Duration: 5 * time.Minute, Gas: divelog.Air})
+
+	tests := []struct {
+		name       string
+		dive       *divelog.Dive
+		violations int
+	}{
+		{"planned ascent", diveFromSegments(planned, divelog.Air, ean50), 0},
+		{"rushed ascent", diveFromSegments(rushed, divelog.Air), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Audit(tt.dive, Params{GFLow: 0.3, GFHigh: 0.85})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Points) != len(tt.dive.Samples) {
+				t.Fatalf("%d points for %d samples", len(res.Points), len(tt.dive.Samples))
+			}
+			if len(res.Violations) != tt.violations {
+				t.Errorf("violations = %+v, want %d", res.Violations, tt.violations)
+			}
+			if res.MaxCeiling < 15 || res.MaxCeiling > 25 {
+				t.Errorf("MaxCeiling = %v, want about 20 m", res.MaxCeiling)
+			}
+			first := res.Points[1]
+			if first.NDL == 0 || first.Ceiling != 0 {
+				t.Errorf("early point = %+v, want NDL and no ceiling", first)
+			}
+			last := res.Points[len(res.Points)-1]
+			if last.Depth != 0 || last.TTS != 0 {
+				t.Errorf("final point = %+v, want surfaced", last)
+			}
+
+			again, _ := Audit(tt.dive, Params{GFLow: 0.3, GFHigh: 0.85})
+			if !reflect.DeepEqual(res, again) {
+				t.Error("replaying the same dive twice gave different results")
+			}
+		})
+	}
+}
+
+func TestReplayGasChange(t *testing.T) {
+	segs := []Segment{
+		{From: 0, To: 40, Duration: 2 * time.Minute, Gas: divelog.Air},
+		{From: 40, To: 40, Duration: 20 * time.Minute, Gas: divelog.Air},
+		{From: 40, To: 6, Duration: 4 * time.Minute, Gas: divelog.Air},
+		{From: 6, To: 6, Duration: 10 * time.Minute, Gas: divelog.Oxygen},
+	}
+	withO2 := diveFromSegments(segs, divelog.Air, divelog.Oxygen)
+	airOnly := withO2.Clone()
+	airOnly.Events = nil
+
+	a, _ := Audit(withO2, Params{})
+	b, _ := Audit(airOnly, Params{})
+	if a.Points[len(a.Points)-1].Gas != divelog.Oxygen {
+		t.Errorf("gas at the end = %v, want oxygen", a.Points[len(a.Points)-1].Gas)
+	}
+	if a.Tissues[0].N2 >= b.Tissues[0].N2 {
+		t.Errorf("fastest compartment after O2 stop = %v, not below air-only %v", a.Tissues[0].N2, b.Tissues[0].N2)
+	}
+}
+
+func TestReplayWithoutSamples(t *testing.T) {
+	d := &divelog.Dive{MaxDepth: 30, Duration: 40 * time.Minute}
+	res, err := Audit(d, Params{GFLow: 1, GFHigh: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Points) != 4 || res.MaxCeiling == 0 {
+		t.Errorf("square profile: %d points, max ceiling %v", len(res.Points), res.MaxCeiling)
+	}
+}
+
+func TestLoadingAndSurfaceInterval(t *testing.T) {
+	m := newModel(t, 1, 1)
+	for _, l := range m.Loading() {
+		if l <= 0 || l >= 1 {
+			t.Fatalf("loading at saturation = %v", m.Loading())
+		}
+	}
+	bottom(m, 30, 20*time.Minute, divelog.Air)
+	loaded := m.Loading()
+	m.SurfaceInterval(6 * time.Hour)
+	rested := m.Loading()
+	for i := range loaded {
+		if rested[i] >= loaded[i] {
+			t.Errorf("compartment %d: loading %v after 6 h, not below %v", i+1, rested[i], loaded[i])
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	day := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	dive := func(n int, start time.Time) *divelog.Dive {
+		return &divelog.Dive{Number: n, Start: start, MaxDepth: 18, Duration: 40 * time.Minute}
+	}
+	dives := []*divelog.Dive{
+		dive(3, day.Add(7*24*time.Hour)),
+		dive(2, day.Add(100*time.Minute)),
+		dive(1, day),
+	}
+	if days := Days(dives); len(days) != 2 || len(days[0]) != 2 || days[0][0].Number != 1 {
+		t.Fatalf("Days = %v", days)
+	}
+
+	p := Params{GFLow: 0.3, GFHigh: 0.85}
+	res, err := Chain(dives, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("Chain returned %d dives", len(res))
+	}
+	first, second, later := res[0], res[1], res[2]
+	if first.Dive.Number != 1 || first.Interval != 0 || first.NDL != first.CleanNDL {
+		t.Errorf("first dive = %+v", first)
+	}
+	if second.Interval != time.Hour {
+		t.Errorf("surface interval = %v, want 1h", second.Interval)
+	}
+	if second.NDL >= second.CleanNDL {
+		t.Errorf("repetitive NDL = %v, not below the first dive's %v", second.NDL, second.CleanNDL)
+	}
+	if later.Interval != 0 || later.NDL != later.CleanNDL {
+		t.Errorf("a week later: %+v, want a clean start", later)
+	}
+
+	// The second dive starts with what the first left, off-gassed over the
+	// interval.
+	m := newModel(t, 0.3, 0.85)
+	m.Replay(dive(1, day))
+	m.SurfaceInterval(time.Hour)
+	if second.Start != m.Tissues() {
+		t.Errorf("second dive starts with %v, want %v", second.Start, m.Tissues())
+	}
+	if c, l := second.Leading(); l <= 0 || l != second.StartLoading[c] {
+		t.Errorf("Leading = %d, %v", c, l)
+	}
+	alone, _ := Audit(dive(2, day), p)
+	if second.Result.Points[1].NDL >= alone.Points[1].NDL {
+		t.Errorf("NDL on reaching the bottom = %v chained, %v alone", second.Result.Points[1].NDL, alone.Points[1].NDL)
+	}
+
+	starts, err := Starts(dives, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range starts {
+		if r.Result != nil || r.Start != res[i].Start || r.NDL != res[i].NDL || r.Interval != res[i].Interval {
+			t.Errorf("Starts[%d] = %+v, Chain gave %+v", i, r, res[i])
+		}
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	for _, p := range []Params{
+		{GFLow: 0.9, GFHigh: 0.7},
+		{GFLow: 0.3, GFHigh: 2},
+		{GFLow: 0.3, GFHigh: 0.8, AscentRate: -9},
+	} {
+		if _, err := New(p); err == nil {
+			t.Errorf("New(%+v) succeeded", p)
+		}
+	}
+}
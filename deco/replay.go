@@ -0,0 +1,165 @@
+package deco
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// Point is the model's state at one sample of a replayed dive.
+type Point struct {
+	Time    time.Duration
+	Depth   divelog.Depth
+	Gas     divelog.GasMix
+	Ceiling divelog.Depth
+
+	// NDL is zero while a stop is needed; TTS includes any stops, using
+	// the dive's other tanks where their oxygen allows.
+	NDL time.Duration
+	TTS time.Duration
+
+	// Loading is each compartment's loading as returned by
+	// Model.Loading.
+	Loading [Compartments]float64
+}
+
+// Violation is a stretch of a dive spent shallower than the ceiling.
+type Violation struct {
+	Start, End time.Duration
+
+	// Excess is how far above the ceiling the diver went at worst.
+	Excess divelog.Depth
+}
+
+// Result is the outcome of replaying a dive.
+type Result struct {
+	Points     []Point
+	Violations []Violation
+	MaxCeiling divelog.Depth
+
+	// Tissues is the loading at the end of the dive.
+	Tissues [Compartments]Tissue
+}
+
+// Audit replays d through a new model with parameters p.
+func Audit(d *divelog.Dive, p Params) (*Result, error) {
+	m, err := New(p)
+	if err != nil {
+		return nil, err
+	}
+	return m.Replay(d), nil
+}
+
+// Replay takes the model through d's profile, leaving it in the state it
+// is in at the end of the dive. The tissues are not reset first, so
+// replaying dives in turn, with surface intervals in between, accounts
+// for residual nitrogen.
+//
+// Gas changes follow the dive's gas change events, starting on the first
+// tank. A dive without samples is replayed as a square profile to its
+// maximum depth.
+func (m *Model) Replay(d *divelog.Dive) *Result {
+	m.SetConditions(d.Surface(), d.Water())
+	m.anchor = 0
+	var gases []Gas
+	for _, t := range d.Tanks {
+		if t.Gas.O2 > 0 {
+			gases = append(gases, Gas{Mix: t.Gas, Depth: m.depth(m.p.MaxPPO2 / t.Gas.O2)})
+		}
+	}
+
+	res := &Result{}
+	var open *Violation
+	m.walk(d, func(s divelog.Sample, gas divelog.GasMix) {
+		if tol := m.tolerated(m.p.GFLow); tol > m.surface {
+			m.anchorAt(tol)
+		}
+		p := Point{
+			Time:    s.Time,
+			Depth:   s.Depth,
+			Gas:     gas,
+			Ceiling: m.Ceiling(),
+			NDL:     m.NDL(s.Depth, gas),
+			TTS:     m.TTS(s.Depth, gas, gases),
+			Loading: m.Loading(),
+		}
+		res.Points = append(res.Points, p)
+		res.MaxCeiling = max(res.MaxCeiling, p.Ceiling)
+
+		if excess := p.Ceiling - p.Depth; excess > 0 {
+			if open == nil {
+				res.Violations = append(res.Violations, Violation{Start: s.Time})
+				open = &res.Violations[len(res.Violations)-1]
+			}
+			open.End = s.Time
+			open.Excess = max(open.Excess, excess)
+		} else {
+			open = nil
+		}
+	})
+	res.Tissues = m.Tissues()
+	return res
+}
+
+// walk sets d's conditions and takes the model through its profile,
+// following its gas changes, calling visit at each sample with the gas
+// breathed on reaching it.
+func (m *Model) walk(d *divelog.Dive, visit func(s divelog.Sample, gas divelog.GasMix)) {
+	m.SetConditions(d.Surface(), d.Water())
+	events := slices.Clone(d.Events)
+	slices.SortStableFunc(events, func(a, b divelog.Event) int { return cmp.Compare(a.Time, b.Time) })
+
+	gas := tankGas(d, 0)
+	prev := divelog.Sample{}
+	for i, s := range m.profile(d) {
+		for len(events) > 0 && events[0].Time <= prev.Time {
+			if events[0].Kind == divelog.EventGasChange {
+				gas = tankGas(d, events[0].Tank)
+			}
+			events = events[1:]
+		}
+		if i > 0 || s.Time > 0 {
+			m.Step(Segment{From: prev.Depth, To: s.Depth, Duration: s.Time - prev.Time, Gas: gas})
+		}
+		if visit != nil {
+			visit(s, gas)
+		}
+		prev = s
+	}
+}
+
+// SurfaceInterval takes the model through time spent breathing air at the
+// surface.
+func (m *Model) SurfaceInterval(d time.Duration) {
+	m.Step(Segment{Duration: d, Gas: divelog.Air})
+}
+
+// tankGas returns the gas in d's tank i, or air if there is no such tank.
+func tankGas(d *divelog.Dive, i int) divelog.GasMix {
+	if i < 0 || i >= len(d.Tanks) || d.Tanks[i].Gas.O2 == 0 {
+		return divelog.Air
+	}
+	return d.Tanks[i].Gas
+}
+
+// profile returns d's samples, or for a dive logged without them a square
+// profile: descent at DescentRate, the rest of the dive at MaxDepth and an
+// ascent at AscentRate.
+func (m *Model) profile(d *divelog.Dive) []divelog.Sample {
+	if len(d.Samples) > 0 || d.MaxDepth <= 0 || d.Duration <= 0 {
+		return d.Samples
+	}
+	rate := func(r divelog.Depth) time.Duration {
+		return time.Duration(float64(d.MaxDepth) / float64(r) * float64(time.Minute))
+	}
+	down, up := rate(m.p.DescentRate), rate(m.p.AscentRate)
+	bottom := max(d.Duration-up, down)
+	return []divelog.Sample{
+		{Time: 0},
+		{Time: down, Depth: d.MaxDepth},
+		{Time: bottom, Depth: d.MaxDepth},
+		{Time: bottom + up},
+	}
+}
@@ -0,0 +1,316 @@
+package divelog
+
+import (
+	"slices"
+	"time"
+)
+
+// Dive is a single logged dive.
+type Dive struct {
+	// Number is the dive's position in the log. It is assigned by the
+	// store when a dive is first saved and never changes afterwards.
+	Number int `json:"number"`
+
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	MaxDepth Depth         `json:"max_depth"`
+	AvgDepth Depth         `json:"avg_depth,omitempty"`
+
+	// MinTemperature is the coldest water temperature seen on the dive.
+	MinTemperature Temperature `json:"min_temperature,omitempty"`
+
+	// SurfacePressure and Salinity describe the conditions needed to turn
+	// depth into ambient pressure. Zero values mean sea level and salt
+	// water; use Surface and Water to read them with defaults applied.
+	SurfacePressure Pressure `json:"surface_pressure,omitempty"`
+	Salinity        Salinity `json:"salinity,omitempty"`
+
+	Site      *Site       `json:"site,omitempty"`
+	Buddies   []Buddy     `json:"buddies,omitempty"`
+	Tanks     []Tank      `json:"tanks,omitempty"`
+	Equipment []Equipment `json:"equipment,omitempty"`
+	Samples   []Sample    `json:"samples,omitempty"`
+	Events    []Event     `json:"events,omitempty"`
+	Tags      []string    `json:"tags,omitempty"`
+	Rating    int         `json:"rating,omitempty"`
+	Notes     string      `json:"notes,omitempty"`
+
+	// Computer is the dive computer that recorded Samples and Events,
+	// when that is known.
+	Computer *Equipment `json:"computer,omitempty"`
+
+	// Profiles are the profiles other computers worn on the dive
+	// recorded, such as a backup's. Analytics use Samples, the primary
+	// profile; SetPrimary swaps one of these in.
+	Profiles []Profile `json:"profiles,omitempty"`
+
+	// Training is set on dives made as part of a course.
+	Training *Training `json:"training,omitempty"`
+
+	// Signatures vouch for the dive as it was when signed. Changing the
+	// dive in any way invalidates them.
+	Signatures []Signature `json:"signatures,omitempty"`
+}
+
+// Sample is one point of a dive profile.
+type Sample struct {
+	// Time is the offset from the start of the dive.
+	Time  time.Duration `json:"time"`
+	Depth Depth         `json:"depth"`
+
+	// Temperature and Pressure are zero when the computer did not record
+	// them for this sample. Pressure is the pressure in Tanks[Tank].
+	Temperature Temperature `json:"temperature,omitempty"`
+	Pressure    Pressure    `json:"pressure,omitempty"`
+	Tank        int         `json:"tank,omitempty"`
+}
+
+// EventKind identifies the type of an Event.
+type EventKind string
+
+const (
+	// EventGasChange marks a switch to breathing from Event.Tank.
+	EventGasChange EventKind = "gaschange"
+	EventBookmark  EventKind = "bookmark"
+	EventAscent    EventKind = "ascent"
+	EventDecoStop  EventKind = "deco"
+	EventViolation EventKind = "violation"
+)
+
+// Event is something that happened at a point in a dive.
+type Event struct {
+	Time time.Duration `json:"time"`
+	Kind EventKind     `json:"kind"`
+	Tank int           `json:"tank,omitempty"`
+	Text string        `json:"text,omitempty"`
+}
+
+// Tank is a cylinder breathed from on a dive.
+type Tank struct {
+	Description string `json:"description,omitempty"`
+
+	// Volume is the water capacity of the cylinder.
+	Volume          Volume   `json:"volume,omitempty"`
+	WorkingPressure Pressure `json:"working_pressure,omitempty"`
+	StartPressure   Pressure `json:"start_pressure,omitempty"`
+	EndPressure     Pressure `json:"end_pressure,omitempty"`
+	Gas             GasMix   `json:"gas"`
+
+	// Fill records how the tank was blended, if that is known.
+	Fill *Fill `json:"fill,omitempty"`
+}
+
+// FillMethod is how a tank was blended.
+type FillMethod string
+
+const (
+	FillPartialPressure FillMethod = "partial-pressure"
+	FillContinuousFlow  FillMethod = "continuous-flow"
+	FillTopUp           FillMethod = "top-up"
+)
+
+// Fill is the blending record of a tank: what it held before, the
+// pressure it was drained to and each gas then added, in order.
+type Fill struct {
+	Method   FillMethod `json:"method"`
+	Start    Pressure   `json:"start"`
+	StartMix GasMix     `json:"start_mix"`
+	Drain    Pressure   `json:"drain"`
+	Steps    []FillStep `json:"steps"`
+}
+
+// FillStep is one gas added to a tank, filling it to pressure To.
+type FillStep struct {
+	Gas GasMix   `json:"gas"`
+	To  Pressure `json:"to"`
+}
+
+// ImperialCylinder returns the water capacity of a cylinder rated, in the
+// imperial fashion, by the free gas volume it holds at its working
+// pressure; an AL80 is ImperialCylinder(77.4, PSI(3000)).
+func ImperialCylinder(capacity Volume, working Pressure) Volume {
+	return Volume(float64(capacity) * float64(StandardAtmosphere) / float64(working))
+}
+
+// RatedCapacity is the inverse of ImperialCylinder: the free gas volume the
+// tank holds when filled to its working pressure. It is zero if either the
+// volume or the working pressure is unknown.
+func (t Tank) RatedCapacity() Volume {
+	if t.WorkingPressure == 0 {
+		return 0
+	}
+	return Volume(float64(t.Volume) * float64(t.WorkingPressure) / float64(StandardAtmosphere))
+}
+
+// Coordinates is a WGS84 position in decimal degrees.
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// EntryType is how a site is reached.
+type EntryType string
+
+const (
+	EntryShore EntryType = "shore"
+	EntryBoat  EntryType = "boat"
+)
+
+// Site is a place dived. Stores that keep a registry of sites give each
+// one an ID; a dive at a registered site carries a copy of it with that
+// ID.
+type Site struct {
+	ID      int          `json:"id,omitempty"`
+	Name    string       `json:"name"`
+	Coords  *Coordinates `json:"coords,omitempty"`
+	Country string       `json:"country,omitempty"`
+	Region  string       `json:"region,omitempty"`
+
+	// MaxDepth is the deepest the site goes, not the deepest dive there.
+	MaxDepth Depth     `json:"max_depth,omitempty"`
+	Entry    EntryType `json:"entry,omitempty"`
+	Notes    string    `json:"notes,omitempty"`
+}
+
+// Clone returns a deep copy of s, or nil if s is nil.
+func (s *Site) Clone() *Site {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if s.Coords != nil {
+		coords := *s.Coords
+		c.Coords = &coords
+	}
+	return &c
+}
+
+// Buddy roles.
+const (
+	RoleBuddy      = "buddy"
+	RoleInstructor = "instructor"
+	RoleGuide      = "guide"
+	RoleStudent    = "student"
+)
+
+// Buddy is someone who dived with the log's owner.
+type Buddy struct {
+	Name string `json:"name"`
+	Role string `json:"role,omitempty"`
+}
+
+// EquipmentKind is the category of a piece of equipment.
+type EquipmentKind string
+
+const (
+	Regulator EquipmentKind = "regulator"
+	BCD       EquipmentKind = "bcd"
+	Computer  EquipmentKind = "computer"
+	Cylinder  EquipmentKind = "cylinder"
+	Drysuit   EquipmentKind = "drysuit"
+	Wetsuit   EquipmentKind = "wetsuit"
+	Light     EquipmentKind = "light"
+	Other     EquipmentKind = "other"
+)
+
+// Equipment is a piece of gear used on a dive.
+type Equipment struct {
+	Kind   EquipmentKind `json:"kind"`
+	Name   string        `json:"name"`
+	Serial string        `json:"serial,omitempty"`
+}
+
+// Surface returns the dive's surface pressure, defaulting to one standard
+// atmosphere.
+func (d *Dive) Surface() Pressure {
+	if d.SurfacePressure == 0 {
+		return StandardAtmosphere
+	}
+	return d.SurfacePressure
+}
+
+// Water returns the dive's salinity, defaulting to salt water.
+func (d *Dive) Water() Salinity {
+	if d.Salinity == 0 {
+		return SaltWater
+	}
+	return d.Salinity
+}
+
+// End returns the time the dive ended.
+func (d *Dive) End() time.Time { return d.Start.Add(d.Duration) }
+
+// HasTag reports whether the dive is tagged with tag.
+func (d *Dive) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns a deep copy of d.
+func (d *Dive) Clone() *Dive {
+	c := *d
+	c.Site = d.Site.Clone()
+	if d.Training != nil {
+		t := *d.Training
+		c.Training = &t
+	}
+	c.Buddies = slices.Clone(d.Buddies)
+	c.Tanks = slices.Clone(d.Tanks)
+	for i, t := range c.Tanks {
+		if t.Fill != nil {
+			fill := *t.Fill
+			fill.Steps = slices.Clone(fill.Steps)
+			c.Tanks[i].Fill = &fill
+		}
+	}
+	c.Equipment = slices.Clone(d.Equipment)
+	c.Samples = slices.Clone(d.Samples)
+	c.Events = slices.Clone(d.Events)
+	c.Tags = slices.Clone(d.Tags)
+	if d.Computer != nil {
+		dc := *d.Computer
+		c.Computer = &dc
+	}
+	c.Profiles = slices.Clone(d.Profiles)
+	for i, p := range c.Profiles {
+		c.Profiles[i].Samples = slices.Clone(p.Samples)
+		c.Profiles[i].Events = slices.Clone(p.Events)
+	}
+	c.Signatures = slices.Clone(d.Signatures)
+	return &c
+}
+
+// Summarize recomputes Duration, MaxDepth, AvgDepth and MinTemperature from
+// the profile. It does nothing if the dive has no samples, so summaries
+// entered by hand are kept.
+func (d *Dive) Summarize() {
+	if len(d.Samples) == 0 {
+		return
+	}
+	var maxDepth Depth
+	var minTemp Temperature
+	var area float64
+	for i, s := range d.Samples {
+		maxDepth = max(maxDepth, s.Depth)
+		if s.Temperature != 0 && (minTemp == 0 || s.Temperature < minTemp) {
+			minTemp = s.Temperature
+		}
+		if i > 0 {
+			p := d.Samples[i-1]
+			area += float64(p.Depth+s.Depth) / 2 * (s.Time - p.Time).Seconds()
+		}
+	}
+	last := d.Samples[len(d.Samples)-1].Time
+	d.Duration = last
+	d.MaxDepth = maxDepth
+	if last > 0 {
+		d.AvgDepth = Depth(area / last.Seconds())
+	}
+	if minTemp != 0 {
+		d.MinTemperature = minTemp
+	}
+}
@@ -0,0 +1,280 @@
+package divelog
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func validDive() *Dive {
+	return &Dive{
+		Start:    time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		Duration: 3 * time.Minute,
+		MaxDepth: 20,
+		Tanks:    []Tank{{Volume: Liters(12), Gas: Air}},
+		Samples: []Sample{
+			{Time: 0, Depth: 0},
+			{Time: time.Minute, Depth: 20, Temperature: Celsius(18), Pressure: Bar(190)},
+			{Time: 2 * time.Minute, Depth: 20, Temperature: Celsius(17), Pressure: Bar(170)},
+			{Time: 3 * time.Minute, Depth: 0},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Dive)
+		field  string
+	}{
+		{"valid", func(*Dive) {}, ""},
+		{"time goes backwards", func(d *Dive) { d.Samples[2].Time = 30 * time.Second }, "samples[2].time"},
+		{"repeated time", func(d *Dive) { d.Samples[2].Time = d.Samples[1].Time }, "samples[2].time"},
+		{"negative sample depth", func(d *Dive) { d.Samples[1].Depth = -1 }, "samples[1].depth"},
+		{"negative max depth", func(d *Dive) { d.MaxDepth = -3 }, "max_depth"},
+		{"hypoxic overflow", func(d *Dive) { d.Tanks[0].Gas = GasMix{O2: 0.5, He: 0.6} }, "tanks[0].gas"},
+		{"no oxygen", func(d *Dive) { d.Tanks[0].Gas = GasMix{} }, "tanks[0].gas"},
+		{"pressure without tank", func(d *Dive) { d.Samples[1].Tank = 3 }, "samples[1].tank"},
+		{"bad latitude", func(d *Dive) { d.Site = &Site{Name: "x", Coords: &Coordinates{Lat: 91}} }, "site.coords"},
+		{"unknown entry", func(d *Dive) { d.Site = &Site{Name: "x", Entry: "jetty"} }, "site.entry"},
+		{"training without course", func(d *Dive) { d.Training = &Training{Dive: "deep"} }, "training.course"},
+		{"empty profile", func(d *Dive) { d.Profiles = []Profile{{Computer: Equipment{Name: "Zoop"}}} }, "profiles[0].samples"},
+		{"profile time goes backwards", func(d *Dive) { d.Profiles = []Profile{{Samples: []Sample{{Time: 2}, {Time: 1}}}} }, "profiles[0].samples[1].time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := validDive()
+			tt.mutate(d)
+			err := d.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("Validate() = %v, want *ValidationError", err)
+			}
+			if ve.Field != tt.field {
+				t.Errorf("field = %q, want %q", ve.Field, tt.field)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	d := validDive()
+	d.MaxDepth = 0
+	d.Summarize()
+	if d.MaxDepth != 20 {
+		t.Errorf("MaxDepth = %v, want 20", d.MaxDepth)
+	}
+	if d.Duration != 3*time.Minute {
+		t.Errorf("Duration = %v, want 3m", d.Duration)
+	}
+	// Trapezoid area: 10 + 20 + 10 metre-minutes over 3 minutes.
+	if math.Abs(float64(d.AvgDepth)-40.0/3) > 1e-9 {
+		t.Errorf("AvgDepth = %v, want %v", d.AvgDepth, 40.0/3)
+	}
+	if got := d.MinTemperature.Celsius(); math.Abs(got-17) > 1e-9 {
+		t.Errorf("MinTemperature = %v °C, want 17", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	// A dive logged by hand and by a computer switched on a minute late.
+	logged := &Dive{
+		Number:   3,
+		Start:    time.Date(2024, 5, 1, 9, 29, 0, 0, time.UTC),
+		Duration: 5 * time.Minute,
+		MaxDepth: 21,
+		Site:     &Site{ID: 2, Name: "Blue Hole"},
+		Buddies:  []Buddy{{Name: "Ana"}},
+		Tags:     []string{"wall"},
+		Notes:    "Turtle.",
+	}
+	computer := validDive()
+	computer.Number = 7
+	computer.Equipment = []Equipment{{Kind: Computer, Name: "OSTC", Serial: "12345"}}
+	computer.Buddies = []Buddy{{Name: "Ana"}}
+	computer.Tags = []string{"wall", "deep"}
+	if !logged.Overlaps(computer) || !computer.Overlaps(logged) {
+		t.Fatal("Overlaps = false")
+	}
+	if later := (&Dive{Start: logged.End(), Duration: time.Hour}); logged.Overlaps(later) {
+		t.Error("a dive starting as another ends overlaps it")
+	}
+
+	d := logged.Clone()
+	d.Merge(computer)
+	if d.Number != 3 || !d.Start.Equal(computer.Start) || d.Duration != computer.Duration || d.MaxDepth != 20 {
+		t.Errorf("merged Number, Start, Duration, MaxDepth = %d, %v, %v, %v", d.Number, d.Start, d.Duration, d.MaxDepth)
+	}
+	if len(d.Samples) != 4 || len(d.Tanks) != 1 || d.Site.Name != "Blue Hole" || d.Notes != "Turtle." {
+		t.Errorf("merged dive lost data: %+v", d)
+	}
+	if len(d.Buddies) != 1 || len(d.Tags) != 2 || len(d.Computers()) != 1 {
+		t.Errorf("merged Buddies, Tags, Computers = %v, %v, %v", d.Buddies, d.Tags, d.Computers())
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("merged dive: %v", err)
+	}
+	d.Samples[0].Depth = 1
+	if computer.Samples[0].Depth != 0 {
+		t.Error("merged dive shares samples with the merged record")
+	}
+
+	// The profile with more samples wins whichever way round.
+	d = computer.Clone()
+	d.Merge(logged)
+	if len(d.Samples) != 4 || !d.Start.Equal(computer.Start) || d.Site.ID != 2 || d.Notes != "Turtle." {
+		t.Errorf("computer dive merged with logged one: %+v", d)
+	}
+
+	// A backup computer's profile is kept, placed by its start time, and
+	// its tanks matched to the dive's by gas.
+	backup := validDive()
+	backup.Start = computer.Start.Add(-20 * time.Second)
+	backup.Samples = backup.Samples[:3]
+	backup.Tanks[0].Gas = GasMix{O2: 0.21}
+	backup.Equipment = []Equipment{{Kind: Computer, Name: "Zoop"}}
+	d.Merge(backup)
+	if len(d.Profiles) != 1 || d.Profiles[0].Computer.Name != "Zoop" || d.Profiles[0].Offset != -20*time.Second ||
+		len(d.Profiles[0].Samples) != 3 || len(d.Tanks) != 1 || len(d.Computers()) != 2 {
+		t.Errorf("merged backup: Profiles %+v, Tanks %+v", d.Profiles, d.Tanks)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("merged dive: %v", err)
+	}
+	d.SetPrimary(0)
+	if !d.Start.Equal(backup.Start) || d.Computer.Name != "Zoop" || d.Profiles[0].Offset != 20*time.Second ||
+		d.Profiles[0].Computer.Name != "OSTC" || d.Duration != 2*time.Minute {
+		t.Errorf("after SetPrimary: Start %v, Computer %v, Profiles %+v", d.Start, d.Computer, d.Profiles)
+	}
+}
+
+func TestMergeTanks(t *testing.T) {
+	// Sidemount: two cylinders of air, one computer reading the pressure
+	// of each, the other knowing only the first.
+	d := validDive()
+	d.Tanks = []Tank{{Volume: Liters(12), Gas: Air, StartPressure: Bar(200), EndPressure: Bar(100)}, {Volume: Liters(12), Gas: Air}}
+	d.Equipment = []Equipment{{Kind: Computer, Name: "Zoop"}}
+	o := validDive()
+	o.Tanks = []Tank{
+		{Volume: Liters(12), Gas: Air, StartPressure: Bar(200), EndPressure: Bar(100)},
+		{Volume: Liters(12), Gas: Air, StartPressure: Bar(210), EndPressure: Bar(110)},
+	}
+	o.Samples = append(o.Samples[:2:2], Sample{Time: 90 * time.Second, Depth: 20, Pressure: Bar(200), Tank: 1})
+	o.Samples = append(o.Samples, validDive().Samples[2:]...)
+	o.Equipment = []Equipment{{Kind: Computer, Name: "Perdix"}}
+	d.Merge(o)
+	if len(d.Tanks) != 2 || d.Tanks[1].StartPressure != Bar(210) || d.Tanks[1].EndPressure != Bar(110) {
+		t.Errorf("merged sidemount tanks: %+v", d.Tanks)
+	}
+	if p := d.Primary(); len(p.Samples) != 5 || p.Samples[2].Tank != 1 {
+		t.Errorf("merged pressure samples: %+v", p.Samples)
+	}
+
+	// Two computers each reporting one of a pair, told apart by name.
+	d = validDive()
+	d.Tanks[0].Description = "left"
+	o = validDive()
+	o.Tanks[0].Description = "right"
+	o.Samples = o.Samples[:3]
+	d.Merge(o)
+	if len(d.Tanks) != 2 || d.Tanks[1].Description != "right" || d.Profiles[0].Samples[1].Tank != 1 {
+		t.Errorf("merged pair: Tanks %+v, Profiles %+v", d.Tanks, d.Profiles)
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("merged pair: %v", err)
+	}
+}
+
+func TestParseGasMix(t *testing.T) {
+	tests := []struct {
+		in   string
+		want GasMix
+		name string
+	}{
+		{"air", Air, "air"},
+		{"EAN32", GasMix{O2: 0.32}, "EAN32"},
+		{"nx50", GasMix{O2: 0.50}, "EAN50"},
+		{"36%", GasMix{O2: 0.36}, "EAN36"},
+		{"18/45", GasMix{O2: 0.18, He: 0.45}, "18/45"},
+		{"TX10/70", GasMix{O2: 0.10, He: 0.70}, "10/70"},
+		{"oxygen", Oxygen, "oxygen"},
+	}
+	for _, tt := range tests {
+		got, err := ParseGasMix(tt.in)
+		if err != nil {
+			t.Errorf("ParseGasMix(%q): %v", tt.in, err)
+			continue
+		}
+		if math.Abs(got.O2-tt.want.O2) > 1e-9 || math.Abs(got.He-tt.want.He) > 1e-9 {
+			t.Errorf("ParseGasMix(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.name {
+			t.Errorf("ParseGasMix(%q).String() = %q, want %q", tt.in, got.String(), tt.name)
+		}
+	}
+	for _, bad := range []string{"", "fizz", "60/50", "0"} {
+		if _, err := ParseGasMix(bad); err == nil {
+			t.Errorf("ParseGasMix(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b Coordinates
+		want float64 // metres
+	}{
+		{Coordinates{17.3157, -87.5346}, Coordinates{17.3157, -87.5346}, 0},
+		{Coordinates{0, 0}, Coordinates{0, 1}, 111195},
+		{Coordinates{51.5007, -0.1246}, Coordinates{40.6892, -74.0445}, 5574840}, // Big Ben to the Statue of Liberty
+		{Coordinates{0, 179.5}, Coordinates{0, -179.5}, 111195},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Distance(tt.b); math.Abs(got-tt.want) > 1 && math.Abs(got-tt.want)/tt.want > 1e-4 {
+			t.Errorf("%v to %v = %.0f m, want %.0f m", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseCoordinates(t *testing.T) {
+	if c, err := ParseCoordinates(" 17.3157, -87.5346"); err != nil || c != (Coordinates{17.3157, -87.5346}) {
+		t.Errorf("ParseCoordinates = %v, %v", c, err)
+	}
+	for _, s := range []string{"17.3", "north,west", "95,10", ""} {
+		if _, err := ParseCoordinates(s); err == nil {
+			t.Errorf("ParseCoordinates(%q) succeeded", s)
+		}
+	}
+}
+
+func TestItemMatches(t *testing.T) {
+	perdix := &Item{Kind: Computer, Name: "Perdix", Serial: "A1"}
+	tests := []struct {
+		e    Equipment
+		want bool
+	}{
+		{Equipment{Kind: Computer, Name: "Perdix", Serial: "A1"}, true},
+		{Equipment{Kind: Computer, Name: "perdix"}, true},
+		{Equipment{Kind: Computer, Name: "Perdix AI", Serial: "A1"}, true},
+		{Equipment{Kind: Computer, Name: "Perdix", Serial: "B2"}, false},
+		{Equipment{Kind: Light, Name: "Perdix"}, false},
+	}
+	for _, tt := range tests {
+		if got := perdix.Matches(tt.e); got != tt.want {
+			t.Errorf("Matches(%+v) = %v, want %v", tt.e, got, tt.want)
+		}
+	}
+	if err := (&Item{Kind: "snorkel", ServiceDives: -1}).Validate(); err == nil {
+		t.Error("Validate accepted an item without a name or a known kind")
+	}
+	if err := perdix.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+// Package divelog defines the data model shared by every divelog tool:
+// dives, their depth profiles, the cylinders and gases breathed, the site,
+// the buddies and the equipment used.
+//
+// All quantities are held in SI units internally: depths in metres,
+// temperatures in kelvin, pressures in pascals and volumes in cubic metres.
+// Times inside a dive are offsets from its start expressed as
+// time.Duration. Conversions to the units people actually read (bar,
+// litres, °C, feet, psi, cubic feet, °F) are explicit methods on the unit
+// types, and UnitSystem formats values for metric or imperial display.
+package divelog
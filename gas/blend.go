@@ -0,0 +1,215 @@
+package gas
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/betonavab/divelog"
+)
+
+// MaxStickO2 is the richest nitrox a continuous-flow system may deliver;
+// richer mixes are not oxygen compatible in an ordinary compressor.
+const MaxStickO2 = 0.40
+
+// Helium is pure helium.
+var Helium = divelog.GasMix{He: 1}
+
+// Blend describes a cylinder fill: what is in the cylinder now and what
+// it should hold. Pressures are gauge readings and all calculations allow
+// for compressibility.
+type Blend struct {
+	// Volume is the cylinder's water capacity. It is optional and only
+	// used to report the volume of each gas added.
+	Volume divelog.Volume
+
+	Start    divelog.Pressure
+	StartMix divelog.GasMix
+
+	Target    divelog.Pressure
+	TargetMix divelog.GasMix
+
+	// TopUp is the gas the fill is finished with; the zero value means
+	// air.
+	TopUp divelog.GasMix
+}
+
+// Step is one gas added to the cylinder.
+type Step struct {
+	Gas divelog.GasMix
+
+	// To is the pressure to fill to, and Volume the free gas volume
+	// added, zero if the cylinder's volume is not known.
+	To     divelog.Pressure
+	Volume divelog.Volume
+}
+
+// Fill is the recipe for a blend.
+type Fill struct {
+	// Drain is the pressure to bleed the cylinder down to before
+	// starting; it equals Blend.Start if nothing needs draining.
+	Drain divelog.Pressure
+	Steps []Step
+}
+
+// linear is a quantity of gas a - n·b that depends on the amount n left
+// in the cylinder after draining and must not be negative.
+type linear struct{ a, b float64 }
+
+// maxRemaining returns the most gas, up to n, that can be left in the
+// cylinder while keeping every quantity in qs non-negative.
+func maxRemaining(n float64, qs ...linear) (float64, error) {
+	for _, q := range qs {
+		switch {
+		case q.b > 0:
+			n = min(n, q.a/q.b)
+		case q.a < -1e-9:
+			return 0, errors.New("the target cannot be reached with these gases")
+		}
+	}
+	if n < -1e-9 {
+		return 0, errors.New("the target cannot be reached with these gases")
+	}
+	return max(n, 0), nil
+}
+
+func (b Blend) check() error {
+	if err := b.TargetMix.Validate(); err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	if b.Start > 0 {
+		if err := b.StartMix.Validate(); err != nil {
+			return fmt.Errorf("start: %v", err)
+		}
+	}
+	if b.Target <= 0 || b.Start < 0 {
+		return errors.New("pressures must be positive")
+	}
+	return nil
+}
+
+// PartialPressure works out a partial-pressure blend: drain if needed,
+// then add helium, then oxygen, then top up.
+func PartialPressure(b Blend) (*Fill, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	top := b.TopUp
+	if top == (divelog.GasMix{}) {
+		top = divelog.Air
+	}
+	if top.N2() <= 0 {
+		return nil, errors.New("the top-up gas must contain nitrogen")
+	}
+	start, target := b.StartMix, b.TargetMix
+	n1 := amount(target, b.Target)
+	n0 := amount(start, b.Start)
+
+	// With n left in the cylinder, the top-up supplies all the missing
+	// nitrogen, t = (n1·N2' - n·N2) / top.N2, and helium and oxygen make
+	// up the rest.
+	perN2 := func(f float64) float64 { return f / top.N2() }
+	topUp := linear{n1 * perN2(target.N2()), perN2(start.N2())}
+	he := linear{n1*target.He - topUp.a*top.He, start.He - topUp.b*top.He}
+	o2 := linear{n1*target.O2 - topUp.a*top.O2, start.O2 - topUp.b*top.O2}
+	n, err := maxRemaining(n0, topUp, he, o2)
+	if err != nil {
+		return nil, err
+	}
+
+	fill := &Fill{Drain: b.Start}
+	if n < n0 {
+		fill.Drain = pressureOf(start, n)
+	}
+	have, mix := n, start
+	for _, add := range []struct {
+		gas divelog.GasMix
+		q   linear
+	}{{Helium, he}, {divelog.Oxygen, o2}, {top, topUp}} {
+		x := add.q.a - n*add.q.b
+		if x < 1e-6 {
+			continue
+		}
+		mix = combine(have, mix, x, add.gas)
+		have += x
+		fill.Steps = append(fill.Steps, b.step(add.gas, x, pressureOf(mix, have)))
+	}
+	if len(fill.Steps) > 0 {
+		fill.Steps[len(fill.Steps)-1].To = b.Target
+	}
+	return fill, nil
+}
+
+// ContinuousFlow works out a fill from a continuous-flow (stick) nitrox
+// system: drain if needed, then fill with the nitrox mix given as the
+// single step's gas. The mix is between air and MaxStickO2.
+func ContinuousFlow(b Blend) (*Fill, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	if b.TargetMix.He > 0 {
+		return nil, errors.New("continuous flow blends nitrox only")
+	}
+	start, target := b.StartMix, b.TargetMix
+	n1 := amount(target, b.Target)
+	n0 := amount(start, b.Start)
+	o2 := n1 * target.O2
+	// What is left after draining must let the stick add gas, with no
+	// helium to match, at a mix between air and MaxStickO2.
+	n, err := maxRemaining(n0,
+		linear{n1, 1},
+		linear{0, start.He},
+		linear{MaxStickO2*n1 - o2, MaxStickO2 - start.O2},
+		linear{o2 - divelog.Air.O2*n1, start.O2 - divelog.Air.O2},
+	)
+	if err != nil {
+		return nil, err
+	}
+	fill := &Fill{Drain: b.Start}
+	if n < n0 {
+		fill.Drain = pressureOf(start, n)
+	}
+	if added := n1 - n; added > 1e-6 {
+		stick := divelog.GasMix{O2: (o2 - n*start.O2) / added}
+		fill.Steps = []Step{b.step(stick, added, b.Target)}
+	}
+	return fill, nil
+}
+
+// InjectionRate returns the oxygen flow a continuous-flow system needs to
+// deliver stick from a compressor producing output per minute.
+func InjectionRate(stick divelog.GasMix, output divelog.Volume) divelog.Volume {
+	return divelog.Volume(float64(output) * (stick.O2 - divelog.Air.O2) / (1 - divelog.Air.O2))
+}
+
+// TopUp returns the mix that results from filling a cylinder holding mix
+// at start with gas up to pressure to.
+func TopUp(start divelog.Pressure, mix, gas divelog.GasMix, to divelog.Pressure) divelog.GasMix {
+	n0 := amount(mix, start)
+	// The final amount depends on the final mix's compressibility;
+	// iterate from the ideal-gas guess.
+	result := combine(n0, mix, max(to.Bar()-n0, 0), gas)
+	for range 20 {
+		result = combine(n0, mix, max(amount(result, to)-n0, 0), gas)
+	}
+	return result
+}
+
+// combine returns the mix of n1 of m1 and n2 of m2.
+func combine(n1 float64, m1 divelog.GasMix, n2 float64, m2 divelog.GasMix) divelog.GasMix {
+	n := n1 + n2
+	if n == 0 {
+		return m1
+	}
+	return divelog.GasMix{
+		O2: (n1*m1.O2 + n2*m2.O2) / n,
+		He: (n1*m1.He + n2*m2.He) / n,
+	}
+}
+
+func (b Blend) step(gas divelog.GasMix, n float64, to divelog.Pressure) Step {
+	return Step{
+		Gas:    gas,
+		To:     to,
+		Volume: divelog.Volume(float64(b.Volume) * n / divelog.StandardAtmosphere.Bar()),
+	}
+}
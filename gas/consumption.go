@@ -0,0 +1,68 @@
+package gas
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/betonavab/divelog"
+)
+
+// Consumption is how fast a diver breathed on a dive, brought back to the
+// surface.
+type Consumption struct {
+	// Used is the free gas volume breathed from the dive's tanks.
+	Used divelog.Volume
+
+	// RMV, the respiratory minute volume, is the free gas volume breathed
+	// per minute at the surface.
+	RMV divelog.Volume
+
+	// SAC, the surface air consumption, is the same rate as the pressure
+	// it takes per minute from the tanks breathed.
+	SAC divelog.Pressure
+}
+
+// ErrNoConsumption is returned by DiveConsumption for dives that lack
+// what it needs.
+var ErrNoConsumption = errors.New("no gas consumption")
+
+// DiveConsumption works out a dive's consumption from the start and end
+// pressures of its tanks, allowing for compressibility, and its average
+// depth. Tanks without both pressures are taken as not breathed from.
+func DiveConsumption(d *divelog.Dive) (Consumption, error) {
+	var c Consumption
+	var volume divelog.Volume
+	for i, t := range d.Tanks {
+		if t.StartPressure == 0 || t.EndPressure == 0 {
+			continue
+		}
+		if t.Volume == 0 {
+			return c, fmt.Errorf("%w: tank %d has no volume", ErrNoConsumption, i+1)
+		}
+		if t.EndPressure > t.StartPressure {
+			return c, fmt.Errorf("%w: tank %d ends above its start pressure", ErrNoConsumption, i+1)
+		}
+		gas := t.Gas
+		if gas.O2 == 0 {
+			gas = divelog.Air
+		}
+		c.Used += FreeVolume(t.Volume, gas, t.StartPressure) - FreeVolume(t.Volume, gas, t.EndPressure)
+		volume += t.Volume
+	}
+	if volume == 0 {
+		return c, fmt.Errorf("%w: no tank has start and end pressures", ErrNoConsumption)
+	}
+	avg := d.AvgDepth
+	if avg == 0 && len(d.Samples) > 0 {
+		s := d.Clone()
+		s.Summarize()
+		avg = s.AvgDepth
+	}
+	if avg == 0 || d.Duration <= 0 {
+		return c, fmt.Errorf("%w: no average depth or duration", ErrNoConsumption)
+	}
+	atm := float64(d.Water().AmbientPressure(avg, d.Surface())) / float64(divelog.StandardAtmosphere)
+	c.RMV = divelog.Volume(float64(c.Used) / d.Duration.Minutes() / atm)
+	c.SAC = divelog.Pressure(float64(c.RMV) / float64(volume) * float64(divelog.StandardAtmosphere))
+	return c, nil
+}
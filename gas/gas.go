@@ -0,0 +1,108 @@
+// Package gas provides the calculations divers and blenders make about
+// breathing gases: maximum operating depth, equivalent narcotic and air
+// depths, density, the best mix for a dive, real-gas cylinder contents,
+// the fills for partial-pressure, continuous-flow and top-up blending, and
+// a diver's gas consumption.
+package gas
+
+import (
+	"math"
+
+	"github.com/betonavab/divelog"
+)
+
+// Density limits in g/l (kg/m³), after Anthony and Mitchell: breathing
+// gas should stay below Recommended and must not exceed Max.
+const (
+	RecommendedDensity = 5.2
+	MaxDensity         = 6.2
+)
+
+// densities of the component gases at 0 °C and one atmosphere, in g/l.
+const (
+	densityO2 = 1.429
+	densityN2 = 1.251
+	densityHe = 0.1786
+)
+
+// Conditions are the surface pressure and water density that depths are
+// measured in. The zero value is sea level in salt water.
+type Conditions struct {
+	Surface divelog.Pressure
+	Water   divelog.Salinity
+}
+
+// SeaLevel is sea level in salt water.
+var SeaLevel = Conditions{}
+
+func (c Conditions) surface() divelog.Pressure {
+	if c.Surface == 0 {
+		return divelog.StandardAtmosphere
+	}
+	return c.Surface
+}
+
+func (c Conditions) water() divelog.Salinity {
+	if c.Water == 0 {
+		return divelog.SaltWater
+	}
+	return c.Water
+}
+
+// Ambient returns the absolute pressure at depth d.
+func (c Conditions) Ambient(d divelog.Depth) divelog.Pressure {
+	return c.water().AmbientPressure(d, c.surface())
+}
+
+// DepthAt returns the depth at which the absolute pressure is p.
+func (c Conditions) DepthAt(p divelog.Pressure) divelog.Depth {
+	return c.water().DepthAt(p, c.surface())
+}
+
+// PPO2 returns the oxygen partial pressure of mix at depth d, in bar.
+func (c Conditions) PPO2(mix divelog.GasMix, d divelog.Depth) float64 {
+	return mix.O2 * c.Ambient(d).Bar()
+}
+
+// MOD returns the maximum operating depth of mix: the depth at which its
+// oxygen partial pressure reaches maxPPO2 bar.
+func (c Conditions) MOD(mix divelog.GasMix, maxPPO2 float64) divelog.Depth {
+	return max(c.DepthAt(divelog.Bar(maxPPO2/mix.O2)), 0)
+}
+
+// END returns the equivalent narcotic depth of mix at d: the depth at
+// which air is as narcotic. Oxygen is counted as narcotic, so only helium
+// reduces it.
+func (c Conditions) END(mix divelog.GasMix, d divelog.Depth) divelog.Depth {
+	return max(c.DepthAt(divelog.Pressure(float64(c.Ambient(d))*(1-mix.He))), 0)
+}
+
+// EAD returns the equivalent air depth of mix at d: the depth at which air
+// has the same nitrogen partial pressure.
+func (c Conditions) EAD(mix divelog.GasMix, d divelog.Depth) divelog.Depth {
+	return max(c.DepthAt(divelog.Pressure(float64(c.Ambient(d))*mix.N2()/divelog.Air.N2())), 0)
+}
+
+// Density returns the density of mix at depth d in g/l.
+func (c Conditions) Density(mix divelog.GasMix, d divelog.Depth) float64 {
+	surface := mix.O2*densityO2 + mix.N2()*densityN2 + mix.He*densityHe
+	return surface * float64(c.Ambient(d)) / float64(divelog.StandardAtmosphere)
+}
+
+// BestMix returns the mix for a dive to depth d with an oxygen partial
+// pressure of ppO2 bar and an equivalent narcotic depth of at most maxEND.
+// The oxygen is rounded down and the helium up to whole percent; a maxEND
+// of zero asks for nitrox. ok is false if no mix meets both limits.
+func (c Conditions) BestMix(d divelog.Depth, ppO2 float64, maxEND divelog.Depth) (mix divelog.GasMix, ok bool) {
+	amb := c.Ambient(d).Bar()
+	mix.O2 = math.Min(math.Floor(ppO2/amb*100)/100, 1)
+	if maxEND > 0 && maxEND < d {
+		narcotic := c.Ambient(maxEND).Bar() / amb
+		mix.He = math.Max(math.Ceil((1-narcotic)*100-1e-9)/100, 0)
+	}
+	if mix.O2+mix.He > 1 {
+		mix.He = 1 - mix.O2
+		return mix, false
+	}
+	return mix, mix.O2 > 0
+}
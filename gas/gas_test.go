@@ -0,0 +1,287 @@
+package gas
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+var (
+	ean32  = divelog.GasMix{O2: 0.32}
+	tx1845 = divelog.GasMix{O2: 0.18, He: 0.45}
+)
+
+func near(a, b, tol float64) bool { return math.Abs(a-b) <= tol }
+
+func TestDepths(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want divelog.Depth
+	}{
+		{"MOD EAN32 at 1.4", SeaLevel.MOD(ean32, 1.4), 33.44},
+		{"MOD oxygen at 1.6", SeaLevel.MOD(divelog.Oxygen, 1.6), 5.84},
+		{"MOD EAN32 at 1.4 in fresh water", Conditions{Water: divelog.FreshWater}.MOD(ean32, 1.4), 34.28},
+		{"END 18/45 at 60 m", SeaLevel.END(tx1845, 60), 28.46},
+		{"END air at 30 m", SeaLevel.END(divelog.Air, 30), 30},
+		{"EAD EAN32 at 30 m", SeaLevel.EAD(ean32, 30), 24.37},
+		{"EAD oxygen", SeaLevel.EAD(divelog.Oxygen, 6), 0},
+	}
+	for _, tt := range tests {
+		if !near(float64(tt.got), float64(tt.want), 0.01) {
+			t.Errorf("%s = %.3f m, want %.2f", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	tests := []struct {
+		mix   divelog.GasMix
+		depth divelog.Depth
+		want  float64
+	}{
+		{divelog.Air, 0, 1.288},
+		{divelog.Air, 30, 5.122},
+		{tx1845, 60, 5.565},
+	}
+	for _, tt := range tests {
+		if got := SeaLevel.Density(tt.mix, tt.depth); !near(got, tt.want, 0.005) {
+			t.Errorf("Density(%v, %v m) = %.3f g/l, want %.3f", tt.mix, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestBestMix(t *testing.T) {
+	tests := []struct {
+		depth, end divelog.Depth
+		ppO2       float64
+		want       divelog.GasMix
+		ok         bool
+	}{
+		{30, 0, 1.4, divelog.GasMix{O2: 0.34}, true},
+		{40, 30, 1.4, divelog.GasMix{O2: 0.27, He: 0.20}, true},
+		{60, 30, 1.2, divelog.GasMix{O2: 0.17, He: 0.43}, true},
+		{20, 30, 1.4, divelog.GasMix{O2: 0.46}, true},
+	}
+	for _, tt := range tests {
+		got, ok := SeaLevel.BestMix(tt.depth, tt.ppO2, tt.end)
+		if ok != tt.ok || !near(got.O2, tt.want.O2, 1e-9) || !near(got.He, tt.want.He, 1e-9) {
+			t.Errorf("BestMix(%v m, %.1f, END %v m) = %v, %v, want %v", tt.depth, tt.ppO2, tt.end, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCompressibility(t *testing.T) {
+	tests := []struct {
+		mix  divelog.GasMix
+		bar  float64
+		want float64
+	}{
+		{divelog.Air, 1, 1.000},
+		{divelog.Air, 200, 1.036},
+		{divelog.Air, 300, 1.111},
+		{Helium, 200, 1.094},
+		{divelog.Oxygen, 200, 0.957},
+	}
+	for _, tt := range tests {
+		if got := Z(tt.mix, divelog.Bar(tt.bar)); !near(got, tt.want, 0.002) {
+			t.Errorf("Z(%v, %v bar) = %.4f, want %.3f", tt.mix, tt.bar, got, tt.want)
+		}
+	}
+
+	// An AL80 holds 11.1 l of water and 77.4 cuft of air at 3000 psi.
+	al80 := FreeVolume(divelog.Liters(11.1), divelog.Air, divelog.PSI(3000))
+	if !near(al80.CubicFeet(), 77.4, 0.5) {
+		t.Errorf("AL80 holds %.1f cuft, want 77.4", al80.CubicFeet())
+	}
+	if p := Pressure(divelog.Liters(11.1), divelog.Air, al80); !near(p.PSI(), 3000, 0.01) {
+		t.Errorf("Pressure round trip = %.2f psi, want 3000", p.PSI())
+	}
+}
+
+// result returns the mix and pressure a fill produces, replaying its steps.
+func result(b Blend, f *Fill) (divelog.GasMix, divelog.Pressure) {
+	mix, n := b.StartMix, amount(b.StartMix, f.Drain)
+	p := f.Drain
+	for _, s := range f.Steps {
+		// The amount added is whatever takes the cylinder to s.To.
+		next := mix
+		for range 50 {
+			next = combine(n, mix, amount(next, s.To)-n, s.Gas)
+		}
+		n, mix, p = amount(next, s.To), next, s.To
+	}
+	return mix, p
+}
+
+func TestPartialPressure(t *testing.T) {
+	tests := []struct {
+		name  string
+		blend Blend
+		drain float64 // bar, or -1 for no drain
+		gases []divelog.GasMix
+	}{
+		{
+			name:  "trimix from empty",
+			blend: Blend{Volume: divelog.Liters(12), Target: divelog.Bar(200), TargetMix: divelog.GasMix{O2: 0.21, He: 0.35}},
+			drain: -1,
+			gases: []divelog.GasMix{Helium, divelog.Oxygen, divelog.Air},
+		},
+		{
+			name:  "nitrox over leftover nitrox",
+			blend: Blend{Start: divelog.Bar(50), StartMix: divelog.GasMix{O2: 0.36}, Target: divelog.Bar(200), TargetMix: ean32},
+			drain: -1,
+			gases: []divelog.GasMix{divelog.Oxygen, divelog.Air},
+		},
+		{
+			name:  "too rich a leftover",
+			blend: Blend{Start: divelog.Bar(150), StartMix: divelog.GasMix{O2: 0.50}, Target: divelog.Bar(200), TargetMix: ean32},
+			drain: 73,
+			gases: []divelog.GasMix{divelog.Air},
+		},
+		{
+			name:  "helium that must go",
+			blend: Blend{Start: divelog.Bar(150), StartMix: tx1845, Target: divelog.Bar(200), TargetMix: ean32},
+			drain: 0,
+			gases: []divelog.GasMix{divelog.Oxygen, divelog.Air},
+		},
+		{
+			name:  "EAN32 top-up",
+			blend: Blend{Target: divelog.Bar(232), TargetMix: divelog.GasMix{O2: 0.50}, TopUp: ean32},
+			drain: -1,
+			gases: []divelog.GasMix{divelog.Oxygen, ean32},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := PartialPressure(tt.blend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.drain < 0 && f.Drain != tt.blend.Start {
+				t.Errorf("Drain = %.1f bar, want none", f.Drain.Bar())
+			}
+			if tt.drain >= 0 && !near(f.Drain.Bar(), tt.drain, 1) {
+				t.Errorf("Drain = %.1f bar, want %.0f", f.Drain.Bar(), tt.drain)
+			}
+			if len(f.Steps) != len(tt.gases) {
+				t.Fatalf("steps = %+v, want gases %v", f.Steps, tt.gases)
+			}
+			for i, s := range f.Steps {
+				if s.Gas != tt.gases[i] {
+					t.Errorf("step %d adds %v, want %v", i, s.Gas, tt.gases[i])
+				}
+				if i > 0 && s.To <= f.Steps[i-1].To {
+					t.Errorf("step %d fills to %v, below the previous step", i, s.To)
+				}
+			}
+			mix, p := result(tt.blend, f)
+			if p != tt.blend.Target || !near(mix.O2, tt.blend.TargetMix.O2, 1e-4) || !near(mix.He, tt.blend.TargetMix.He, 1e-4) {
+				t.Errorf("fill gives %v at %.1f bar (O2 %.4f, He %.4f), want %v", mix, p.Bar(), mix.O2, mix.He, tt.blend.TargetMix)
+			}
+		})
+	}
+
+	// Real gas: the finished trimix is less compressible than ideal, so
+	// the helium stops short of the ideal 70 bar.
+	f, _ := PartialPressure(tests[0].blend)
+	he := f.Steps[0]
+	if p := he.To.Bar(); p >= 70 || p < 65 {
+		t.Errorf("helium fill to %.1f bar, want a little under 70", p)
+	}
+	if want := FreeVolume(divelog.Liters(12), Helium, he.To); !near(he.Volume.Liters(), want.Liters(), 0.5) {
+		t.Errorf("helium volume = %.0f l, want %.0f", he.Volume.Liters(), want.Liters())
+	}
+
+	if _, err := PartialPressure(Blend{Target: divelog.Bar(200), TargetMix: divelog.GasMix{O2: 0.10}}); err == nil {
+		t.Error("blending 10% nitrox with an air top-up succeeded")
+	}
+}
+
+func TestContinuousFlow(t *testing.T) {
+	f, err := ContinuousFlow(Blend{Target: divelog.Bar(200), TargetMix: ean32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Steps) != 1 || !near(f.Steps[0].Gas.O2, 0.32, 1e-9) {
+		t.Errorf("fill from empty = %+v", f)
+	}
+
+	// Raising 100 bar of air to EAN36 needs a stick above 40%, so some
+	// air must go first.
+	f, err = ContinuousFlow(Blend{Start: divelog.Bar(100), StartMix: divelog.Air, Target: divelog.Bar(200), TargetMix: divelog.GasMix{O2: 0.36}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(f.Drain.Bar(), 42, 2) || !near(f.Steps[0].Gas.O2, MaxStickO2, 1e-9) {
+		t.Errorf("fill = %+v, want a drain to about 42 bar and a 40%% stick", f)
+	}
+
+	if _, err := ContinuousFlow(Blend{Target: divelog.Bar(200), TargetMix: tx1845}); err == nil {
+		t.Error("continuous flow trimix succeeded")
+	}
+	if got := InjectionRate(ean32, divelog.Liters(300)).Liters(); !near(got, 42.1, 0.1) {
+		t.Errorf("InjectionRate = %.1f l/min, want 42.1", got)
+	}
+}
+
+func TestTopUp(t *testing.T) {
+	got := TopUp(divelog.Bar(100), ean32, divelog.Air, divelog.Bar(200))
+	if !near(got.O2, 0.2645, 0.003) || got.He != 0 {
+		t.Errorf("TopUp = %+v, want about 26.5%% O2", got)
+	}
+	if got := TopUp(0, ean32, divelog.Air, divelog.Bar(200)); !near(got.O2, divelog.Air.O2, 1e-9) {
+		t.Errorf("TopUp of an empty cylinder = %v, want air", got)
+	}
+}
+
+func TestDiveConsumption(t *testing.T) {
+	d := &divelog.Dive{
+		Duration: 50 * time.Minute,
+		AvgDepth: 15,
+		Tanks: []divelog.Tank{
+			{Volume: divelog.Liters(12), StartPressure: divelog.Bar(200), EndPressure: divelog.Bar(70), Gas: divelog.Air},
+			{Volume: divelog.Liters(7), Gas: divelog.Oxygen}, // not breathed
+		},
+	}
+	c, err := DiveConsumption(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Air at 200 bar is compressed less than an ideal gas, so 130 bar of
+	// it is some 6% less gas than the ideal 1540 l.
+	want := 12 * (200/Z(divelog.Air, divelog.Bar(200)) - 70/Z(divelog.Air, divelog.Bar(70))) / 1.01325
+	if got := c.Used.Liters(); !near(got, want, 0.01) || got > 1460 {
+		t.Errorf("Used = %.0f l, want %.0f", got, want)
+	}
+	atm := SeaLevel.Ambient(15).Bar() / 1.01325
+	if want := c.Used.Liters() / 50 / atm; !near(c.RMV.Liters(), want, 1e-9) {
+		t.Errorf("RMV = %.2f l/min, want %.2f", c.RMV.Liters(), want)
+	}
+	if want := c.RMV.Liters() / 12 * 1.01325; !near(c.SAC.Bar(), want, 1e-9) {
+		t.Errorf("SAC = %.3f bar/min, want %.3f", c.SAC.Bar(), want)
+	}
+
+	// The average depth comes from the profile when it is not logged.
+	p := d.Clone()
+	p.AvgDepth = 0
+	p.Samples = []divelog.Sample{{Time: 0, Depth: 15}, {Time: 50 * time.Minute, Depth: 15}}
+	if got, err := DiveConsumption(p); err != nil || !near(got.RMV.Liters(), c.RMV.Liters(), 1e-9) {
+		t.Errorf("from the profile: %+v, %v", got, err)
+	}
+
+	for name, mutate := range map[string]func(*divelog.Dive){
+		"no pressures":  func(d *divelog.Dive) { d.Tanks[0].EndPressure = 0 },
+		"no volume":     func(d *divelog.Dive) { d.Tanks[0].Volume = 0 },
+		"no depth":      func(d *divelog.Dive) { d.AvgDepth = 0 },
+		"gauge went up": func(d *divelog.Dive) { d.Tanks[0].EndPressure = divelog.Bar(210) },
+	} {
+		bad := d.Clone()
+		mutate(bad)
+		if _, err := DiveConsumption(bad); !errors.Is(err, ErrNoConsumption) {
+			t.Errorf("%s: err = %v, want ErrNoConsumption", name, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package divelog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GasMix is a breathing gas given as fractions of oxygen and helium; the
+// remainder is nitrogen. The zero value is not a valid mix; use Air.
+type GasMix struct {
+	O2 float64 `json:"o2"`
+	He float64 `json:"he,omitempty"`
+}
+
+// Common mixes.
+var (
+	Air    = GasMix{O2: 0.209}
+	Oxygen = GasMix{O2: 1}
+)
+
+// N2 returns the nitrogen fraction of m.
+func (m GasMix) N2() float64 { return 1 - m.O2 - m.He }
+
+// IsAir reports whether m is air to within the precision of an analyser.
+func (m GasMix) IsAir() bool {
+	return m.He == 0 && math.Abs(m.O2-Air.O2) < 0.005
+}
+
+// Validate reports whether m describes a physically possible mix.
+func (m GasMix) Validate() error {
+	switch {
+	case m.O2 <= 0:
+		return fmt.Errorf("oxygen fraction %.3f must be positive", m.O2)
+	case m.He < 0:
+		return fmt.Errorf("helium fraction %.3f is negative", m.He)
+	case m.O2+m.He > 1+1e-9:
+		return fmt.Errorf("O2 %.1f%% + He %.1f%% exceeds 100%%", m.O2*100, m.He*100)
+	}
+	return nil
+}
+
+// String returns the conventional name of m: "air", "oxygen", "EAN32" or
+// "18/45" for trimix.
+func (m GasMix) String() string {
+	o2 := math.Round(m.O2 * 100)
+	he := math.Round(m.He * 100)
+	switch {
+	case m.IsAir():
+		return "air"
+	case he == 0 && o2 == 100:
+		return "oxygen"
+	case o2 == 0 && he == 100:
+		return "helium"
+	case he == 0:
+		return fmt.Sprintf("EAN%.0f", o2)
+	}
+	return fmt.Sprintf("%.0f/%.0f", o2, he)
+}
+
+// ParseGasMix parses a gas name as written by divers: "air", "oxygen",
+// "EAN32", "nx32" or "32" for nitrox, and "18/45" or "tx18/45" for trimix.
+func ParseGasMix(s string) (GasMix, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	switch v {
+	case "air":
+		return Air, nil
+	case "oxygen", "o2":
+		return Oxygen, nil
+	}
+	for _, p := range []string{"ean", "nx", "tx", "trimix"} {
+		v = strings.TrimPrefix(v, p)
+	}
+	v = strings.TrimSuffix(v, "%")
+	var m GasMix
+	o2, he, trimix := strings.Cut(v, "/")
+	pct, err := strconv.ParseFloat(o2, 64)
+	if err != nil {
+		return GasMix{}, fmt.Errorf("invalid gas %q", s)
+	}
+	m.O2 = pct / 100
+	if trimix {
+		pct, err := strconv.ParseFloat(he, 64)
+		if err != nil {
+			return GasMix{}, fmt.Errorf("invalid gas %q", s)
+		}
+		m.He = pct / 100
+	}
+	if err := m.Validate(); err != nil {
+		return GasMix{}, fmt.Errorf("invalid gas %q: %w", s, err)
+	}
+	return m, nil
+}
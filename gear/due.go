@@ -0,0 +1,109 @@
+package gear
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// Check is a kind of maintenance an item needs from time to time.
+type Check string
+
+const (
+	Service Check = "service"
+	Hydro   Check = "hydrostatic test"
+	Visual  Check = "visual inspection"
+)
+
+// The intervals between a cylinder's tests, as most of the US and Europe
+// require them. Shops under other rules can change them.
+var (
+	HydroYears   = 5
+	VisualMonths = 12
+)
+
+// How far ahead Reminders warns of a check falling due.
+const (
+	NoticeTime  = 30 * 24 * time.Hour
+	NoticeDives = 5
+)
+
+// Reminder is a check that is due or soon will be.
+type Reminder struct {
+	Item  *divelog.Item
+	Check Check
+
+	// Due is the date the check falls due. It is zero when only a number
+	// of dives limits the check, or when Never is set.
+	Due time.Time
+
+	// Never is set when the date the check counts from was never
+	// recorded. The check is then overdue.
+	Never bool
+
+	// ByDives is set when the check falls due after a number of dives,
+	// and DivesLeft is then the number left; it is negative once overdue.
+	ByDives   bool
+	DivesLeft int
+
+	Overdue bool
+}
+
+// Reminders returns the checks of items that are overdue at now or fall
+// due within NoticeTime or NoticeDives, overdue ones first. Retired items
+// need no checks. usage is the items' usage by ID, as Tally returns it.
+func Reminders(items []*divelog.Item, usage map[int]*Usage, now time.Time) []Reminder {
+	var due []Reminder
+	add := func(r Reminder) {
+		soon := !r.Due.IsZero() && r.Due.Sub(now) <= NoticeTime || r.ByDives && r.DivesLeft <= NoticeDives
+		if r.Overdue || soon {
+			due = append(due, r)
+		}
+	}
+	// dated returns the reminder for a check every interval from last.
+	dated := func(it *divelog.Item, check Check, last time.Time, years, months int) Reminder {
+		r := Reminder{Item: it, Check: check, Never: last.IsZero(), Overdue: last.IsZero()}
+		if !last.IsZero() {
+			r.Due = last.AddDate(years, months, 0)
+			r.Overdue = !now.Before(r.Due)
+		}
+		return r
+	}
+
+	for _, it := range items {
+		if it.Retired {
+			continue
+		}
+		if it.ServiceMonths > 0 || it.ServiceDives > 0 {
+			r := Reminder{Item: it, Check: Service}
+			if it.ServiceMonths > 0 {
+				r = dated(it, Service, serviceBase(it), 0, it.ServiceMonths)
+			}
+			if it.ServiceDives > 0 {
+				var since int
+				if u := usage[it.ID]; u != nil {
+					since = u.SinceService
+				}
+				r.ByDives, r.DivesLeft = true, it.ServiceDives-since
+				r.Overdue = r.Overdue || r.DivesLeft <= 0
+			}
+			add(r)
+		}
+		if it.Kind == divelog.Cylinder {
+			add(dated(it, Hydro, it.LastHydro, HydroYears, 0))
+			add(dated(it, Visual, it.LastVisual, 0, VisualMonths))
+		}
+	}
+	slices.SortStableFunc(due, func(a, b Reminder) int {
+		if a.Overdue != b.Overdue {
+			if a.Overdue {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Item.ID, b.Item.ID)
+	})
+	return due
+}
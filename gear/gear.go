@@ -0,0 +1,155 @@
+// Package gear keeps the equipment inventory of a dive log: how much each
+// item has been used, which dives it was used on and when its service,
+// hydrostatic test or visual inspection falls due.
+//
+// The inventory lives in stores that implement store.Inventory. Dives
+// record the gear used as divelog.Equipment entries, and an item's dives
+// are those with an entry it matches, so dives imported from a computer
+// count towards the computer's item without further work.
+package gear
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+// Usage is how much an item has been used.
+type Usage struct {
+	Dives int
+	Time  time.Duration
+
+	First, Last time.Time // the first and last dives with the item
+
+	// SinceService is the number of dives since the item was last
+	// serviced, or bought if it never was.
+	SinceService int
+}
+
+// Tally returns the usage of each item in dives, by item ID.
+func Tally(items []*divelog.Item, dives []*divelog.Dive) map[int]*Usage {
+	usage := make(map[int]*Usage, len(items))
+	for _, it := range items {
+		u := &Usage{}
+		usage[it.ID] = u
+		since := serviceBase(it)
+		for _, d := range dives {
+			if !Used(it, d) {
+				continue
+			}
+			u.Dives++
+			u.Time += d.Duration
+			if u.First.IsZero() || d.Start.Before(u.First) {
+				u.First = d.Start
+			}
+			if d.Start.After(u.Last) {
+				u.Last = d.Start
+			}
+			if !d.Start.Before(since) {
+				u.SinceService++
+			}
+		}
+	}
+	return usage
+}
+
+// Used reports whether it was used on d.
+func Used(it *divelog.Item, d *divelog.Dive) bool {
+	return slices.ContainsFunc(d.Equipment, it.Matches)
+}
+
+// Dives returns the dives in dives that it was used on.
+func Dives(it *divelog.Item, dives []*divelog.Dive) []*divelog.Dive {
+	var used []*divelog.Dive
+	for _, d := range dives {
+		if Used(it, d) {
+			used = append(used, d)
+		}
+	}
+	return used
+}
+
+// Use records it on the dives with the given numbers that do not already
+// list it. It returns the number of dives changed.
+func Use(s store.Store, it *divelog.Item, numbers ...int) (int, error) {
+	n := 0
+	for _, number := range numbers {
+		d, err := s.Get(number)
+		if err != nil {
+			return n, fmt.Errorf("dive #%d: %w", number, err)
+		}
+		if Used(it, d) {
+			continue
+		}
+		d.Equipment = append(d.Equipment, it.Equipment())
+		if err := s.Put(d); err != nil {
+			return n, fmt.Errorf("dive #%d: %w", number, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Update saves an inventory item and rewrites the record of it on every
+// dive it was used on, so that renaming an item or giving it a serial
+// number does not lose its history. It returns the number of dives
+// changed.
+func Update(s store.Store, it *divelog.Item) (int, error) {
+	inv, ok := s.(store.Inventory)
+	if !ok {
+		return 0, errors.New("this log has no equipment inventory")
+	}
+	if err := it.Validate(); err != nil {
+		return 0, err
+	}
+	var was *divelog.Item
+	if it.ID != 0 {
+		old, err := inv.GetItem(it.ID)
+		if err != nil && !errors.Is(err, store.ErrItemNotFound) {
+			return 0, err
+		}
+		was = old
+	}
+	if err := inv.PutItem(it); err != nil {
+		return 0, err
+	}
+	if was == nil || was.Equipment() == it.Equipment() {
+		return 0, nil
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, d := range dives {
+		if !Used(was, d) {
+			continue
+		}
+		// Read the dive again in full so that its profile is kept.
+		if d, err = s.Get(d.Number); err != nil {
+			return n, err
+		}
+		for i, e := range d.Equipment {
+			if was.Matches(e) {
+				d.Equipment[i] = it.Equipment()
+			}
+		}
+		if err := s.Put(d); err != nil {
+			return n, fmt.Errorf("dive #%d: %w", d.Number, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// serviceBase returns the date an item's service interval counts from.
+func serviceBase(it *divelog.Item) time.Time {
+	if !it.LastService.IsZero() {
+		return it.LastService
+	}
+	return it.Purchased
+}
@@ -0,0 +1,131 @@
+package gear
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+func day(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 10, 0, 0, 0, time.UTC) }
+
+var (
+	perdix = &divelog.Item{ID: 1, Kind: divelog.Computer, Name: "Perdix", Serial: "A1"}
+	mk25   = &divelog.Item{ID: 2, Kind: divelog.Regulator, Name: "Mk25", LastService: day(2024, 5, 2), ServiceMonths: 12, ServiceDives: 3}
+	al80   = &divelog.Item{ID: 3, Kind: divelog.Cylinder, Name: "AL80", Serial: "L1", LastHydro: day(2019, 11, 1), LastVisual: day(2024, 1, 1)}
+)
+
+func dives() []*divelog.Dive {
+	return []*divelog.Dive{
+		{Number: 1, Start: day(2024, 5, 1), Duration: 40 * time.Minute,
+			Equipment: []divelog.Equipment{{Kind: divelog.Computer, Name: "Perdix", Serial: "A1"}, {Kind: divelog.Regulator, Name: "mk25"}}},
+		{Number: 2, Start: day(2024, 5, 3), Duration: 50 * time.Minute,
+			Equipment: []divelog.Equipment{{Kind: divelog.Computer, Serial: "A1"}, {Kind: divelog.Regulator, Name: "Mk25"}}},
+		{Number: 3, Start: day(2024, 5, 4), Duration: 30 * time.Minute,
+			Equipment: []divelog.Equipment{{Kind: divelog.Regulator, Name: "Mk25"}, {Kind: divelog.Cylinder, Name: "AL80", Serial: "L2"}}},
+	}
+}
+
+func TestTally(t *testing.T) {
+	usage := Tally([]*divelog.Item{perdix, mk25, al80}, dives())
+	want := map[int]*Usage{
+		1: {Dives: 2, Time: 90 * time.Minute, First: day(2024, 5, 1), Last: day(2024, 5, 3), SinceService: 2},
+		2: {Dives: 3, Time: 120 * time.Minute, First: day(2024, 5, 1), Last: day(2024, 5, 4), SinceService: 2},
+		3: {},
+	}
+	if !reflect.DeepEqual(usage, want) {
+		for id, u := range usage {
+			t.Errorf("item %d: %+v, want %+v", id, u, want[id])
+		}
+	}
+	var numbers []int
+	for _, d := range Dives(mk25, dives()) {
+		numbers = append(numbers, d.Number)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(numbers, want) {
+		t.Errorf("Dives(mk25) = %v, want %v", numbers, want)
+	}
+}
+
+func TestReminders(t *testing.T) {
+	items := []*divelog.Item{perdix, mk25, al80,
+		{ID: 4, Kind: divelog.Cylinder, Name: "Old steel", Retired: true},
+		{ID: 5, Kind: divelog.BCD, Name: "Wing", Purchased: day(2023, 6, 1), ServiceMonths: 12},
+	}
+	usage := Tally(items, dives())
+	type reminder struct {
+		item      int
+		check     Check
+		due       time.Time
+		divesLeft int
+		overdue   bool
+	}
+	var got []reminder
+	for _, r := range Reminders(items, usage, day(2024, 10, 15)) {
+		got = append(got, reminder{r.Item.ID, r.Check, r.Due, r.DivesLeft, r.Overdue})
+	}
+	want := []reminder{
+		{5, Service, day(2024, 6, 1), 0, true},
+		{2, Service, day(2025, 5, 2), 1, false}, // one dive left
+		{3, Hydro, day(2024, 11, 1), 0, false},  // in 17 days
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Reminders =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// A cylinder without test dates is overdue for both.
+	var checks []Check
+	for _, r := range Reminders([]*divelog.Item{{ID: 6, Kind: divelog.Cylinder, Name: "HP100"}}, nil, day(2024, 10, 15)) {
+		if !r.Overdue || !r.Never || !r.Due.IsZero() {
+			t.Errorf("untested cylinder: %+v", r)
+		}
+		checks = append(checks, r.Check)
+	}
+	if want := []Check{Hydro, Visual}; !reflect.DeepEqual(checks, want) {
+		t.Errorf("untested cylinder checks = %v, want %v", checks, want)
+	}
+}
+
+func TestUseUpdate(t *testing.T) {
+	s := store.NewMemory()
+	for _, d := range dives() {
+		d.Samples = []divelog.Sample{{}, {Time: time.Minute, Depth: 10}, {Time: d.Duration}}
+		if err := s.Put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg := &divelog.Item{Kind: divelog.Regulator, Name: "Mk25"}
+	if err := s.PutItem(reg); err != nil {
+		t.Fatal(err)
+	}
+	cyl := &divelog.Item{Kind: divelog.Cylinder, Name: "AL80", Serial: "L1"}
+	if err := s.PutItem(cyl); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Use(s, cyl, 1, 2, 1); err != nil || n != 2 {
+		t.Errorf("Use = %d, %v; want 2 dives", n, err)
+	}
+	if _, err := Use(s, cyl, 9); err == nil {
+		t.Error("Use on a missing dive succeeded")
+	}
+
+	reg.Name, reg.Serial = "Mk25 EVO", "R9"
+	if n, err := Update(s, reg); err != nil || n != 3 {
+		t.Fatalf("Update = %d, %v; want 3 dives", n, err)
+	}
+	all, _ := s.List()
+	if got := Dives(reg, all); len(got) != 3 {
+		t.Errorf("renamed regulator used on %d dives, want 3", len(got))
+	}
+	if got := Dives(cyl, all); len(got) != 2 {
+		t.Errorf("cylinder used on %d dives, want 2", len(got))
+	}
+	if d, _ := s.Get(3); len(d.Samples) != 3 || d.Equipment[0] != reg.Equipment() {
+		t.Errorf("dive #3 after Update: %+v", d)
+	}
+	if _, err := Update(s, &divelog.Item{Kind: "snorkel", Name: "x"}); err == nil {
+		t.Error("Update accepted an invalid item")
+	}
+}
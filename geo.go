@@ -0,0 +1,38 @@
+package divelog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean radius of the Earth in metres.
+const EarthRadius = 6371008.8
+
+// Distance returns the great-circle distance in metres from c to o, by the
+// haversine formula on a spherical Earth.
+func (c Coordinates) Distance(o Coordinates) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(o.Lat-c.Lat), rad(o.Lon-c.Lon)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(rad(c.Lat))*math.Cos(rad(o.Lat))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(min(h, 1)))
+}
+
+// ParseCoordinates parses a position written as "lat,lon" in decimal
+// degrees, such as "17.3157,-87.5346".
+func ParseCoordinates(s string) (Coordinates, error) {
+	lat, lon, ok := strings.Cut(s, ",")
+	var c Coordinates
+	var err error
+	if ok {
+		c.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	}
+	if ok && err == nil {
+		c.Lon, err = strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	}
+	if !ok || err != nil {
+		return c, fmt.Errorf("invalid position %q, want lat,lon in decimal degrees", s)
+	}
+	return c, c.Validate()
+}
@@ -0,0 +1,58 @@
+package divelog
+
+import (
+	"strings"
+	"time"
+)
+
+// Item is a piece of equipment in the owner's or a shop's inventory, with
+// the dates its maintenance is counted from. Dives record the equipment
+// used as Equipment values; an item was used on a dive when one of them
+// matches it (see Item.Matches).
+type Item struct {
+	ID     int           `json:"id,omitempty"`
+	Kind   EquipmentKind `json:"kind"`
+	Name   string        `json:"name"`
+	Serial string        `json:"serial,omitempty"`
+
+	// Rental marks shop gear lent to customers.
+	Rental    bool      `json:"rental,omitempty"`
+	Purchased time.Time `json:"purchased,omitzero"`
+
+	// ServiceMonths and ServiceDives are how long and how many dives the
+	// item may go between services, whichever comes first; zero is no
+	// limit. The count starts at LastService, or Purchased if it was never
+	// serviced.
+	LastService   time.Time `json:"last_service,omitzero"`
+	ServiceMonths int       `json:"service_months,omitempty"`
+	ServiceDives  int       `json:"service_dives,omitempty"`
+
+	// LastHydro and LastVisual are the dates of a cylinder's last
+	// hydrostatic test and visual inspection.
+	LastHydro  time.Time `json:"last_hydro,omitzero"`
+	LastVisual time.Time `json:"last_visual,omitzero"`
+
+	// Retired items are kept for their history but no longer used.
+	Retired bool   `json:"retired,omitempty"`
+	Notes   string `json:"notes,omitempty"`
+}
+
+// Equipment returns the entry a dive records when the item is used on it.
+func (it *Item) Equipment() Equipment {
+	return Equipment{Kind: it.Kind, Name: it.Name, Serial: it.Serial}
+}
+
+// Matches reports whether e, as recorded on a dive, is the item. Kinds
+// must agree; when both carry a serial number the serials decide, and
+// otherwise the names must be equal ignoring case. Identical items, such as
+// a shop's rental cylinders, need distinct serials or names to be told
+// apart.
+func (it *Item) Matches(e Equipment) bool {
+	if e.Kind != it.Kind {
+		return false
+	}
+	if e.Serial != "" && it.Serial != "" {
+		return e.Serial == it.Serial
+	}
+	return it.Name != "" && strings.EqualFold(e.Name, it.Name)
+}
@@ -0,0 +1,181 @@
+package divelog
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// Overlaps reports whether d and o were in the water at the same time, as
+// when two computers record one dive.
+func (d *Dive) Overlaps(o *Dive) bool {
+	return d.Start.Before(o.End()) && o.Start.Before(d.End())
+}
+
+// Computers returns the dive computers among d's equipment.
+func (d *Dive) Computers() []Equipment {
+	var dcs []Equipment
+	for _, e := range d.Equipment {
+		if e.Kind == Computer {
+			dcs = append(dcs, e)
+		}
+	}
+	return dcs
+}
+
+// Merge folds o, another record of the same dive, into d. Its profiles
+// join d's, placed by the difference in start times, and the one with the
+// most samples becomes the primary profile, giving the dive its start,
+// duration and depths. The other record fills in what d lacks, and tanks,
+// buddies, equipment and tags are combined. d keeps its number, and its
+// signatures, which the merge invalidates.
+func (d *Dive) Merge(o *Dive) {
+	// Pin down which computer recorded d's profile before equipment is
+	// combined.
+	if p := d.Primary(); d.Computer == nil && p.Computer != (Equipment{}) {
+		d.Computer = &p.Computer
+	}
+	o = o.Clone()
+	o.mapTanks(d.mergeTanks(o.Tanks))
+
+	offset := o.Start.Sub(d.Start)
+	first := len(d.Profiles)
+	if p := o.Primary(); len(p.Samples) > 0 {
+		d.Profiles = append(d.Profiles, p)
+	}
+	d.Profiles = append(d.Profiles, o.Profiles...)
+	for i := first; i < len(d.Profiles); i++ {
+		d.Profiles[i].Offset += offset
+	}
+	if len(d.Samples) == 0 && len(o.Samples) == 0 {
+		// Neither has a profile; keep the longer record's times.
+		if o.Duration > d.Duration {
+			d.Start, d.Duration = o.Start, o.Duration
+		}
+	}
+	if len(o.Samples) > len(d.Samples) {
+		d.SetPrimary(first)
+		// Keep the figures the computer gave for its profile.
+		d.Duration, d.MaxDepth, d.AvgDepth = o.Duration, o.MaxDepth, o.AvgDepth
+		if o.MinTemperature != 0 {
+			d.MinTemperature = o.MinTemperature
+		}
+	}
+	if d.MaxDepth == 0 {
+		d.MaxDepth = o.MaxDepth
+	}
+	if d.AvgDepth == 0 {
+		d.AvgDepth = o.AvgDepth
+	}
+	if d.MinTemperature == 0 {
+		d.MinTemperature = o.MinTemperature
+	}
+	if d.SurfacePressure == 0 {
+		d.SurfacePressure = o.SurfacePressure
+	}
+	if d.Salinity == 0 {
+		d.Salinity = o.Salinity
+	}
+	if d.Site == nil {
+		d.Site = o.Site
+	}
+	if d.Training == nil {
+		d.Training = o.Training
+	}
+	if d.Rating == 0 {
+		d.Rating = o.Rating
+	}
+	switch {
+	case d.Notes == "":
+		d.Notes = o.Notes
+	case o.Notes != "" && o.Notes != d.Notes:
+		d.Notes += "\n\n" + o.Notes
+	}
+	d.Buddies = union(d.Buddies, o.Buddies)
+	d.Equipment = union(d.Equipment, o.Equipment)
+	d.Tags = union(d.Tags, o.Tags)
+}
+
+// mergeTanks adds to d's tanks those of tanks it lacks, and fills in what
+// d's know less about. Each of tanks takes the first of d's that could be
+// the same cylinder and no other of tanks has taken, so that two of one
+// mix, as in sidemount, stay two. It returns the index in d.Tanks of each
+// of tanks.
+func (d *Dive) mergeTanks(tanks []Tank) []int {
+	index := make([]int, len(tanks))
+	taken := make([]bool, len(d.Tanks))
+	for i, t := range tanks {
+		j := -1
+		for k := range taken {
+			if !taken[k] && sameTank(d.Tanks[k], t) {
+				j = k
+				break
+			}
+		}
+		if j < 0 {
+			j = len(d.Tanks)
+			d.Tanks = append(d.Tanks, t)
+		} else {
+			taken[j] = true
+		}
+		dt := &d.Tanks[j]
+		if dt.Volume == 0 {
+			dt.Volume, dt.WorkingPressure = t.Volume, t.WorkingPressure
+		}
+		if dt.StartPressure == 0 && dt.EndPressure == 0 {
+			dt.StartPressure, dt.EndPressure = t.StartPressure, t.EndPressure
+		}
+		if dt.Description == "" {
+			dt.Description = t.Description
+		}
+		if dt.Fill == nil {
+			dt.Fill = t.Fill
+		}
+		index[i] = j
+	}
+	return index
+}
+
+// mapTanks renumbers the tanks d's samples and events refer to by index.
+func (d *Dive) mapTanks(index []int) {
+	mapProfile := func(samples []Sample, events []Event) {
+		for i, s := range samples {
+			if s.Tank >= 0 && s.Tank < len(index) {
+				samples[i].Tank = index[s.Tank]
+			}
+		}
+		for i, e := range events {
+			if e.Kind == EventGasChange && e.Tank >= 0 && e.Tank < len(index) {
+				events[i].Tank = index[e.Tank]
+			}
+		}
+	}
+	mapProfile(d.Samples, d.Events)
+	for _, p := range d.Profiles {
+		mapProfile(p.Samples, p.Events)
+	}
+}
+
+// sameTank reports whether a and b could be one cylinder: the same gas,
+// and the same size and description where both give them.
+func sameTank(a, b Tank) bool {
+	return sameGas(a.Gas, b.Gas) &&
+		(a.Volume == 0 || b.Volume == 0 || math.Abs(float64(a.Volume-b.Volume)) < float64(Liters(0.5))) &&
+		(a.Description == "" || b.Description == "" || strings.EqualFold(a.Description, b.Description))
+}
+
+// sameGas reports whether a and b are the same gas, give or take the
+// rounding of a computer that keeps whole percentages.
+func sameGas(a, b GasMix) bool {
+	return math.Abs(a.O2-b.O2) < 0.005 && math.Abs(a.He-b.He) < 0.005
+}
+
+// union appends to a the elements of b it does not already hold.
+func union[E comparable](a, b []E) []E {
+	for _, e := range b {
+		if !slices.Contains(a, e) {
+			a = append(a, e)
+		}
+	}
+	return a
+}
@@ -0,0 +1,172 @@
+// Package oxtox tracks oxygen toxicity: central nervous system (CNS)
+// loading as a percentage of the NOAA single-exposure limits, and
+// whole-body toxicity in oxygen tolerance units (OTU) against the REPEX
+// limits for multi-day diving.
+package oxtox
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// CNS loadings, in percent, at which to warn and past which the limit is
+// exceeded, and the highest ppO2 in bar the NOAA tables allow.
+const (
+	CNSWarning = 80.0
+	CNSLimit   = 100.0
+	MaxPPO2    = 1.6
+)
+
+// noaa is the NOAA single-exposure limit at each ppO2 in bar.
+var noaa = []struct {
+	ppO2  float64
+	limit time.Duration
+}{
+	{0.6, 720 * time.Minute},
+	{0.7, 570 * time.Minute},
+	{0.8, 450 * time.Minute},
+	{0.9, 360 * time.Minute},
+	{1.0, 300 * time.Minute},
+	{1.1, 240 * time.Minute},
+	{1.2, 210 * time.Minute},
+	{1.3, 180 * time.Minute},
+	{1.4, 150 * time.Minute},
+	{1.5, 120 * time.Minute},
+	{1.6, 45 * time.Minute},
+}
+
+// minExposure is where the limit bottoms out above 1.6 bar, where the
+// NOAA tables end.
+const minExposure = 6 * time.Minute
+
+// ExposureLimit returns the NOAA single-exposure limit at ppO2 bar,
+// interpolating between the table's entries. Below 0.5 bar there is no
+// limit and it returns zero. Between 0.5 and 0.6 bar the 0.6 bar limit
+// applies, and above 1.6 bar the 1.5 to 1.6 bar slope is extended down to
+// six minutes.
+func ExposureLimit(ppO2 float64) time.Duration {
+	switch {
+	case ppO2 < 0.5:
+		return 0
+	case ppO2 <= noaa[0].ppO2:
+		return noaa[0].limit
+	}
+	i := 1
+	for i < len(noaa)-1 && noaa[i].ppO2 < ppO2 {
+		i++
+	}
+	a, b := noaa[i-1], noaa[i]
+	f := (ppO2 - a.ppO2) / (b.ppO2 - a.ppO2)
+	limit := time.Duration(float64(a.limit) + f*float64(b.limit-a.limit))
+	return max(limit, minExposure)
+}
+
+// CNS returns the CNS loading, in percent, of breathing ppO2 bar for d.
+func CNS(ppO2 float64, d time.Duration) float64 {
+	limit := ExposureLimit(ppO2)
+	if limit == 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(limit)
+}
+
+// OTU returns the oxygen tolerance units of breathing ppO2 bar for d.
+func OTU(ppO2 float64, d time.Duration) float64 {
+	if ppO2 <= 0.5 {
+		return 0
+	}
+	return d.Minutes() * math.Pow((ppO2-0.5)/0.5, 5.0/6)
+}
+
+// HalfLife is the half-life of CNS loading at the surface.
+const HalfLife = 90 * time.Minute
+
+// Decay returns what remains of a CNS loading after a surface interval.
+func Decay(cns float64, interval time.Duration) float64 {
+	if interval <= 0 {
+		return cns
+	}
+	return cns * math.Exp2(-float64(interval)/float64(HalfLife))
+}
+
+// repex is the REPEX total OTU limit for trips of 1 to 14 days; longer
+// trips are allowed 300 OTU a day.
+var repex = []float64{850, 1400, 1860, 2100, 2300, 2520, 2660, 2800, 2970, 3100, 3300, 3600, 3900, 4200}
+
+// TripLimit returns the REPEX limit on the OTU accumulated over a trip of
+// the given number of days.
+func TripLimit(days int) float64 {
+	switch {
+	case days <= 0:
+		return 0
+	case days <= len(repex):
+		return repex[days-1]
+	}
+	return 300 * float64(days)
+}
+
+// step is the longest stretch of a profile taken at a single ppO2.
+const step = 10 * time.Second
+
+// Exposure is the oxygen dose of a single dive.
+type Exposure struct {
+	CNS     float64 // percent
+	OTU     float64
+	MaxPPO2 float64 // bar
+}
+
+// Dive returns the exposure of d, following its gas changes from the
+// first tank. A dive without samples is taken as spent entirely at its
+// maximum depth.
+func Dive(d *divelog.Dive) Exposure {
+	var e Exposure
+	ppO2 := func(depth divelog.Depth, gas divelog.GasMix) float64 {
+		return gas.O2 * d.Water().AmbientPressure(depth, d.Surface()).Bar()
+	}
+	add := func(pp float64, dt time.Duration) {
+		e.CNS += CNS(pp, dt)
+		e.OTU += OTU(pp, dt)
+		e.MaxPPO2 = max(e.MaxPPO2, pp)
+	}
+	if len(d.Samples) == 0 {
+		add(ppO2(d.MaxDepth, tankGas(d, 0)), d.Duration)
+		return e
+	}
+
+	events := slices.Clone(d.Events)
+	slices.SortStableFunc(events, func(a, b divelog.Event) int { return cmp.Compare(a.Time, b.Time) })
+	gas := tankGas(d, 0)
+	var prev divelog.Sample
+	for _, s := range d.Samples {
+		for len(events) > 0 && events[0].Time <= prev.Time {
+			if events[0].Kind == divelog.EventGasChange {
+				gas = tankGas(d, events[0].Tank)
+			}
+			events = events[1:]
+		}
+		// Depth changes linearly between samples; take each step at its
+		// midpoint.
+		span := s.Time - prev.Time
+		n := int((span + step - 1) / step)
+		for i := range n {
+			mid := (float64(i) + 0.5) / float64(n)
+			depth := prev.Depth + divelog.Depth(mid*float64(s.Depth-prev.Depth))
+			add(ppO2(depth, gas), span/time.Duration(n))
+		}
+		e.MaxPPO2 = max(e.MaxPPO2, ppO2(s.Depth, gas))
+		prev = s
+	}
+	return e
+}
+
+// tankGas returns the gas in d's tank i, or air if there is no such tank.
+func tankGas(d *divelog.Dive, i int) divelog.GasMix {
+	if i < 0 || i >= len(d.Tanks) || d.Tanks[i].Gas.O2 == 0 {
+		return divelog.Air
+	}
+	return d.Tanks[i].Gas
+}
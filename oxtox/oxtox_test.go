@@ -0,0 +1,159 @@
+package oxtox
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func near(a, b, tol float64) bool { return math.Abs(a-b) <= tol }
+
+func TestExposureLimit(t *testing.T) {
+	tests := []struct {
+		ppO2 float64
+		want time.Duration
+	}{
+		{0.4, 0},
+		{0.55, 720 * time.Minute},
+		{1.0, 300 * time.Minute},
+		{1.4, 150 * time.Minute},
+		{1.45, 135 * time.Minute},
+		{1.6, 45 * time.Minute},
+		{1.65, 7*time.Minute + 30*time.Second},
+		{2.0, 6 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := ExposureLimit(tt.ppO2); (got - tt.want).Abs() > time.Second {
+			t.Errorf("ExposureLimit(%.2f) = %v, want %v", tt.ppO2, got, tt.want)
+		}
+	}
+}
+
+func TestDose(t *testing.T) {
+	if got := CNS(1.4, 30*time.Minute); !near(got, 20, 1e-9) {
+		t.Errorf("CNS(1.4, 30 min) = %.2f%%, want 20%%", got)
+	}
+	tests := []struct {
+		ppO2 float64
+		d    time.Duration
+		want float64
+	}{
+		{0.5, time.Hour, 0},
+		{1.0, time.Hour, 60},
+		{1.4, 30 * time.Minute, 48.97},
+		{1.6, 20 * time.Minute, 38.58},
+	}
+	for _, tt := range tests {
+		if got := OTU(tt.ppO2, tt.d); !near(got, tt.want, 0.01) {
+			t.Errorf("OTU(%.1f, %v) = %.2f, want %.2f", tt.ppO2, tt.d, got, tt.want)
+		}
+	}
+	if got := Decay(40, 90*time.Minute); !near(got, 20, 1e-9) {
+		t.Errorf("Decay(40%%, 90 min) = %.2f%%, want 20%%", got)
+	}
+	for days, want := range map[int]float64{1: 850, 2: 1400, 14: 4200, 20: 6000} {
+		if got := TripLimit(days); got != want {
+			t.Errorf("TripLimit(%d) = %v, want %v", days, got, want)
+		}
+	}
+}
+
+var ean32 = divelog.GasMix{O2: 0.32}
+
+// squareDive returns a dive breathing mix at ppO2 bar for bottom, with a
+// minute's descent and ascent at 1 bar.
+func squareDive(n int, start time.Time, mix divelog.GasMix, ppO2 float64, bottom time.Duration) *divelog.Dive {
+	depth := divelog.SaltWater.DepthAt(divelog.Bar(ppO2/mix.O2), divelog.StandardAtmosphere)
+	return &divelog.Dive{
+		Number:   n,
+		Start:    start,
+		Duration: bottom,
+		MaxDepth: depth,
+		Tanks:    []divelog.Tank{{Gas: mix}},
+		Samples: []divelog.Sample{
+			{Time: 0, Depth: depth},
+			{Time: bottom, Depth: depth},
+		},
+	}
+}
+
+func TestDive(t *testing.T) {
+	e := Dive(squareDive(1, time.Time{}, ean32, 1.4, 30*time.Minute))
+	if !near(e.CNS, 20, 0.01) || !near(e.OTU, 48.97, 0.01) || !near(e.MaxPPO2, 1.4, 1e-9) {
+		t.Errorf("Dive = %+v, want CNS 20%%, OTU 48.97, max ppO2 1.4", e)
+	}
+
+	// Without samples the whole dive is at the maximum depth.
+	d := squareDive(1, time.Time{}, ean32, 1.4, 30*time.Minute)
+	d.Samples = nil
+	if got := Dive(d); !near(got.CNS, e.CNS, 1e-9) || !near(got.OTU, e.OTU, 1e-9) {
+		t.Errorf("Dive without samples = %+v, want %+v", got, e)
+	}
+
+	// Switching to oxygen at 6 m for the last ten minutes.
+	d = &divelog.Dive{
+		Tanks: []divelog.Tank{{Gas: divelog.Air}, {Gas: divelog.Oxygen}},
+		Samples: []divelog.Sample{
+			{Time: 0, Depth: 6},
+			{Time: 10 * time.Minute, Depth: 6},
+			{Time: 20 * time.Minute, Depth: 6},
+		},
+		Events: []divelog.Event{{Time: 10 * time.Minute, Kind: divelog.EventGasChange, Tank: 1}},
+	}
+	pp := divelog.SaltWater.AmbientPressure(6, divelog.StandardAtmosphere).Bar()
+	want := CNS(pp, 10*time.Minute) + CNS(pp*divelog.Air.O2, 10*time.Minute)
+	if got := Dive(d); !near(got.CNS, want, 1e-6) || !near(got.MaxPPO2, pp, 1e-9) {
+		t.Errorf("Dive with gas change = %+v, want CNS %.2f%% and max ppO2 %.3f", got, want, pp)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	day := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	dive := func(n int, start time.Time) *divelog.Dive {
+		return squareDive(n, start, ean32, 1.4, 30*time.Minute)
+	}
+	dives := []*divelog.Dive{
+		dive(3, day.Add(24*time.Hour)),
+		dive(1, day),
+		dive(2, day.Add(2*time.Hour)), // 90 minutes after the first surfaced
+		dive(4, day.Add(5*24*time.Hour)),
+	}
+	got := Track(dives)
+	want := []struct {
+		number          int
+		start, end, otu float64
+		day             int
+	}{
+		{1, 0, 20, 48.97, 1},
+		{2, 10, 30, 97.94, 1},
+		{3, Decay(30, 24*time.Hour-150*time.Minute), 20 + Decay(30, 24*time.Hour-150*time.Minute), 146.91, 2},
+		{4, 0, 20, 48.97, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Track returned %d statuses", len(got))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Number != w.number || !near(g.StartCNS, w.start, 0.01) || !near(g.EndCNS, w.end, 0.01) ||
+			!near(g.TripOTU, w.otu, 0.05) || g.TripDay != w.day {
+			t.Errorf("status %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	if s, ok := Find(got, 2); !ok || s.CNSExceeded() || s.OTUExceeded() || s.PPO2Exceeded() {
+		t.Errorf("dive 2 = %+v, %v, want within limits", s, ok)
+	}
+	hot := Track([]*divelog.Dive{
+		squareDive(1, day, divelog.Oxygen, 1.61, 40*time.Minute),
+		squareDive(2, day.Add(time.Hour), divelog.Oxygen, 1.6, 20*time.Minute),
+	})
+	if !hot[0].PPO2Exceeded() || hot[1].PPO2Exceeded() {
+		t.Errorf("ppO2 exceeded = %v at 1.61 bar and %v at 1.6, want true and false",
+			hot[0].PPO2Exceeded(), hot[1].PPO2Exceeded())
+	}
+	if s := hot[1]; !s.CNSExceeded() || s.OTUExceeded() {
+		t.Errorf("second oxygen dive = %+v, want only CNS exceeded", s)
+	}
+}
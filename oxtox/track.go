@@ -0,0 +1,91 @@
+package oxtox
+
+import (
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// TripBreak is the surface interval that ends a trip: OTU accumulate over
+// dives closer together than this.
+const TripBreak = 48 * time.Hour
+
+// Status is a dive's oxygen exposure in the context of the dives before
+// it.
+type Status struct {
+	Number int
+	Exposure
+
+	// StartCNS is the CNS loading carried over from earlier dives,
+	// decayed over the surface interval, and EndCNS the loading on
+	// surfacing.
+	StartCNS, EndCNS float64
+
+	// TripOTU is the OTU accumulated over the trip up to and including
+	// this dive, and TripDay the day of the trip it falls on, counting
+	// from 1.
+	TripOTU float64
+	TripDay int
+}
+
+// TripLimit returns the REPEX limit for the trip so far.
+func (s Status) TripLimit() float64 { return TripLimit(s.TripDay) }
+
+// CNSExceeded reports whether the CNS loading went over 100%.
+func (s Status) CNSExceeded() bool { return s.EndCNS > CNSLimit }
+
+// OTUExceeded reports whether the trip's OTU went over the REPEX limit.
+func (s Status) OTUExceeded() bool { return s.TripOTU > s.TripLimit() }
+
+// PPO2Exceeded reports whether the dive's ppO2 went over MaxPPO2; it is
+// rounded to 0.01 bar, as dive computers display it.
+func (s Status) PPO2Exceeded() bool { return s.MaxPPO2 >= MaxPPO2+0.005 }
+
+// Track works out the status of each dive, carrying CNS loading over
+// surface intervals and OTU over trips. The result is in order of start
+// time, which need not be the order of dives.
+func Track(dives []*divelog.Dive) []Status {
+	dives = slices.Clone(dives)
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+
+	res := make([]Status, 0, len(dives))
+	var prev *divelog.Dive
+	var cns, otu float64
+	var tripStart time.Time
+	for _, d := range dives {
+		s := Status{Number: d.Number, Exposure: Dive(d)}
+		if prev == nil || d.Start.Sub(prev.Start.Add(prev.Duration)) >= TripBreak {
+			cns, otu, tripStart = 0, 0, d.Start
+		} else {
+			cns = Decay(cns, d.Start.Sub(prev.Start.Add(prev.Duration)))
+		}
+		s.StartCNS = cns
+		cns += s.CNS
+		otu += s.OTU
+		s.EndCNS, s.TripOTU = cns, otu
+		s.TripDay = days(tripStart, d.Start)
+		res = append(res, s)
+		prev = d
+	}
+	return res
+}
+
+// Find returns the status of dive number n.
+func Find(statuses []Status, n int) (Status, bool) {
+	i := slices.IndexFunc(statuses, func(s Status) bool { return s.Number == n })
+	if i < 0 {
+		return Status{}, false
+	}
+	return statuses[i], true
+}
+
+// days counts the calendar days from the one holding from to the one
+// holding to, inclusive, in to's location.
+func days(from, to time.Time) int {
+	date := func(t time.Time) time.Time {
+		t = t.In(to.Location())
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int(date(to).Sub(date(from))/(24*time.Hour)) + 1
+}
@@ -0,0 +1,299 @@
+// Package plan works out decompression dive plans: the stop schedule for
+// a square profile, the gas each cylinder must supply and the reserve
+// each must keep back.
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/deco"
+)
+
+// Cylinder is a cylinder carried on the planned dive.
+type Cylinder struct {
+	Gas divelog.GasMix
+
+	// Switch is the depth at which the ascent switches to this cylinder.
+	// It is ignored for the first cylinder, which holds the bottom gas.
+	Switch divelog.Depth
+
+	// Volume is the water capacity and Pressure the fill pressure. Both
+	// are zero if the cylinder's size is not known, in which case only
+	// the gas used is reported.
+	Volume   divelog.Volume
+	Pressure divelog.Pressure
+}
+
+// Available returns the free gas volume in the cylinder when filled.
+func (c Cylinder) Available() divelog.Volume {
+	return divelog.Volume(float64(c.Volume) * float64(c.Pressure) / float64(divelog.StandardAtmosphere))
+}
+
+// Reserve selects how much gas a plan keeps back.
+type Reserve string
+
+const (
+	// RockBottom keeps enough bottom gas for two divers, breathing at
+	// the stressed rate, to spend a minute sorting out a problem at the
+	// deepest point and then ascend to the first gas switch or the
+	// surface. Deco cylinders keep back as much again as they supply.
+	RockBottom Reserve = "rockbottom"
+
+	// Thirds uses at most two thirds of each cylinder.
+	Thirds Reserve = "thirds"
+
+	NoReserve Reserve = "none"
+)
+
+// Plan describes a dive to plan.
+type Plan struct {
+	Depth divelog.Depth
+
+	// BottomTime runs from leaving the surface to leaving the bottom.
+	BottomTime time.Duration
+
+	// Cylinders lists the gases carried, bottom gas first.
+	Cylinders []Cylinder
+
+	// DescentRate is in metres per minute; the ascent rate, stop depths
+	// and gradient factors come from Deco.
+	DescentRate divelog.Depth
+	Deco        deco.Params
+
+	// SAC is the surface air consumption per minute on the bottom and
+	// DecoSAC that during stops. StressedSAC is the rate used for the
+	// rock bottom reserve; it defaults to one and a half times SAC.
+	SAC, DecoSAC, StressedSAC divelog.Volume
+
+	Reserve Reserve
+}
+
+// Leg is one stretch of the planned dive.
+type Leg struct {
+	deco.Segment
+	Cylinder int
+	Runtime  time.Duration // at the end of the leg
+}
+
+// GasUse is the gas planned from one cylinder.
+type GasUse struct {
+	Used    divelog.Volume
+	Reserve divelog.Volume
+
+	// Enough reports whether the cylinder holds Used plus Reserve. It is
+	// true when the cylinder's size is not known.
+	Enough bool
+}
+
+// Result is a worked out plan.
+type Result struct {
+	// Legs holds the descent, the time on the bottom and then each
+	// stretch of the ascent.
+	Legs    []Leg
+	Runtime time.Duration
+
+	// TTS is the time from leaving the bottom to surfacing.
+	TTS time.Duration
+
+	// Gas has one entry per cylinder of the plan.
+	Gas []GasUse
+
+	Warnings []Warning
+}
+
+// Stops returns the stop legs of the plan, leaving out the bottom.
+func (r *Result) Stops() []Leg {
+	var stops []Leg
+	for _, l := range r.Legs[2:] {
+		if l.IsStop() {
+			stops = append(stops, l)
+		}
+	}
+	return stops
+}
+
+// Warning flags a cylinder breathed at an oxygen partial pressure outside
+// the limits below.
+type Warning struct {
+	Cylinder int
+	Depth    divelog.Depth
+	PPO2     float64 // bar
+	Limit    float64 // bar; a minimum if PPO2 is below it
+}
+
+// Limits on the oxygen partial pressure, in bar, beyond which a plan is
+// flagged.
+const (
+	MaxBottomPPO2 = 1.4
+	MaxDecoPPO2   = 1.6
+	MinPPO2       = 0.16
+)
+
+func (p Plan) withDefaults() Plan {
+	if p.DescentRate == 0 {
+		p.DescentRate = deco.DefaultParams.DescentRate
+	}
+	if p.DecoSAC == 0 {
+		p.DecoSAC = p.SAC
+	}
+	if p.StressedSAC == 0 {
+		p.StressedSAC = p.SAC * 3 / 2
+	}
+	if p.Reserve == "" {
+		p.Reserve = RockBottom
+	}
+	return p
+}
+
+// Validate reports whether p can be planned.
+func (p Plan) Validate() error {
+	var errs []error
+	if p.Depth <= 0 {
+		errs = append(errs, errors.New("depth must be positive"))
+	}
+	if p.DescentRate < 0 || p.SAC < 0 || p.DecoSAC < 0 || p.StressedSAC < 0 {
+		errs = append(errs, errors.New("rates must be positive"))
+	} else if p.DescentRate > 0 && p.BottomTime < p.descent() {
+		errs = append(errs, fmt.Errorf("bottom time %v is shorter than the descent", p.BottomTime))
+	}
+	if len(p.Cylinders) == 0 {
+		errs = append(errs, errors.New("no cylinders"))
+	}
+	for i, c := range p.Cylinders {
+		if err := c.Gas.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("cylinder %d: %v", i+1, err))
+		}
+		if i > 0 && c.Switch <= 0 {
+			errs = append(errs, fmt.Errorf("cylinder %d: no switch depth", i+1))
+		}
+		if c.Volume < 0 || c.Pressure < 0 {
+			errs = append(errs, fmt.Errorf("cylinder %d: size must be positive", i+1))
+		}
+	}
+	switch p.Reserve {
+	case "", RockBottom, Thirds, NoReserve:
+	default:
+		errs = append(errs, fmt.Errorf("unknown reserve rule %q", p.Reserve))
+	}
+	return errors.Join(errs...)
+}
+
+func (p Plan) descent() time.Duration {
+	return time.Duration(float64(p.Depth) / float64(p.DescentRate) * float64(time.Minute))
+}
+
+// Make works out the plan.
+func Make(p Plan) (*Result, error) {
+	p = p.withDefaults()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	m, err := deco.New(p.Deco)
+	if err != nil {
+		return nil, err
+	}
+	water := divelog.SaltWater
+	ppO2 := func(g divelog.GasMix, d divelog.Depth) float64 {
+		return g.O2 * water.AmbientPressure(d, divelog.StandardAtmosphere).Bar()
+	}
+
+	bottomGas := p.Cylinders[0].Gas
+	var gases []deco.Gas
+	for _, c := range p.Cylinders[1:] {
+		gases = append(gases, deco.Gas{Mix: c.Gas, Depth: c.Switch})
+	}
+	res := &Result{Gas: make([]GasUse, len(p.Cylinders))}
+	add := func(s deco.Segment) {
+		res.Runtime += s.Duration
+		res.Legs = append(res.Legs, Leg{Segment: s, Cylinder: s.Source, Runtime: res.Runtime})
+	}
+	for _, s := range []deco.Segment{
+		{From: 0, To: p.Depth, Duration: p.descent(), Gas: bottomGas},
+		{From: p.Depth, To: p.Depth, Duration: p.BottomTime - p.descent(), Gas: bottomGas},
+	} {
+		m.Step(s)
+		add(s)
+	}
+	for _, s := range m.Ascent(p.Depth, bottomGas, gases) {
+		add(s)
+	}
+	res.TTS = res.Runtime - p.BottomTime
+
+	for i, l := range res.Legs {
+		sac := p.SAC
+		if i >= 2 && l.IsStop() {
+			sac = p.DecoSAC
+		}
+		res.Gas[l.Cylinder].Used += consumed(l.Segment, sac, water)
+	}
+	p.reserve(res, water)
+	for i, c := range p.Cylinders {
+		u := &res.Gas[i]
+		u.Enough = c.Volume == 0 || u.Used+u.Reserve <= c.Available()
+	}
+
+	warn := func(i int, d divelog.Depth, limit float64) {
+		pp := ppO2(p.Cylinders[i].Gas, d)
+		if (limit == MinPPO2 && pp < limit) || (limit != MinPPO2 && exceeds(pp, limit)) {
+			res.Warnings = append(res.Warnings, Warning{Cylinder: i, Depth: d, PPO2: pp, Limit: limit})
+		}
+	}
+	warn(0, p.Depth, MaxBottomPPO2)
+	warn(0, 0, MinPPO2)
+	for i, c := range p.Cylinders[1:] {
+		warn(i+1, c.Switch, MaxDecoPPO2)
+	}
+	return res, nil
+}
+
+// exceeds reports whether ppO2 is over limit at the 0.1 bar resolution
+// limits are quoted in, so that oxygen at 6 m (1.62 bar) is within 1.6.
+func exceeds(ppO2, limit float64) bool {
+	return math.Round(ppO2*10)/10 > limit
+}
+
+// SwitchDepth returns the deepest multiple of interval at which gas is
+// within MaxDecoPPO2.
+func SwitchDepth(gas divelog.GasMix, interval divelog.Depth) divelog.Depth {
+	surface := divelog.StandardAtmosphere
+	mod := divelog.SaltWater.DepthAt(divelog.Bar((MaxDecoPPO2+0.05)/gas.O2), surface)
+	d := divelog.Depth(int(mod/interval)) * interval
+	for d > 0 && exceeds(gas.O2*divelog.SaltWater.AmbientPressure(d, surface).Bar(), MaxDecoPPO2) {
+		d -= interval
+	}
+	return d
+}
+
+// consumed returns the free gas volume breathed during s at sac.
+func consumed(s deco.Segment, sac divelog.Volume, water divelog.Salinity) divelog.Volume {
+	surface := divelog.StandardAtmosphere
+	mean := (water.AmbientPressure(s.From, surface) + water.AmbientPressure(s.To, surface)) / 2
+	return divelog.Volume(float64(sac) * s.Duration.Minutes() * float64(mean) / float64(surface))
+}
+
+// reserve fills in the reserve of each cylinder in res.
+func (p Plan) reserve(res *Result, water divelog.Salinity) {
+	switch p.Reserve {
+	case Thirds:
+		for i := range res.Gas {
+			res.Gas[i].Reserve = res.Gas[i].Used / 2
+		}
+	case RockBottom:
+		// Two divers breathing at the stressed rate from the bottom to
+		// the first switch, stops included, after a minute at depth.
+		rb := consumed(deco.Segment{From: p.Depth, To: p.Depth, Duration: time.Minute}, 2*p.StressedSAC, water)
+		for _, l := range res.Legs[2:] {
+			if l.Cylinder == 0 {
+				rb += consumed(l.Segment, 2*p.StressedSAC, water)
+			}
+		}
+		res.Gas[0].Reserve = rb
+		for i := 1; i < len(res.Gas); i++ {
+			res.Gas[i].Reserve = res.Gas[i].Used
+		}
+	}
+}
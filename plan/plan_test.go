@@ -0,0 +1,225 @@
+package plan
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/deco"
+)
+
+var (
+	tx1845 = divelog.GasMix{O2: 0.18, He: 0.45}
+	ean50  = divelog.GasMix{O2: 0.50}
+)
+
+func trimixPlan() Plan {
+	return Plan{
+		Depth:      60,
+		BottomTime: 20 * time.Minute,
+		Cylinders: []Cylinder{
+			{Gas: tx1845, Volume: divelog.Liters(24), Pressure: divelog.Bar(230)},
+			{Gas: ean50, Switch: 21, Volume: divelog.Liters(11), Pressure: divelog.Bar(200)},
+			{Gas: divelog.Oxygen, Switch: 6, Volume: divelog.Liters(7), Pressure: divelog.Bar(200)},
+		},
+		Deco:    deco.Params{GFLow: 0.3, GFHigh: 0.8},
+		SAC:     divelog.Liters(20),
+		DecoSAC: divelog.Liters(15),
+	}
+}
+
+func TestMake(t *testing.T) {
+	res, err := Make(trimixPlan())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total time.Duration
+	for i, l := range res.Legs {
+		total += l.Duration
+		if l.Runtime != total {
+			t.Errorf("leg %d runtime = %v, want %v", i, l.Runtime, total)
+		}
+	}
+	if res.Runtime != total || res.TTS != total-20*time.Minute {
+		t.Errorf("Runtime = %v, TTS = %v, legs add up to %v", res.Runtime, res.TTS, total)
+	}
+
+	stops := res.Stops()
+	if len(stops) == 0 {
+		t.Fatal("no stops on a 60 m trimix dive")
+	}
+	for _, s := range stops {
+		if m := math.Mod(float64(s.From), 3); m > 1e-9 && m < 3-1e-9 {
+			t.Errorf("stop at %v m is not a multiple of 3 m", s.From)
+		}
+		want := 0
+		switch {
+		case s.From <= 6:
+			want = 2
+		case s.From <= 21:
+			want = 1
+		}
+		if s.Cylinder != want {
+			t.Errorf("stop at %v m on cylinder %d, want %d", s.From, s.Cylinder, want)
+		}
+	}
+	if last := stops[len(stops)-1]; last.From != 3 {
+		t.Errorf("last stop at %v m, want 3 m", last.From)
+	}
+
+	// Descent and bottom at 20 l/min, about 7 bar at 60 m.
+	descent := res.Legs[0].Duration.Minutes() * 20 * (1.01325 + 7.04) / 2 / 1.01325
+	bottom := res.Legs[1].Duration.Minutes() * 20 * 7.04 / 1.01325
+	if got := res.Gas[0].Used.Liters(); got < descent+bottom {
+		t.Errorf("bottom gas used = %.0f l, less than the %.0f l of descent and bottom", got, descent+bottom)
+	}
+	for i, u := range res.Gas {
+		if u.Used <= 0 || u.Reserve <= 0 {
+			t.Errorf("cylinder %d: used %v, reserve %v", i+1, u.Used, u.Reserve)
+		}
+		if !u.Enough {
+			t.Errorf("cylinder %d: not enough gas: %+v", i+1, u)
+		}
+	}
+	if res.Gas[1].Reserve != res.Gas[1].Used {
+		t.Errorf("rock bottom deco reserve = %v, want the gas used %v", res.Gas[1].Reserve, res.Gas[1].Used)
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("warnings = %+v", res.Warnings)
+	}
+}
+
+func TestSameMix(t *testing.T) {
+	// Two EAN50 stages, one switched to at 21 m and one carried for the
+	// shallow stops.
+	p := trimixPlan()
+	p.Cylinders[2] = Cylinder{Gas: ean50, Switch: 21, Volume: divelog.Liters(11), Pressure: divelog.Bar(200)}
+	p.Cylinders[1].Switch = 6
+	res, err := Make(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := res.Gas[1].Used; u != 0 {
+		t.Errorf("stage switched to at 6 m used %v with EAN50 already breathed from 21 m", u)
+	}
+	if u := res.Gas[2].Used; u <= 0 {
+		t.Errorf("stage switched to at 21 m used %v", u)
+	}
+	for _, s := range res.Stops() {
+		if s.From <= 21 && s.Cylinder != 2 {
+			t.Errorf("stop at %v m on cylinder %d, want 3", s.From, s.Cylinder+1)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	p := trimixPlan()
+	p.Reserve = Thirds
+	res, err := Make(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, u := range res.Gas {
+		if u.Reserve != u.Used/2 {
+			t.Errorf("cylinder %d: thirds reserve = %v for %v used", i+1, u.Reserve, u.Used)
+		}
+	}
+
+	rb := func(depth divelog.Depth) divelog.Volume {
+		p := Plan{
+			Depth:      depth,
+			BottomTime: 10 * time.Minute,
+			Cylinders:  []Cylinder{{Gas: divelog.Air}},
+			SAC:        divelog.Liters(20),
+		}
+		res, err := Make(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Gas[0].Reserve
+	}
+	// A minute at 18 m and a 2 minute ascent, for two divers at 30 l/min.
+	amb := divelog.SaltWater.AmbientPressure(18, divelog.StandardAtmosphere).Bar()
+	want := 2 * 30 * (amb + 2*(amb+1.01325)/2) / 1.01325
+	if got := rb(18).Liters(); math.Abs(got-want) > 0.01 {
+		t.Errorf("rock bottom at 18 m = %.1f l, want %.1f", got, want)
+	}
+	if rb(30) <= rb(18) {
+		t.Error("rock bottom does not grow with depth")
+	}
+
+	p = trimixPlan()
+	p.Cylinders[0].Volume = divelog.Liters(12)
+	res, err = Make(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Gas[0].Enough {
+		t.Errorf("a 12 l cylinder is enough for %v plus %v", res.Gas[0].Used, res.Gas[0].Reserve)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	p := trimixPlan()
+	p.Cylinders[0].Gas = divelog.GasMix{O2: 0.10, He: 0.70}
+	p.Cylinders[1].Switch = 24
+	res, err := Make(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		cylinder int
+		limit    float64
+	}{{0, MinPPO2}, {1, MaxDecoPPO2}}
+	if len(res.Warnings) != len(want) {
+		t.Fatalf("warnings = %+v", res.Warnings)
+	}
+	for i, w := range want {
+		if got := res.Warnings[i]; got.Cylinder != w.cylinder || got.Limit != w.limit {
+			t.Errorf("warning %d = %+v, want cylinder %d over %.2f", i, got, w.cylinder, w.limit)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Plan)
+		want   string
+	}{
+		{"no depth", func(p *Plan) { p.Depth = 0 }, "depth"},
+		{"short bottom time", func(p *Plan) { p.BottomTime = time.Minute }, "shorter than the descent"},
+		{"no cylinders", func(p *Plan) { p.Cylinders = nil }, "no cylinders"},
+		{"no switch depth", func(p *Plan) { p.Cylinders[1].Switch = 0 }, "cylinder 2: no switch depth"},
+		{"bad reserve", func(p *Plan) { p.Reserve = "halves" }, "reserve"},
+		{"bad gradient factors", func(p *Plan) { p.Deco.GFLow = 0.9 }, "GF low"},
+	}
+	for _, tt := range tests {
+		p := trimixPlan()
+		tt.mutate(&p)
+		_, err := Make(p)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Make = %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSwitchDepth(t *testing.T) {
+	tests := []struct {
+		gas  divelog.GasMix
+		want divelog.Depth
+	}{
+		{divelog.Oxygen, 6},
+		{ean50, 21},
+		{divelog.GasMix{O2: 0.32}, 39},
+		{divelog.GasMix{O2: 0.35, He: 0.25}, 36},
+	}
+	for _, tt := range tests {
+		if got := SwitchDepth(tt.gas, 3); got != tt.want {
+			t.Errorf("SwitchDepth(%v) = %v, want %v", tt.gas, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package divelog
+
+import "time"
+
+// Profile is a dive profile recorded by one of several computers worn on
+// a dive.
+type Profile struct {
+	Computer Equipment `json:"computer"`
+
+	// Offset places the profile on the dive's timeline: the sample at
+	// Time was taken Time+Offset into the dive. It makes up for the
+	// computers' clocks disagreeing and for them noticing the start of
+	// the dive at different depths.
+	Offset  time.Duration `json:"offset,omitempty"`
+	Samples []Sample      `json:"samples"`
+	Events  []Event       `json:"events,omitempty"`
+}
+
+// Primary returns the dive's primary profile as a Profile. Its computer
+// is d.Computer or, failing that, the only computer in d's equipment.
+func (d *Dive) Primary() Profile {
+	p := Profile{Samples: d.Samples, Events: d.Events}
+	if d.Computer != nil {
+		p.Computer = *d.Computer
+	} else if dcs := d.Computers(); len(dcs) == 1 {
+		p.Computer = dcs[0]
+	}
+	return p
+}
+
+// SetPrimary makes Profiles[i] the dive's primary profile, the one
+// analytics use. The current primary profile takes its place, or is
+// dropped if it has no samples. Start moves by the profile's offset, so
+// that every sample keeps its moment, and the summary is recomputed from
+// the new profile.
+func (d *Dive) SetPrimary(i int) {
+	p := d.Profiles[i]
+	old := d.Primary()
+	old.Offset = -p.Offset
+	for j := range d.Profiles {
+		d.Profiles[j].Offset -= p.Offset
+	}
+	if len(old.Samples) > 0 {
+		d.Profiles[i] = old
+	} else {
+		d.Profiles = append(d.Profiles[:i], d.Profiles[i+1:]...)
+	}
+	d.Start = d.Start.Add(p.Offset)
+	d.Samples, d.Events = p.Samples, p.Events
+	d.Computer = &p.Computer
+	d.Summarize()
+}
@@ -0,0 +1,394 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/betonavab/divelog"
+)
+
+// A SyntaxError reports a query that does not parse.
+type SyntaxError struct {
+	Offset int // in bytes, of the offending term
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query: column %d: %s", e.Offset+1, e.Msg)
+}
+
+// opChars are the characters operators are made of.
+const opChars = ":=!<>~"
+
+// Parse parses a query. Numbers are read in the units u, dates in the
+// local time zone. The empty query is the empty And, which matches every
+// dive.
+func Parse(src string, u divelog.UnitSystem) (Expr, error) {
+	p := &parser{src: src, units: u}
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t.text)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokCond
+	tokOpen
+	tokClose
+	tokNot
+	tokOr
+	tokAnd
+)
+
+type token struct {
+	kind   tokenKind
+	offset int
+	text   string // as written
+
+	// The parts of a tokCond, and the text of tokWord and tokPhrase.
+	field string
+	op    Op
+	value string
+}
+
+type parser struct {
+	src   string
+	units divelog.UnitSystem
+	toks  []token
+	pos   int
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Offset: t.offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// scan splits the query into tokens.
+func (p *parser) scan() error {
+	s := p.src
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '(':
+			p.toks = append(p.toks, token{kind: tokOpen, offset: i, text: "("})
+			i++
+			continue
+		case r == ')':
+			p.toks = append(p.toks, token{kind: tokClose, offset: i, text: ")"})
+			i++
+			continue
+		case r == '-' && i+1 < len(s) && !isSpace(s[i+1:]):
+			p.toks = append(p.toks, token{kind: tokNot, offset: i, text: "-"})
+			i++
+			continue
+		case r == '"':
+			v, n, err := unquote(s[i:])
+			if err != nil {
+				return &SyntaxError{Offset: i, Msg: err.Error()}
+			}
+			i += n
+			p.toks = append(p.toks, token{kind: tokPhrase, offset: start, text: s[start:i], value: v})
+			continue
+		}
+
+		// A field name is made of letters and followed by an operator;
+		// any other word runs to the next space or parenthesis.
+		j := i
+		for j < len(s) && isLetter(s[j]) {
+			j++
+		}
+		if j > i && j < len(s) && strings.IndexByte(opChars, s[j]) >= 0 {
+			t := token{kind: tokCond, offset: start, field: strings.ToLower(s[i:j])}
+			for _, op := range ops {
+				if strings.HasPrefix(s[j:], string(op)) {
+					t.op = op
+					break
+				}
+			}
+			if t.op == "" {
+				return &SyntaxError{Offset: j, Msg: fmt.Sprintf("unknown operator %q", s[j:j+1])}
+			}
+			i = j + len(t.op)
+			if i < len(s) && s[i] == '"' {
+				v, n, err := unquote(s[i:])
+				if err != nil {
+					return &SyntaxError{Offset: i, Msg: err.Error()}
+				}
+				t.value = v
+				i += n
+			} else {
+				end := i + wordLen(s[i:])
+				t.value = s[i:end]
+				i = end
+			}
+			t.text = s[start:i]
+			p.toks = append(p.toks, t)
+			continue
+		}
+		i += wordLen(s[i:])
+		t := token{kind: tokWord, offset: start, text: s[start:i], value: s[start:i]}
+		switch t.text {
+		case "OR":
+			t.kind = tokOr
+		case "AND":
+			t.kind = tokAnd
+		case "NOT":
+			t.kind = tokNot
+		}
+		p.toks = append(p.toks, t)
+	}
+	p.toks = append(p.toks, token{kind: tokEOF, offset: len(s), text: "end of query"})
+	return nil
+}
+
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+
+func isSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
+func isKeyword(s string) bool { return s == "OR" || s == "AND" || s == "NOT" }
+
+// wordLen returns the length of the word s starts with, which runs to the
+// next space or parenthesis.
+func wordLen(s string) int {
+	for i, r := range s {
+		if unicode.IsSpace(r) || r == '(' || r == ')' {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// unquote reads the Go-style quoted string s starts with, returning its
+// value and length.
+func unquote(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid quoted string %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string")
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// or parses terms joined by OR.
+func (p *parser) or() (Expr, error) {
+	var terms Or
+	for {
+		e, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		if or, ok := e.(Or); ok {
+			terms = append(terms, or...) // from parentheses
+		} else {
+			terms = append(terms, e)
+		}
+		if p.peek().kind != tokOr {
+			break
+		}
+		t := p.next()
+		if k := p.peek().kind; k == tokEOF || k == tokClose {
+			return nil, p.errorf(t, "OR needs a term on each side")
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+// and parses terms up to an OR, a closing parenthesis or the end.
+func (p *parser) and() (Expr, error) {
+	var terms And
+	for {
+		switch t := p.peek(); t.kind {
+		case tokEOF, tokOr, tokClose:
+			if len(terms) == 0 && t.kind != tokEOF {
+				return nil, p.errorf(t, "missing term before %s", t.text)
+			}
+			// A lone term stands for itself; the empty query is the
+			// empty And.
+			if len(terms) == 1 {
+				return terms[0], nil
+			}
+			return terms, nil
+		case tokAnd:
+			p.next()
+			if k := p.peek().kind; len(terms) == 0 || k == tokEOF || k == tokOr || k == tokClose {
+				return nil, p.errorf(t, "AND needs a term on each side")
+			}
+			continue
+		}
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if and, ok := e.(And); ok {
+			terms = append(terms, and...) // from parentheses
+		} else {
+			terms = append(terms, e)
+		}
+	}
+}
+
+func (p *parser) unary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		if k := p.peek().kind; k == tokEOF || k == tokOr || k == tokAnd || k == tokClose {
+			return nil, p.errorf(t, "%s needs a term", t.text)
+		}
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{x}, nil
+	case tokOpen:
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokClose {
+			return nil, p.errorf(t, "unclosed parenthesis")
+		}
+		return e, nil
+	case tokWord, tokPhrase:
+		return Text(t.value), nil
+	case tokCond:
+		return p.cond(t)
+	}
+	return nil, p.errorf(t, "unexpected %s", t.text)
+}
+
+// cond checks a condition's field and operator and parses its value.
+func (p *parser) cond(t token) (Expr, error) {
+	k, ok := fields[t.field]
+	if !ok {
+		return nil, p.errorf(t, "unknown field %q", t.field)
+	}
+	c := &Cond{Field: t.field, Op: t.op, Value: t.value, units: p.units}
+	valid := slices.Contains(kindOps[k], t.op)
+	if t.field == "after" || t.field == "before" {
+		valid = t.op == Has
+	}
+	if !valid {
+		return nil, p.errorf(t, "%s does not take %s", t.field, t.op)
+	}
+	if t.value == "" {
+		return nil, p.errorf(t, "%s%s needs a value", t.field, t.op)
+	}
+	var err error
+	switch k {
+	case numeric:
+		err = c.parseNumber()
+	case date:
+		err = c.parseDate()
+	case gas:
+		err = c.parseGas()
+	}
+	if err != nil {
+		return nil, p.errorf(t, "%s: %v", t.text, err)
+	}
+	return c, nil
+}
+
+func (c *Cond) parseNumber() error {
+	if c.Field == "duration" && strings.ContainsAny(c.Value, "hms") {
+		d, err := time.ParseDuration(c.Value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", c.Value)
+		}
+		c.num, c.scale = d.Minutes(), 60 // to the second
+		return nil
+	}
+	v, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid number %q", c.Value)
+	}
+	decimals := 0
+	if _, frac, ok := strings.Cut(c.Value, "."); ok {
+		decimals = len(frac)
+	}
+	c.num, c.scale = v, math.Pow10(decimals)
+	return nil
+}
+
+func (c *Cond) parseDate() error {
+	for _, f := range []struct {
+		layout      string
+		years, mons int
+		days        int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	} {
+		if t, err := time.ParseInLocation(f.layout, c.Value, time.Local); err == nil {
+			c.from, c.to = t, t.AddDate(f.years, f.mons, f.days)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q, want YYYY, YYYY-MM or YYYY-MM-DD", c.Value)
+}
+
+func (c *Cond) parseGas() error {
+	switch strings.ToLower(c.Value) {
+	case "nitrox":
+		c.gas = func(m divelog.GasMix) bool { return m.He == 0 && !m.IsAir() && m.O2 > divelog.Air.O2 }
+		return nil
+	case "trimix":
+		c.gas = func(m divelog.GasMix) bool { return m.He > 0 }
+		return nil
+	}
+	want, err := divelog.ParseGasMix(c.Value)
+	if err != nil {
+		return err
+	}
+	c.gas = func(m divelog.GasMix) bool {
+		// Give or take the rounding of computers that keep whole
+		// percentages.
+		return math.Abs(m.O2-want.O2) < 0.005 && math.Abs(m.He-want.He) < 0.005
+	}
+	return nil
+}
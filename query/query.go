@@ -0,0 +1,429 @@
+// Package query implements the search language of divelog list: a query
+// such as
+//
+//	depth>30 site~"Blue Hole" buddy:ana after:2024-01 tag:night
+//
+// is parsed into an expression tree that matches dives and runs against
+// any store. The conditions a store.Query can express are handed to the
+// store, so backends that keep indexes, such as SQLite, narrow the dives
+// before the rest of the expression is checked.
+//
+// A query is a list of terms, all of which must match. A term is a
+// condition on a field, written field, operator and value with no spaces
+// between them, or a bare word or quoted phrase, which the dive's notes
+// must contain. Terms are combined with OR, which binds looser than the
+// implied AND, negated with a leading - or NOT and grouped with
+// parentheses:
+//
+//	(site:canyon OR site:arch) -tag:training "manta"
+//
+// The fields are:
+//
+//	number, depth, duration, temp, rating
+//		numbers, compared with = (or :), !=, <, <=, > and >=. Depth
+//		is the maximum depth and temp the coldest temperature, both in
+//		the display units; duration is in minutes or a Go duration
+//		such as 1h10m. Equality holds to the precision written:
+//		depth:30 matches 29.5 to 30.5.
+//	date, after, before
+//		a year, month or day such as 2024, 2024-01 or 2024-01-15 in
+//		local time. date compares like a number, date:2024-01 being
+//		any day of January; after:2024-01 means from January on and
+//		before:2024-01 before January.
+//	site, country, buddy, computer, notes
+//		text. : and ~ match values containing the text, = and !=
+//		compare whole values, all ignoring case. Dives match buddy and
+//		computer conditions through any of their buddies or computers.
+//	tag
+//		: and = match dives with the tag, ~ dives with a tag containing
+//		the text and != dives without the tag.
+//	gas
+//		a mix such as air, EAN32 or 18/45, or nitrox or trimix for any
+//		such mix: : and = match dives breathing it, != dives that did
+//		not.
+package query
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+// Expr is a query expression.
+type Expr interface {
+	// Match reports whether d satisfies the expression.
+	Match(d *divelog.Dive) bool
+
+	// String returns the expression in the query language, such that
+	// parsing it gives the same expression.
+	String() string
+}
+
+// And matches dives that satisfy all of its expressions. The empty And
+// matches every dive.
+type And []Expr
+
+// Or matches dives that satisfy any of its expressions.
+type Or []Expr
+
+// Not matches dives that do not satisfy X.
+type Not struct{ X Expr }
+
+// Text matches dives whose notes contain it, ignoring case.
+type Text string
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	Has  Op = ":"
+	Eq   Op = "="
+	Ne   Op = "!="
+	Lt   Op = "<"
+	Le   Op = "<="
+	Gt   Op = ">"
+	Ge   Op = ">="
+	Like Op = "~"
+)
+
+// ops are the operators, longest first so that scanning finds "<=" before
+// "<".
+var ops = []Op{Ne, Le, Ge, Has, Eq, Lt, Gt, Like}
+
+// Cond is a condition on a field of the dive, such as depth>30.
+type Cond struct {
+	Field string
+	Op    Op
+	Value string // as written
+
+	units divelog.UnitSystem
+	num   float64 // numeric fields, in the display units or minutes
+	scale float64 // numbers are equal when they round alike at 1/scale
+	from  time.Time
+	to    time.Time // date fields: the period Value names
+	gas   func(divelog.GasMix) bool
+}
+
+// A kind is the type of a field, which decides its operators and how its
+// value is parsed.
+type kind int
+
+const (
+	numeric kind = iota
+	date
+	text
+	tag
+	gas
+)
+
+var fields = map[string]kind{
+	"number":   numeric,
+	"depth":    numeric,
+	"duration": numeric,
+	"temp":     numeric,
+	"rating":   numeric,
+	"date":     date,
+	"after":    date,
+	"before":   date,
+	"site":     text,
+	"country":  text,
+	"buddy":    text,
+	"computer": text,
+	"notes":    text,
+	"tag":      tag,
+	"gas":      gas,
+}
+
+// kindOps are the operators each kind of field takes.
+var kindOps = map[kind][]Op{
+	numeric: {Has, Eq, Ne, Lt, Le, Gt, Ge},
+	date:    {Has, Eq, Ne, Lt, Le, Gt, Ge},
+	text:    {Has, Like, Eq, Ne},
+	tag:     {Has, Eq, Like, Ne},
+	gas:     {Has, Eq, Ne},
+}
+
+func (e And) Match(d *divelog.Dive) bool {
+	for _, x := range e {
+		if !x.Match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e Or) Match(d *divelog.Dive) bool {
+	for _, x := range e {
+		if x.Match(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Not) Match(d *divelog.Dive) bool { return !e.X.Match(d) }
+
+func (e Text) Match(d *divelog.Dive) bool { return containsFold(d.Notes, string(e)) }
+
+func (c *Cond) Match(d *divelog.Dive) bool {
+	switch fields[c.Field] {
+	case numeric:
+		x, ok := c.number(d)
+		return ok && compare(math.Round(x*1e6)/1e6, c.num, c.scale, c.Op)
+	case date:
+		return c.matchDate(d.Start)
+	case gas:
+		found := slices.ContainsFunc(d.Tanks, func(t divelog.Tank) bool { return c.gas(t.Gas) })
+		return found == (c.Op != Ne)
+	}
+	values := c.strings(d)
+	contains := func(v string) bool { return containsFold(v, c.Value) }
+	equals := func(v string) bool { return strings.EqualFold(v, c.Value) }
+	switch {
+	case c.Op == Ne:
+		return !slices.ContainsFunc(values, equals)
+	case c.Op == Like, c.Op == Has && c.Field != "tag":
+		return slices.ContainsFunc(values, contains)
+	}
+	return slices.ContainsFunc(values, equals)
+}
+
+// number returns the value of a numeric field, reporting false if the
+// dive does not record it.
+func (c *Cond) number(d *divelog.Dive) (float64, bool) {
+	switch c.Field {
+	case "number":
+		return float64(d.Number), true
+	case "depth":
+		return c.units.DepthValue(d.MaxDepth), true
+	case "duration":
+		return d.Duration.Minutes(), true
+	case "temp":
+		return c.units.TemperatureValue(d.MinTemperature), d.MinTemperature != 0
+	case "rating":
+		return float64(d.Rating), d.Rating != 0
+	}
+	return 0, false
+}
+
+func compare(x, v, scale float64, op Op) bool {
+	switch op {
+	case Ne:
+		return math.Round(x*scale) != math.Round(v*scale)
+	case Lt:
+		return x < v
+	case Le:
+		return x <= v
+	case Gt:
+		return x > v
+	case Ge:
+		return x >= v
+	}
+	return math.Round(x*scale) == math.Round(v*scale)
+}
+
+// dateOp returns the operator a date condition compares with: after and
+// before are shorthands.
+func (c *Cond) dateOp() Op {
+	switch c.Field {
+	case "after":
+		return Ge
+	case "before":
+		return Lt
+	}
+	return c.Op
+}
+
+func (c *Cond) matchDate(t time.Time) bool {
+	switch c.dateOp() {
+	case Ne:
+		return t.Before(c.from) || !t.Before(c.to)
+	case Lt:
+		return t.Before(c.from)
+	case Le:
+		return t.Before(c.to)
+	case Gt:
+		return !t.Before(c.to)
+	case Ge:
+		return !t.Before(c.from)
+	}
+	return !t.Before(c.from) && t.Before(c.to)
+}
+
+// strings returns the values of a text field or the dive's tags.
+func (c *Cond) strings(d *divelog.Dive) []string {
+	var values []string
+	switch c.Field {
+	case "site":
+		if d.Site != nil {
+			values = append(values, d.Site.Name)
+		}
+	case "country":
+		if d.Site != nil {
+			values = append(values, d.Site.Country)
+		}
+	case "buddy":
+		for _, b := range d.Buddies {
+			values = append(values, b.Name)
+		}
+	case "computer":
+		dcs := d.Computers()
+		if d.Computer != nil {
+			dcs = append(dcs, *d.Computer)
+		}
+		for _, p := range d.Profiles {
+			dcs = append(dcs, p.Computer)
+		}
+		for _, dc := range dcs {
+			values = append(values, dc.Name, dc.Serial, strings.TrimSpace(dc.Name+" "+dc.Serial))
+		}
+	case "notes":
+		values = append(values, d.Notes)
+	case "tag":
+		values = d.Tags
+	}
+	return values
+}
+
+func (e And) String() string {
+	terms := make([]string, len(e))
+	for i, x := range e {
+		if _, ok := x.(Or); ok {
+			terms[i] = "(" + x.String() + ")"
+		} else {
+			terms[i] = x.String()
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+func (e Or) String() string {
+	terms := make([]string, len(e))
+	for i, x := range e {
+		terms[i] = x.String()
+	}
+	return strings.Join(terms, " OR ")
+}
+
+func (e Not) String() string {
+	switch e.X.(type) {
+	case And, Or:
+		return "-(" + e.X.String() + ")"
+	}
+	return "-" + e.X.String()
+}
+
+func (e Text) String() string {
+	s := string(e)
+	if s == "" || s[0] == '-' || isKeyword(s) || strings.ContainsAny(s, " \t\n\"()"+opChars) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (c *Cond) String() string {
+	v := c.Value
+	if v == "" || strings.ContainsAny(v, " \t\n\"()") {
+		v = strconv.Quote(v)
+	}
+	return c.Field + string(c.Op) + v
+}
+
+// Run returns the dives in s that satisfy both base and e, ordered by
+// number. The conditions of e that every matching dive must meet and that
+// a store.Query can express are added to base for the store to apply;
+// the rest of e is checked against the dives it returns.
+func Run(s store.Store, e Expr, base store.Query) ([]*divelog.Dive, error) {
+	q := base
+	Narrow(e, &q)
+	dives, err := s.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	matched := dives[:0]
+	for _, d := range dives {
+		if base.Match(d) && e.Match(d) {
+			matched = append(matched, d)
+		}
+	}
+	return matched, nil
+}
+
+// Narrow tightens q with the conditions of e that every dive matching e
+// satisfies and that q can express. The dives q then matches include all
+// of those matching e, and perhaps others.
+func Narrow(e Expr, q *store.Query) {
+	switch e := e.(type) {
+	case And:
+		for _, x := range e {
+			Narrow(x, q)
+		}
+	case Text:
+		q.Text = append(q.Text, string(e))
+	case *Cond:
+		e.narrow(q)
+	}
+}
+
+// slack widens the depth bounds handed to a store by more than converting
+// them to and from the display units can shift them.
+const slack = 1e-6
+
+func (c *Cond) narrow(q *store.Query) {
+	switch c.Field {
+	case "depth":
+		lo, hi := 0.0, 0.0
+		switch c.Op {
+		case Gt, Ge:
+			lo = c.num
+		case Lt, Le:
+			hi = c.num
+		case Has, Eq:
+			lo, hi = c.num-0.5/c.scale, c.num+0.5/c.scale
+		}
+		if d := c.units.Depth(lo) - slack; lo > 0 && d > q.MinDepth {
+			q.MinDepth = d
+		}
+		if d := c.units.Depth(hi) + slack; hi > 0 && (q.MaxDepth == 0 || d < q.MaxDepth) {
+			q.MaxDepth = d
+		}
+	case "date", "after", "before":
+		from, to := time.Time{}, time.Time{}
+		switch c.dateOp() {
+		case Has, Eq:
+			from, to = c.from, c.to
+		case Lt:
+			to = c.from
+		case Le:
+			to = c.to
+		case Gt:
+			from = c.to
+		case Ge:
+			from = c.from
+		}
+		if from.After(q.From) {
+			q.From = from
+		}
+		if !to.IsZero() && (q.To.IsZero() || to.Before(q.To)) {
+			q.To = to
+		}
+	case "site":
+		if c.Op != Ne && q.Site == "" {
+			q.Site = c.Value
+		}
+	case "notes":
+		if c.Op != Ne {
+			q.Text = append(q.Text, c.Value)
+		}
+	}
+}
+
+// containsFold reports whether s contains substr, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
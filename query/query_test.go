@@ -0,0 +1,259 @@
+package query
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+	"github.com/betonavab/divelog/store/sqlite"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{``, ``},
+		{`depth>30 site~"Blue Hole" buddy:ana after:2024-01 tag:night`, `depth>30 site~"Blue Hole" buddy:ana after:2024-01 tag:night`},
+		{`Depth>=30`, `depth>=30`},
+		{`  turtle  "manta ray" `, `turtle "manta ray"`},
+		{`a b OR c`, `a b OR c`},
+		{`a (b OR c)`, `a (b OR c)`},
+		{`(a b) c`, `a b c`},
+		{`a OR (b OR c)`, `a OR b OR c`},
+		{`a AND b`, `a b`},
+		{`-tag:training NOT site:arch`, `-tag:training -site:arch`},
+		{`-(a OR b)`, `-(a OR b)`},
+		{`"-" "OR" "10:30"`, `"-" "OR" "10:30"`},
+		{`notes:"say \"hi\""`, `notes:"say \"hi\""`},
+		{`duration<1h10m temp<=-2 rating!=3 gas:ean32 date:2024`, `duration<1h10m temp<=-2 rating!=3 gas:ean32 date:2024`},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src, divelog.Metric)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+		again, err := Parse(e.String(), divelog.Metric)
+		if err != nil || again.String() != e.String() {
+			t.Errorf("reparsing %q: %v, %v", e.String(), again, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		column int
+	}{
+		{`dpeth>30`, 1},
+		{`depth~30`, 1},
+		{`depth>deep`, 1},
+		{`site:ok after>2024`, 9},
+		{`date:2024-13`, 1},
+		{`gas:soup`, 1},
+		{`tag:`, 1},
+		{`"manta`, 1},
+		{`site:"Blue`, 6},
+		{`a OR`, 3},
+		{`OR a`, 1},
+		{`(a`, 1},
+		{`a)`, 2},
+		{`()`, 2},
+		{`a AND`, 3},
+		{`NOT`, 1},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src, divelog.Metric)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q) = %v, want a syntax error", tt.src, err)
+			continue
+		}
+		if se.Offset+1 != tt.column {
+			t.Errorf("Parse(%q): %v, want column %d", tt.src, err, tt.column)
+		}
+	}
+}
+
+func dives() []*divelog.Dive {
+	day := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 20, 0, 0, 0, time.Local) }
+	ean32, _ := divelog.ParseGasMix("EAN32")
+	return []*divelog.Dive{
+		{Number: 1, Start: day(1, 10), Duration: 45 * time.Minute, MaxDepth: 30.2, MinTemperature: divelog.Celsius(24),
+			Site: &divelog.Site{Name: "Blue Hole", Country: "Belize"}, Buddies: []divelog.Buddy{{Name: "Ana"}},
+			Tanks: []divelog.Tank{{Gas: divelog.Air}}, Tags: []string{"night"}, Rating: 4, Notes: "Turtles under the arch."},
+		{Number: 2, Start: day(2, 3), Duration: 62 * time.Minute, MaxDepth: 18, MinTemperature: divelog.Celsius(26),
+			Site: &divelog.Site{Name: "Coral Canyon", Country: "Belize"}, Buddies: []divelog.Buddy{{Name: "Anabel"}, {Name: "Joe"}},
+			Tanks: []divelog.Tank{{Gas: ean32}}, Rating: 2, Notes: "A manta ray at the cleaning station"},
+		{Number: 3, Start: day(3, 15), Duration: 38 * time.Minute, MaxDepth: 41,
+			Site: &divelog.Site{Name: "Great Blue Hole"}, Tanks: []divelog.Tank{{Gas: divelog.GasMix{O2: 0.18, He: 0.45}}},
+			Tags: []string{"Night", "training"}, Equipment: []divelog.Equipment{{Kind: divelog.Computer, Name: "OSTC", Serial: "1234"}}},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []int
+	}{
+		{``, []int{1, 2, 3}},
+		{`depth>30`, []int{1, 3}},
+		{`depth:30`, []int{1}},
+		{`depth:30.0`, nil},
+		{`depth=30.2`, []int{1}},
+		{`depth<=18`, []int{2}},
+		{`duration>=45`, []int{1, 2}},
+		{`duration>1h`, []int{2}},
+		{`temp<25`, []int{1}},
+		{`temp!=24`, []int{2}},
+		{`rating>=2 rating<4`, []int{2}},
+		{`number!=2`, []int{1, 3}},
+		{`after:2024-02`, []int{2, 3}},
+		{`before:2024-02`, []int{1}},
+		{`date:2024-02`, []int{2}},
+		{`date:2024-03-15`, []int{3}},
+		{`date!=2024-02`, []int{1, 3}},
+		{`date>2024-01`, []int{2, 3}},
+		{`date<=2024-02`, []int{1, 2}},
+		{`date:2023`, nil},
+		{`site:blue`, []int{1, 3}},
+		{`site~"Blue Hole"`, []int{1, 3}},
+		{`site="blue hole"`, []int{1}},
+		{`site!="blue hole"`, []int{2, 3}},
+		{`country:belize`, []int{1, 2}},
+		{`buddy:ana`, []int{1, 2}},
+		{`buddy=ana`, []int{1}},
+		{`buddy!=ana`, []int{2, 3}},
+		{`computer:ostc`, []int{3}},
+		{`computer="OSTC 1234"`, []int{3}},
+		{`tag:night`, []int{1, 3}},
+		{`tag:nig`, nil},
+		{`tag~nig`, []int{1, 3}},
+		{`tag!=training`, []int{1, 2}},
+		{`gas:air`, []int{1}},
+		{`gas:32`, []int{2}},
+		{`gas:nitrox`, []int{2}},
+		{`gas:trimix`, []int{3}},
+		{`gas!=air`, []int{2, 3}},
+		{`turtle`, []int{1}},
+		{`"MANTA RAY"`, []int{2}},
+		{`notes:manta`, []int{2}},
+		{`turtle OR manta`, []int{1, 2}},
+		{`-tag:night`, []int{2}},
+		{`site:blue -(tag:training OR depth<20)`, []int{1}},
+		{`depth>30 site~"Blue Hole" buddy:ana after:2024-01 tag:night`, []int{1}},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src, divelog.Metric)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		var got []int
+		for _, d := range dives() {
+			if e.Match(d) {
+				got = append(got, d.Number)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got dives %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestImperial(t *testing.T) {
+	d := &divelog.Dive{MaxDepth: divelog.Feet(100), MinTemperature: divelog.Fahrenheit(75)}
+	for _, src := range []string{`depth>=100`, `depth:100`, `depth<=100`, `temp:75`, `temp>74.5`} {
+		e, err := Parse(src, divelog.Imperial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !e.Match(d) {
+			t.Errorf("%s does not match a 100 ft, 75°F dive", src)
+		}
+		q := store.Query{}
+		Narrow(e, &q)
+		if !q.Match(d) {
+			t.Errorf("%s: narrowed to %+v, which misses the dive", src, q)
+		}
+	}
+}
+
+func TestNarrow(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	feb := jan.AddDate(0, 1, 0)
+	tests := []struct {
+		src  string
+		want store.Query
+	}{
+		{`depth>30 depth>20 depth<40`, store.Query{MinDepth: 30 - slack, MaxDepth: 40 + slack}},
+		{`depth:30`, store.Query{MinDepth: 29.5 - slack, MaxDepth: 30.5 + slack}},
+		{`date:2024-01`, store.Query{From: jan, To: feb}},
+		{`after:2024-01 before:2024-02`, store.Query{From: jan, To: feb}},
+		{`date>2024-01`, store.Query{From: feb}},
+		{`site:blue site:hole turtle notes:ray`, store.Query{Site: "blue", Text: []string{"turtle", "ray"}}},
+		{`site!=blue -turtle notes!=ray`, store.Query{}},
+		{`depth>30 OR turtle`, store.Query{}},
+		{`(depth>30 turtle) OR manta`, store.Query{}},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src, divelog.Metric)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var q store.Query
+		Narrow(e, &q)
+		if !reflect.DeepEqual(q, tt.want) {
+			t.Errorf("%s: narrowed to %+v, want %+v", tt.src, q, tt.want)
+		}
+	}
+}
+
+// TestRun runs queries against each backend, which must agree with
+// matching every dive.
+func TestRun(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "log.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	backends := map[string]store.Store{"memory": store.NewMemory(), "sqlite": db}
+	for _, s := range backends {
+		for _, d := range dives() {
+			if err := s.Put(d); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	base := store.Query{To: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)}
+	for _, src := range []string{``, `depth>30`, `site:blue turtle`, `"manta ray" date:2024-02`, `ray OR depth:41`, `-arch`} {
+		e, err := Parse(src, divelog.Metric)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []int
+		for _, d := range dives() {
+			if base.Match(d) && e.Match(d) {
+				want = append(want, d.Number)
+			}
+		}
+		for name, s := range backends {
+			dives, err := Run(s, e, base)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var got []int
+			for _, d := range dives {
+				got = append(got, d.Number)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s: got dives %v, want %v", name, src, got, want)
+			}
+		}
+	}
+}
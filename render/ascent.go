@@ -0,0 +1,62 @@
+package render
+
+import (
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// span is a stretch of a dive.
+type span struct{ start, end time.Duration }
+
+// fastAscents returns the stretches of a profile where the ascent rate,
+// averaged over window, is above limit per minute. Each stretch starts a
+// window before the first sample found too fast, so it covers the ascent
+// that made it so.
+func fastAscents(samples []divelog.Sample, limit divelog.Depth, window time.Duration) []span {
+	var spans []span
+	for _, s := range samples[1:] {
+		from := max(s.Time-window, samples[0].Time)
+		dt := s.Time - from
+		if dt <= 0 {
+			continue
+		}
+		rate := float64(depthAt(samples, from)-s.Depth) / dt.Minutes()
+		if rate <= float64(limit) {
+			continue
+		}
+		if n := len(spans); n > 0 && spans[n-1].end >= from {
+			spans[n-1].end = s.Time
+		} else {
+			spans = append(spans, span{from, s.Time})
+		}
+	}
+	return spans
+}
+
+// depthAt returns the depth at t, interpolating between samples.
+func depthAt(samples []divelog.Sample, t time.Duration) divelog.Depth {
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		if t <= b.Time {
+			if b.Time == a.Time {
+				return b.Depth
+			}
+			f := float64(t-a.Time) / float64(b.Time-a.Time)
+			return a.Depth + divelog.Depth(f*float64(b.Depth-a.Depth))
+		}
+	}
+	return samples[len(samples)-1].Depth
+}
+
+// clip returns the part of a profile from start to end, with samples
+// interpolated at both ends.
+func clip(samples []divelog.Sample, start, end time.Duration) []divelog.Sample {
+	out := []divelog.Sample{{Time: start, Depth: depthAt(samples, start)}}
+	for _, s := range samples {
+		if s.Time > start && s.Time < end {
+			out = append(out, s)
+		}
+	}
+	return append(out, divelog.Sample{Time: end, Depth: depthAt(samples, end)})
+}
@@ -0,0 +1,129 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+)
+
+// rasterCanvas draws into an image. Lines and shapes are not
+// antialiased.
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func newRaster(w, h int) *rasterCanvas {
+	return &rasterCanvas{img: image.NewRGBA(image.Rect(0, 0, w, h))}
+}
+
+// blend paints pixel (x, y) with c over what is there.
+func (c *rasterCanvas) blend(x, y int, col color.RGBA) {
+	if !(image.Point{x, y}.In(c.img.Rect)) {
+		return
+	}
+	if col.A == 255 {
+		c.img.SetRGBA(x, y, col)
+		return
+	}
+	a := float64(col.A) / 255
+	old := c.img.RGBAAt(x, y)
+	mix := func(n, o uint8) uint8 { return uint8(math.Round(float64(n)*a + float64(o)*(1-a))) }
+	c.img.SetRGBA(x, y, color.RGBA{mix(col.R, old.R), mix(col.G, old.G), mix(col.B, old.B), 255})
+}
+
+func (c *rasterCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	for py := int(math.Round(y)); py < int(math.Round(y+h)); py++ {
+		for px := int(math.Round(x)); px < int(math.Round(x+w)); px++ {
+			c.blend(px, py, col)
+		}
+	}
+}
+
+// polyline stamps a square of the line's width every half pixel along
+// it. Dashes are 4 pixels on and 3 off.
+func (c *rasterCanvas) polyline(pts []point, col color.RGBA, width float64, dashed bool) {
+	// Collect the pixels first so that translucent lines are painted once
+	// where the stamps overlap.
+	seen := map[image.Point]bool{}
+	half := width / 2
+	var dist float64
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		length := math.Hypot(b.x-a.x, b.y-a.y)
+		steps := max(int(math.Ceil(length*2)), 1)
+		for s := 0; s <= steps; s++ {
+			f := float64(s) / float64(steps)
+			if dashed && math.Mod(dist+f*length, 7) >= 4 {
+				continue
+			}
+			x, y := a.x+f*(b.x-a.x), a.y+f*(b.y-a.y)
+			for py := int(math.Floor(y - half + 0.5)); py < int(math.Floor(y+half+0.5)); py++ {
+				for px := int(math.Floor(x - half + 0.5)); px < int(math.Floor(x+half+0.5)); px++ {
+					seen[image.Point{px, py}] = true
+				}
+			}
+		}
+		dist += length
+	}
+	for p := range seen {
+		c.blend(p.X, p.Y, col)
+	}
+}
+
+// polygon fills pts with the even-odd rule, sampling each pixel at its
+// centre.
+func (c *rasterCanvas) polygon(pts []point, col color.RGBA) {
+	if len(pts) < 3 {
+		return
+	}
+	top, bottom := math.Inf(1), math.Inf(-1)
+	for _, p := range pts {
+		top, bottom = min(top, p.y), max(bottom, p.y)
+	}
+	var xs []float64
+	for py := int(math.Floor(top)); py <= int(math.Ceil(bottom)); py++ {
+		y := float64(py) + 0.5
+		xs = xs[:0]
+		for i := range pts {
+			a, b := pts[i], pts[(i+1)%len(pts)]
+			if (a.y <= y) != (b.y <= y) {
+				xs = append(xs, a.x+(y-a.y)/(b.y-a.y)*(b.x-a.x))
+			}
+		}
+		slices.Sort(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for px := int(math.Ceil(xs[i] - 0.5)); float64(px)+0.5 <= xs[i+1]; px++ {
+				c.blend(px, py, col)
+			}
+		}
+	}
+}
+
+func (c *rasterCanvas) text(x, y float64, s string, col color.RGBA, a anchor) {
+	w := float64(textWidth(s, 1))
+	switch a {
+	case middle:
+		x -= w / 2
+	case end:
+		x -= w
+	}
+	left, top := int(math.Round(x)), int(math.Round(y-glyphHeight/2.0))
+	for _, r := range s {
+		g := glyph(r)
+		for gx, bits := range g {
+			for row := range glyphHeight {
+				if bits&(1<<row) != 0 {
+					c.blend(left+gx, top+row, col)
+				}
+			}
+		}
+		left += glyphWidth + 1
+	}
+}
+
+func (c *rasterCanvas) write(w io.Writer) error {
+	return png.Encode(w, c.img)
+}
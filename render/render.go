@@ -0,0 +1,388 @@
+// Package render draws dive profiles as charts: depth over time, with
+// optional deco ceiling, gas switches, tank pressure and temperature, and
+// too-fast ascents picked out. Charts are written as SVG or PNG entirely in
+// Go; PNG text uses a small built-in bitmap font. StatsSVG draws a log's
+// statistics.
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/deco"
+)
+
+// ErrNoProfile is returned for dives logged without samples.
+var ErrNoProfile = errors.New("dive has no profile")
+
+// Options controls what a chart shows. The zero value draws depth, tank
+// pressure and temperature at 900×500 in metric units.
+type Options struct {
+	Width, Height int
+	Units         divelog.UnitSystem
+
+	// Ceiling overlays the decompression ceiling worked out with Deco.
+	Ceiling bool
+	Deco    deco.Params
+
+	// NoPressure and NoTemperature leave out the traces below the depth
+	// profile; without either the profile takes the whole chart.
+	NoPressure    bool
+	NoTemperature bool
+
+	// MaxAscentRate is the ascent rate, per minute, above which the
+	// profile is drawn in red; zero means 10 m/min. Rates are averaged
+	// over AscentWindow.
+	MaxAscentRate divelog.Depth
+}
+
+// AscentWindow is the period over which ascent rates are averaged, so that
+// a single noisy sample is not taken for a fast ascent.
+const AscentWindow = 30 * time.Second
+
+func (o Options) withDefaults() Options {
+	if o.Width == 0 {
+		o.Width = 900
+	}
+	if o.Height == 0 {
+		o.Height = 500
+	}
+	if o.MaxAscentRate == 0 {
+		o.MaxAscentRate = 10
+	}
+	return o
+}
+
+// SVG writes a chart of d's profile as an SVG document.
+func SVG(w io.Writer, d *divelog.Dive, o Options) error {
+	o = o.withDefaults()
+	c := newSVG(o.Width, o.Height)
+	if err := draw(c, d, o); err != nil {
+		return err
+	}
+	return c.write(w)
+}
+
+// PNG writes a chart of d's profile as a PNG image.
+func PNG(w io.Writer, d *divelog.Dive, o Options) error {
+	o = o.withDefaults()
+	c := newRaster(o.Width, o.Height)
+	if err := draw(c, d, o); err != nil {
+		return err
+	}
+	return c.write(w)
+}
+
+// point is a position on the chart in pixels, from the top left.
+type point struct{ x, y float64 }
+
+// anchor is where a text's position is along it.
+type anchor int
+
+const (
+	start anchor = iota
+	middle
+	end
+)
+
+// canvas is what the chart is drawn on: an SVG document or an image.
+type canvas interface {
+	rect(x, y, w, h float64, c color.RGBA)
+	polyline(pts []point, c color.RGBA, width float64, dashed bool)
+	polygon(pts []point, c color.RGBA)
+	// text draws s with its vertical middle at y.
+	text(x, y float64, s string, c color.RGBA, a anchor)
+}
+
+// Colours of the chart's elements.
+var (
+	white       = color.RGBA{255, 255, 255, 255}
+	black       = color.RGBA{40, 40, 40, 255}
+	grid        = color.RGBA{225, 225, 225, 255}
+	depthColour = color.RGBA{31, 119, 180, 255}
+	ceilColour  = color.RGBA{214, 39, 40, 64}
+	fastColour  = color.RGBA{214, 39, 40, 255}
+	gasColour   = color.RGBA{44, 160, 44, 255}
+	pressColour = color.RGBA{255, 127, 14, 255}
+	tempColour  = color.RGBA{148, 103, 189, 255}
+)
+
+// Layout in pixels.
+const (
+	marginLeft   = 60
+	marginRight  = 60
+	marginTop    = 40
+	marginBottom = 36
+	panelGap     = 28
+	tickLength   = 4
+)
+
+// axis maps data values onto pixels.
+type axis struct{ v0, v1, p0, p1 float64 }
+
+func (a axis) at(v float64) float64 {
+	if a.v1 == a.v0 {
+		return a.p0
+	}
+	return a.p0 + (v-a.v0)/(a.v1-a.v0)*(a.p1-a.p0)
+}
+
+// niceStep returns a round tick interval, 1, 2 or 5 times a power of ten,
+// that divides span into at most about n parts.
+func niceStep(span float64, n int) float64 {
+	if span <= 0 {
+		return 1
+	}
+	raw := span / float64(n)
+	pow := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*pow >= raw {
+			return m * pow
+		}
+	}
+	return 10 * pow
+}
+
+// formatTick formats a tick value with no more decimals than step needs.
+func formatTick(v, step float64) string {
+	decimals := max(0, int(math.Ceil(-math.Log10(step)-1e-9)))
+	return fmt.Sprintf("%.*f", decimals, v)
+}
+
+func draw(c canvas, d *divelog.Dive, o Options) error {
+	if len(d.Samples) == 0 {
+		return ErrNoProfile
+	}
+	u := o.Units
+	c.rect(0, 0, float64(o.Width), float64(o.Height), white)
+
+	title := fmt.Sprintf("Dive #%d  %s", d.Number, d.Start.Format("2006-01-02 15:04"))
+	if d.Site != nil && d.Site.Name != "" {
+		title += "  " + d.Site.Name
+	}
+	c.text(marginLeft, marginTop/2, title, black, start)
+
+	samples := d.Samples
+	duration := samples[len(samples)-1].Time.Minutes()
+	var maxDepth float64
+	for _, s := range samples {
+		maxDepth = max(maxDepth, u.DepthValue(s.Depth))
+	}
+
+	var ceiling []deco.Point
+	if o.Ceiling {
+		res, err := deco.Audit(d, o.Deco)
+		if err != nil {
+			return err
+		}
+		ceiling = res.Points
+	}
+
+	pressures := !o.NoPressure && hasPressure(d)
+	temps := !o.NoTemperature && hasTemperature(d)
+	left, right := float64(marginLeft), float64(o.Width-marginRight)
+	top, bottom := float64(marginTop), float64(o.Height-marginBottom)
+	mainBottom := bottom
+	if pressures || temps {
+		mainBottom = top + (bottom-top-panelGap)*0.68
+	}
+
+	tStep := niceStep(duration, 10)
+	tEnd := math.Ceil(duration/tStep) * tStep
+	tx := axis{0, tEnd, left, right}
+	dStep := niceStep(maxDepth, 6)
+	dy := axis{0, math.Ceil(maxDepth*1.05/dStep) * dStep, top, mainBottom}
+
+	// Grid and axes of the depth panel.
+	for v := 0.0; v <= dy.v1+1e-9; v += dStep {
+		y := dy.at(v)
+		c.polyline([]point{{left, y}, {right, y}}, grid, 1, false)
+		c.text(left-tickLength-2, y, formatTick(v, dStep), black, end)
+	}
+	c.text(left-tickLength-2, top-14, u.DepthUnit(), black, end)
+	timeAxis(c, tx, tStep, mainBottom, top)
+
+	minute := func(t time.Duration) float64 { return tx.at(t.Minutes()) }
+	if len(ceiling) > 0 {
+		pts := []point{{minute(ceiling[0].Time), dy.at(0)}}
+		for _, p := range ceiling {
+			pts = append(pts, point{minute(p.Time), dy.at(u.DepthValue(p.Ceiling))})
+		}
+		pts = append(pts, point{minute(ceiling[len(ceiling)-1].Time), dy.at(0)})
+		c.polygon(pts, ceilColour)
+	}
+
+	profile := make([]point, len(samples))
+	for i, s := range samples {
+		profile[i] = point{minute(s.Time), dy.at(u.DepthValue(s.Depth))}
+	}
+	c.polyline(profile, depthColour, 2, false)
+	for _, span := range fastAscents(samples, o.MaxAscentRate, AscentWindow) {
+		var pts []point
+		for _, s := range clip(samples, span.start, span.end) {
+			pts = append(pts, point{minute(s.Time), dy.at(u.DepthValue(s.Depth))})
+		}
+		c.polyline(pts, fastColour, 3, false)
+	}
+
+	for _, ev := range d.Events {
+		if ev.Kind != divelog.EventGasChange {
+			continue
+		}
+		x := minute(ev.Time)
+		// A switch at the start only names the first gas; the axis is
+		// already there.
+		if ev.Time > 0 {
+			c.polyline([]point{{x, top}, {x, mainBottom}}, gasColour, 1, true)
+		}
+		c.text(x+3, top+8, tankGas(d, ev.Tank).String(), gasColour, start)
+	}
+
+	legend := []legendEntry{{"depth", depthColour}}
+	if len(ceiling) > 0 {
+		legend = append(legend, legendEntry{"ceiling", ceilColour})
+	}
+	legend = append(legend, legendEntry{fmt.Sprintf("ascent > %s/min", u.FormatDepth(o.MaxAscentRate)), fastColour})
+
+	if pressures || temps {
+		lowerTop := mainBottom + panelGap
+		timeAxis(c, tx, tStep, bottom, lowerTop)
+		if pressures {
+			drawPressure(c, d, u, tx, lowerTop, bottom)
+			legend = append(legend, legendEntry{"pressure", pressColour})
+		}
+		if temps {
+			drawTemperature(c, d, u, tx, lowerTop, bottom)
+			legend = append(legend, legendEntry{"temperature", tempColour})
+		}
+	}
+
+	// The legend runs right to left along the title line.
+	x := right
+	for i := len(legend) - 1; i >= 0; i-- {
+		l := legend[i]
+		x -= float64(textWidth(l.label, 1))
+		c.text(x, marginTop/2, l.label, black, start)
+		x -= 14
+		c.rect(x, marginTop/2-4, 10, 8, opaque(l.c))
+		x -= 12
+	}
+	return nil
+}
+
+// legendEntry is one item of the legend.
+type legendEntry struct {
+	label string
+	c     color.RGBA
+}
+
+// opaque returns c without transparency, for legend swatches.
+func opaque(c color.RGBA) color.RGBA {
+	if c.A == 255 || c.A == 0 {
+		return c
+	}
+	a := float64(c.A) / 255
+	blend := func(v uint8) uint8 { return uint8(float64(v)*a + 255*(1-a)) }
+	return color.RGBA{blend(c.R), blend(c.G), blend(c.B), 255}
+}
+
+// timeAxis draws the time ticks and labels along the bottom of a panel
+// spanning top to bottom.
+func timeAxis(c canvas, tx axis, step, bottom, top float64) {
+	for v := 0.0; v <= tx.v1+1e-9; v += step {
+		x := tx.at(v)
+		c.polyline([]point{{x, top}, {x, bottom}}, grid, 1, false)
+		c.text(x, bottom+tickLength+6, formatTick(v, step), black, middle)
+	}
+	c.polyline([]point{{tx.p0, bottom}, {tx.p1, bottom}}, black, 1, false)
+	c.polyline([]point{{tx.p0, top}, {tx.p0, bottom}}, black, 1, false)
+	c.text(tx.p1+12, bottom+tickLength+6, "min", black, start)
+}
+
+// drawPressure draws each tank's pressure against the left axis of the
+// lower panel.
+func drawPressure(c canvas, d *divelog.Dive, u divelog.UnitSystem, tx axis, top, bottom float64) {
+	var hi float64
+	for _, s := range d.Samples {
+		hi = max(hi, u.PressureValue(s.Pressure))
+	}
+	step := niceStep(hi, 4)
+	py := axis{0, math.Ceil(hi/step) * step, bottom, top}
+	for v := 0.0; v <= py.v1+1e-9; v += step {
+		c.text(tx.p0-tickLength-2, py.at(v), formatTick(v, step), pressColour, end)
+	}
+	c.text(tx.p0-tickLength-2, top-12, u.PressureUnit(), pressColour, end)
+	traces := map[int][]point{}
+	for _, s := range d.Samples {
+		if s.Pressure != 0 {
+			traces[s.Tank] = append(traces[s.Tank], point{tx.at(s.Time.Minutes()), py.at(u.PressureValue(s.Pressure))})
+		}
+	}
+	for tank := range len(d.Tanks) + 1 {
+		if pts := traces[tank]; len(pts) > 1 {
+			c.polyline(pts, pressColour, 1.5, tank > 0)
+		}
+	}
+}
+
+// drawTemperature draws the water temperature against the right axis of
+// the lower panel.
+func drawTemperature(c canvas, d *divelog.Dive, u divelog.UnitSystem, tx axis, top, bottom float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	var pts []divelog.Sample
+	for _, s := range d.Samples {
+		if s.Temperature != 0 {
+			v := u.TemperatureValue(s.Temperature)
+			lo, hi = min(lo, v), max(hi, v)
+			pts = append(pts, s)
+		}
+	}
+	step := niceStep(max(hi-lo, 1), 4)
+	lo, hi = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	if hi == lo {
+		hi += step
+	}
+	ty := axis{lo, hi, bottom, top}
+	for v := lo; v <= hi+1e-9; v += step {
+		c.text(tx.p1+tickLength+2, ty.at(v), formatTick(v, step), tempColour, start)
+	}
+	c.text(tx.p1+tickLength+2, top-12, u.TemperatureUnit(), tempColour, start)
+	line := make([]point, len(pts))
+	for i, s := range pts {
+		line[i] = point{tx.at(s.Time.Minutes()), ty.at(u.TemperatureValue(s.Temperature))}
+	}
+	c.polyline(line, tempColour, 1.5, false)
+}
+
+func hasPressure(d *divelog.Dive) bool {
+	n := 0
+	for _, s := range d.Samples {
+		if s.Pressure != 0 {
+			n++
+		}
+	}
+	return n > 1
+}
+
+func hasTemperature(d *divelog.Dive) bool {
+	n := 0
+	for _, s := range d.Samples {
+		if s.Temperature != 0 {
+			n++
+		}
+	}
+	return n > 1
+}
+
+// tankGas returns the gas in d's tank i, or air if there is no such tank.
+func tankGas(d *divelog.Dive, i int) divelog.GasMix {
+	if i < 0 || i >= len(d.Tanks) || d.Tanks[i].Gas.O2 == 0 {
+		return divelog.Air
+	}
+	return d.Tanks[i].Gas
+}
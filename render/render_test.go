@@ -0,0 +1,225 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/stats"
+)
+
+// testDive is a 30 m dive with a switch to EAN50 at 21 m and a rushed
+// ascent from 15 m to 5 m in half a minute.
+func testDive() *divelog.Dive {
+	d := &divelog.Dive{
+		Number: 7,
+		Start:  time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		Site:   &divelog.Site{Name: "Blue Hole"},
+		Tanks:  []divelog.Tank{{Gas: divelog.Air}, {Gas: divelog.GasMix{O2: 0.5}}},
+		Events: []divelog.Event{{Time: 27 * time.Minute, Kind: divelog.EventGasChange, Tank: 1}},
+	}
+	profile := []struct {
+		min   float64
+		depth divelog.Depth
+	}{{0, 0}, {2, 30}, {25, 30}, {27, 21}, {29, 15}, {29.5, 5}, {32, 5}, {33, 0}}
+	for i, p := range profile {
+		t := time.Duration(p.min * float64(time.Minute))
+		d.Samples = append(d.Samples, divelog.Sample{
+			Time:        t,
+			Depth:       p.depth,
+			Temperature: divelog.Celsius(24 - float64(p.depth)/10),
+			Pressure:    divelog.Bar(200 - 4*p.min),
+			Tank:        min(i/5, 1),
+		})
+	}
+	return d
+}
+
+func TestFastAscents(t *testing.T) {
+	spans := fastAscents(testDive().Samples, 10, AscentWindow)
+	if len(spans) != 1 {
+		t.Fatalf("fast ascents = %v, want one", spans)
+	}
+	if s := spans[0]; s.start != 29*time.Minute || s.end < 29*time.Minute+30*time.Second || s.end > 30*time.Minute {
+		t.Errorf("fast ascent from %v to %v, want from 29m to about 29m30s", s.start, s.end)
+	}
+	if spans := fastAscents(testDive().Samples, 25, AscentWindow); len(spans) != 0 {
+		t.Errorf("fast ascents over 25 m/min = %v", spans)
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct {
+		span float64
+		n    int
+		want float64
+	}{{33, 10, 5}, {30, 6, 5}, {200, 4, 50}, {3.2, 4, 1}, {0.7, 4, 0.2}}
+	for _, tt := range tests {
+		if got := niceStep(tt.span, tt.n); got != tt.want {
+			t.Errorf("niceStep(%v, %d) = %v, want %v", tt.span, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SVG(&buf, testDive(), Options{Ceiling: true}); err != nil {
+		t.Fatal(err)
+	}
+	// The document must be well-formed XML.
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	elements := map[string]int{}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v\n%s", err, buf.String())
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			elements[se.Name.Local]++
+		}
+	}
+	if elements["svg"] != 1 || elements["polygon"] != 1 || elements["polyline"] == 0 {
+		t.Errorf("elements = %v", elements)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Dive #7  2024-05-01 09:30  Blue Hole",
+		`stroke="rgb(214,39,40)"`,            // the rushed ascent
+		`stroke-dasharray="4 3"`,             // the gas switch
+		">EAN50</text>",                      // labelled
+		`stroke="rgb(255,127,14)"`,           // tank pressure
+		`stroke="rgb(148,103,189)"`,          // temperature
+		`fill="rgb(214,39,40)" fill-opacity`, // ceiling
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("SVG lacks %s", want)
+		}
+	}
+
+	buf.Reset()
+	SVG(&buf, testDive(), Options{NoPressure: true, NoTemperature: true, Units: divelog.Imperial})
+	if out := buf.String(); strings.Contains(out, "rgb(255,127,14)") || !strings.Contains(out, ">ft</text>") {
+		t.Error("SVG without traces, in feet, still has a pressure trace or lacks feet")
+	}
+
+	d := testDive()
+	d.Samples = nil
+	if err := SVG(io.Discard, d, Options{}); !errors.Is(err, ErrNoProfile) {
+		t.Errorf("SVG of a dive without samples: %v", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := PNG(&buf, testDive(), Options{Width: 600, Height: 300, Ceiling: true}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 600 || b.Dy() != 300 {
+		t.Fatalf("image is %v, want 600×300", b)
+	}
+	count := map[[3]uint32]int{}
+	for y := range 300 {
+		for x := range 600 {
+			r, g, b, _ := img.At(x, y).RGBA()
+			count[[3]uint32{r >> 8, g >> 8, b >> 8}]++
+		}
+	}
+	for name, c := range map[string][3]uint32{
+		"depth":       {31, 119, 180},
+		"fast ascent": {214, 39, 40},
+		"gas switch":  {44, 160, 44},
+		"pressure":    {255, 127, 14},
+		"temperature": {148, 103, 189},
+		"text":        {40, 40, 40},
+	} {
+		if count[c] < 10 {
+			t.Errorf("%s colour has %d pixels", name, count[c])
+		}
+	}
+	if count[[3]uint32{255, 255, 255}] < 600*300/2 {
+		t.Error("less than half the image is background")
+	}
+}
+
+func TestFont(t *testing.T) {
+	for r := ' '; r <= '~'; r++ {
+		if r != ' ' && glyph(r) == glyph(' ') {
+			t.Errorf("no glyph for %q", r)
+		}
+	}
+	if glyph('é') != glyph('?') || glyph('°') == glyph('?') {
+		t.Error("characters outside the font are not drawn as ?")
+	}
+	if got := textWidth("EAN50", 1); got != 29 {
+		t.Errorf("textWidth = %d, want 29", got)
+	}
+}
+
+func TestStatsSVG(t *testing.T) {
+	var dives []*divelog.Dive
+	for i := range 30 {
+		d := testDive()
+		d.Number = i + 1
+		d.Start = d.Start.AddDate(0, 0, 9*i)
+		d.Duration = 40 * time.Minute
+		d.MaxDepth = divelog.Depth(8 + i)
+		d.Site = &divelog.Site{Name: fmt.Sprintf("Site with a rather long name %d", i%12)}
+		dives = append(dives, d)
+	}
+	var buf bytes.Buffer
+	if err := StatsSVG(&buf, stats.Compute(dives, stats.Options{}), Options{Width: 900, Height: 600}); err != nil {
+		t.Fatal(err)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	texts := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v\n%s", err, buf.String())
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "text" {
+			texts++
+		}
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"30 dives  20.0 h underwater  2024-05-01 to 2025-01-17",
+		"deepest 37.0 m",
+		">Dives per month</text>",
+		">2024-05</text>",
+		">Site with a rathe...</text>",
+		`fill="rgb(31,119,180)"`, // the depth histogram
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("statistics SVG lacks %s", want)
+		}
+	}
+	// Nine months of labels do not fit under the bars: some are left out.
+	if strings.Count(out, ">2024-") >= 8 {
+		t.Errorf("month labels not thinned out:\n%s", out)
+	}
+	if strings.Count(out, ">Site with") != 10 {
+		t.Errorf("%d sites listed, want 10", strings.Count(out, ">Site with"))
+	}
+
+	if err := StatsSVG(io.Discard, stats.Compute(nil, stats.Options{}), Options{}); !errors.Is(err, ErrNoDives) {
+		t.Errorf("StatsSVG of no dives: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/betonavab/divelog/stats"
+)
+
+// ErrNoDives is returned for statistics of no dives.
+var ErrNoDives = errors.New("no dives")
+
+// maxSiteBars is the most sites the statistics chart lists.
+const maxSiteBars = 10
+
+// StatsSVG writes a dashboard of a log's statistics as an SVG document:
+// the totals and records over four bar charts, of the dives' maximum
+// depths, the dives per year and per month, and the most dived sites.
+// Of the Options only the size and the units apply.
+func StatsSVG(w io.Writer, s *stats.Summary, o Options) error {
+	o = o.withDefaults()
+	c := newSVG(o.Width, o.Height)
+	if err := drawStats(c, s, o); err != nil {
+		return err
+	}
+	return c.write(w)
+}
+
+func drawStats(c canvas, s *stats.Summary, o Options) error {
+	if s.Dives == 0 {
+		return ErrNoDives
+	}
+	u := o.Units
+	c.rect(0, 0, float64(o.Width), float64(o.Height), white)
+
+	title := fmt.Sprintf("%d dives  %.1f h underwater  %s to %s", s.Dives, s.BottomTime.Hours(),
+		s.First.Start.Format("2006-01-02"), s.Last.Start.Format("2006-01-02"))
+	c.text(marginLeft, marginTop/2, title, black, start)
+	records := fmt.Sprintf("deepest %s  longest %.0f min", u.FormatDepth(s.Deepest.MaxDepth), s.Longest.Duration.Minutes())
+	if s.Coldest != nil {
+		records += "  coldest " + u.FormatTemperature(s.Coldest.MinTemperature)
+	}
+	if s.Streak.Length > 1 {
+		records += fmt.Sprintf("  streak %d days", s.Streak.Length)
+	}
+	c.text(float64(o.Width-marginRight), marginTop/2, records, black, end)
+
+	left, right := float64(marginLeft), float64(o.Width-marginRight)
+	top, bottom := float64(marginTop), float64(o.Height-marginBottom)
+	midX, midY := (left+right)/2, top+(bottom-top)/2
+
+	var labels []string
+	var values []int
+	for _, b := range s.Depths {
+		labels = append(labels, fmt.Sprintf("%.0f", u.DepthValue(b.From)))
+		values = append(values, b.Dives)
+	}
+	bars(c, left, top, midX-panelGap, midY-panelGap/2, "Dives by maximum depth ("+u.DepthUnit()+")", labels, values, depthColour)
+
+	labels, values = nil, nil
+	for _, p := range s.Years {
+		labels = append(labels, p.Period)
+		values = append(values, p.Dives)
+	}
+	bars(c, midX+panelGap, top, right, midY-panelGap/2, "Dives per year", labels, values, gasColour)
+
+	labels, values = nil, nil
+	for _, p := range s.Months {
+		labels = append(labels, p.Period)
+		values = append(values, p.Dives)
+	}
+	bars(c, left, midY+panelGap/2, midX-panelGap, bottom, "Dives per month", labels, values, pressColour)
+
+	labels, values = nil, nil
+	for _, g := range s.Sites[:min(len(s.Sites), maxSiteBars)] {
+		labels = append(labels, g.Name)
+		values = append(values, g.Dives)
+	}
+	rows(c, midX+panelGap, midY+panelGap/2, right, bottom, "Most dived sites", labels, values, tempColour)
+	return nil
+}
+
+// bars draws a titled bar chart of values in the box x0, y0 to x1, y1,
+// with the values' axis on the left and labels under the bars, thinned
+// out so that they do not overlap.
+func bars(c canvas, x0, y0, x1, y1 float64, title string, labels []string, values []int, col color.RGBA) {
+	c.text(x0, y0, title, black, start)
+	top, bottom := y0+16, y1-tickLength-12
+	most := 1
+	for _, v := range values {
+		most = max(most, v)
+	}
+	step := max(1, niceStep(float64(most), 4))
+	vy := axis{0, math.Ceil(float64(most)/step) * step, bottom, top}
+	for v := 0.0; v <= vy.v1+1e-9; v += step {
+		y := vy.at(v)
+		c.polyline([]point{{x0, y}, {x1, y}}, grid, 1, false)
+		c.text(x0-tickLength-2, y, formatTick(v, step), black, end)
+	}
+	if len(values) == 0 {
+		return
+	}
+	slot := (x1 - x0) / float64(len(values))
+	widest := 0
+	for _, l := range labels {
+		widest = max(widest, textWidth(l, 1))
+	}
+	every := max(1, int(math.Ceil(float64(widest+6)/slot)))
+	for i, v := range values {
+		x := x0 + float64(i)*slot
+		if v > 0 {
+			c.rect(x+slot*0.1, vy.at(float64(v)), slot*0.8, bottom-vy.at(float64(v)), col)
+		}
+		if i%every == 0 {
+			c.text(x+slot/2, bottom+tickLength+6, labels[i], black, middle)
+		}
+	}
+}
+
+// rows draws a titled chart of horizontal bars in the box x0, y0 to x1,
+// y1, one per label, each followed by its value.
+func rows(c canvas, x0, y0, x1, y1 float64, title string, labels []string, values []int, col color.RGBA) {
+	c.text(x0, y0, title, black, start)
+	if len(values) == 0 {
+		return
+	}
+	const maxLabel = 20 // characters
+	widest, most := 0, 1
+	for i, l := range labels {
+		if r := []rune(l); len(r) > maxLabel {
+			labels[i] = string(r[:maxLabel-3]) + "..."
+		}
+		widest = max(widest, textWidth(labels[i], 1))
+		most = max(most, values[i])
+	}
+	top := y0 + 16
+	height := min((y1-top)/float64(len(values)), 24)
+	barLeft := x0 + float64(widest) + 8
+	vx := axis{0, float64(most), barLeft, x1 - 30}
+	for i, v := range values {
+		y := top + float64(i)*height
+		c.text(barLeft-6, y+height/2, labels[i], black, end)
+		c.rect(barLeft, y+height*0.15, vx.at(float64(v))-barLeft, height*0.7, col)
+		c.text(vx.at(float64(v))+4, y+height/2, fmt.Sprint(v), black, start)
+	}
+}
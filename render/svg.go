@@ -0,0 +1,71 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// svgCanvas builds an SVG document.
+type svgCanvas struct {
+	w, h int
+	b    strings.Builder
+}
+
+func newSVG(w, h int) *svgCanvas { return &svgCanvas{w: w, h: h} }
+
+// paint returns the attributes that give an element colour c, as a fill
+// or a stroke.
+func paint(attr string, c color.RGBA) string {
+	s := fmt.Sprintf(`%s="rgb(%d,%d,%d)"`, attr, c.R, c.G, c.B)
+	if c.A != 255 {
+		s += fmt.Sprintf(` %s-opacity="%.2f"`, attr, float64(c.A)/255)
+	}
+	return s
+}
+
+func points(pts []point) string {
+	var b strings.Builder
+	for i, p := range pts {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%.1f,%.1f", p.x, p.y)
+	}
+	return b.String()
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	fmt.Fprintf(&c.b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" %s/>\n", x, y, w, h, paint("fill", col))
+}
+
+func (c *svgCanvas) polyline(pts []point, col color.RGBA, width float64, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="4 3"`
+	}
+	fmt.Fprintf(&c.b, "<polyline points=\"%s\" fill=\"none\" %s stroke-width=\"%g\" stroke-linejoin=\"round\"%s/>\n",
+		points(pts), paint("stroke", col), width, dash)
+}
+
+func (c *svgCanvas) polygon(pts []point, col color.RGBA) {
+	fmt.Fprintf(&c.b, "<polygon points=\"%s\" %s/>\n", points(pts), paint("fill", col))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, col color.RGBA, a anchor) {
+	anchors := [...]string{start: "start", middle: "middle", end: "end"}
+	fmt.Fprintf(&c.b, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"%s\" dominant-baseline=\"middle\" %s>",
+		x, y, anchors[a], paint("fill", col))
+	xml.EscapeText(&c.b, []byte(s))
+	c.b.WriteString("</text>\n")
+}
+
+func (c *svgCanvas) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="10">
+%s</svg>
+`, c.w, c.h, c.w, c.h, c.b.String())
+	return err
+}
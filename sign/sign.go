@@ -0,0 +1,171 @@
+// Package sign lets a buddy or instructor sign a dive record with an
+// ed25519 key, in place of the stamp in a paper log book, and checks those
+// signatures.
+//
+// A signature covers the canonical serialization of the dive (see
+// Canonical) together with the signer's name, role and the time of
+// signing, so any later change to the dive, however small, makes it fail
+// to verify. A signature proves only that the holder of a key vouched for
+// the dive; that the key belongs to the person named is for the reader to
+// check, by comparing its Fingerprint with one the signer gave them.
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// ErrInvalid is returned by Verify when a signature does not match the
+// dive, which is what happens when the dive was changed after signing.
+var ErrInvalid = errors.New("signature does not match the dive")
+
+// context separates dive signatures from anything else the key signs.
+const context = "divelog dive signature v1\n"
+
+// Canonical returns the canonical serialization of d that signatures
+// cover: the dive as compact JSON without its signatures and with its
+// start in UTC. Encoding d's fields in declaration order with Go's float
+// formatting makes the result the same for every store the dive is kept
+// in, and whatever time zone it is read in.
+func Canonical(d *divelog.Dive) ([]byte, error) {
+	c := *d
+	c.Start = d.Start.UTC()
+	c.Signatures = nil
+	return json.Marshal(&c)
+}
+
+// message returns the bytes s signs for d.
+func message(d *divelog.Dive, s *divelog.Signature) ([]byte, error) {
+	dive, err := Canonical(d)
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(struct {
+		Signer    string `json:"signer"`
+		Role      string `json:"role"`
+		PublicKey []byte `json:"public_key"`
+		Signed    string `json:"signed"`
+	}{s.Signer, s.Role, s.PublicKey, s.Signed.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(context)
+	b.Write(header)
+	b.WriteByte('\n')
+	b.Write(dive)
+	return b.Bytes(), nil
+}
+
+// Sign signs d with key on behalf of signer and adds the signature to
+// d.Signatures, replacing any earlier signature by the same key. It
+// returns the new signature.
+func Sign(d *divelog.Dive, key ed25519.PrivateKey, signer, role string, now time.Time) (*divelog.Signature, error) {
+	if strings.TrimSpace(signer) == "" {
+		return nil, errors.New("a signature needs a signer")
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	s := divelog.Signature{
+		Signer:    signer,
+		Role:      role,
+		PublicKey: pub,
+		Signed:    now.UTC().Truncate(time.Second),
+	}
+	msg, err := message(d, &s)
+	if err != nil {
+		return nil, err
+	}
+	s.Sig = ed25519.Sign(key, msg)
+
+	var kept []divelog.Signature
+	for _, old := range d.Signatures {
+		if !bytes.Equal(old.PublicKey, pub) {
+			kept = append(kept, old)
+		}
+	}
+	d.Signatures = append(kept, s)
+	return &d.Signatures[len(d.Signatures)-1], nil
+}
+
+// Verify checks that s is a good signature of d. It returns ErrInvalid if
+// the dive or the signature was changed after signing.
+func Verify(d *divelog.Dive, s *divelog.Signature) error {
+	if len(s.PublicKey) != ed25519.PublicKeySize {
+		return errors.New("not an ed25519 public key")
+	}
+	msg, err := message(d, s)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(s.PublicKey, msg, s.Sig) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Fingerprint returns a short form of a public key for people to compare,
+// in the style of SSH: "SHA256:" and the unpadded base64 of its hash.
+func Fingerprint(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a new private key.
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+// WriteKey writes key to a new file at path as PEM-encoded PKCS #8, the
+// form OpenSSL reads, readable only by its owner. It will not overwrite
+// an existing file.
+func WriteKey(path string, key ed25519.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadKey reads a private key written by WriteKey or by
+// "openssl genpkey -algorithm ed25519".
+func ReadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: not a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", path)
+	}
+	return ed, nil
+}
@@ -0,0 +1,116 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func dive() *divelog.Dive {
+	return &divelog.Dive{
+		Number:   12,
+		Start:    time.Date(2024, 5, 1, 9, 30, 0, 0, time.FixedZone("CST", -6*3600)),
+		Duration: 3 * time.Minute,
+		MaxDepth: 20,
+		Site:     &divelog.Site{Name: "Blue Hole"},
+		Buddies:  []divelog.Buddy{{Name: "Ana"}},
+		Tanks:    []divelog.Tank{{Gas: divelog.GasMix{O2: 0.32}}},
+		Samples:  []divelog.Sample{{}, {Time: time.Minute, Depth: 20}, {Time: 3 * time.Minute}},
+		Notes:    "Hammerheads",
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	ana, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ben, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := dive()
+	now := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	if _, err := Sign(d, ana, "Ana", "buddy", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sign(d, ben, "Ben", "instructor", now); err != nil {
+		t.Fatal(err)
+	}
+	for i := range d.Signatures {
+		if err := Verify(d, &d.Signatures[i]); err != nil {
+			t.Errorf("signature %d: %v", i, err)
+		}
+	}
+	if err := d.Validate(); err != nil {
+		t.Errorf("signed dive does not validate: %v", err)
+	}
+
+	// Signing again with the same key replaces the signature.
+	if _, err := Sign(d, ana, "Ana Díaz", "buddy", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Signatures) != 2 || d.Signatures[1].Signer != "Ana Díaz" {
+		t.Errorf("signatures after re-signing: %+v", d.Signatures)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(d *divelog.Dive, s *divelog.Signature)
+	}{
+		{"notes", func(d *divelog.Dive, _ *divelog.Signature) { d.Notes += "." }},
+		{"number", func(d *divelog.Dive, _ *divelog.Signature) { d.Number = 13 }},
+		{"sample", func(d *divelog.Dive, _ *divelog.Signature) { d.Samples[1].Depth += 0.1 }},
+		{"start", func(d *divelog.Dive, _ *divelog.Signature) { d.Start = d.Start.Add(time.Minute) }},
+		{"signer", func(_ *divelog.Dive, s *divelog.Signature) { s.Signer = "Eve" }},
+		{"role", func(_ *divelog.Dive, s *divelog.Signature) { s.Role = "witness" }},
+		{"signed", func(_ *divelog.Dive, s *divelog.Signature) { s.Signed = s.Signed.Add(time.Second) }},
+	}
+	for _, tt := range tests {
+		c := d.Clone()
+		s := c.Signatures[0]
+		tt.mutate(c, &s)
+		if err := Verify(c, &s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("after changing %s: Verify = %v, want ErrInvalid", tt.name, err)
+		}
+	}
+
+	// Adding another signature or reading the dive in another time zone
+	// changes nothing that is signed.
+	c := d.Clone()
+	c.Start = c.Start.In(time.FixedZone("", 0))
+	c.Signatures = append(c.Signatures[:1:1], divelog.Signature{Signer: "Eve"})
+	if err := Verify(c, &c.Signatures[0]); err != nil {
+		t.Errorf("Verify with another signature added: %v", err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ana.pem")
+	if err := WriteKey(path, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteKey(path, key); err == nil {
+		t.Error("WriteKey overwrote an existing key")
+	}
+	got, err := ReadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("ReadKey returned a different key")
+	}
+	fp := Fingerprint(key.Public().(ed25519.PublicKey))
+	if len(fp) != len("SHA256:")+43 {
+		t.Errorf("Fingerprint = %q", fp)
+	}
+}
@@ -0,0 +1,18 @@
+package divelog
+
+import "time"
+
+// Signature is a buddy's or instructor's ed25519 signature of a dive
+// record, the digital form of a stamp in a paper log book. Package sign
+// makes and checks them.
+type Signature struct {
+	Signer string `json:"signer"`
+
+	// Role is the signer's part in the dive, such as "buddy" or
+	// "instructor".
+	Role string `json:"role,omitempty"`
+
+	PublicKey []byte    `json:"public_key"`
+	Signed    time.Time `json:"signed"`
+	Sig       []byte    `json:"sig"`
+}
@@ -0,0 +1,105 @@
+package sites
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/betonavab/divelog"
+)
+
+// Duplicate is a pair of registered sites that look like one site entered
+// twice.
+type Duplicate struct {
+	A, B *divelog.Site
+
+	// Similarity is how alike the names are, from 0 to 1.
+	Similarity float64
+
+	// Distance is how far apart the sites are in metres, or negative when
+	// either has no coordinates.
+	Distance float64
+}
+
+// Duplicates returns the pairs of sites whose names are at least
+// minSimilarity alike and that are within maxDistance metres of each other
+// or not both placed, most alike first. A site without coordinates is
+// compared by name alone.
+func Duplicates(sites []*divelog.Site, maxDistance, minSimilarity float64) []Duplicate {
+	names := make([]string, len(sites))
+	for i, s := range sites {
+		names[i] = normalize(s.Name)
+	}
+	var dups []Duplicate
+	for i, a := range sites {
+		for j := i + 1; j < len(sites); j++ {
+			b := sites[j]
+			dist := -1.0
+			if a.Coords != nil && b.Coords != nil {
+				if dist = a.Coords.Distance(*b.Coords); dist > maxDistance {
+					continue
+				}
+			}
+			if sim := similarity(names[i], names[j]); sim >= minSimilarity {
+				dups = append(dups, Duplicate{a, b, sim, dist})
+			}
+		}
+	}
+	slices.SortStableFunc(dups, func(x, y Duplicate) int {
+		return cmp.Or(cmp.Compare(y.Similarity, x.Similarity), cmp.Compare(x.Distance, y.Distance))
+	})
+	return dups
+}
+
+// Similarity returns how alike two site names are, from 0 for nothing in
+// common to 1 for names that differ only in case, punctuation, spacing or
+// word order.
+func Similarity(a, b string) float64 { return similarity(normalize(a), normalize(b)) }
+
+// similarity compares normalized names by edit distance, both as written
+// and with their words sorted, and returns the closer of the two.
+func similarity(a, b string) float64 {
+	sim := func(a, b []rune) float64 {
+		if len(a) == 0 && len(b) == 0 {
+			return 1
+		}
+		return 1 - float64(levenshtein(a, b))/float64(max(len(a), len(b)))
+	}
+	sorted := func(s string) []rune {
+		words := strings.Fields(s)
+		slices.Sort(words)
+		return []rune(strings.Join(words, " "))
+	}
+	return max(sim([]rune(a), []rune(b)), sim(sorted(a), sorted(b)))
+}
+
+// normalize lowers the case of a name and reduces everything but letters
+// and digits to single spaces.
+func normalize(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// levenshtein returns the number of single-rune insertions, deletions and
+// substitutions that turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range a {
+		cur[0] = i + 1
+		for j := range b {
+			cost := 1
+			if a[i] == b[j] {
+				cost = 0
+			}
+			cur[j+1] = min(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
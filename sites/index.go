@@ -0,0 +1,106 @@
+package sites
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/betonavab/divelog"
+)
+
+// cellSize is the side of the index's grid cells in degrees, about 11 km
+// north to south.
+const cellSize = 0.1
+
+// lonCells is the number of cells around a parallel.
+const lonCells = 360 / cellSize
+
+type cell struct{ lat, lon int }
+
+// Index finds sites near a position. It files sites in a grid of cells
+// cellSize degrees on a side, so that a search only measures the distance
+// to sites in the cells around the position.
+type Index struct {
+	cells map[cell][]*divelog.Site
+	all   []*divelog.Site
+}
+
+// NewIndex returns an index of the sites with coordinates among sites.
+func NewIndex(sites []*divelog.Site) *Index {
+	x := &Index{cells: map[cell][]*divelog.Site{}}
+	for _, s := range sites {
+		x.Add(s)
+	}
+	return x
+}
+
+// Add adds s to the index, unless it has no coordinates.
+func (x *Index) Add(s *divelog.Site) {
+	if s.Coords == nil {
+		return
+	}
+	c := cellOf(*s.Coords)
+	x.cells[c] = append(x.cells[c], s)
+	x.all = append(x.all, s)
+}
+
+func cellOf(c divelog.Coordinates) cell {
+	return cell{int(math.Floor(c.Lat / cellSize)), wrapLon(int(math.Floor(c.Lon / cellSize)))}
+}
+
+// wrapLon maps a column of cells to its place in [-lonCells/2, lonCells/2),
+// so that the columns either side of the antimeridian meet.
+func wrapLon(i int) int {
+	n := int(lonCells)
+	return ((i+n/2)%n+n)%n - n/2
+}
+
+// Match is a site found by Near.
+type Match struct {
+	Site     *divelog.Site
+	Distance float64 // metres
+}
+
+// Near returns the sites within radius metres of c, nearest first.
+func (x *Index) Near(c divelog.Coordinates, radius float64) []Match {
+	var matches []Match
+	add := func(s *divelog.Site) {
+		if d := c.Distance(*s.Coords); d <= radius {
+			matches = append(matches, Match{s, d})
+		}
+	}
+
+	// The cells spanned by a circle of the radius: its latitudes, and the
+	// widest spread of longitudes at any of them.
+	dLat := radius / divelog.EarthRadius * 180 / math.Pi
+	latLo, latHi := max(c.Lat-dLat, -90), min(c.Lat+dLat, 90)
+	rows := int(math.Floor(latHi/cellSize)) - int(math.Floor(latLo/cellSize)) + 1
+	cols := int(lonCells)
+	var lonLo float64
+	if polar := max(math.Abs(latLo), math.Abs(latHi)); polar < 90 {
+		if dLon := dLat / math.Cos(polar*math.Pi/180); dLon < 180 {
+			lonLo = c.Lon - dLon
+			cols = min(cols, int(math.Floor((c.Lon+dLon)/cellSize))-int(math.Floor(lonLo/cellSize))+1)
+		}
+	}
+
+	if rows*cols > len(x.all) {
+		// Fewer sites than cells to look in: measure them all.
+		for _, s := range x.all {
+			add(s)
+		}
+	} else {
+		row0, col0 := int(math.Floor(latLo/cellSize)), int(math.Floor(lonLo/cellSize))
+		for i := range rows {
+			for j := range cols {
+				for _, s := range x.cells[cell{row0 + i, wrapLon(col0 + j)}] {
+					add(s)
+				}
+			}
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.Site.Name, b.Site.Name))
+	})
+	return matches
+}
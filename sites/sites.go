@@ -0,0 +1,298 @@
+// Package sites keeps the site registry of a dive log: it links each dive
+// to a registered site, finds sites near a position and finds sites
+// registered twice under slightly different names so that they can be
+// merged.
+//
+// The registry lives in stores that implement store.SiteRegistry. A dive
+// refers to its site by ID and carries a copy of it, so dives still read
+// on their own and stores without a registry keep working unchanged.
+package sites
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+// LinkDistance is how far apart, in metres, a dive's site and a registered
+// site of the same name may be and still be taken as the same site.
+const LinkDistance = 250.0
+
+// Link points d at its site in the registry, registering the site if it
+// is new, and replaces d's copy of the site with the registry's. A dive
+// already linked keeps its site unless its name or position was changed;
+// otherwise it is linked to a site of the same name, ignoring case, within
+// LinkDistance or without a position. Dives without a site name are left
+// alone.
+func Link(reg store.SiteRegistry, d *divelog.Dive) error {
+	sites, err := reg.Sites()
+	if err != nil {
+		return err
+	}
+	l := &linker{reg: reg, sites: sites}
+	return l.link(d)
+}
+
+// PutDive links d to the registry when s has one, then saves it.
+func PutDive(s store.Store, d *divelog.Dive) error {
+	if reg, ok := s.(store.SiteRegistry); ok {
+		if err := Link(reg, d); err != nil {
+			return err
+		}
+	}
+	return s.Put(d)
+}
+
+// Sync links every dive in s to the registry, registering the sites of
+// dives logged before it existed or imported since. It returns the number
+// of dives changed.
+func Sync(s store.Store) (int, error) {
+	reg, ok := s.(store.SiteRegistry)
+	if !ok {
+		return 0, errors.New("this log has no site registry")
+	}
+	sites, err := reg.Sites()
+	if err != nil {
+		return 0, err
+	}
+	l := &linker{reg: reg, sites: sites}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, d := range dives {
+		was := d.Site.Clone()
+		if err := l.link(d); err != nil {
+			return changed, fmt.Errorf("dive #%d: %w", d.Number, err)
+		}
+		if same(was, d.Site) {
+			continue
+		}
+		if err := setSite(s, d.Number, d.Site); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// Unsynced reports whether Sync would change d's site against the
+// registered sites: d is not linked, or its copy of its site is out of
+// date.
+func Unsynced(registered []*divelog.Site, d *divelog.Dive) bool {
+	if d.Site == nil || d.Site.Name == "" {
+		return false
+	}
+	if d.Site.ID != 0 {
+		for _, site := range registered {
+			if site.ID == d.Site.ID && matches(site, d.Site) {
+				linked := site.Clone()
+				if linked.Coords == nil {
+					linked.Coords = d.Site.Clone().Coords
+				}
+				return !same(linked, d.Site)
+			}
+		}
+	}
+	return true
+}
+
+// Update saves a registered site and refreshes the copy every dive at it
+// carries. It returns the number of dives changed.
+func Update(s store.Store, site *divelog.Site) (int, error) {
+	reg, ok := s.(store.SiteRegistry)
+	if !ok {
+		return 0, errors.New("this log has no site registry")
+	}
+	if err := site.Validate(); err != nil {
+		return 0, err
+	}
+	if err := reg.PutSite(site); err != nil {
+		return 0, err
+	}
+	return relink(s, site, site.ID)
+}
+
+// Merge folds the sites with IDs drop into the site keep: dives at any of
+// them are moved to keep, keep takes any detail it lacks from the others,
+// and the others are removed from the registry. It returns the merged site
+// and the number of dives moved or refreshed.
+func Merge(s store.Store, keep int, drop ...int) (*divelog.Site, int, error) {
+	reg, ok := s.(store.SiteRegistry)
+	if !ok {
+		return nil, 0, errors.New("this log has no site registry")
+	}
+	site, err := Merged(reg, keep, drop...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := reg.PutSite(site); err != nil {
+		return nil, 0, err
+	}
+	// Move the dives before deleting the sites, so that an interrupted
+	// merge can be run again.
+	n, err := relink(s, site, append([]int{keep}, drop...)...)
+	if err != nil {
+		return nil, n, err
+	}
+	for _, id := range drop {
+		if err := reg.DeleteSite(id); err != nil {
+			return nil, n, fmt.Errorf("site %d: %w", id, err)
+		}
+	}
+	return site, n, nil
+}
+
+// Merged returns the site keep as Merge would leave it, without changing
+// the registry.
+func Merged(reg store.SiteRegistry, keep int, drop ...int) (*divelog.Site, error) {
+	site, err := reg.GetSite(keep)
+	if err != nil {
+		return nil, fmt.Errorf("site %d: %w", keep, err)
+	}
+	for _, id := range drop {
+		if id == keep {
+			return nil, fmt.Errorf("cannot merge site %d into itself", id)
+		}
+		other, err := reg.GetSite(id)
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", id, err)
+		}
+		fill(site, other)
+	}
+	return site, nil
+}
+
+// Relinks reports whether Update or Merge giving the dives at the sites
+// ids a copy of site would change d.
+func Relinks(d *divelog.Dive, site *divelog.Site, ids ...int) bool {
+	return d.Site != nil && d.Site.ID != 0 && slices.Contains(ids, d.Site.ID) && !same(d.Site, site)
+}
+
+// linker links dives against a snapshot of the registry that it keeps up
+// to date with the sites it registers itself.
+type linker struct {
+	reg   store.SiteRegistry
+	sites []*divelog.Site
+}
+
+func (l *linker) link(d *divelog.Dive) error {
+	if d.Site == nil || d.Site.Name == "" {
+		return nil
+	}
+	if d.Site.ID != 0 {
+		for _, site := range l.sites {
+			if site.ID == d.Site.ID && matches(site, d.Site) {
+				return l.use(site, d)
+			}
+		}
+	}
+	for _, site := range l.sites {
+		if matches(site, d.Site) {
+			return l.use(site, d)
+		}
+	}
+	site := d.Site.Clone()
+	site.ID = 0
+	if err := l.reg.PutSite(site); err != nil {
+		return err
+	}
+	l.sites = append(l.sites, site)
+	d.Site = site.Clone()
+	return nil
+}
+
+// use links d to the registered site, which d matches.
+func (l *linker) use(site *divelog.Site, d *divelog.Dive) error {
+	if site.Coords == nil && d.Site.Coords != nil {
+		// The dive places a site the registry could not.
+		c := *d.Site.Coords
+		site.Coords = &c
+		if err := l.reg.PutSite(site); err != nil {
+			return err
+		}
+	}
+	d.Site = site.Clone()
+	return nil
+}
+
+// matches reports whether a dive's site s may be the registered site.
+func matches(site, s *divelog.Site) bool {
+	if !strings.EqualFold(strings.TrimSpace(site.Name), strings.TrimSpace(s.Name)) {
+		return false
+	}
+	return site.Coords == nil || s.Coords == nil || site.Coords.Distance(*s.Coords) <= LinkDistance
+}
+
+// relink gives every dive at one of the sites ids a copy of site.
+func relink(s store.Store, site *divelog.Site, ids ...int) (int, error) {
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, d := range dives {
+		if !Relinks(d, site, ids...) {
+			continue
+		}
+		if err := setSite(s, d.Number, site); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// setSite saves dive number's site. Dives from queries without samples are
+// read again in full so that their profiles are kept.
+func setSite(s store.Store, number int, site *divelog.Site) error {
+	d, err := s.Get(number)
+	if err != nil {
+		return fmt.Errorf("dive #%d: %w", number, err)
+	}
+	d.Site = site.Clone()
+	if err := s.Put(d); err != nil {
+		return fmt.Errorf("dive #%d: %w", number, err)
+	}
+	return nil
+}
+
+// fill sets the details site lacks from other.
+func fill(site, other *divelog.Site) {
+	if site.Coords == nil && other.Coords != nil {
+		c := *other.Coords
+		site.Coords = &c
+	}
+	if site.Country == "" {
+		site.Country = other.Country
+	}
+	if site.Region == "" {
+		site.Region = other.Region
+	}
+	if site.MaxDepth == 0 {
+		site.MaxDepth = other.MaxDepth
+	}
+	if site.Entry == "" {
+		site.Entry = other.Entry
+	}
+	if site.Notes == "" {
+		site.Notes = other.Notes
+	}
+}
+
+func same(a, b *divelog.Site) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if (a.Coords == nil) != (b.Coords == nil) || a.Coords != nil && *a.Coords != *b.Coords {
+		return false
+	}
+	x, y := *a, *b
+	x.Coords, y.Coords = nil, nil
+	return x == y
+}
@@ -0,0 +1,231 @@
+package sites
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+func at(lat, lon float64) *divelog.Coordinates { return &divelog.Coordinates{Lat: lat, Lon: lon} }
+
+func names(matches []Match) []string {
+	var list []string
+	for _, m := range matches {
+		list = append(list, m.Site.Name)
+	}
+	return list
+}
+
+func TestNear(t *testing.T) {
+	sites := []*divelog.Site{
+		{Name: "Blue Hole", Coords: at(17.3157, -87.5346)},
+		{Name: "Half Moon Caye Wall", Coords: at(17.2050, -87.5460)},
+		{Name: "Aquarium", Coords: at(17.3300, -87.5400)},
+		{Name: "Unplaced"},
+		{Name: "Taveuni East", Coords: at(-16.80, 179.98)},
+		{Name: "Taveuni West", Coords: at(-16.80, -179.98)},
+		{Name: "Pole", Coords: at(89.99, 10)},
+		{Name: "Far Pole", Coords: at(89.98, -170)},
+	}
+	x := NewIndex(sites)
+	tests := []struct {
+		name   string
+		c      divelog.Coordinates
+		radius float64
+		want   []string
+	}{
+		{"close", divelog.Coordinates{Lat: 17.3157, Lon: -87.5346}, 5000, []string{"Blue Hole", "Aquarium"}},
+		{"wider", divelog.Coordinates{Lat: 17.3157, Lon: -87.5346}, 15000, []string{"Blue Hole", "Aquarium", "Half Moon Caye Wall"}},
+		{"nothing", divelog.Coordinates{Lat: 0, Lon: 0}, 10000, nil},
+		{"antimeridian", divelog.Coordinates{Lat: -16.80, Lon: 179.99}, 5000, []string{"Taveuni East", "Taveuni West"}},
+		{"pole", divelog.Coordinates{Lat: 90, Lon: 0}, 5000, []string{"Pole", "Far Pole"}},
+	}
+	for _, tt := range tests {
+		got := x.Near(tt.c, tt.radius)
+		if !reflect.DeepEqual(names(got), tt.want) {
+			t.Errorf("%s: Near = %v, want %v", tt.name, names(got), tt.want)
+		}
+		for _, m := range got {
+			if d := tt.c.Distance(*m.Site.Coords); d != m.Distance {
+				t.Errorf("%s: %s at %.0f m, want %.0f m", tt.name, m.Site.Name, m.Distance, d)
+			}
+		}
+	}
+
+	// With more sites than cells to search, the grid finds what measuring
+	// every site would.
+	var many []*divelog.Site
+	for i := range 2000 {
+		many = append(many, &divelog.Site{Name: strconv.Itoa(i), Coords: at(17+float64(i%40)*0.01, -87+float64(i/40)*0.01)})
+	}
+	c, radius := divelog.Coordinates{Lat: 17.2, Lon: -86.8}, 3000.0
+	want := 0
+	for _, s := range many {
+		if c.Distance(*s.Coords) <= radius {
+			want++
+		}
+	}
+	if got := NewIndex(many).Near(c, radius); want == 0 || len(got) != want {
+		t.Errorf("grid search found %d sites, want %d", len(got), want)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		lo, hi float64
+	}{
+		{"Blue Hole", "blue  hole.", 1, 1},
+		{"Coral Canyon", "Canyon, Coral", 1, 1},
+		{"Blue Hole", "Blu Hole", 1 - 1.0/9, 1 - 1.0/9},
+		{"Blue Hole", "Aquarium", 0, 0.3},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); got < tt.lo-1e-9 || got > tt.hi+1e-9 {
+			t.Errorf("Similarity(%q, %q) = %.3f, want %.3f to %.3f", tt.a, tt.b, got, tt.lo, tt.hi)
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	sites := []*divelog.Site{
+		{ID: 1, Name: "Blue Hole", Coords: at(17.3157, -87.5346)},
+		{ID: 2, Name: "Blue hole", Coords: at(17.3160, -87.5350)},
+		{ID: 3, Name: "Blu Hole"},
+		{ID: 4, Name: "Blue Hole", Coords: at(25.0, -77.0)}, // another Blue Hole
+		{ID: 5, Name: "Aquarium", Coords: at(17.3157, -87.5346)},
+	}
+	var got [][2]int
+	for _, d := range Duplicates(sites, 500, 0.8) {
+		got = append(got, [2]int{d.A.ID, d.B.ID})
+		if (d.A.Coords == nil || d.B.Coords == nil) != (d.Distance < 0) {
+			t.Errorf("%d and %d: distance %.0f", d.A.ID, d.B.ID, d.Distance)
+		}
+	}
+	want := [][2]int{{1, 2}, {1, 3}, {2, 3}, {3, 4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Duplicates = %v, want %v", got, want)
+	}
+}
+
+func dive(day int, site *divelog.Site) *divelog.Dive {
+	return &divelog.Dive{
+		Start:    time.Date(2024, 5, day, 10, 0, 0, 0, time.UTC),
+		Duration: 40 * time.Minute,
+		MaxDepth: 18,
+		Site:     site,
+		Samples:  []divelog.Sample{{Depth: 0}, {Time: time.Minute, Depth: 18}, {Time: 40 * time.Minute}},
+	}
+}
+
+func TestLink(t *testing.T) {
+	s := store.NewMemory()
+	put := func(d *divelog.Dive) *divelog.Dive {
+		t.Helper()
+		if err := PutDive(s, d); err != nil {
+			t.Fatalf("PutDive: %v", err)
+		}
+		return d
+	}
+	a := put(dive(1, &divelog.Site{Name: "Blue Hole"}))
+	b := put(dive(2, &divelog.Site{Name: "blue hole", Coords: at(17.3157, -87.5346)}))
+	c := put(dive(3, &divelog.Site{Name: "Blue Hole", Coords: at(25, -77)}))
+	put(dive(4, nil))
+	if a.Site.ID != 1 || b.Site.ID != 1 || c.Site.ID != 2 {
+		t.Errorf("site IDs %d, %d, %d; want 1, 1, 2", a.Site.ID, b.Site.ID, c.Site.ID)
+	}
+	// The second dive placed the site the first could not.
+	if site, _ := s.GetSite(1); site.Coords == nil || site.Name != "Blue Hole" {
+		t.Errorf("site 1 = %+v", site)
+	}
+
+	// Renaming a linked dive's site moves it to another site; a dive
+	// claiming a site it does not match is not taken at its word.
+	b.Site.Name = "Aquarium"
+	put(b)
+	d := put(dive(5, &divelog.Site{ID: 1, Name: "Elsewhere"}))
+	if b.Site.ID != 3 || d.Site.ID != 4 {
+		t.Errorf("site IDs %d, %d after renaming; want 3, 4", b.Site.ID, d.Site.ID)
+	}
+
+	// A linked dive that places its site places the registered one too.
+	e := put(dive(6, &divelog.Site{Name: "Reef"}))
+	e.Site.Coords = at(-16.5, 145.7)
+	put(e)
+	if site, _ := s.GetSite(5); e.Site.ID != 5 || e.Site.Coords == nil || site.Coords == nil || *site.Coords != *e.Site.Coords {
+		t.Errorf("dive #6 site %+v, registered %+v after placing it", e.Site, site)
+	}
+}
+
+func TestSyncUpdateMerge(t *testing.T) {
+	s := store.NewMemory()
+	for i, site := range []*divelog.Site{
+		{Name: "Blue Hole", Coords: at(17.3157, -87.5346)},
+		{Name: "Blue Hole"},
+		{Name: "Blu Hole", Country: "Belize"},
+		{Name: "Aquarium"},
+	} {
+		if err := s.Put(dive(i+1, site)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := Sync(s); err != nil || n != 4 {
+		t.Fatalf("Sync = %d, %v; want 4 dives", n, err)
+	}
+	if n, err := Sync(s); err != nil || n != 0 {
+		t.Errorf("second Sync = %d, %v; want no changes", n, err)
+	}
+	registered, _ := s.Sites()
+	if len(registered) != 3 {
+		t.Fatalf("%d sites registered, want 3", len(registered))
+	}
+	dives, _ := s.List()
+	for _, d := range dives {
+		if Unsynced(registered, d) {
+			t.Errorf("dive #%d unsynced after Sync: %+v", d.Number, d.Site)
+		}
+	}
+	if d := dive(9, &divelog.Site{Name: "Aquarium"}); !Unsynced(registered, d) {
+		t.Error("a dive not linked is not unsynced")
+	}
+	stale := dives[0].Clone()
+	stale.Site.Country = "Mexico"
+	if !Unsynced(registered, stale) {
+		t.Error("a dive with a stale copy of its site is not unsynced")
+	}
+
+	site, n, err := Merge(s, 1, 2)
+	// The dive at site 2 moves, and the two at site 1 take its country.
+	if err != nil || n != 3 {
+		t.Fatalf("Merge = %d, %v; want 3 dives", n, err)
+	}
+	if site.Country != "Belize" || site.Coords == nil {
+		t.Errorf("merged site = %+v", site)
+	}
+	if _, err := s.GetSite(2); err == nil {
+		t.Error("merged site 2 still registered")
+	}
+	if _, _, err := Merge(s, 1, 1); err == nil {
+		t.Error("merging a site into itself succeeded")
+	}
+
+	site.Entry = divelog.EntryBoat
+	if n, err := Update(s, site); err != nil || n != 3 {
+		t.Errorf("Update = %d, %v; want 3 dives", n, err)
+	}
+	d, _ := s.Get(3)
+	if d.Site.ID != 1 || d.Site.Entry != divelog.EntryBoat || d.Site.Name != "Blue Hole" {
+		t.Errorf("dive #3 site = %+v", d.Site)
+	}
+	if len(d.Samples) != 3 {
+		t.Errorf("relinking lost dive #3's profile")
+	}
+	site.Entry = "jetty"
+	if _, err := Update(s, site); err == nil {
+		t.Error("Update accepted an invalid site")
+	}
+}
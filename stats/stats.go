@@ -0,0 +1,290 @@
+// Package stats sums up a dive log: totals and records, how deep and how
+// often the diver dives, where, with whom and on what gas, and the longest
+// runs of diving, as for a club's year-end report.
+//
+// A Summary marshals to JSON with quantities in the units of the dive
+// JSON: metres, kelvin and nanoseconds.
+package stats
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// DefaultBinWidth is the width of the depth histogram's bins when Options
+// do not set one.
+const DefaultBinWidth divelog.Depth = 5
+
+// Options controls how dives are grouped.
+type Options struct {
+	// BinWidth is the width of the depth histogram's bins; zero means
+	// DefaultBinWidth.
+	BinWidth divelog.Depth
+}
+
+// Summary is the statistics of a set of dives.
+type Summary struct {
+	Dives      int           `json:"dives"`
+	DivingDays int           `json:"diving_days"`
+	BottomTime time.Duration `json:"bottom_time"` // the dives' durations added up
+
+	// First and Last are the first and the last dive, nil without dives.
+	First *Record `json:"first,omitempty"`
+	Last  *Record `json:"last,omitempty"`
+
+	// Deepest, Longest and Coldest hold the records: nil without dives
+	// or, for Coldest, without a temperature logged. Ties go to the
+	// earlier dive.
+	Deepest *Record `json:"deepest,omitempty"`
+	Longest *Record `json:"longest,omitempty"`
+	Coldest *Record `json:"coldest,omitempty"`
+
+	// Depths is the histogram of the dives' maximum depths, from the
+	// surface to the deepest dive.
+	Depths []Bin `json:"depths"`
+
+	// Months and Years count the dives in every month and year from the
+	// first dive to the last, including those without.
+	Months []Period `json:"months"`
+	Years  []Period `json:"years"`
+
+	// Sites, Buddies and Gases break the dives down, the most dived
+	// first. A dive counts towards each of its buddies and gases; dives
+	// without a site, buddies or tanks are left out of that breakdown.
+	Sites   []Group `json:"sites"`
+	Buddies []Group `json:"buddies"`
+	Gases   []Group `json:"gases"`
+
+	// Streak is the longest run of consecutive days with a dive, and
+	// MonthStreak that of consecutive months. The earlier run wins a
+	// tie.
+	Streak      Streak `json:"streak"`
+	MonthStreak Streak `json:"month_streak"`
+}
+
+// Record is a dive that holds one of the log's records, with its figures.
+type Record struct {
+	Number         int                 `json:"number"`
+	Start          time.Time           `json:"start"`
+	Site           string              `json:"site,omitempty"`
+	Duration       time.Duration       `json:"duration"`
+	MaxDepth       divelog.Depth       `json:"max_depth"`
+	MinTemperature divelog.Temperature `json:"min_temperature,omitempty"`
+}
+
+// Bin is a bar of the depth histogram: the dives whose maximum depth is
+// at least From and less than To.
+type Bin struct {
+	From  divelog.Depth `json:"from"`
+	To    divelog.Depth `json:"to"`
+	Dives int           `json:"dives"`
+}
+
+// Period is a month, such as "2024-05", or a year, such as "2024".
+type Period struct {
+	Period     string        `json:"period"`
+	Dives      int           `json:"dives"`
+	BottomTime time.Duration `json:"bottom_time"`
+}
+
+// Group is the dives at one site, with one buddy or on one gas.
+type Group struct {
+	Name       string        `json:"name"`
+	Dives      int           `json:"dives"`
+	BottomTime time.Duration `json:"bottom_time"`
+	MaxDepth   divelog.Depth `json:"max_depth"`
+	Last       time.Time     `json:"last"` // the start of the latest dive
+}
+
+// Streak is a run of consecutive days, or months, each with a dive. From
+// and To are its first and last day, such as "2024-05-01", or month.
+type Streak struct {
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Length int    `json:"length"` // in days or months
+	Dives  int    `json:"dives"`
+}
+
+// Compute works out the statistics of dives. Days and months are those of
+// the dives' start times where they were made.
+func Compute(dives []*divelog.Dive, o Options) *Summary {
+	width := o.BinWidth
+	if width <= 0 {
+		width = DefaultBinWidth
+	}
+	dives = slices.Clone(dives)
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+
+	s := &Summary{Dives: len(dives), Depths: []Bin{}, Months: []Period{}, Years: []Period{},
+		Sites: []Group{}, Buddies: []Group{}, Gases: []Group{}}
+	if len(dives) == 0 {
+		return s
+	}
+	s.First, s.Last = record(dives[0]), record(dives[len(dives)-1])
+	sites, buddies, gases := groups{}, groups{}, groups{}
+	var deepest, longest, coldest *divelog.Dive
+	for _, d := range dives {
+		s.BottomTime += d.Duration
+		if deepest == nil || d.MaxDepth > deepest.MaxDepth {
+			deepest = d
+		}
+		if longest == nil || d.Duration > longest.Duration {
+			longest = d
+		}
+		if d.MinTemperature != 0 && (coldest == nil || d.MinTemperature < coldest.MinTemperature) {
+			coldest = d
+		}
+		if d.Site != nil && d.Site.Name != "" {
+			sites.add(d.Site.Name, d)
+		}
+		for _, b := range d.Buddies {
+			buddies.add(b.Name, d)
+		}
+		var mixes []string
+		for _, t := range d.Tanks {
+			if m := t.Gas.String(); !slices.Contains(mixes, m) {
+				mixes = append(mixes, m)
+				gases.add(m, d)
+			}
+		}
+	}
+	s.Deepest, s.Longest = record(deepest), record(longest)
+	if coldest != nil {
+		s.Coldest = record(coldest)
+	}
+	s.Sites, s.Buddies, s.Gases = sites.sorted(), buddies.sorted(), gases.sorted()
+
+	bins := int(math.Floor(float64(deepest.MaxDepth/width))) + 1
+	for i := range bins {
+		s.Depths = append(s.Depths, Bin{From: divelog.Depth(i) * width, To: divelog.Depth(i+1) * width})
+	}
+	for _, d := range dives {
+		i := min(max(int(math.Floor(float64(d.MaxDepth/width))), 0), bins-1)
+		s.Depths[i].Dives++
+	}
+
+	s.Months, s.Years = periods(dives, month), periods(dives, year)
+	s.Streak, s.DivingDays = longestRun(dives, day)
+	s.MonthStreak, _ = longestRun(dives, month)
+	return s
+}
+
+func record(d *divelog.Dive) *Record {
+	r := &Record{Number: d.Number, Start: d.Start, Duration: d.Duration, MaxDepth: d.MaxDepth, MinTemperature: d.MinTemperature}
+	if d.Site != nil {
+		r.Site = d.Site.Name
+	}
+	return r
+}
+
+// groups gathers the dives of a breakdown by name.
+type groups map[string]*Group
+
+func (gs groups) add(name string, d *divelog.Dive) {
+	g := gs[name]
+	if g == nil {
+		g = &Group{Name: name}
+		gs[name] = g
+	}
+	g.Dives++
+	g.BottomTime += d.Duration
+	g.MaxDepth = max(g.MaxDepth, d.MaxDepth)
+	if d.Start.After(g.Last) {
+		g.Last = d.Start
+	}
+}
+
+// sorted returns the groups, the most dives first, then the most time
+// underwater, then by name.
+func (gs groups) sorted() []Group {
+	list := make([]Group, 0, len(gs))
+	for _, g := range gs {
+		list = append(list, *g)
+	}
+	slices.SortFunc(list, func(a, b Group) int {
+		return cmp.Or(cmp.Compare(b.Dives, a.Dives), cmp.Compare(b.BottomTime, a.BottomTime), cmp.Compare(a.Name, b.Name))
+	})
+	return list
+}
+
+// A unit is a kind of calendar period: a day, a month or a year.
+type unit struct {
+	layout string
+
+	// start returns the start of the period of a time, as a UTC time so
+	// that stepping with next is not upset by changes of time zone.
+	start func(time.Time) time.Time
+	next  func(time.Time) time.Time
+}
+
+var (
+	day = unit{"2006-01-02",
+		func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) },
+		func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }}
+	month = unit{"2006-01",
+		func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC) },
+		func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }}
+	year = unit{"2006",
+		func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC) },
+		func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }}
+)
+
+// inPeriods returns dives sorted by the start of their periods. Sorting by
+// start time is not enough: a dive made later in a time zone further east
+// may still fall on an earlier day.
+func inPeriods(dives []*divelog.Dive, u unit) []*divelog.Dive {
+	dives = slices.Clone(dives)
+	slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return u.start(a.Start).Compare(u.start(b.Start)) })
+	return dives
+}
+
+// periods counts dives in each period from the first dive's to the
+// last's.
+func periods(dives []*divelog.Dive, u unit) []Period {
+	dives = inPeriods(dives, u)
+	var ps []Period
+	last := u.start(dives[len(dives)-1].Start)
+	i := 0
+	for p := u.start(dives[0].Start); !p.After(last); p = u.next(p) {
+		period := Period{Period: p.Format(u.layout)}
+		for ; i < len(dives) && u.start(dives[i].Start).Equal(p); i++ {
+			period.Dives++
+			period.BottomTime += dives[i].Duration
+		}
+		ps = append(ps, period)
+	}
+	return ps
+}
+
+// longestRun returns the longest run of consecutive periods with dives
+// and the number of periods with dives.
+func longestRun(dives []*divelog.Dive, u unit) (Streak, int) {
+	var runs []Streak
+	var prev time.Time
+	for _, d := range inPeriods(dives, u) {
+		p := u.start(d.Start)
+		switch {
+		case len(runs) > 0 && p.Equal(prev):
+		case len(runs) > 0 && p.Equal(u.next(prev)):
+			runs[len(runs)-1].Length++
+			runs[len(runs)-1].To = p.Format(u.layout)
+		default:
+			runs = append(runs, Streak{From: p.Format(u.layout), To: p.Format(u.layout), Length: 1})
+		}
+		runs[len(runs)-1].Dives++
+		prev = p
+	}
+	var best Streak
+	periods := 0
+	for _, r := range runs {
+		periods += r.Length
+		if r.Length > best.Length {
+			best = r
+		}
+	}
+	return best, periods
+}
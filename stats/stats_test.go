@@ -0,0 +1,134 @@
+package stats
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func testDives() []*divelog.Dive {
+	at := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, time.UTC) }
+	ean32, _ := divelog.ParseGasMix("EAN32")
+	blue := &divelog.Site{Name: "Blue Hole"}
+	return []*divelog.Dive{
+		// Out of order, as a store may list them.
+		{Number: 4, Start: at(2024, 3, 2, 9), Duration: 50 * time.Minute, MaxDepth: 12, Site: blue,
+			Tanks: []divelog.Tank{{Gas: ean32}, {Gas: ean32}}},
+		{Number: 1, Start: at(2023, 12, 30, 9), Duration: 40 * time.Minute, MaxDepth: 18, MinTemperature: divelog.Celsius(22),
+			Site: blue, Buddies: []divelog.Buddy{{Name: "Ana"}}, Tanks: []divelog.Tank{{Gas: divelog.Air}}},
+		{Number: 2, Start: at(2023, 12, 31, 9), Duration: 55 * time.Minute, MaxDepth: 31, MinTemperature: divelog.Celsius(19),
+			Site: &divelog.Site{Name: "Canyon"}, Buddies: []divelog.Buddy{{Name: "Ana"}, {Name: "Joe"}},
+			Tanks: []divelog.Tank{{Gas: divelog.Air}, {Gas: ean32}}},
+		{Number: 3, Start: at(2024, 1, 1, 14), Duration: 35 * time.Minute, MaxDepth: 5, MinTemperature: divelog.Celsius(19)},
+		{Number: 5, Start: at(2024, 3, 2, 14), Duration: 55 * time.Minute, MaxDepth: 9.5, Site: blue},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	s := Compute(testDives(), Options{})
+	if s.Dives != 5 || s.DivingDays != 4 || s.BottomTime != 235*time.Minute {
+		t.Errorf("totals: %d dives on %d days, %v", s.Dives, s.DivingDays, s.BottomTime)
+	}
+	for name, tt := range map[string]struct {
+		r    *Record
+		want int
+	}{
+		"first": {s.First, 1}, "last": {s.Last, 5}, "deepest": {s.Deepest, 2}, "longest": {s.Longest, 2}, "coldest": {s.Coldest, 2},
+	} {
+		if tt.r == nil || tt.r.Number != tt.want {
+			t.Errorf("%s = %+v, want dive #%d", name, tt.r, tt.want)
+		}
+	}
+	if s.Deepest.Site != "Canyon" || s.Deepest.MaxDepth != 31 {
+		t.Errorf("deepest = %+v", s.Deepest)
+	}
+
+	depths := []int{0, 2, 1, 1, 0, 0, 1}
+	if len(s.Depths) != len(depths) {
+		t.Fatalf("depth histogram = %+v", s.Depths)
+	}
+	for i, b := range s.Depths {
+		if b.Dives != depths[i] || b.From != divelog.Depth(5*i) || b.To != divelog.Depth(5*i+5) {
+			t.Errorf("bin %d = %+v, want %d dives from %d m", i, b, depths[i], 5*i)
+		}
+	}
+
+	want := []Period{{"2023-12", 2, 95 * time.Minute}, {"2024-01", 1, 35 * time.Minute}, {"2024-02", 0, 0}, {"2024-03", 2, 105 * time.Minute}}
+	if !reflect.DeepEqual(s.Months, want) {
+		t.Errorf("months = %+v, want %+v", s.Months, want)
+	}
+	want = []Period{{"2023", 2, 95 * time.Minute}, {"2024", 3, 140 * time.Minute}}
+	if !reflect.DeepEqual(s.Years, want) {
+		t.Errorf("years = %+v, want %+v", s.Years, want)
+	}
+
+	names := func(gs []Group) (out []string) {
+		for _, g := range gs {
+			out = append(out, g.Name)
+		}
+		return out
+	}
+	if got := names(s.Sites); !reflect.DeepEqual(got, []string{"Blue Hole", "Canyon"}) || s.Sites[0].Dives != 3 ||
+		s.Sites[0].MaxDepth != 18 || !s.Sites[0].Last.Equal(testDives()[4].Start) {
+		t.Errorf("sites = %+v", s.Sites)
+	}
+	if got := names(s.Buddies); !reflect.DeepEqual(got, []string{"Ana", "Joe"}) || s.Buddies[0].Dives != 2 {
+		t.Errorf("buddies = %+v", s.Buddies)
+	}
+	// Dive 4 breathes EAN32 from two tanks but counts once.
+	if got := names(s.Gases); !reflect.DeepEqual(got, []string{"EAN32", "air"}) || s.Gases[0].Dives != 2 ||
+		s.Gases[0].BottomTime != 105*time.Minute {
+		t.Errorf("gases = %+v", s.Gases)
+	}
+
+	if want := (Streak{"2023-12-30", "2024-01-01", 3, 3}); s.Streak != want {
+		t.Errorf("streak = %+v, want %+v", s.Streak, want)
+	}
+	if want := (Streak{"2023-12", "2024-01", 2, 3}); s.MonthStreak != want {
+		t.Errorf("month streak = %+v, want %+v", s.MonthStreak, want)
+	}
+
+	if s := Compute(testDives(), Options{BinWidth: 10}); len(s.Depths) != 4 || s.Depths[0].Dives != 2 || s.Depths[1].Dives != 2 {
+		t.Errorf("10 m bins = %+v", s.Depths)
+	}
+}
+
+func TestComputeTimeZones(t *testing.T) {
+	hawaii := time.FixedZone("HST", -10*60*60)
+	dives := []*divelog.Dive{
+		// Made after dive 2, but on the last evening of January in Hawaii.
+		{Number: 1, Start: time.Date(2024, 1, 31, 22, 0, 0, 0, hawaii), Duration: 40 * time.Minute},
+		{Number: 2, Start: time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC), Duration: 30 * time.Minute},
+		{Number: 3, Start: time.Date(2024, 2, 2, 10, 0, 0, 0, time.UTC), Duration: 50 * time.Minute},
+	}
+	s := Compute(dives, Options{})
+	want := []Period{{"2024-01", 1, 40 * time.Minute}, {"2024-02", 2, 80 * time.Minute}}
+	if !reflect.DeepEqual(s.Months, want) {
+		t.Errorf("months = %+v, want %+v", s.Months, want)
+	}
+	if want := (Streak{"2024-01-31", "2024-02-02", 3, 3}); s.Streak != want || s.DivingDays != 3 {
+		t.Errorf("streak = %+v on %d days, want %+v", s.Streak, s.DivingDays, want)
+	}
+	if want := (Streak{"2024-01", "2024-02", 2, 3}); s.MonthStreak != want {
+		t.Errorf("month streak = %+v, want %+v", s.MonthStreak, want)
+	}
+}
+
+func TestComputeEmpty(t *testing.T) {
+	s := Compute(nil, Options{})
+	if s.Dives != 0 || s.Deepest != nil || s.Streak.Length != 0 {
+		t.Errorf("summary of no dives = %+v", s)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	if m["depths"] == nil || m["sites"] == nil {
+		t.Errorf("empty lists marshal as null: %s", data)
+	}
+}
@@ -0,0 +1,372 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// ErrLocked is returned by OpenJSON when another process holds the log
+// open for longer than LockTimeout.
+var ErrLocked = errors.New("dive log is locked by another process")
+
+// LockTimeout is how long OpenJSON waits for another process to release
+// the log before giving up with ErrLocked.
+var LockTimeout = 10 * time.Second
+
+// JSONFile is a Store kept in a single JSON file.
+//
+// Every change rewrites the whole file through a temporary file in the same
+// directory that is synced and then renamed over the original, so a crash
+// leaves either the old or the new log on disk, never a torn one. While
+// open, the store holds an exclusive lock on the file named path+".lock",
+// so two processes cannot interleave their changes.
+type JSONFile struct {
+	path string
+	lock *fileLock
+	mem  *Memory
+}
+
+// jsonLog is the file format.
+type jsonLog struct {
+	NextNumber int                      `json:"next_number"`
+	Dives      []*divelog.Dive          `json:"dives"`
+	NextSite   int                      `json:"next_site,omitempty"`
+	Sites      []*divelog.Site          `json:"sites,omitempty"`
+	NextItem   int                      `json:"next_item,omitempty"`
+	Items      []*divelog.Item          `json:"items,omitempty"`
+	NextCert   int                      `json:"next_certification,omitempty"`
+	Certs      []*divelog.Certification `json:"certifications,omitempty"`
+
+	// Fingerprints are the download fingerprints by device.
+	Fingerprints map[string]string `json:"fingerprints,omitempty"`
+}
+
+// OpenJSON opens the log stored at path, creating an empty one if the file
+// does not exist.
+func OpenJSON(path string) (*JSONFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := acquireLock(path+".lock", LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s := &JSONFile{path: path, lock: lock, mem: NewMemory()}
+	if err := s.load(); err != nil {
+		lock.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONFile) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var l jsonLog
+	if err := json.Unmarshal(data, &l); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	for _, d := range l.Dives {
+		s.mem.put(d)
+	}
+	s.mem.next = max(s.mem.next, l.NextNumber)
+	for _, site := range l.Sites {
+		s.mem.putSite(site)
+	}
+	s.mem.nextSite = max(s.mem.nextSite, l.NextSite)
+	for _, it := range l.Items {
+		s.mem.putItem(it)
+	}
+	s.mem.nextItem = max(s.mem.nextItem, l.NextItem)
+	for _, c := range l.Certs {
+		s.mem.putCertification(c)
+	}
+	s.mem.nextCert = max(s.mem.nextCert, l.NextCert)
+	maps.Copy(s.mem.fingerprints, l.Fingerprints)
+	return nil
+}
+
+// save writes the log to disk. The caller holds s.mem.mu.
+func (s *JSONFile) save() error {
+	l := jsonLog{NextNumber: s.mem.next, Dives: make([]*divelog.Dive, 0, len(s.mem.dives))}
+	for _, d := range s.mem.dives {
+		l.Dives = append(l.Dives, d)
+	}
+	sortByNumber(l.Dives)
+	if len(s.mem.sites) > 0 || s.mem.nextSite > 1 {
+		l.NextSite = s.mem.nextSite
+	}
+	for _, site := range s.mem.sites {
+		l.Sites = append(l.Sites, site)
+	}
+	slices.SortFunc(l.Sites, func(a, b *divelog.Site) int { return a.ID - b.ID })
+	if len(s.mem.items) > 0 || s.mem.nextItem > 1 {
+		l.NextItem = s.mem.nextItem
+	}
+	for _, it := range s.mem.items {
+		l.Items = append(l.Items, it)
+	}
+	slices.SortFunc(l.Items, func(a, b *divelog.Item) int { return a.ID - b.ID })
+	if len(s.mem.certs) > 0 || s.mem.nextCert > 1 {
+		l.NextCert = s.mem.nextCert
+	}
+	for _, c := range s.mem.certs {
+		l.Certs = append(l.Certs, c)
+	}
+	slices.SortFunc(l.Certs, func(a, b *divelog.Certification) int { return a.ID - b.ID })
+	if len(s.mem.fingerprints) > 0 {
+		l.Fingerprints = s.mem.fingerprints
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, 0o644)
+}
+
+func (s *JSONFile) Get(number int) (*divelog.Dive, error) { return s.mem.Get(number) }
+
+func (s *JSONFile) List() ([]*divelog.Dive, error) { return s.mem.List() }
+
+func (s *JSONFile) Query(q Query) ([]*divelog.Dive, error) { return s.mem.Query(q) }
+
+func (s *JSONFile) NextNumber() (int, error) { return s.mem.NextNumber() }
+
+func (s *JSONFile) SetNextNumber(n int) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n <= m.next {
+		return nil
+	}
+	old := m.next
+	m.next = n
+	if err := s.save(); err != nil {
+		m.next = old
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) Put(d *divelog.Dive) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	number, next := d.Number, m.next
+	old, existed := m.dives[d.Number]
+	m.put(d)
+	if err := s.save(); err != nil {
+		// Leave memory matching the file that is still on disk.
+		if existed {
+			m.dives[number] = old
+		} else {
+			delete(m.dives, d.Number)
+		}
+		m.next, d.Number = next, number
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) Delete(number int) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.dives[number]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.dives, number)
+	if err := s.save(); err != nil {
+		m.dives[number] = old
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) Sites() ([]*divelog.Site, error) { return s.mem.Sites() }
+
+func (s *JSONFile) GetSite(id int) (*divelog.Site, error) { return s.mem.GetSite(id) }
+
+func (s *JSONFile) PutSite(site *divelog.Site) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, next := site.ID, m.nextSite
+	old, existed := m.sites[site.ID]
+	m.putSite(site)
+	if err := s.save(); err != nil {
+		if existed {
+			m.sites[id] = old
+		} else {
+			delete(m.sites, site.ID)
+		}
+		m.nextSite, site.ID = next, id
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) DeleteSite(id int) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.sites[id]
+	if !ok {
+		return ErrSiteNotFound
+	}
+	delete(m.sites, id)
+	if err := s.save(); err != nil {
+		m.sites[id] = old
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) Items() ([]*divelog.Item, error) { return s.mem.Items() }
+
+func (s *JSONFile) GetItem(id int) (*divelog.Item, error) { return s.mem.GetItem(id) }
+
+func (s *JSONFile) PutItem(it *divelog.Item) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, next := it.ID, m.nextItem
+	old, existed := m.items[it.ID]
+	m.putItem(it)
+	if err := s.save(); err != nil {
+		if existed {
+			m.items[id] = old
+		} else {
+			delete(m.items, it.ID)
+		}
+		m.nextItem, it.ID = next, id
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) DeleteItem(id int) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.items[id]
+	if !ok {
+		return ErrItemNotFound
+	}
+	delete(m.items, id)
+	if err := s.save(); err != nil {
+		m.items[id] = old
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) Certifications() ([]*divelog.Certification, error) {
+	return s.mem.Certifications()
+}
+
+func (s *JSONFile) GetCertification(id int) (*divelog.Certification, error) {
+	return s.mem.GetCertification(id)
+}
+
+func (s *JSONFile) PutCertification(c *divelog.Certification) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, next := c.ID, m.nextCert
+	old, existed := m.certs[c.ID]
+	m.putCertification(c)
+	if err := s.save(); err != nil {
+		if existed {
+			m.certs[id] = old
+		} else {
+			delete(m.certs, c.ID)
+		}
+		m.nextCert, c.ID = next, id
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) DeleteCertification(id int) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.certs[id]
+	if !ok {
+		return ErrCertificationNotFound
+	}
+	delete(m.certs, id)
+	if err := s.save(); err != nil {
+		m.certs[id] = old
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFile) Fingerprints() (map[string]string, error) { return s.mem.Fingerprints() }
+
+func (s *JSONFile) SetFingerprint(device, fingerprint string) error {
+	m := s.mem
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, existed := m.fingerprints[device]
+	m.fingerprints[device] = fingerprint
+	if err := s.save(); err != nil {
+		if existed {
+			m.fingerprints[device] = old
+		} else {
+			delete(m.fingerprints, device)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close releases the lock on the log.
+func (s *JSONFile) Close() error { return s.lock.release() }
+
+// writeFileAtomic replaces the file at path with data such that readers,
+// and the file system after a crash, see either the old contents or the
+// new ones.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
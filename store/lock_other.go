@@ -0,0 +1,40 @@
+//go:build !unix
+
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// fileLock is a lock file created exclusively and removed on release, for
+// systems without flock(2). A process that crashes leaves the file behind;
+// delete it by hand to unlock the log.
+type fileLock struct {
+	path string
+}
+
+func acquireLock(path string, timeout time.Duration) (*fileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return &fileLock{path: path}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (l *fileLock) release() error { return os.Remove(l.path) }
+
+// syncDir is a no-op: directories cannot be synced portably here.
+func syncDir(string) error { return nil }
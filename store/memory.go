@@ -0,0 +1,269 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/betonavab/divelog"
+)
+
+// Memory is a Store that keeps the log in memory. It is safe for
+// concurrent use.
+type Memory struct {
+	mu    sync.RWMutex
+	next  int
+	dives map[int]*divelog.Dive
+
+	nextSite int
+	sites    map[int]*divelog.Site
+
+	nextItem int
+	items    map[int]*divelog.Item
+
+	nextCert int
+	certs    map[int]*divelog.Certification
+
+	fingerprints map[string]string
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{next: 1, dives: make(map[int]*divelog.Dive), nextSite: 1, sites: make(map[int]*divelog.Site),
+		nextItem: 1, items: make(map[int]*divelog.Item),
+		nextCert: 1, certs: make(map[int]*divelog.Certification),
+		fingerprints: make(map[string]string)}
+}
+
+func (m *Memory) Get(number int) (*divelog.Dive, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.dives[number]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return d.Clone(), nil
+}
+
+func (m *Memory) Put(d *divelog.Dive) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(d)
+	return nil
+}
+
+func (m *Memory) put(d *divelog.Dive) {
+	if d.Number == 0 {
+		d.Number = m.next
+	}
+	m.next = max(m.next, d.Number+1)
+	m.dives[d.Number] = d.Clone()
+}
+
+func (m *Memory) Delete(number int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.dives[number]; !ok {
+		return ErrNotFound
+	}
+	delete(m.dives, number)
+	return nil
+}
+
+func (m *Memory) List() ([]*divelog.Dive, error) {
+	return m.Query(Query{})
+}
+
+func (m *Memory) Query(q Query) ([]*divelog.Dive, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var dives []*divelog.Dive
+	for _, d := range m.dives {
+		if !q.Match(d) {
+			continue
+		}
+		c := d.Clone()
+		if q.OmitSamples {
+			c.Samples, c.Profiles = nil, nil
+		}
+		dives = append(dives, c)
+	}
+	sortByNumber(dives)
+	return dives, nil
+}
+
+func (m *Memory) NextNumber() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.next, nil
+}
+
+func (m *Memory) SetNextNumber(n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next = max(m.next, n)
+	return nil
+}
+
+func (m *Memory) Sites() ([]*divelog.Site, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sites := make([]*divelog.Site, 0, len(m.sites))
+	for _, s := range m.sites {
+		sites = append(sites, s.Clone())
+	}
+	slices.SortFunc(sites, func(a, b *divelog.Site) int { return a.ID - b.ID })
+	return sites, nil
+}
+
+func (m *Memory) GetSite(id int) (*divelog.Site, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sites[id]
+	if !ok {
+		return nil, ErrSiteNotFound
+	}
+	return s.Clone(), nil
+}
+
+func (m *Memory) PutSite(s *divelog.Site) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putSite(s)
+	return nil
+}
+
+func (m *Memory) putSite(s *divelog.Site) {
+	if s.ID == 0 {
+		s.ID = m.nextSite
+	}
+	m.nextSite = max(m.nextSite, s.ID+1)
+	m.sites[s.ID] = s.Clone()
+}
+
+func (m *Memory) DeleteSite(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sites[id]; !ok {
+		return ErrSiteNotFound
+	}
+	delete(m.sites, id)
+	return nil
+}
+
+func (m *Memory) Items() ([]*divelog.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := make([]*divelog.Item, 0, len(m.items))
+	for _, it := range m.items {
+		c := *it
+		items = append(items, &c)
+	}
+	slices.SortFunc(items, func(a, b *divelog.Item) int { return a.ID - b.ID })
+	return items, nil
+}
+
+func (m *Memory) GetItem(id int) (*divelog.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	it, ok := m.items[id]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	c := *it
+	return &c, nil
+}
+
+func (m *Memory) PutItem(it *divelog.Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putItem(it)
+	return nil
+}
+
+func (m *Memory) putItem(it *divelog.Item) {
+	if it.ID == 0 {
+		it.ID = m.nextItem
+	}
+	m.nextItem = max(m.nextItem, it.ID+1)
+	c := *it
+	m.items[it.ID] = &c
+}
+
+func (m *Memory) DeleteItem(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[id]; !ok {
+		return ErrItemNotFound
+	}
+	delete(m.items, id)
+	return nil
+}
+
+func (m *Memory) Certifications() ([]*divelog.Certification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	certs := make([]*divelog.Certification, 0, len(m.certs))
+	for _, c := range m.certs {
+		cc := *c
+		certs = append(certs, &cc)
+	}
+	slices.SortFunc(certs, func(a, b *divelog.Certification) int { return a.ID - b.ID })
+	return certs, nil
+}
+
+func (m *Memory) GetCertification(id int) (*divelog.Certification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.certs[id]
+	if !ok {
+		return nil, ErrCertificationNotFound
+	}
+	cc := *c
+	return &cc, nil
+}
+
+func (m *Memory) PutCertification(c *divelog.Certification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putCertification(c)
+	return nil
+}
+
+func (m *Memory) putCertification(c *divelog.Certification) {
+	if c.ID == 0 {
+		c.ID = m.nextCert
+	}
+	m.nextCert = max(m.nextCert, c.ID+1)
+	cc := *c
+	m.certs[c.ID] = &cc
+}
+
+func (m *Memory) DeleteCertification(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.certs[id]; !ok {
+		return ErrCertificationNotFound
+	}
+	delete(m.certs, id)
+	return nil
+}
+
+func (m *Memory) Fingerprints() (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return maps.Clone(m.fingerprints), nil
+}
+
+func (m *Memory) SetFingerprint(device, fingerprint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fingerprints[device] = fingerprint
+	return nil
+}
+
+func (m *Memory) Close() error { return nil }
+
+func sortByNumber(dives []*divelog.Dive) {
+	slices.SortFunc(dives, func(a, b *divelog.Dive) int { return a.Number - b.Number })
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order to bring a database up to date. The
+// schema version is the number of migrations applied, kept in SQLite's
+// user_version pragma. Migrations are forward-only: never edit or reorder
+// an entry once released, append a new one instead.
+var migrations = []string{
+	// 1: dives, their profiles and the dive number sequence.
+	`CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);
+	INSERT INTO meta (key, value) VALUES ('next_number', 1);
+
+	CREATE TABLE dives (
+		number     INTEGER PRIMARY KEY,
+		start_time INTEGER NOT NULL, -- Unix nanoseconds, for indexing
+		site       TEXT,
+		max_depth  REAL NOT NULL,
+		data       BLOB NOT NULL     -- the dive as JSON, without samples
+	);
+	CREATE INDEX dives_start_time ON dives (start_time);
+	CREATE INDEX dives_site ON dives (site COLLATE NOCASE);
+	CREATE INDEX dives_max_depth ON dives (max_depth);
+
+	CREATE TABLE samples (
+		dive INTEGER PRIMARY KEY REFERENCES dives (number) ON DELETE CASCADE,
+		data BLOB NOT NULL -- see encodeSamples
+	);`,
+
+	// 2: the site registry.
+	`INSERT INTO meta (key, value) VALUES ('next_site', 1);
+
+	CREATE TABLE sites (
+		id   INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		data BLOB NOT NULL -- the site as JSON
+	);`,
+
+	// 3: the equipment inventory.
+	`INSERT INTO meta (key, value) VALUES ('next_item', 1);
+
+	CREATE TABLE items (
+		id   INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		data BLOB NOT NULL -- the item as JSON
+	);`,
+
+	// 4: certifications.
+	`INSERT INTO meta (key, value) VALUES ('next_certification', 1);
+
+	CREATE TABLE certifications (
+		id   INTEGER PRIMARY KEY,
+		data BLOB NOT NULL -- the certification as JSON
+	);`,
+
+	// 5: download fingerprints.
+	`CREATE TABLE fingerprints (
+		device      TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL
+	);`,
+
+	// 6: the profiles of a dive's other computers, numbered in the order
+	// of the dive's Profiles.
+	`CREATE TABLE profiles (
+		dive INTEGER NOT NULL REFERENCES dives (number) ON DELETE CASCADE,
+		n    INTEGER NOT NULL,
+		data BLOB NOT NULL, -- see encodeSamples
+		PRIMARY KEY (dive, n)
+	);`,
+
+	// 7: full-text search over the dives' notes. The trigram tokenizer
+	// finds any substring of three characters or more, as Query.Text
+	// does, where whole-word tokens would miss "turtle" in "turtles".
+	`CREATE VIRTUAL TABLE notes USING fts5 (text, tokenize = 'trigram');
+	INSERT INTO notes (rowid, text)
+		SELECT number, data ->> '$.notes' FROM dives WHERE data ->> '$.notes' != '';`,
+}
+
+// SchemaVersion is the schema version this package writes.
+var SchemaVersion = len(migrations)
+
+// migrate applies the migrations db has not seen yet, each in its own
+// transaction.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this divelog supports (%d)", version, len(migrations))
+	}
+	for v := version; v < len(migrations); v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		// PRAGMA does not take parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+	}
+	return nil
+}
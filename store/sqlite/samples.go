@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// Profiles are stored as a version byte followed by fixed-size records of
+// little-endian fields: time in nanoseconds (int64), depth, temperature and
+// pressure (float64) and tank (int32). Floats are stored bit for bit so
+// that a profile reads back exactly as written.
+const (
+	samplesV1  = 1
+	sampleSize = 8 + 8 + 8 + 8 + 4
+)
+
+func encodeSamples(samples []divelog.Sample) []byte {
+	b := make([]byte, 1, 1+len(samples)*sampleSize)
+	b[0] = samplesV1
+	for _, s := range samples {
+		b = binary.LittleEndian.AppendUint64(b, uint64(s.Time))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(float64(s.Depth)))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(float64(s.Temperature)))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(float64(s.Pressure)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(int32(s.Tank)))
+	}
+	return b
+}
+
+func decodeSamples(b []byte) ([]divelog.Sample, error) {
+	if len(b) == 0 || b[0] != samplesV1 || (len(b)-1)%sampleSize != 0 {
+		return nil, fmt.Errorf("corrupt sample data")
+	}
+	b = b[1:]
+	samples := make([]divelog.Sample, len(b)/sampleSize)
+	for i := range samples {
+		r := b[i*sampleSize:]
+		samples[i] = divelog.Sample{
+			Time:        time.Duration(binary.LittleEndian.Uint64(r)),
+			Depth:       divelog.Depth(math.Float64frombits(binary.LittleEndian.Uint64(r[8:]))),
+			Temperature: divelog.Temperature(math.Float64frombits(binary.LittleEndian.Uint64(r[16:]))),
+			Pressure:    divelog.Pressure(math.Float64frombits(binary.LittleEndian.Uint64(r[24:]))),
+			Tank:        int(int32(binary.LittleEndian.Uint32(r[32:]))),
+		}
+	}
+	return samples, nil
+}
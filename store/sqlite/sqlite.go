@@ -0,0 +1,587 @@
+// Package sqlite is a store.Store kept in an SQLite database, for logs too
+// large to rewrite as a single JSON file on every change. It uses a pure-Go
+// SQLite driver, so building it needs no C toolchain.
+//
+// Each dive is a row holding the dive as JSON next to indexed copies of the
+// fields queries filter on; profiles live in a separate table in a compact
+// binary form and are only read when asked for.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Store is a store.Store backed by an SQLite database.
+type Store struct {
+	db *sql.DB
+}
+
+var _ interface {
+	store.Store
+	store.Sequencer
+	store.SiteRegistry
+	store.Inventory
+	store.CertRegistry
+} = (*Store)(nil)
+
+// Open opens the database at path, creating it if needed, and brings its
+// schema up to date.
+func Open(path string) (*Store, error) {
+	dsn := path + "?_pragma=busy_timeout(10000)&_pragma=foreign_keys(1)" +
+		"&_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// One connection serialises writers within the process; other
+	// processes wait on SQLite's own lock for up to busy_timeout.
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error { return s.db.Close() }
+
+func (s *Store) Get(number int) (*divelog.Dive, error) {
+	dives, err := s.selectDives("d.number = ?", []any{number}, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(dives) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return dives[0], nil
+}
+
+func (s *Store) Put(d *divelog.Dive) error {
+	summary := *d
+	summary.Samples = nil
+	// Profiles' samples go in the profiles table.
+	summary.Profiles = slices.Clone(d.Profiles)
+	for i := range summary.Profiles {
+		summary.Profiles[i].Samples = nil
+	}
+	data, err := json.Marshal(&summary)
+	if err != nil {
+		return err
+	}
+	var site sql.NullString
+	if d.Site != nil {
+		site = sql.NullString{String: d.Site.Name, Valid: true}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	number := d.Number
+	if number == 0 {
+		if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'next_number'`).Scan(&number); err != nil {
+			return err
+		}
+		// The JSON copy carries the number too.
+		summary.Number = number
+		if data, err = json.Marshal(&summary); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO dives (number, start_time, site, max_depth, data)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (number) DO UPDATE SET
+			start_time = excluded.start_time,
+			site = excluded.site,
+			max_depth = excluded.max_depth,
+			data = excluded.data`,
+		number, d.Start.UnixNano(), site, float64(d.MaxDepth), data)
+	if err != nil {
+		return err
+	}
+	if len(d.Samples) > 0 {
+		_, err = tx.Exec(`INSERT INTO samples (dive, data) VALUES (?, ?)
+			ON CONFLICT (dive) DO UPDATE SET data = excluded.data`,
+			number, encodeSamples(d.Samples))
+	} else {
+		_, err = tx.Exec(`DELETE FROM samples WHERE dive = ?`, number)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM profiles WHERE dive = ?`, number); err != nil {
+		return err
+	}
+	for i, p := range d.Profiles {
+		if _, err := tx.Exec(`INSERT INTO profiles (dive, n, data) VALUES (?, ?, ?)`,
+			number, i, encodeSamples(p.Samples)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM notes WHERE rowid = ?`, number); err != nil {
+		return err
+	}
+	if d.Notes != "" {
+		if _, err := tx.Exec(`INSERT INTO notes (rowid, text) VALUES (?, ?)`, number, d.Notes); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE meta SET value = max(value, ?) WHERE key = 'next_number'`, number+1); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.Number = number
+	return nil
+}
+
+func (s *Store) Delete(number int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM dives WHERE number = ?`, number)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrNotFound
+	}
+	// Virtual tables take no foreign keys to cascade from.
+	if _, err := tx.Exec(`DELETE FROM notes WHERE rowid = ?`, number); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) List() ([]*divelog.Dive, error) {
+	return s.Query(store.Query{})
+}
+
+// Query narrows the rows with the indexed columns and then applies
+// q.Match, so results agree exactly with the other backends.
+func (s *Store) Query(q store.Query) ([]*divelog.Dive, error) {
+	var where []string
+	var args []any
+	if !q.From.IsZero() {
+		where = append(where, "d.start_time >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "d.start_time < ?")
+		args = append(args, q.To.UnixNano())
+	}
+	if q.MinDepth != 0 {
+		where = append(where, "d.max_depth >= ?")
+		args = append(args, float64(q.MinDepth))
+	}
+	if q.MaxDepth != 0 {
+		where = append(where, "d.max_depth <= ?")
+		args = append(args, float64(q.MaxDepth))
+	}
+	// LIKE only folds ASCII case, so leave other names to Match.
+	if q.Site != "" && isASCII(q.Site) {
+		where = append(where, `d.site LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.Site)+"%")
+	}
+	// The trigram index needs three characters and, like LIKE, folds
+	// only ASCII case.
+	for _, t := range q.Text {
+		if utf8.RuneCountInString(t) >= 3 && isASCII(t) {
+			where = append(where, "d.number IN (SELECT rowid FROM notes WHERE notes MATCH ?)")
+			args = append(args, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+		}
+	}
+	dives, err := s.selectDives(strings.Join(where, " AND "), args, !q.OmitSamples)
+	if err != nil {
+		return nil, err
+	}
+	matched := dives[:0]
+	for _, d := range dives {
+		if q.Match(d) {
+			matched = append(matched, d)
+		}
+	}
+	return matched, nil
+}
+
+// selectDives returns the dives satisfying the SQL condition where, which
+// may refer to the dives table as d, ordered by number.
+func (s *Store) selectDives(where string, args []any, withSamples bool) ([]*divelog.Dive, error) {
+	query := `SELECT d.data, NULL FROM dives d`
+	if withSamples {
+		query = `SELECT d.data, s.data FROM dives d LEFT JOIN samples s ON s.dive = d.number`
+	}
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY d.number"
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var dives []*divelog.Dive
+	for rows.Next() {
+		var data, samples []byte
+		if err := rows.Scan(&data, &samples); err != nil {
+			return nil, err
+		}
+		d := new(divelog.Dive)
+		if err := json.Unmarshal(data, d); err != nil {
+			return nil, fmt.Errorf("corrupt dive: %w", err)
+		}
+		if samples != nil {
+			if d.Samples, err = decodeSamples(samples); err != nil {
+				return nil, fmt.Errorf("dive #%d: %w", d.Number, err)
+			}
+		}
+		if !withSamples {
+			d.Profiles = nil
+		}
+		dives = append(dives, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	for _, d := range dives {
+		if len(d.Profiles) > 0 {
+			if err := s.readProfiles(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dives, nil
+}
+
+// readProfiles reads the samples of d's other computers' profiles.
+func (s *Store) readProfiles(d *divelog.Dive) error {
+	rows, err := s.db.Query(`SELECT n, data FROM profiles WHERE dive = ?`, d.Number)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n int
+		var data []byte
+		if err := rows.Scan(&n, &data); err != nil {
+			return err
+		}
+		if n < 0 || n >= len(d.Profiles) {
+			return fmt.Errorf("dive #%d: profile %d of %d", d.Number, n, len(d.Profiles))
+		}
+		if d.Profiles[n].Samples, err = decodeSamples(data); err != nil {
+			return fmt.Errorf("dive #%d profile %d: %w", d.Number, n, err)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Store) NextNumber() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'next_number'`).Scan(&n)
+	return n, err
+}
+
+func (s *Store) SetNextNumber(n int) error {
+	_, err := s.db.Exec(`UPDATE meta SET value = max(value, ?) WHERE key = 'next_number'`, n)
+	return err
+}
+
+func (s *Store) Sites() ([]*divelog.Site, error) {
+	rows, err := s.db.Query(`SELECT data FROM sites ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sites []*divelog.Site
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		site := new(divelog.Site)
+		if err := json.Unmarshal(data, site); err != nil {
+			return nil, fmt.Errorf("corrupt site: %w", err)
+		}
+		sites = append(sites, site)
+	}
+	return sites, rows.Err()
+}
+
+func (s *Store) GetSite(id int) (*divelog.Site, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM sites WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrSiteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	site := new(divelog.Site)
+	if err := json.Unmarshal(data, site); err != nil {
+		return nil, fmt.Errorf("corrupt site %d: %w", id, err)
+	}
+	return site, nil
+}
+
+func (s *Store) PutSite(site *divelog.Site) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	saved := *site
+	if saved.ID == 0 {
+		if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'next_site'`).Scan(&saved.ID); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO sites (id, name, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, data = excluded.data`,
+		saved.ID, saved.Name, data)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE meta SET value = max(value, ?) WHERE key = 'next_site'`, saved.ID+1); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	site.ID = saved.ID
+	return nil
+}
+
+func (s *Store) DeleteSite(id int) error {
+	res, err := s.db.Exec(`DELETE FROM sites WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrSiteNotFound
+	}
+	return nil
+}
+
+func (s *Store) Items() ([]*divelog.Item, error) {
+	rows, err := s.db.Query(`SELECT data FROM items ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*divelog.Item
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		it := new(divelog.Item)
+		if err := json.Unmarshal(data, it); err != nil {
+			return nil, fmt.Errorf("corrupt item: %w", err)
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) GetItem(id int) (*divelog.Item, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM items WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	it := new(divelog.Item)
+	if err := json.Unmarshal(data, it); err != nil {
+		return nil, fmt.Errorf("corrupt item %d: %w", id, err)
+	}
+	return it, nil
+}
+
+func (s *Store) PutItem(it *divelog.Item) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	saved := *it
+	if saved.ID == 0 {
+		if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'next_item'`).Scan(&saved.ID); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO items (id, name, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, data = excluded.data`,
+		saved.ID, saved.Name, data)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE meta SET value = max(value, ?) WHERE key = 'next_item'`, saved.ID+1); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	it.ID = saved.ID
+	return nil
+}
+
+func (s *Store) DeleteItem(id int) error {
+	res, err := s.db.Exec(`DELETE FROM items WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrItemNotFound
+	}
+	return nil
+}
+
+func (s *Store) Certifications() ([]*divelog.Certification, error) {
+	rows, err := s.db.Query(`SELECT data FROM certifications ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var certs []*divelog.Certification
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		c := new(divelog.Certification)
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("corrupt certification: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, rows.Err()
+}
+
+func (s *Store) GetCertification(id int) (*divelog.Certification, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM certifications WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrCertificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := new(divelog.Certification)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("corrupt certification %d: %w", id, err)
+	}
+	return c, nil
+}
+
+func (s *Store) PutCertification(c *divelog.Certification) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	saved := *c
+	if saved.ID == 0 {
+		if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'next_certification'`).Scan(&saved.ID); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO certifications (id, data) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, saved.ID, data)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE meta SET value = max(value, ?) WHERE key = 'next_certification'`, saved.ID+1); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.ID = saved.ID
+	return nil
+}
+
+func (s *Store) DeleteCertification(id int) error {
+	res, err := s.db.Exec(`DELETE FROM certifications WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrCertificationNotFound
+	}
+	return nil
+}
+
+func (s *Store) Fingerprints() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT device, fingerprint FROM fingerprints`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fps := make(map[string]string)
+	for rows.Next() {
+		var device, fp string
+		if err := rows.Scan(&device, &fp); err != nil {
+			return nil, err
+		}
+		fps[device] = fp
+	}
+	return fps, rows.Err()
+}
+
+func (s *Store) SetFingerprint(device, fingerprint string) error {
+	_, err := s.db.Exec(`INSERT INTO fingerprints (device, fingerprint) VALUES (?, ?)
+		ON CONFLICT (device) DO UPDATE SET fingerprint = excluded.fingerprint`, device, fingerprint)
+	return err
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string { return likeEscaper.Replace(s) }
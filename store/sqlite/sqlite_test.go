@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/betonavab/divelog/store"
+	"github.com/betonavab/divelog/store/storetest"
+)
+
+func open(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "log.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore(t *testing.T) {
+	storetest.TestStore(t, func(t *testing.T) store.Store { return open(t) })
+}
+
+func TestMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("user_version = %d, want %d", version, SchemaVersion)
+	}
+	for _, index := range []string{"dives_start_time", "dives_site", "dives_max_depth"} {
+		var n int
+		s.db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&n)
+		if n != 1 {
+			t.Errorf("index %s missing", index)
+		}
+	}
+
+	// Reopening an up-to-date database is a no-op; a database from a
+	// newer divelog is refused.
+	s.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s.db.Exec(`PRAGMA user_version = 999`)
+	s.Close()
+	if _, err := Open(path); err == nil {
+		t.Error("opened a database with a newer schema")
+	}
+}
+
+func TestSamplesEncoding(t *testing.T) {
+	want := storetest.SampleDive().Samples
+	got, err := decodeSamples(encodeSamples(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeSamples(encodeSamples(s)) = %+v, want %+v", got, want)
+	}
+	if _, err := decodeSamples([]byte{samplesV1, 0, 1}); err == nil {
+		t.Error("decoded truncated sample data")
+	}
+}
+
+func TestOmitSamples(t *testing.T) {
+	s := open(t)
+	defer s.Close()
+	if err := s.Put(storetest.SampleDive()); err != nil {
+		t.Fatal(err)
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dives) != 1 || dives[0].Samples != nil {
+		t.Errorf("OmitSamples query returned samples")
+	}
+}
+
+func TestNotesIndex(t *testing.T) {
+	s := open(t)
+	defer s.Close()
+	d := storetest.SampleDive()
+	d.Notes = "Saw a hawksbill turtle."
+	if err := s.Put(d); err != nil {
+		t.Fatal(err)
+	}
+	count := func(text string) int {
+		t.Helper()
+		dives, err := s.Query(store.Query{Text: []string{text}, OmitSamples: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(dives)
+	}
+	if n := count("Turtle"); n != 1 {
+		t.Fatalf("found %d dives, want 1", n)
+	}
+
+	// The index narrows the rows: a dive missing from it is not found.
+	if _, err := s.db.Exec(`DELETE FROM notes`); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("turtle"); n != 0 {
+		t.Errorf("found %d dives without their notes indexed, want 0", n)
+	}
+	if err := s.Put(d); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("turtle"); n != 1 {
+		t.Errorf("found %d dives after Put, want 1", n)
+	}
+	if err := s.Delete(d.Number); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	s.db.QueryRow(`SELECT count(*) FROM notes`).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("%d notes left after Delete", rows)
+	}
+}
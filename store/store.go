@@ -0,0 +1,337 @@
+// Package store defines how a dive log is persisted and provides the
+// in-memory and JSON-file implementations. Other backends live in
+// subpackages and satisfy the same Store interface.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// ErrNotFound is returned when a dive number is not in the store.
+var ErrNotFound = errors.New("dive not found")
+
+// ErrSiteNotFound is returned when a site ID is not in the registry.
+var ErrSiteNotFound = errors.New("site not found")
+
+// ErrItemNotFound is returned when an item ID is not in the inventory.
+var ErrItemNotFound = errors.New("item not found")
+
+// ErrCertificationNotFound is returned when a certification ID is not in
+// the store.
+var ErrCertificationNotFound = errors.New("certification not found")
+
+// Store is a dive log. Dives are identified by their Number. Stores hand
+// out copies: changing a dive returned by Get has no effect until it is
+// passed back to Put.
+type Store interface {
+	// Get returns the dive with the given number, or ErrNotFound.
+	Get(number int) (*divelog.Dive, error)
+
+	// Put saves d. If d.Number is zero the dive is new and Put assigns it
+	// the next unused number, which it also stores in d.Number. Numbers
+	// are never reused, even after the dive holding one is deleted.
+	Put(d *divelog.Dive) error
+
+	// Delete removes a dive, returning ErrNotFound if there is none.
+	Delete(number int) error
+
+	// List returns every dive ordered by number.
+	List() ([]*divelog.Dive, error)
+
+	// Query returns the dives matching q ordered by number.
+	Query(q Query) ([]*divelog.Dive, error)
+
+	// Close releases the store. Changes are already durable when Put and
+	// Delete return; Close does not flush anything.
+	Close() error
+}
+
+// Sequencer is implemented by stores that can report and restore the
+// number they will give the next new dive, so that copying a log to
+// another backend does not make the numbers of deleted dives available
+// again.
+type Sequencer interface {
+	NextNumber() (int, error)
+
+	// SetNextNumber raises the next number to n. It never lowers it.
+	SetNextNumber(n int) error
+}
+
+// SiteRegistry is implemented by stores that keep a registry of dive sites
+// apart from the dives. A dive refers to a registered site by its ID and
+// carries a copy of it, so that dives still read on their own. Like dives,
+// sites are handed out as copies.
+type SiteRegistry interface {
+	// Sites returns every registered site ordered by ID.
+	Sites() ([]*divelog.Site, error)
+
+	// GetSite returns the site with the given ID, or ErrSiteNotFound.
+	GetSite(id int) (*divelog.Site, error)
+
+	// PutSite saves s. If s.ID is zero the site is new and PutSite
+	// assigns it the next unused ID, which it also stores in s.ID. IDs
+	// are never reused.
+	PutSite(s *divelog.Site) error
+
+	// DeleteSite removes a site from the registry, returning
+	// ErrSiteNotFound if there is none. Dives keep their copies.
+	DeleteSite(id int) error
+}
+
+// Inventory is implemented by stores that keep an inventory of equipment.
+// Like dives, items are handed out as copies.
+type Inventory interface {
+	// Items returns every item ordered by ID.
+	Items() ([]*divelog.Item, error)
+
+	// GetItem returns the item with the given ID, or ErrItemNotFound.
+	GetItem(id int) (*divelog.Item, error)
+
+	// PutItem saves it. If it.ID is zero the item is new and PutItem
+	// assigns it the next unused ID, which it also stores in it.ID. IDs
+	// are never reused.
+	PutItem(it *divelog.Item) error
+
+	// DeleteItem removes an item, returning ErrItemNotFound if there is
+	// none. Dives keep their record of it.
+	DeleteItem(id int) error
+}
+
+// CertRegistry is implemented by stores that keep the diver's
+// certifications. Like dives, certifications are handed out as copies.
+type CertRegistry interface {
+	// Certifications returns every certification ordered by ID.
+	Certifications() ([]*divelog.Certification, error)
+
+	// GetCertification returns the certification with the given ID, or
+	// ErrCertificationNotFound.
+	GetCertification(id int) (*divelog.Certification, error)
+
+	// PutCertification saves c. If c.ID is zero the certification is new
+	// and PutCertification assigns it the next unused ID, which it also
+	// stores in c.ID. IDs are never reused.
+	PutCertification(c *divelog.Certification) error
+
+	// DeleteCertification removes a certification, returning
+	// ErrCertificationNotFound if there is none.
+	DeleteCertification(id int) error
+}
+
+// Fingerprints is implemented by stores that remember, for each dive
+// computer, the fingerprint of the newest dive downloaded from it, so that
+// the next download can stop there instead of reading every dive again.
+type Fingerprints interface {
+	// Fingerprints returns the fingerprints by device.
+	Fingerprints() (map[string]string, error)
+
+	// SetFingerprint records the fingerprint of the newest dive
+	// downloaded from device.
+	SetFingerprint(device, fingerprint string) error
+}
+
+// Copy puts every dive in src into dst, keeping their numbers, and carries
+// over the next dive number when both stores are Sequencers, the site
+// registry when both are SiteRegistries, the inventory when both are
+// Inventories, the certifications when both are CertRegistries and the
+// download fingerprints when both keep Fingerprints. It returns the number
+// of dives copied.
+func Copy(dst, src Store) (int, error) {
+	if err := copySites(dst, src); err != nil {
+		return 0, err
+	}
+	if err := copyItems(dst, src); err != nil {
+		return 0, err
+	}
+	if err := copyCertifications(dst, src); err != nil {
+		return 0, err
+	}
+	if err := copyFingerprints(dst, src); err != nil {
+		return 0, err
+	}
+	dives, err := src.List()
+	if err != nil {
+		return 0, err
+	}
+	for i, d := range dives {
+		if err := dst.Put(d); err != nil {
+			return i, fmt.Errorf("dive #%d: %w", d.Number, err)
+		}
+	}
+	from, ok1 := src.(Sequencer)
+	to, ok2 := dst.(Sequencer)
+	if ok1 && ok2 {
+		n, err := from.NextNumber()
+		if err != nil {
+			return len(dives), err
+		}
+		if err := to.SetNextNumber(n); err != nil {
+			return len(dives), err
+		}
+	}
+	return len(dives), nil
+}
+
+// copySites copies the site registry of src into dst, keeping the IDs the
+// dives refer to, when both stores have one.
+func copySites(dst, src Store) error {
+	from, ok1 := src.(SiteRegistry)
+	to, ok2 := dst.(SiteRegistry)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	sites, err := from.Sites()
+	if err != nil {
+		return err
+	}
+	for _, s := range sites {
+		if err := to.PutSite(s); err != nil {
+			return fmt.Errorf("site %d: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// copyItems copies the inventory of src into dst, keeping the items' IDs,
+// when both stores have one.
+func copyItems(dst, src Store) error {
+	from, ok1 := src.(Inventory)
+	to, ok2 := dst.(Inventory)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	items, err := from.Items()
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if err := to.PutItem(it); err != nil {
+			return fmt.Errorf("item %d: %w", it.ID, err)
+		}
+	}
+	return nil
+}
+
+// copyCertifications copies the certifications of src into dst, keeping
+// their IDs, when both stores keep them.
+func copyCertifications(dst, src Store) error {
+	from, ok1 := src.(CertRegistry)
+	to, ok2 := dst.(CertRegistry)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	certs, err := from.Certifications()
+	if err != nil {
+		return err
+	}
+	for _, c := range certs {
+		if err := to.PutCertification(c); err != nil {
+			return fmt.Errorf("certification %d: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// copyFingerprints copies the download fingerprints of src into dst when
+// both stores keep them.
+func copyFingerprints(dst, src Store) error {
+	from, ok1 := src.(Fingerprints)
+	to, ok2 := dst.(Fingerprints)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	fps, err := from.Fingerprints()
+	if err != nil {
+		return err
+	}
+	for device, fp := range fps {
+		if err := to.SetFingerprint(device, fp); err != nil {
+			return fmt.Errorf("fingerprint of %s: %w", device, err)
+		}
+	}
+	return nil
+}
+
+// longestDive bounds how long a dive can last, so that Before can tell
+// that no dive starting earlier than a surface interval and this before a
+// dive ended within that interval of it.
+const longestDive = 24 * time.Hour
+
+// Before returns the dives starting at or before t back to the first
+// surface interval of at least gap, in order of start time: the dives
+// whose loading a dive starting at t carries over, for gap the interval
+// that clears it. It reads the log a window at a time rather than whole.
+func Before(s Store, t time.Time, gap time.Duration) ([]*divelog.Dive, error) {
+	var run []*divelog.Dive
+	to := t.Add(time.Nanosecond)
+	for {
+		dives, err := s.Query(Query{From: to.Add(-gap - longestDive), To: to})
+		if err != nil {
+			return nil, err
+		}
+		slices.SortStableFunc(dives, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+		i := len(dives)
+		for ; i > 0; i-- {
+			d := dives[i-1]
+			if len(run) > 0 && run[0].Start.Sub(d.Start.Add(d.Duration)) >= gap {
+				break
+			}
+			run = append([]*divelog.Dive{d}, run...)
+		}
+		if i > 0 || len(dives) == 0 {
+			return run, nil
+		}
+		to = run[0].Start
+	}
+}
+
+// Query selects dives. Zero fields do not constrain the result.
+type Query struct {
+	From time.Time // dives starting at or after From
+	To   time.Time // dives starting before To
+
+	// Site matches dives whose site name contains it, ignoring case.
+	Site string
+
+	MinDepth divelog.Depth
+	MaxDepth divelog.Depth
+
+	// Text matches dives whose notes contain every one of its strings,
+	// ignoring case.
+	Text []string
+
+	// OmitSamples asks for dives without their profiles, Samples and
+	// Profiles, for listings that only need the summary fields. Backends
+	// that keep profiles apart from the rest of the dive can skip reading
+	// them.
+	OmitSamples bool
+}
+
+// Match reports whether d satisfies q.
+func (q Query) Match(d *divelog.Dive) bool {
+	switch {
+	case !q.From.IsZero() && d.Start.Before(q.From),
+		!q.To.IsZero() && !d.Start.Before(q.To),
+		q.MinDepth != 0 && d.MaxDepth < q.MinDepth,
+		q.MaxDepth != 0 && d.MaxDepth > q.MaxDepth:
+		return false
+	case q.Site != "" && (d.Site == nil || !containsFold(d.Site.Name, q.Site)):
+		return false
+	}
+	for _, t := range q.Text {
+		if !containsFold(d.Notes, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether s contains substr, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
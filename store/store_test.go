@@ -0,0 +1,151 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+	"github.com/betonavab/divelog/store/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.TestStore(t, func(*testing.T) store.Store { return store.NewMemory() })
+}
+
+func TestJSONFile(t *testing.T) {
+	storetest.TestStore(t, func(t *testing.T) store.Store {
+		s, err := store.OpenJSON(filepath.Join(t.TempDir(), "log.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestJSONFilePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "log.json")
+	s, err := store.OpenJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Put(storetest.SampleDive()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetFingerprint("OSTC 12345", "aa"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = store.OpenJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	dives, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dives) != 2 {
+		t.Fatalf("reopened log has %d dives, want 2", len(dives))
+	}
+	d := storetest.SampleDive()
+	if err := s.Put(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Number != 4 {
+		t.Errorf("number after reopen = %d, want 4", d.Number)
+	}
+	if fps, _ := s.Fingerprints(); fps["OSTC 12345"] != "aa" {
+		t.Errorf("fingerprints after reopen = %v", fps)
+	}
+
+	// No temporary files are left behind.
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if e.Name() != "log.json" && e.Name() != "log.json.lock" {
+			t.Errorf("stray file %s", e.Name())
+		}
+	}
+}
+
+func TestJSONFileLock(t *testing.T) {
+	defer func(d time.Duration) { store.LockTimeout = d }(store.LockTimeout)
+	store.LockTimeout = 100 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "log.json")
+	s, err := store.OpenJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.OpenJSON(path); !errors.Is(err, store.ErrLocked) {
+		t.Fatalf("second OpenJSON error = %v, want ErrLocked", err)
+	}
+	s.Close()
+	s, err = store.OpenJSON(path)
+	if err != nil {
+		t.Fatalf("OpenJSON after Close: %v", err)
+	}
+	s.Close()
+}
+
+func TestJSONFileKeepsLogOnFailedWrite(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.json")
+	s, err := store.OpenJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Put(storetest.SampleDive()); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(dir, 0o500)
+	defer os.Chmod(dir, 0o700)
+	d := storetest.SampleDive()
+	if err := s.Put(d); err == nil {
+		t.Fatal("Put into read-only directory succeeded")
+	}
+	if d.Number != 0 {
+		t.Errorf("failed Put left number %d on the dive", d.Number)
+	}
+	if dives, _ := s.List(); len(dives) != 1 {
+		t.Errorf("failed Put changed the log: %d dives", len(dives))
+	}
+}
+
+func TestBefore(t *testing.T) {
+	s := store.NewMemory()
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	// A dive, a three day break, then a trip of a dive every 30 hours that
+	// runs past more than one window.
+	for _, h := range []int{0, 72 + 1, 103, 133, 163, 193, 223} {
+		d := &divelog.Dive{Start: start.Add(time.Duration(h) * time.Hour), Duration: time.Hour}
+		if err := s.Put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dives, err := store.Before(s, start.Add(193*time.Hour), 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, d := range dives {
+		got = append(got, d.Number)
+	}
+	if want := []int{2, 3, 4, 5, 6}; !slices.Equal(got, want) {
+		t.Errorf("Before = %v, want %v", got, want)
+	}
+}
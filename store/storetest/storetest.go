@@ -0,0 +1,545 @@
+// Package storetest provides a conformance test for store.Store
+// implementations.
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/store"
+)
+
+// SampleDive returns a dive using every field of the model, for checking
+// that a backend stores dives without loss.
+func SampleDive() *divelog.Dive {
+	return &divelog.Dive{
+		Start:           time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		Duration:        3 * time.Minute,
+		MaxDepth:        21.5,
+		AvgDepth:        12.25,
+		MinTemperature:  divelog.Celsius(17),
+		SurfacePressure: divelog.Bar(1.013),
+		Salinity:        divelog.SaltWater,
+		Site: &divelog.Site{
+			ID:       7,
+			Name:     "Blue Hole",
+			Coords:   &divelog.Coordinates{Lat: 17.3157, Lon: -87.5346},
+			Country:  "Belize",
+			Region:   "Lighthouse Reef",
+			MaxDepth: 124,
+			Entry:    divelog.EntryBoat,
+			Notes:    "sinkhole",
+		},
+		Buddies:   []divelog.Buddy{{Name: "Ana", Role: divelog.RoleInstructor}, {Name: "Bob"}},
+		Tanks:     []divelog.Tank{{Description: "AL80", Volume: divelog.Liters(11.1), WorkingPressure: divelog.Bar(207), StartPressure: divelog.Bar(200), EndPressure: divelog.Bar(60), Gas: divelog.GasMix{O2: 0.32}}},
+		Equipment: []divelog.Equipment{{Kind: divelog.Computer, Name: "Perdix", Serial: "A1"}},
+		Samples: []divelog.Sample{
+			{Time: 0, Depth: 0, Temperature: divelog.Celsius(25)},
+			{Time: time.Minute, Depth: 21.5, Temperature: divelog.Celsius(17), Pressure: divelog.Bar(180)},
+			{Time: 3 * time.Minute, Depth: 0, Pressure: divelog.Bar(60)},
+		},
+		Events:   []divelog.Event{{Time: 90 * time.Second, Kind: divelog.EventBookmark, Text: "turtle"}},
+		Computer: &divelog.Equipment{Kind: divelog.Computer, Name: "Perdix", Serial: "A1"},
+		Profiles: []divelog.Profile{{
+			Computer: divelog.Equipment{Kind: divelog.Computer, Name: "Zoop"},
+			Offset:   -12 * time.Second,
+			Samples: []divelog.Sample{
+				{Time: 20 * time.Second, Depth: 0.8},
+				{Time: 80 * time.Second, Depth: 21.9, Temperature: divelog.Celsius(16)},
+				{Time: 200 * time.Second, Depth: 0.4},
+			},
+			Events: []divelog.Event{{Time: 100 * time.Second, Kind: divelog.EventAscent}},
+		}},
+		Tags:     []string{"wall", "reef"},
+		Rating:   4,
+		Notes:    "Great viz.",
+		Training: &divelog.Training{Course: "AOW", Dive: "deep"},
+	}
+}
+
+// TestStore runs the conformance tests against stores returned by open,
+// which must return a new, empty store each time it is called.
+func TestStore(t *testing.T, open func(t *testing.T) store.Store) {
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, open(t)) })
+	t.Run("Numbering", func(t *testing.T) { testNumbering(t, open(t)) })
+	t.Run("Copies", func(t *testing.T) { testCopies(t, open(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, open(t)) })
+	t.Run("Query", func(t *testing.T) { testQuery(t, open(t)) })
+	t.Run("Sequence", func(t *testing.T) { testSequence(t, open(t)) })
+	t.Run("Sites", func(t *testing.T) { testSites(t, open(t)) })
+	t.Run("Inventory", func(t *testing.T) { testInventory(t, open(t)) })
+	t.Run("Certifications", func(t *testing.T) { testCertifications(t, open(t)) })
+	t.Run("Signed", func(t *testing.T) { testSigned(t, open(t)) })
+	t.Run("Fingerprints", func(t *testing.T) { testFingerprints(t, open(t)) })
+}
+
+func testRoundTrip(t *testing.T, s store.Store) {
+	defer s.Close()
+	want := SampleDive()
+	if err := s.Put(want); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := s.Get(want.Number)
+	if err != nil {
+		t.Fatalf("Get(%d): %v", want.Number, err)
+	}
+	if !got.Start.Equal(want.Start) {
+		t.Errorf("Start = %v, want %v", got.Start, want.Start)
+	}
+	got.Start = want.Start
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get returned\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func testNumbering(t *testing.T, s store.Store) {
+	defer s.Close()
+	for i := 1; i <= 3; i++ {
+		d := SampleDive()
+		if err := s.Put(d); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if d.Number != i {
+			t.Fatalf("dive %d got number %d", i, d.Number)
+		}
+	}
+	if err := s.Delete(3); err != nil {
+		t.Fatalf("Delete(3): %v", err)
+	}
+	d := SampleDive()
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if d.Number != 4 {
+		t.Errorf("dive after deleting #3 got number %d, want 4", d.Number)
+	}
+
+	// Dives imported with their own numbers keep them.
+	d = SampleDive()
+	d.Number = 10
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put(#10): %v", err)
+	}
+	d = SampleDive()
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if d.Number != 11 {
+		t.Errorf("dive after #10 got number %d, want 11", d.Number)
+	}
+
+	dives, err := s.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var numbers []int
+	for _, d := range dives {
+		numbers = append(numbers, d.Number)
+	}
+	if want := []int{1, 2, 4, 10, 11}; !reflect.DeepEqual(numbers, want) {
+		t.Errorf("List numbers = %v, want %v", numbers, want)
+	}
+}
+
+func testCopies(t *testing.T, s store.Store) {
+	defer s.Close()
+	d := SampleDive()
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	d.Notes = "changed after Put"
+	got, err := s.Get(d.Number)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got.Samples[1].Depth = 99
+	got.Site.Name = "changed after Get"
+	again, err := s.Get(d.Number)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if again.Notes != SampleDive().Notes || again.Samples[1].Depth != 21.5 || again.Site.Name != "Blue Hole" {
+		t.Errorf("store shares memory with callers: %+v", again)
+	}
+
+	got.MaxDepth = 30
+	if err := s.Put(got); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if again, _ = s.Get(d.Number); again.MaxDepth != 30 {
+		t.Errorf("update not saved: MaxDepth = %v", again.MaxDepth)
+	}
+}
+
+func testNotFound(t *testing.T, s store.Store) {
+	defer s.Close()
+	if _, err := s.Get(42); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get(42) error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(42); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete(42) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testQuery(t *testing.T, s store.Store) {
+	defer s.Close()
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 10, 0, 0, 0, time.UTC) }
+	for _, d := range []*divelog.Dive{
+		{Start: day(1), MaxDepth: 30, Site: &divelog.Site{Name: "Blue Hole"}, Notes: "Two turtles at the arch."},
+		{Start: day(2), MaxDepth: 12, Site: &divelog.Site{Name: "Coral Canyon"}, Notes: "Sea turtle and a ray"},
+		{Start: day(3), MaxDepth: 18},
+		{Start: day(4), MaxDepth: 40, Site: &divelog.Site{Name: "blue corner"}, Notes: "Grey reef sharks; no ray. Café après."},
+	} {
+		if err := s.Put(d); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	tests := []struct {
+		name string
+		q    store.Query
+		want []int
+	}{
+		{"all", store.Query{}, []int{1, 2, 3, 4}},
+		{"from", store.Query{From: day(2)}, []int{2, 3, 4}},
+		{"to", store.Query{To: day(3)}, []int{1, 2}},
+		{"site", store.Query{Site: "BLUE"}, []int{1, 4}},
+		{"depth", store.Query{MinDepth: 15, MaxDepth: 35}, []int{1, 3}},
+		{"combined", store.Query{Site: "blue", MaxDepth: 35}, []int{1}},
+		{"text", store.Query{Text: []string{"TURTLE"}}, []int{1, 2}},
+		{"words", store.Query{Text: []string{"turtle", "ray"}}, []int{2}},
+		{"short word", store.Query{Text: []string{"ra"}}, []int{2, 4}},
+		{"non-ascii", store.Query{Text: []string{"CAFÉ"}}, []int{4}},
+		{"text and site", store.Query{Site: "blue", Text: []string{"ray"}}, []int{4}},
+	}
+	dives, err := s.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for _, d := range dives {
+		if d.Samples != nil || d.Profiles != nil {
+			t.Errorf("OmitSamples: dive #%d has samples", d.Number)
+		}
+	}
+	for _, tt := range tests {
+		dives, err := s.Query(tt.q)
+		if err != nil {
+			t.Fatalf("%s: Query: %v", tt.name, err)
+		}
+		var got []int
+		for _, d := range dives {
+			got = append(got, d.Number)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got dives %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testSequence(t *testing.T, s store.Store) {
+	defer s.Close()
+	seq, ok := s.(store.Sequencer)
+	if !ok {
+		t.Skip("not a store.Sequencer")
+	}
+	if err := s.Put(SampleDive()); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if n, err := seq.NextNumber(); err != nil || n != 2 {
+		t.Errorf("NextNumber() = %d, %v; want 2", n, err)
+	}
+	if err := seq.SetNextNumber(10); err != nil {
+		t.Fatalf("SetNextNumber(10): %v", err)
+	}
+	if err := seq.SetNextNumber(5); err != nil {
+		t.Fatalf("SetNextNumber(5): %v", err)
+	}
+	d := SampleDive()
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if d.Number != 10 {
+		t.Errorf("dive after SetNextNumber(10) got number %d, want 10", d.Number)
+	}
+}
+
+func testSites(t *testing.T, s store.Store) {
+	defer s.Close()
+	reg, ok := s.(store.SiteRegistry)
+	if !ok {
+		t.Skip("not a store.SiteRegistry")
+	}
+	want := SampleDive().Site
+	want.ID = 0
+	if err := reg.PutSite(want); err != nil {
+		t.Fatalf("PutSite: %v", err)
+	}
+	if want.ID != 1 {
+		t.Errorf("first site got ID %d, want 1", want.ID)
+	}
+	got, err := reg.GetSite(want.ID)
+	if err != nil {
+		t.Fatalf("GetSite: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSite returned\n%+v\nwant\n%+v", got, want)
+	}
+	got.Coords.Lat = 0
+	if again, _ := reg.GetSite(want.ID); again.Coords.Lat != want.Coords.Lat {
+		t.Errorf("registry shares memory with callers: %+v", again)
+	}
+
+	// Sites copied with their own IDs keep them, and new ones follow.
+	for _, site := range []*divelog.Site{{ID: 5, Name: "Canyon"}, {Name: "Corner"}} {
+		if err := reg.PutSite(site); err != nil {
+			t.Fatalf("PutSite(%q): %v", site.Name, err)
+		}
+	}
+	if err := reg.DeleteSite(6); err != nil {
+		t.Fatalf("DeleteSite(6): %v", err)
+	}
+	site := &divelog.Site{Name: "Wall"}
+	if err := reg.PutSite(site); err != nil {
+		t.Fatalf("PutSite: %v", err)
+	}
+	if site.ID != 7 {
+		t.Errorf("site after deleting 6 got ID %d, want 7", site.ID)
+	}
+	site.Entry = divelog.EntryShore
+	if err := reg.PutSite(site); err != nil {
+		t.Fatalf("PutSite: %v", err)
+	}
+
+	sites, err := reg.Sites()
+	if err != nil {
+		t.Fatalf("Sites: %v", err)
+	}
+	var ids []int
+	for _, s := range sites {
+		ids = append(ids, s.ID)
+	}
+	if want := []int{1, 5, 7}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Sites IDs = %v, want %v", ids, want)
+	}
+	if sites[2].Entry != divelog.EntryShore {
+		t.Errorf("update not saved: %+v", sites[2])
+	}
+	if _, err := reg.GetSite(6); !errors.Is(err, store.ErrSiteNotFound) {
+		t.Errorf("GetSite(6) error = %v, want ErrSiteNotFound", err)
+	}
+	if err := reg.DeleteSite(6); !errors.Is(err, store.ErrSiteNotFound) {
+		t.Errorf("DeleteSite(6) error = %v, want ErrSiteNotFound", err)
+	}
+}
+
+// SampleItem returns an item using every field of the inventory.
+func SampleItem() *divelog.Item {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	return &divelog.Item{
+		Kind:          divelog.Cylinder,
+		Name:          "AL80 #3",
+		Serial:        "L123456",
+		Rental:        true,
+		Purchased:     day(2019, 3, 1),
+		LastService:   day(2024, 3, 1),
+		ServiceMonths: 12,
+		ServiceDives:  100,
+		LastHydro:     day(2021, 6, 15),
+		LastVisual:    day(2024, 3, 1),
+		Notes:         "valve rebuilt",
+	}
+}
+
+func testInventory(t *testing.T, s store.Store) {
+	defer s.Close()
+	inv, ok := s.(store.Inventory)
+	if !ok {
+		t.Skip("not a store.Inventory")
+	}
+	want := SampleItem()
+	if err := inv.PutItem(want); err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+	if want.ID != 1 {
+		t.Errorf("first item got ID %d, want 1", want.ID)
+	}
+	got, err := inv.GetItem(want.ID)
+	if err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+	if !got.LastHydro.Equal(want.LastHydro) || !got.Purchased.Equal(want.Purchased) {
+		t.Errorf("dates = %v, %v; want %v, %v", got.Purchased, got.LastHydro, want.Purchased, want.LastHydro)
+	}
+	got.Purchased, got.LastService, got.LastHydro, got.LastVisual = want.Purchased, want.LastService, want.LastHydro, want.LastVisual
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetItem returned\n%+v\nwant\n%+v", got, want)
+	}
+
+	for _, it := range []*divelog.Item{{ID: 5, Kind: divelog.Computer, Name: "Perdix"}, {Kind: divelog.BCD, Name: "Wing"}} {
+		if err := inv.PutItem(it); err != nil {
+			t.Fatalf("PutItem(%q): %v", it.Name, err)
+		}
+	}
+	if err := inv.DeleteItem(6); err != nil {
+		t.Fatalf("DeleteItem(6): %v", err)
+	}
+	it := &divelog.Item{Kind: divelog.Regulator, Name: "Mk25"}
+	if err := inv.PutItem(it); err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+	if it.ID != 7 {
+		t.Errorf("item after deleting 6 got ID %d, want 7", it.ID)
+	}
+	it.Retired = true
+	if err := inv.PutItem(it); err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+	items, err := inv.Items()
+	if err != nil {
+		t.Fatalf("Items: %v", err)
+	}
+	var ids []int
+	for _, it := range items {
+		ids = append(ids, it.ID)
+	}
+	if want := []int{1, 5, 7}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Items IDs = %v, want %v", ids, want)
+	}
+	if !items[2].Retired {
+		t.Errorf("update not saved: %+v", items[2])
+	}
+	if _, err := inv.GetItem(6); !errors.Is(err, store.ErrItemNotFound) {
+		t.Errorf("GetItem(6) error = %v, want ErrItemNotFound", err)
+	}
+	if err := inv.DeleteItem(6); !errors.Is(err, store.ErrItemNotFound) {
+		t.Errorf("DeleteItem(6) error = %v, want ErrItemNotFound", err)
+	}
+}
+
+func testCertifications(t *testing.T, s store.Store) {
+	defer s.Close()
+	reg, ok := s.(store.CertRegistry)
+	if !ok {
+		t.Skip("not a store.CertRegistry")
+	}
+	want := &divelog.Certification{
+		Agency:           "PADI",
+		Level:            "Advanced Open Water Diver",
+		Number:           "2405AB1234",
+		Date:             time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC),
+		Instructor:       "Ana",
+		InstructorNumber: "123456",
+		CardImage:        "cards/aow.jpg",
+		Notes:            "Belize",
+	}
+	if err := reg.PutCertification(want); err != nil {
+		t.Fatalf("PutCertification: %v", err)
+	}
+	if want.ID != 1 {
+		t.Errorf("first certification got ID %d, want 1", want.ID)
+	}
+	got, err := reg.GetCertification(want.ID)
+	if err != nil {
+		t.Fatalf("GetCertification: %v", err)
+	}
+	if !got.Date.Equal(want.Date) {
+		t.Errorf("Date = %v, want %v", got.Date, want.Date)
+	}
+	got.Date = want.Date
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetCertification returned\n%+v\nwant\n%+v", got, want)
+	}
+
+	ow := &divelog.Certification{ID: 5, Agency: "SSI", Level: "Open Water Diver", Date: want.Date.AddDate(-1, 0, 0)}
+	if err := reg.PutCertification(ow); err != nil {
+		t.Fatalf("PutCertification: %v", err)
+	}
+	if err := reg.DeleteCertification(1); err != nil {
+		t.Fatalf("DeleteCertification(1): %v", err)
+	}
+	c := &divelog.Certification{Agency: "PADI", Level: "Rescue Diver", Date: want.Date}
+	if err := reg.PutCertification(c); err != nil {
+		t.Fatalf("PutCertification: %v", err)
+	}
+	if c.ID != 6 {
+		t.Errorf("certification after 5 got ID %d, want 6", c.ID)
+	}
+	certs, err := reg.Certifications()
+	if err != nil {
+		t.Fatalf("Certifications: %v", err)
+	}
+	var ids []int
+	for _, c := range certs {
+		ids = append(ids, c.ID)
+	}
+	if want := []int{5, 6}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Certifications IDs = %v, want %v", ids, want)
+	}
+	if _, err := reg.GetCertification(1); !errors.Is(err, store.ErrCertificationNotFound) {
+		t.Errorf("GetCertification(1) error = %v, want ErrCertificationNotFound", err)
+	}
+	if err := reg.DeleteCertification(1); !errors.Is(err, store.ErrCertificationNotFound) {
+		t.Errorf("DeleteCertification(1) error = %v, want ErrCertificationNotFound", err)
+	}
+}
+
+func testFingerprints(t *testing.T, s store.Store) {
+	defer s.Close()
+	fps, ok := s.(store.Fingerprints)
+	if !ok {
+		t.Skip("not a store.Fingerprints")
+	}
+	if got, err := fps.Fingerprints(); err != nil || len(got) != 0 {
+		t.Fatalf("Fingerprints of an empty store = %v, %v", got, err)
+	}
+	for _, set := range [][2]string{{"OSTC 12345", "aa"}, {"OSTC 777", "bb"}, {"OSTC 12345", "cc"}} {
+		if err := fps.SetFingerprint(set[0], set[1]); err != nil {
+			t.Fatalf("SetFingerprint(%q, %q): %v", set[0], set[1], err)
+		}
+	}
+	got, err := fps.Fingerprints()
+	if err != nil {
+		t.Fatalf("Fingerprints: %v", err)
+	}
+	if want := map[string]string{"OSTC 12345": "cc", "OSTC 777": "bb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fingerprints = %v, want %v", got, want)
+	}
+	got["OSTC 777"] = "dd"
+	if again, _ := fps.Fingerprints(); again["OSTC 777"] != "bb" {
+		t.Error("changing the map Fingerprints returned changed the store")
+	}
+}
+
+// testSigned checks that a signed dive still verifies when read back, so
+// the store keeps every field exactly, time zones included.
+func testSigned(t *testing.T, s store.Store) {
+	defer s.Close()
+	d := SampleDive()
+	d.Start = d.Start.In(time.FixedZone("CST", -6*3600))
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	key, err := sign.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sign.Sign(d, key, "Ana", "buddy", d.Start.Add(time.Hour)); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := s.Put(d); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := s.Get(d.Number)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got.Signatures) != 1 {
+		t.Fatalf("read back %d signatures, want 1", len(got.Signatures))
+	}
+	if err := sign.Verify(got, &got.Signatures[0]); err != nil {
+		t.Errorf("Verify after a round trip: %v", err)
+	}
+}
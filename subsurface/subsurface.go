@@ -0,0 +1,411 @@
+// Package subsurface reads and writes the XML log format of the Subsurface
+// dive log program (.ssrf and .xml files).
+//
+// Dives, their profiles and events, cylinders, dive sites with GPS
+// positions, buddies, the divemaster and tags are carried across. Where a
+// dive was recorded by several dive computers, the first one provides the
+// profile. Subsurface has no equipment list; the dive computer model is
+// mapped to an Equipment entry of kind divelog.Computer.
+package subsurface
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// Subsurface stores dive times as wall-clock times at the site, without a
+// zone. These are the layouts of the date and time attributes.
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04:05"
+)
+
+// Event types as numbered by libdivecomputer, which Subsurface writes
+// alongside the event name.
+var eventTypes = map[divelog.EventKind]int{
+	divelog.EventDecoStop:  1,
+	divelog.EventAscent:    3,
+	divelog.EventViolation: 7,
+	divelog.EventBookmark:  8,
+	divelog.EventGasChange: 25,
+}
+
+// Read parses a Subsurface log. Dive times, which the format records
+// without a zone, are interpreted in loc.
+func Read(r io.Reader, loc *time.Location) ([]*divelog.Dive, error) {
+	var l xmlLog
+	if err := xml.NewDecoder(r).Decode(&l); err != nil {
+		return nil, fmt.Errorf("subsurface: %w", err)
+	}
+	sites := make(map[string]*divelog.Site)
+	for _, s := range l.Sites {
+		site := &divelog.Site{Name: s.Name, Notes: strings.TrimSpace(s.Notes)}
+		if site.Notes == "" {
+			site.Notes = s.Description
+		}
+		if s.GPS != "" {
+			c, err := parseGPS(s.GPS)
+			if err != nil {
+				return nil, fmt.Errorf("subsurface: site %q: %w", s.Name, err)
+			}
+			site.Coords = c
+		}
+		sites[s.UUID] = site
+	}
+	xdives := l.Dives.Dives
+	for _, t := range l.Dives.Trips {
+		xdives = append(xdives, t.Dives...)
+	}
+	dives := make([]*divelog.Dive, 0, len(xdives))
+	for i, x := range xdives {
+		d, err := convertDive(&x, sites, loc)
+		if err != nil {
+			return nil, fmt.Errorf("subsurface: dive %d (%s %s): %w", i+1, x.Date, x.Time, err)
+		}
+		dives = append(dives, d)
+	}
+	return dives, nil
+}
+
+func convertDive(x *xmlDive, sites map[string]*divelog.Site, loc *time.Location) (*divelog.Dive, error) {
+	start, err := time.ParseInLocation(dateLayout+" "+timeLayout, x.Date+" "+x.Time, loc)
+	if err != nil {
+		return nil, err
+	}
+	d := &divelog.Dive{Number: x.Number, Start: start, Rating: x.Rating, Notes: strings.TrimSpace(x.Notes)}
+	if x.Duration != "" {
+		if d.Duration, err = parseDuration(x.Duration); err != nil {
+			return nil, err
+		}
+	}
+	d.Tags = splitList(x.Tags)
+	if s, ok := sites[x.DiveSiteID]; ok {
+		site := *s
+		d.Site = &site
+	} else if x.Location != nil {
+		d.Site = &divelog.Site{Name: strings.TrimSpace(x.Location.Name)}
+		if x.Location.GPS != "" {
+			if d.Site.Coords, err = parseGPS(x.Location.GPS); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, name := range splitList(x.Buddy) {
+		d.Buddies = append(d.Buddies, divelog.Buddy{Name: name})
+	}
+	for _, name := range splitList(x.Divemaster) {
+		d.Buddies = append(d.Buddies, divelog.Buddy{Name: name, Role: divelog.RoleGuide})
+	}
+	for _, c := range x.Cylinders {
+		t, err := convertCylinder(c)
+		if err != nil {
+			return nil, err
+		}
+		d.Tanks = append(d.Tanks, t)
+	}
+	if len(x.Computers) > 0 {
+		if err := convertComputer(d, &x.Computers[0]); err != nil {
+			return nil, err
+		}
+	}
+	// Fill in whatever summary the file left out from the profile.
+	if len(d.Samples) > 0 {
+		s := *d
+		s.Summarize()
+		if d.Duration == 0 {
+			d.Duration = s.Duration
+		}
+		if d.MaxDepth == 0 {
+			d.MaxDepth = s.MaxDepth
+		}
+		if d.AvgDepth == 0 {
+			d.AvgDepth = s.AvgDepth
+		}
+		if d.MinTemperature == 0 {
+			d.MinTemperature = s.MinTemperature
+		}
+	}
+	return d, nil
+}
+
+func convertCylinder(c xmlCylinder) (divelog.Tank, error) {
+	t := divelog.Tank{Description: c.Description, Gas: divelog.Air}
+	var err error
+	set := func(s string, parse func(string) error) {
+		if s != "" && err == nil {
+			err = parse(s)
+		}
+	}
+	set(c.Size, func(s string) (err error) { t.Volume, err = parseVolume(s); return })
+	set(c.WorkPressure, func(s string) (err error) { t.WorkingPressure, err = parsePressure(s); return })
+	set(c.Start, func(s string) (err error) { t.StartPressure, err = parsePressure(s); return })
+	set(c.End, func(s string) (err error) { t.EndPressure, err = parsePressure(s); return })
+	if c.O2 != "" || c.He != "" {
+		t.Gas = divelog.GasMix{O2: divelog.Air.O2}
+		set(c.O2, func(s string) (err error) { t.Gas.O2, err = parseFraction(s); return })
+		set(c.He, func(s string) (err error) { t.Gas.He, err = parseFraction(s); return })
+	}
+	return t, err
+}
+
+func convertComputer(d *divelog.Dive, c *xmlComputer) error {
+	var err error
+	set := func(s string, parse func(string) error) {
+		if s != "" && err == nil {
+			err = parse(s)
+		}
+	}
+	if c.Model != "" {
+		d.Equipment = append(d.Equipment, divelog.Equipment{Kind: divelog.Computer, Name: c.Model})
+	}
+	if c.Depth != nil {
+		set(c.Depth.Max, func(s string) (err error) { d.MaxDepth, err = parseDepth(s); return })
+		set(c.Depth.Mean, func(s string) (err error) { d.AvgDepth, err = parseDepth(s); return })
+	}
+	if c.Temperature != nil {
+		set(c.Temperature.Water, func(s string) (err error) { d.MinTemperature, err = parseTemperature(s); return })
+	}
+	if c.Surface != nil {
+		set(c.Surface.Pressure, func(s string) (err error) { d.SurfacePressure, err = parsePressure(s); return })
+	}
+	if c.Water != nil {
+		set(c.Water.Salinity, func(s string) (err error) { d.Salinity, err = parseSalinity(s); return })
+	}
+	if err != nil {
+		return err
+	}
+	for _, x := range c.Events {
+		t, err := parseDuration(x.Time)
+		if err != nil {
+			return fmt.Errorf("event %s: %w", x.Name, err)
+		}
+		e := divelog.Event{Time: t, Kind: divelog.EventKind(x.Name), Text: strings.TrimSpace(x.Text)}
+		if e.Kind == divelog.EventGasChange {
+			if x.Cylinder != nil {
+				e.Tank = *x.Cylinder
+			} else {
+				e.Tank = tankForGas(d.Tanks, x.Value)
+			}
+		}
+		d.Events = append(d.Events, e)
+	}
+
+	// Subsurface writes a sample's sensor, the tank its pressure is
+	// from, only when it changes, and the pressure of a second
+	// transmitter as pressure1. A sample holds one pressure: that of the
+	// tank breathed from if the sample has it, otherwise the first given.
+	sensors := [2]int{0, 1}
+	for _, x := range c.Samples {
+		var s divelog.Sample
+		var pressures [2]divelog.Pressure
+		set(x.Time, func(v string) (err error) { s.Time, err = parseDuration(v); return })
+		set(x.Depth, func(v string) (err error) { s.Depth, err = parseDepth(v); return })
+		set(x.Temp, func(v string) (err error) { s.Temperature, err = parseTemperature(v); return })
+		set(x.Pressure, func(v string) (err error) { pressures[0], err = parsePressure(v); return })
+		set(x.Pressure1, func(v string) (err error) { pressures[1], err = parsePressure(v); return })
+		if err != nil {
+			return fmt.Errorf("sample %s: %w", x.Time, err)
+		}
+		if x.Sensor != nil {
+			sensors[0] = *x.Sensor
+		}
+		if x.Sensor1 != nil {
+			sensors[1] = *x.Sensor1
+		}
+		current := tankAt(d.Events, s.Time)
+		for i, p := range pressures {
+			if p != 0 && (s.Pressure == 0 || sensors[i] == current) {
+				s.Pressure, s.Tank = p, sensors[i]
+			}
+		}
+		d.Samples = append(d.Samples, s)
+	}
+	return nil
+}
+
+// tankAt returns the tank breathed from at time t, as set by the last
+// gas change in events at or before it.
+func tankAt(events []divelog.Event, t time.Duration) int {
+	tank, at := 0, time.Duration(-1)
+	for _, e := range events {
+		if e.Kind == divelog.EventGasChange && e.Time <= t && e.Time >= at {
+			tank, at = e.Tank, e.Time
+		}
+	}
+	return tank
+}
+
+// tankForGas finds the tank holding the mix encoded in a gas change event
+// value as the O2 percentage plus the He percentage shifted left 16 bits,
+// which is how files written before cylinder indexes were recorded
+// identify the new gas.
+func tankForGas(tanks []divelog.Tank, value int) int {
+	o2, he := float64(value&0xffff)/100, float64(value>>16)/100
+	for i, t := range tanks {
+		if math.Abs(t.Gas.O2-o2) < 0.005 && math.Abs(t.Gas.He-he) < 0.005 {
+			return i
+		}
+	}
+	return 0
+}
+
+// Write writes dives as a Subsurface log.
+func Write(w io.Writer, dives []*divelog.Dive) error {
+	l := xmlLog{Program: "divelog", Version: "3"}
+	seen := make(map[string]bool)
+	for _, d := range dives {
+		x := exportDive(d)
+		if d.Site != nil {
+			id := siteID(d.Site)
+			x.DiveSiteID = id
+			if !seen[id] {
+				seen[id] = true
+				s := xmlSite{UUID: id, Name: d.Site.Name, Notes: d.Site.Notes}
+				if d.Site.Coords != nil {
+					s.GPS = formatGPS(d.Site.Coords)
+				}
+				l.Sites = append(l.Sites, s)
+			}
+		}
+		l.Dives.Dives = append(l.Dives.Dives, x)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&l); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func exportDive(d *divelog.Dive) xmlDive {
+	x := xmlDive{
+		Number:   d.Number,
+		Rating:   d.Rating,
+		Tags:     strings.Join(d.Tags, ", "),
+		Date:     d.Start.Format(dateLayout),
+		Time:     d.Start.Format(timeLayout),
+		Duration: formatDuration(d.Duration),
+		Notes:    d.Notes,
+	}
+	var buddies, guides []string
+	for _, b := range d.Buddies {
+		switch b.Role {
+		case divelog.RoleGuide, divelog.RoleInstructor:
+			guides = append(guides, b.Name)
+		default:
+			buddies = append(buddies, b.Name)
+		}
+	}
+	x.Buddy = strings.Join(buddies, ", ")
+	x.Divemaster = strings.Join(guides, ", ")
+	for _, t := range d.Tanks {
+		c := xmlCylinder{Description: t.Description}
+		if t.Volume != 0 {
+			c.Size = formatVolume(t.Volume)
+		}
+		if t.WorkingPressure != 0 {
+			c.WorkPressure = formatPressure(t.WorkingPressure)
+		}
+		if t.StartPressure != 0 {
+			c.Start = formatPressure(t.StartPressure)
+		}
+		if t.EndPressure != 0 {
+			c.End = formatPressure(t.EndPressure)
+		}
+		if !t.Gas.IsAir() {
+			c.O2 = formatFraction(t.Gas.O2)
+			if t.Gas.He != 0 {
+				c.He = formatFraction(t.Gas.He)
+			}
+		}
+		x.Cylinders = append(x.Cylinders, c)
+	}
+	x.Computers = []xmlComputer{exportComputer(d)}
+	return x
+}
+
+func exportComputer(d *divelog.Dive) xmlComputer {
+	var c xmlComputer
+	for _, eq := range d.Equipment {
+		if eq.Kind == divelog.Computer {
+			c.Model = eq.Name
+			break
+		}
+	}
+	c.Depth = &xmlDepth{Max: formatDepth(d.MaxDepth)}
+	if d.AvgDepth != 0 {
+		c.Depth.Mean = formatDepth(d.AvgDepth)
+	}
+	if d.MinTemperature != 0 {
+		c.Temperature = &xmlTemperature{Water: formatTemperature(d.MinTemperature)}
+	}
+	if d.SurfacePressure != 0 {
+		c.Surface = &xmlSurface{Pressure: formatPressure(d.SurfacePressure)}
+	}
+	if d.Salinity != 0 {
+		c.Water = &xmlWater{Salinity: fmt.Sprintf("%.0f g/l", float64(d.Salinity))}
+	}
+	for _, e := range d.Events {
+		x := xmlEvent{Time: formatDuration(e.Time), Type: eventTypes[e.Kind], Name: string(e.Kind), Text: e.Text}
+		if e.Kind == divelog.EventGasChange {
+			tank := e.Tank
+			x.Cylinder = &tank
+			x.Flags = 1
+			if tank >= 0 && tank < len(d.Tanks) {
+				g := d.Tanks[tank].Gas
+				x.Value = int(g.O2*100+0.5) | int(g.He*100+0.5)<<16
+			}
+		}
+		c.Events = append(c.Events, x)
+	}
+	// Like Subsurface, write the sensor only where it changes.
+	sensor := 0
+	for _, s := range d.Samples {
+		x := xmlSample{Time: formatDuration(s.Time), Depth: formatDepth(s.Depth)}
+		if s.Temperature != 0 {
+			x.Temp = formatTemperature(s.Temperature)
+		}
+		if s.Pressure != 0 {
+			x.Pressure = formatPressure(s.Pressure)
+			if s.Tank != sensor {
+				tank := s.Tank
+				x.Sensor = &tank
+				sensor = tank
+			}
+		}
+		c.Samples = append(c.Samples, x)
+	}
+	return c
+}
+
+// siteID derives a stable Subsurface site UUID from the site's name and
+// position, so the same site gets the same ID in every export.
+func siteID(s *divelog.Site) string {
+	h := fnv.New32a()
+	io.WriteString(h, s.Name)
+	if s.Coords != nil {
+		io.WriteString(h, formatGPS(s.Coords))
+	}
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
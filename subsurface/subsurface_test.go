@@ -0,0 +1,153 @@
+package subsurface
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func readFile(t *testing.T, path string) []*divelog.Dive {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dives, err := Read(f, time.UTC)
+	if err != nil {
+		t.Fatalf("Read(%s): %v", path, err)
+	}
+	return dives
+}
+
+func TestRead(t *testing.T) {
+	dives := readFile(t, "testdata/belize.ssrf")
+	if len(dives) != 3 {
+		t.Fatalf("read %d dives, want 3", len(dives))
+	}
+	for _, d := range dives {
+		if err := d.Validate(); err != nil {
+			t.Errorf("dive #%d: %v", d.Number, err)
+		}
+	}
+
+	d := dives[1] // trips come after top-level dives
+	if d.Number != 101 || !d.Start.Equal(time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("dive = #%d at %v", d.Number, d.Start)
+	}
+	if d.Duration != 35*time.Minute || d.MaxDepth != 41.2 || d.AvgDepth != 18.75 {
+		t.Errorf("summary = %v, %v m, %v m", d.Duration, d.MaxDepth, d.AvgDepth)
+	}
+	if d.Site == nil || d.Site.Name != "Blue Hole" || d.Site.Coords == nil || d.Site.Coords.Lat != 17.3157 {
+		t.Errorf("site = %+v", d.Site)
+	}
+	wantBuddies := []divelog.Buddy{{Name: "Ana"}, {Name: "Bob"}, {Name: "Marco", Role: divelog.RoleGuide}}
+	if !reflect.DeepEqual(d.Buddies, wantBuddies) {
+		t.Errorf("buddies = %+v", d.Buddies)
+	}
+	if !reflect.DeepEqual(d.Tags, []string{"wall", "deep"}) {
+		t.Errorf("tags = %q", d.Tags)
+	}
+	if len(d.Tanks) != 2 || d.Tanks[0].Gas.String() != "21/35" || d.Tanks[1].Gas.String() != "EAN50" {
+		t.Fatalf("tanks = %+v", d.Tanks)
+	}
+	if math.Abs(d.Tanks[0].StartPressure.Bar()-210) > 1e-9 || math.Abs(d.Tanks[0].Volume.Liters()-11.1) > 1e-9 {
+		t.Errorf("tank 0 = %+v", d.Tanks[0])
+	}
+	// The samples after the switch name the tank once.
+	if len(d.Samples) != 10 || d.Samples[6].Tank != 1 || math.Abs(d.Samples[6].Pressure.Bar()-200) > 1e-9 ||
+		d.Samples[8].Tank != 1 || d.Samples[5].Tank != 0 {
+		t.Errorf("samples = %+v", d.Samples)
+	}
+	if len(d.Events) != 3 || d.Events[1].Kind != divelog.EventGasChange || d.Events[1].Tank != 1 {
+		t.Errorf("events = %+v", d.Events)
+	}
+	if d.Salinity != 1025 || math.Abs(d.SurfacePressure.Bar()-1.012) > 1e-9 {
+		t.Errorf("conditions = %v, %v", d.Salinity, d.SurfacePressure)
+	}
+	if len(d.Equipment) != 1 || d.Equipment[0].Name != "Shearwater Perdix" {
+		t.Errorf("equipment = %+v", d.Equipment)
+	}
+
+	old := dives[0]
+	if old.Site == nil || old.Site.Name != "Cala del Pino" || old.Site.Coords == nil {
+		t.Errorf("pre-v3 location = %+v", old.Site)
+	}
+	if len(old.Tanks) != 1 || !old.Tanks[0].Gas.IsAir() {
+		t.Errorf("cylinder without gas = %+v, want air", old.Tanks)
+	}
+}
+
+// TestReadTransmitters reads a dive with a transmitter on each tank, which
+// takes each sample's pressure from the tank breathed from.
+func TestReadTransmitters(t *testing.T) {
+	dives := readFile(t, "testdata/transmitters.ssrf")
+	if len(dives) != 1 {
+		t.Fatalf("read %d dives, want 1", len(dives))
+	}
+	type reading struct {
+		bar  float64
+		tank int
+	}
+	want := []reading{{200, 0}, {150, 0}, {200, 1}, {196, 1}, {170, 1}, {160, 1}}
+	var got []reading
+	for _, s := range dives[0].Samples {
+		got = append(got, reading{math.Round(s.Pressure.Bar()), s.Tank})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pressures = %v, want %v", got, want)
+	}
+}
+
+// TestRoundTrip checks that every fixture survives being written out and
+// read back unchanged.
+func TestRoundTrip(t *testing.T) {
+	files, _ := filepath.Glob("testdata/*.ssrf")
+	if len(files) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			want := readFile(t, file)
+			var buf bytes.Buffer
+			if err := Write(&buf, want); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			got, err := Read(&buf, time.UTC)
+			if err != nil {
+				t.Fatalf("reading written log: %v\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(got, want) {
+				for i := range want {
+					if i < len(got) && !reflect.DeepEqual(got[i], want[i]) {
+						t.Errorf("dive %d changed:\ngot  %+v\nwant %+v", i, got[i], want[i])
+					}
+				}
+				if len(got) != len(want) {
+					t.Errorf("got %d dives, want %d", len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSharesSites(t *testing.T) {
+	site := &divelog.Site{Name: "Reef", Coords: &divelog.Coordinates{Lat: 1, Lon: 2}}
+	dives := []*divelog.Dive{
+		{Start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), MaxDepth: 10, Site: site},
+		{Start: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC), MaxDepth: 12, Site: site},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, dives); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("<site ")); n != 1 {
+		t.Errorf("wrote %d site elements, want 1:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,162 @@
+package subsurface
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// splitValue splits an attribute such as "21.5 m" into its number and unit.
+func splitValue(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+')
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid value %q", s)
+	}
+	return v, strings.ToLower(strings.TrimSpace(s[i:])), nil
+}
+
+func parseDepth(s string) (divelog.Depth, error) {
+	v, unit, err := splitValue(s)
+	switch {
+	case err != nil:
+		return 0, err
+	case unit == "m" || unit == "":
+		return divelog.Depth(v), nil
+	case unit == "ft":
+		return divelog.Feet(v), nil
+	}
+	return 0, fmt.Errorf("invalid depth %q", s)
+}
+
+func parseTemperature(s string) (divelog.Temperature, error) {
+	v, unit, err := splitValue(s)
+	switch {
+	case err != nil:
+		return 0, err
+	case unit == "c" || unit == "°c" || unit == "":
+		return divelog.Celsius(v), nil
+	case unit == "f" || unit == "°f":
+		return divelog.Fahrenheit(v), nil
+	case unit == "k":
+		return divelog.Temperature(v), nil
+	}
+	return 0, fmt.Errorf("invalid temperature %q", s)
+}
+
+func parsePressure(s string) (divelog.Pressure, error) {
+	v, unit, err := splitValue(s)
+	switch {
+	case err != nil:
+		return 0, err
+	case unit == "bar" || unit == "":
+		return divelog.Bar(v), nil
+	case unit == "mbar":
+		return divelog.Bar(v / 1000), nil
+	case unit == "psi":
+		return divelog.PSI(v), nil
+	}
+	return 0, fmt.Errorf("invalid pressure %q", s)
+}
+
+func parseVolume(s string) (divelog.Volume, error) {
+	v, unit, err := splitValue(s)
+	switch {
+	case err != nil:
+		return 0, err
+	case unit == "l" || unit == "":
+		return divelog.Liters(v), nil
+	case unit == "cuft":
+		return divelog.CubicFeet(v), nil
+	}
+	return 0, fmt.Errorf("invalid volume %q", s)
+}
+
+// parseSalinity parses a water density such as "1025 g/l".
+func parseSalinity(s string) (divelog.Salinity, error) {
+	v, _, err := splitValue(s)
+	return divelog.Salinity(v), err
+}
+
+// parseFraction parses a gas percentage such as "32.0%".
+func parseFraction(s string) (float64, error) {
+	v, _, err := splitValue(s)
+	return v / 100, err
+}
+
+// parseDuration parses the "mm:ss min" form Subsurface uses for dive and
+// sample times, along with "h:mm:ss" and plain "45 min".
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(s, "min"))
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var total float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total = total*60 + v
+	}
+	if len(parts) == 1 {
+		total *= 60 // "45 min"
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+// parseGPS parses "lat lon" in decimal degrees.
+func parseGPS(s string) (*divelog.Coordinates, error) {
+	f := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(f) != 2 {
+		return nil, fmt.Errorf("invalid gps %q", s)
+	}
+	lat, err1 := strconv.ParseFloat(f[0], 64)
+	lon, err2 := strconv.ParseFloat(f[1], 64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid gps %q", s)
+	}
+	return &divelog.Coordinates{Lat: lat, Lon: lon}, nil
+}
+
+// num formats v with at most prec decimals and at least one, matching the
+// precision Subsurface keeps internally (millimetres, millikelvin, mbar).
+func num(v float64, prec int) string {
+	p := math.Pow(10, float64(prec))
+	s := strconv.FormatFloat(math.Round(v*p)/p, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func formatDepth(d divelog.Depth) string { return num(d.Meters(), 3) + " m" }
+
+func formatTemperature(t divelog.Temperature) string { return num(t.Celsius(), 3) + " C" }
+
+func formatPressure(p divelog.Pressure) string { return num(p.Bar(), 3) + " bar" }
+
+func formatVolume(v divelog.Volume) string { return num(v.Liters(), 3) + " l" }
+
+func formatFraction(f float64) string { return num(f*100, 1) + "%" }
+
+func formatDuration(d time.Duration) string {
+	sec := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d min", sec/60, sec%60)
+}
+
+func formatGPS(c *divelog.Coordinates) string {
+	return fmt.Sprintf("%.6f %.6f", c.Lat, c.Lon)
+}
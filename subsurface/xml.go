@@ -0,0 +1,118 @@
+package subsurface
+
+import "encoding/xml"
+
+// The structs below mirror the parts of Subsurface's XML that divelog
+// understands. Attribute values carry their unit, e.g. depth='21.5 m'.
+
+type xmlLog struct {
+	XMLName xml.Name  `xml:"divelog"`
+	Program string    `xml:"program,attr"`
+	Version string    `xml:"version,attr"`
+	Sites   []xmlSite `xml:"divesites>site"`
+	Dives   xmlDives  `xml:"dives"`
+}
+
+type xmlDives struct {
+	Trips []xmlTrip `xml:"trip"`
+	Dives []xmlDive `xml:"dive"`
+}
+
+type xmlTrip struct {
+	Date     string    `xml:"date,attr,omitempty"`
+	Location string    `xml:"location,attr,omitempty"`
+	Dives    []xmlDive `xml:"dive"`
+}
+
+type xmlSite struct {
+	UUID        string `xml:"uuid,attr"`
+	Name        string `xml:"name,attr"`
+	GPS         string `xml:"gps,attr,omitempty"`
+	Description string `xml:"description,attr,omitempty"`
+	Notes       string `xml:"notes,omitempty"`
+}
+
+type xmlDive struct {
+	Number     int    `xml:"number,attr,omitempty"`
+	Rating     int    `xml:"rating,attr,omitempty"`
+	Tags       string `xml:"tags,attr,omitempty"`
+	DiveSiteID string `xml:"divesiteid,attr,omitempty"`
+	Date       string `xml:"date,attr"`
+	Time       string `xml:"time,attr"`
+	Duration   string `xml:"duration,attr"`
+
+	// Location is how Subsurface wrote sites before version 3.
+	Location   *xmlLocation  `xml:"location"`
+	Divemaster string        `xml:"divemaster,omitempty"`
+	Buddy      string        `xml:"buddy,omitempty"`
+	Notes      string        `xml:"notes,omitempty"`
+	Cylinders  []xmlCylinder `xml:"cylinder"`
+	Computers  []xmlComputer `xml:"divecomputer"`
+}
+
+type xmlLocation struct {
+	GPS  string `xml:"gps,attr"`
+	Name string `xml:",chardata"`
+}
+
+type xmlCylinder struct {
+	Size         string `xml:"size,attr,omitempty"`
+	WorkPressure string `xml:"workpressure,attr,omitempty"`
+	Description  string `xml:"description,attr,omitempty"`
+	O2           string `xml:"o2,attr,omitempty"`
+	He           string `xml:"he,attr,omitempty"`
+	Start        string `xml:"start,attr,omitempty"`
+	End          string `xml:"end,attr,omitempty"`
+}
+
+type xmlComputer struct {
+	Model       string          `xml:"model,attr,omitempty"`
+	DeviceID    string          `xml:"deviceid,attr,omitempty"`
+	DiveID      string          `xml:"diveid,attr,omitempty"`
+	Depth       *xmlDepth       `xml:"depth"`
+	Temperature *xmlTemperature `xml:"temperature"`
+	Surface     *xmlSurface     `xml:"surface"`
+	Water       *xmlWater       `xml:"water"`
+	Events      []xmlEvent      `xml:"event"`
+	Samples     []xmlSample     `xml:"sample"`
+}
+
+type xmlDepth struct {
+	Max  string `xml:"max,attr,omitempty"`
+	Mean string `xml:"mean,attr,omitempty"`
+}
+
+type xmlTemperature struct {
+	Water string `xml:"water,attr,omitempty"`
+	Air   string `xml:"air,attr,omitempty"`
+}
+
+type xmlSurface struct {
+	Pressure string `xml:"pressure,attr"`
+}
+
+type xmlWater struct {
+	Salinity string `xml:"salinity,attr"`
+}
+
+type xmlEvent struct {
+	Time     string `xml:"time,attr"`
+	Type     int    `xml:"type,attr,omitempty"`
+	Flags    int    `xml:"flags,attr,omitempty"`
+	Value    int    `xml:"value,attr,omitempty"`
+	Name     string `xml:"name,attr"`
+	Cylinder *int   `xml:"cylinder,attr"`
+	Text     string `xml:",chardata"`
+}
+
+type xmlSample struct {
+	Time     string `xml:"time,attr"`
+	Depth    string `xml:"depth,attr"`
+	Temp     string `xml:"temp,attr,omitempty"`
+	Pressure string `xml:"pressure,attr,omitempty"`
+	Sensor   *int   `xml:"sensor,attr"`
+
+	// A second transmitter's pressure and tank.
+	Pressure1 string `xml:"pressure1,attr,omitempty"`
+	Sensor1   *int   `xml:"sensor1,attr"`
+}
@@ -0,0 +1,171 @@
+package training
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Standard is what a course requires of the diver: prerequisite
+// certifications and experience before it begins, and training dives
+// before the diver can be certified.
+//
+// Standards are usually loaded from YAML:
+//
+//   - course: AOW
+//     name: Advanced Open Water Diver
+//     aliases: [Advanced Adventurer]
+//     requires: [OW]
+//     training_dives: 5
+//     required_dives: [deep, navigation]
+type Standard struct {
+	// Course is the short name of the course, as training dives give it.
+	Course string `yaml:"course"`
+	Name   string `yaml:"name"`
+
+	// Aliases are other names certification cards give the course, such
+	// as another agency's name for it.
+	Aliases []string `yaml:"aliases"`
+
+	// Requires lists the courses, by short name, the diver must be
+	// certified for first.
+	Requires []string `yaml:"requires"`
+
+	// MinDives is the number of dives the diver must have logged before
+	// the course.
+	MinDives int `yaml:"min_dives"`
+
+	// TrainingDives is the number of dives the course takes, and
+	// RequiredDives names particular ones among them, such as "deep".
+	TrainingDives int      `yaml:"training_dives"`
+	RequiredDives []string `yaml:"required_dives"`
+}
+
+// Names reports whether s is the course's short name, name or an alias,
+// ignoring case.
+func (std *Standard) Names(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.EqualFold(s, std.Course) || strings.EqualFold(s, std.Name) ||
+		slices.ContainsFunc(std.Aliases, func(a string) bool { return strings.EqualFold(s, a) })
+}
+
+// Standards is a set of course standards.
+type Standards []*Standard
+
+// Builtin are generic recreational standards, close to those of the
+// major agencies. Shops that teach to others load their own.
+var Builtin = Standards{
+	{Course: "OW", Name: "Open Water Diver", Aliases: []string{"Open Water", "OWD"},
+		TrainingDives: 4},
+	{Course: "AOW", Name: "Advanced Open Water Diver", Aliases: []string{"Advanced Open Water", "AOWD", "Advanced Adventurer"},
+		Requires: []string{"OW"}, TrainingDives: 5, RequiredDives: []string{"deep", "navigation"}},
+	{Course: "Nitrox", Name: "Enriched Air Diver", Aliases: []string{"Enriched Air Nitrox", "Nitrox Diver", "EANx"},
+		Requires: []string{"OW"}},
+	{Course: "Deep", Name: "Deep Diver", Requires: []string{"AOW"}, TrainingDives: 4},
+	{Course: "Rescue", Name: "Rescue Diver", Aliases: []string{"Stress & Rescue"},
+		Requires: []string{"AOW"}},
+	{Course: "DM", Name: "Divemaster", Aliases: []string{"Dive Master"},
+		Requires: []string{"Rescue"}, MinDives: 40},
+}
+
+// Find returns the standard for a course given by short name, name or
+// alias, or nil.
+func (ss Standards) Find(course string) *Standard {
+	for _, std := range ss {
+		if std.Names(course) {
+			return std
+		}
+	}
+	return nil
+}
+
+// Implies reports whether a certification for course a implies one for
+// course b, because a is b or requires it, directly or through other
+// courses.
+func (ss Standards) Implies(a, b string) bool {
+	return ss.implies(a, b, map[string]bool{})
+}
+
+func (ss Standards) implies(a, b string, seen map[string]bool) bool {
+	std := ss.Find(a)
+	if std == nil {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+	if std.Names(b) {
+		return true
+	}
+	if seen[std.Course] {
+		return false
+	}
+	seen[std.Course] = true
+	for _, r := range std.Requires {
+		if ss.implies(r, b, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadStandards reads a YAML list of standards.
+func LoadStandards(path string) (Standards, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := ParseStandards(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ss, nil
+}
+
+// ParseStandards parses and checks a YAML list of standards.
+func ParseStandards(data []byte) (Standards, error) {
+	var ss Standards
+	if err := yaml.Unmarshal(data, &ss); err != nil {
+		return nil, err
+	}
+	if err := ss.check(); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// check validates the standards: every course named once, prerequisites
+// that are themselves courses, and no course that requires itself.
+func (ss Standards) check() error {
+	if len(ss) == 0 {
+		return fmt.Errorf("no standards given")
+	}
+	for i, std := range ss {
+		if std == nil || std.Course == "" {
+			return fmt.Errorf("standard %d: no course given", i+1)
+		}
+		if std.MinDives < 0 || std.TrainingDives < 0 {
+			return fmt.Errorf("course %s: negative number of dives", std.Course)
+		}
+		if len(std.RequiredDives) > std.TrainingDives {
+			return fmt.Errorf("course %s: %d required dives but only %d training dives",
+				std.Course, len(std.RequiredDives), std.TrainingDives)
+		}
+		for _, other := range ss[:i] {
+			if other.Names(std.Course) || std.Names(other.Course) {
+				return fmt.Errorf("course %s given twice", std.Course)
+			}
+		}
+	}
+	for _, std := range ss {
+		for _, r := range std.Requires {
+			if ss.Find(r) == nil {
+				return fmt.Errorf("course %s: requires unknown course %s", std.Course, r)
+			}
+			if ss.Implies(r, std.Course) {
+				return fmt.Errorf("course %s requires itself", std.Course)
+			}
+		}
+	}
+	return nil
+}
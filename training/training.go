@@ -0,0 +1,121 @@
+// Package training checks a diver's certifications and training dives
+// against course standards, so that an instructor has proof a student
+// meets a course's prerequisites before it begins and has made its
+// required dives before certifying.
+//
+// Certifications live in stores that implement store.CertRegistry. Dives
+// made on a course carry a divelog.Training naming the course and, for
+// the dives a standard requires by name, the dive.
+package training
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/betonavab/divelog"
+)
+
+// Requirement is one requirement of a standard and what meets it.
+type Requirement struct {
+	What string // such as "OW certification" or "5 training dives"
+	Met  bool
+
+	// Cert is the certification that meets a prerequisite course, or nil.
+	Cert *divelog.Certification
+
+	// Dives are the dives that count towards a requirement for dives.
+	Dives []*divelog.Dive
+}
+
+// Report is the result of checking a diver against a standard.
+type Report struct {
+	Standard *Standard
+
+	// Prerequisites must be met before the course begins, Training
+	// before the diver is certified.
+	Prerequisites []Requirement
+	Training      []Requirement
+}
+
+// Ready reports whether the diver meets the prerequisites of the course.
+func (r *Report) Ready() bool { return allMet(r.Prerequisites) }
+
+// Complete reports whether the diver meets the prerequisites and has made
+// the course's training dives.
+func (r *Report) Complete() bool { return r.Ready() && allMet(r.Training) }
+
+func allMet(reqs []Requirement) bool {
+	for _, r := range reqs {
+		if !r.Met {
+			return false
+		}
+	}
+	return true
+}
+
+// Check checks certs and dives against std. A certification meets a
+// prerequisite course when ss say its course implies the prerequisite,
+// so a Rescue card proves Open Water too.
+func (ss Standards) Check(std *Standard, certs []*divelog.Certification, dives []*divelog.Dive) *Report {
+	r := &Report{Standard: std}
+	for _, course := range std.Requires {
+		req := Requirement{What: course + " certification"}
+		req.Cert = ss.best(course, certs)
+		req.Met = req.Cert != nil
+		r.Prerequisites = append(r.Prerequisites, req)
+	}
+	if std.MinDives > 0 {
+		r.Prerequisites = append(r.Prerequisites, Requirement{
+			What:  fmt.Sprintf("%d logged dives", std.MinDives),
+			Met:   len(dives) >= std.MinDives,
+			Dives: dives,
+		})
+	}
+
+	var course []*divelog.Dive
+	for _, d := range dives {
+		if d.Training != nil && std.Names(d.Training.Course) {
+			course = append(course, d)
+		}
+	}
+	slices.SortFunc(course, func(a, b *divelog.Dive) int { return a.Start.Compare(b.Start) })
+	if std.TrainingDives > 0 {
+		r.Training = append(r.Training, Requirement{
+			What:  fmt.Sprintf("%d training dives", std.TrainingDives),
+			Met:   len(course) >= std.TrainingDives,
+			Dives: course,
+		})
+	}
+	for _, name := range std.RequiredDives {
+		req := Requirement{What: name + " dive"}
+		for _, d := range course {
+			if strings.EqualFold(strings.TrimSpace(d.Training.Dive), name) {
+				req.Dives = append(req.Dives, d)
+			}
+		}
+		req.Met = len(req.Dives) > 0
+		r.Training = append(r.Training, req)
+	}
+	return r
+}
+
+// best returns the certification that best proves course: one for the
+// course itself over one that implies it, then the earliest.
+func (ss Standards) best(course string, certs []*divelog.Certification) *divelog.Certification {
+	var best *divelog.Certification
+	bestDirect := false
+	for _, c := range certs {
+		if !ss.Implies(c.Level, course) {
+			continue
+		}
+		direct := ss.Implies(course, c.Level)
+		switch {
+		case best == nil,
+			direct && !bestDirect,
+			direct == bestDirect && c.Date.Before(best.Date):
+			best, bestDirect = c, direct
+		}
+	}
+	return best
+}
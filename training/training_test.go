@@ -0,0 +1,141 @@
+package training
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func day(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 10, 0, 0, 0, time.UTC) }
+
+func TestImplies(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"AOW", "OW", true},
+		{"Advanced Adventurer", "open water diver", true},
+		{"DM", "OW", true},
+		{"Rescue", "Nitrox", false},
+		{"OW", "AOW", false},
+		{"Nitrox", "enriched air nitrox", true},
+		{"Cave", "cave", true}, // unknown courses only imply themselves
+		{"Cave", "OW", false},
+	}
+	for _, tt := range tests {
+		if got := Builtin.Implies(tt.a, tt.b); got != tt.want {
+			t.Errorf("Implies(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ow := &divelog.Certification{ID: 1, Agency: "SSI", Level: "Open Water Diver", Number: "OW1", Date: day(2020, 3, 1)}
+	aow := &divelog.Certification{ID: 2, Agency: "PADI", Level: "Advanced Adventurer", Number: "A2", Date: day(2021, 6, 1)}
+	var dives []*divelog.Dive
+	for i, dive := range []string{"deep", "", "wreck", "Navigation"} {
+		dives = append(dives, &divelog.Dive{Number: i + 1, Start: day(2021, 5, 10+i),
+			Training: &divelog.Training{Course: "aow", Dive: dive}})
+	}
+	dives = append(dives, &divelog.Dive{Number: 5, Start: day(2021, 5, 1),
+		Training: &divelog.Training{Course: "OW"}})
+
+	type line struct {
+		what  string
+		met   bool
+		cert  int
+		dives []int
+	}
+	lines := func(reqs []Requirement) []line {
+		var ls []line
+		for _, r := range reqs {
+			l := line{what: r.What, met: r.Met}
+			if r.Cert != nil {
+				l.cert = r.Cert.ID
+			}
+			for _, d := range r.Dives {
+				l.dives = append(l.dives, d.Number)
+			}
+			ls = append(ls, l)
+		}
+		return ls
+	}
+
+	r := Builtin.Check(Builtin.Find("AOW"), []*divelog.Certification{ow}, dives)
+	if want := []line{{"OW certification", true, 1, nil}}; !reflect.DeepEqual(lines(r.Prerequisites), want) {
+		t.Errorf("AOW prerequisites = %+v, want %+v", lines(r.Prerequisites), want)
+	}
+	want := []line{
+		{"5 training dives", false, 0, []int{1, 2, 3, 4}},
+		{"deep dive", true, 0, []int{1}},
+		{"navigation dive", true, 0, []int{4}},
+	}
+	if !reflect.DeepEqual(lines(r.Training), want) {
+		t.Errorf("AOW training = %+v, want %+v", lines(r.Training), want)
+	}
+	if !r.Ready() || r.Complete() {
+		t.Errorf("AOW: Ready = %v, Complete = %v; want true, false", r.Ready(), r.Complete())
+	}
+
+	// The AOW card proves Open Water as well, but the OW card is the
+	// direct proof.
+	r = Builtin.Check(Builtin.Find("nitrox"), []*divelog.Certification{aow, ow}, nil)
+	if want := []line{{"OW certification", true, 1, nil}}; !reflect.DeepEqual(lines(r.Prerequisites), want) {
+		t.Errorf("Nitrox prerequisites = %+v, want %+v", lines(r.Prerequisites), want)
+	}
+	r = Builtin.Check(Builtin.Find("Deep"), []*divelog.Certification{aow}, nil)
+	if !r.Ready() || r.Prerequisites[0].Cert != aow {
+		t.Errorf("Deep with an AOW card: %+v", r.Prerequisites)
+	}
+
+	r = Builtin.Check(Builtin.Find("DM"), []*divelog.Certification{ow, aow}, dives)
+	want = []line{
+		{"Rescue certification", false, 0, nil},
+		{"40 logged dives", false, 0, []int{1, 2, 3, 4, 5}},
+	}
+	if !reflect.DeepEqual(lines(r.Prerequisites), want) || r.Ready() {
+		t.Errorf("DM prerequisites = %+v, want %+v", lines(r.Prerequisites), want)
+	}
+}
+
+func TestParseStandards(t *testing.T) {
+	ss, err := ParseStandards([]byte(`
+- course: OW
+  name: Open Water Diver
+  training_dives: 4
+- course: Cave
+  name: Full Cave Diver
+  requires: [OW]
+  min_dives: 100
+  training_dives: 6
+  required_dives: [lost line]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Standard{Course: "Cave", Name: "Full Cave Diver", Requires: []string{"OW"},
+		MinDives: 100, TrainingDives: 6, RequiredDives: []string{"lost line"}}
+	if got := ss.Find("full cave diver"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %+v, want %+v", got, want)
+	}
+
+	bad := []struct{ yaml, err string }{
+		{`[]`, "no standards"},
+		{`[{name: Open Water}]`, "no course"},
+		{`[{course: OW}, {course: ow}]`, "given twice"},
+		{`[{course: AOW, requires: [OW]}]`, "unknown course OW"},
+		{`[{course: A, requires: [B]}, {course: B, requires: [A]}]`, "requires itself"},
+		{`[{course: A, training_dives: 1, required_dives: [x, y]}]`, "only 1 training dives"},
+	}
+	for _, tt := range bad {
+		if _, err := ParseStandards([]byte(tt.yaml)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseStandards(%s) error = %v, want %q", tt.yaml, err, tt.err)
+		}
+	}
+	if err := Builtin.check(); err != nil {
+		t.Errorf("built-in standards: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package uddf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// schema is the subset of the UDDF 3.2 schema that this package reads and
+// writes: for each element, the children it may contain in the order the
+// standard's xs:sequence gives them. Elements not listed here may not
+// appear at all; elements listed with no children hold text.
+var schema = map[string][]string{
+	"uddf":                  {"generator", "diver", "divesite", "gasdefinitions", "profiledata"},
+	"generator":             {"name", "type", "manufacturer", "version", "datetime"},
+	"manufacturer":          {"name"},
+	"diver":                 {"owner", "buddy"},
+	"owner":                 {"personal", "equipment"},
+	"buddy":                 {"personal"},
+	"personal":              {"firstname", "lastname"},
+	"equipment":             {"buoyancycontroldevice", "divecomputer", "light", "regulator", "suit", "tank", "variouspieces"},
+	"buoyancycontroldevice": {"name", "serialnumber"},
+	"divecomputer":          {"name", "serialnumber"},
+	"light":                 {"name", "serialnumber"},
+	"regulator":             {"name", "serialnumber"},
+	"suit":                  {"name", "serialnumber", "suittype"},
+	"tank":                  {"name", "serialnumber"},
+	"variouspieces":         {"name", "serialnumber"},
+	"divesite":              {"site"},
+	"site":                  {"name", "geography", "notes"},
+	"geography":             {"location", "latitude", "longitude"},
+	"notes":                 {"para"},
+	"gasdefinitions":        {"mix"},
+	"mix":                   {"name", "o2", "n2", "he"},
+	"profiledata":           {"repetitiongroup"},
+	"repetitiongroup":       {"dive"},
+	"dive":                  {"informationbeforedive", "tankdata", "samples", "informationafterdive"},
+	"informationbeforedive": {"link", "divenumber", "datetime", "equipmentused"},
+	"equipmentused":         {"link"},
+	"tankdata":              {"link", "tankvolume", "tankpressurebegin", "tankpressureend"},
+	"samples":               {"waypoint"},
+	"waypoint":              {"alarm", "depth", "divetime", "setmarker", "switchmix", "tankpressure", "temperature"},
+	"informationafterdive":  {"greatestdepth", "averagedepth", "diveduration", "lowesttemperature", "notes", "rating"},
+	"rating":                {"ratingvalue"},
+}
+
+// required lists children that must be present in each element.
+var required = map[string][]string{
+	"uddf":                  {"generator", "profiledata"},
+	"generator":             {"name"},
+	"dive":                  {"informationbeforedive", "informationafterdive"},
+	"informationbeforedive": {"datetime"},
+	"informationafterdive":  {"greatestdepth"},
+	"waypoint":              {"depth", "divetime"},
+	"mix":                   {"o2"},
+}
+
+// numeric lists text elements whose content must be a decimal number.
+var numeric = []string{
+	"latitude", "longitude", "o2", "n2", "he", "divenumber", "tankvolume",
+	"tankpressurebegin", "tankpressureend", "depth", "divetime", "tankpressure",
+	"temperature", "greatestdepth", "averagedepth", "diveduration",
+	"lowesttemperature", "ratingvalue",
+}
+
+// idRefs lists elements that must carry a ref attribute.
+var idRefs = []string{"link", "switchmix"}
+
+// validate checks a document against schema, required, numeric and idRefs,
+// and that every ref names an id defined in the document.
+func validate(r io.Reader) error {
+	type frame struct {
+		name     string
+		pos      int // index in schema of the last child seen
+		children map[string]bool
+		text     strings.Builder
+	}
+	var stack []*frame
+	ids := make(map[string]bool)
+	var refs []string
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if len(stack) == 0 {
+				if name != "uddf" {
+					return fmt.Errorf("root element is <%s>, want <uddf>", name)
+				}
+			} else {
+				parent := stack[len(stack)-1]
+				allowed := schema[parent.name]
+				i := slices.Index(allowed, name)
+				if i < 0 {
+					return fmt.Errorf("<%s> not allowed in <%s>", name, parent.name)
+				}
+				if i < parent.pos {
+					return fmt.Errorf("<%s> out of order in <%s>", name, parent.name)
+				}
+				parent.pos = i
+				parent.children[name] = true
+			}
+			for _, a := range t.Attr {
+				switch a.Name.Local {
+				case "id":
+					if ids[a.Value] {
+						return fmt.Errorf("duplicate id %q", a.Value)
+					}
+					ids[a.Value] = true
+				case "ref":
+					refs = append(refs, a.Value)
+				}
+			}
+			if slices.Contains(idRefs, name) && !slices.ContainsFunc(t.Attr, func(a xml.Attr) bool { return a.Name.Local == "ref" }) {
+				return fmt.Errorf("<%s> without ref", name)
+			}
+			stack = append(stack, &frame{name: name, children: make(map[string]bool)})
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, c := range required[f.name] {
+				if !f.children[c] {
+					return fmt.Errorf("<%s> missing <%s>", f.name, c)
+				}
+			}
+			if slices.Contains(numeric, f.name) {
+				if _, err := strconv.ParseFloat(strings.TrimSpace(f.text.String()), 64); err != nil {
+					return fmt.Errorf("<%s> is not a number: %q", f.name, f.text.String())
+				}
+			}
+		}
+	}
+	for _, r := range refs {
+		if !ids[r] {
+			return fmt.Errorf("ref %q names no element", r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,555 @@
+// Package uddf reads and writes the Universal Dive Data Format, version
+// 3.2, the interchange format exported by many dive computer vendors and
+// logging programs.
+//
+// UDDF is an SI format, so values map onto the divelog model without
+// conversion. Gas definitions become tank gases, tank data becomes tanks,
+// dive sites keep their geography, and profile waypoints become samples,
+// with mix switches turned into gas change events and set markers into
+// bookmarks. UDDF has no tags, buddy roles, tank working pressures or event
+// texts; those are not written.
+package uddf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// Namespace is the UDDF 3.2 XML namespace written on export.
+const Namespace = "http://www.streit.cc/uddf/3.2/"
+
+// Version is the UDDF version written on export.
+const Version = "3.2.1"
+
+// dateTimeLayouts are the forms of xs:dateTime seen in UDDF files; those
+// without a zone are wall-clock times at the dive site.
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// alarms maps UDDF waypoint alarms to event kinds.
+var alarms = map[string]divelog.EventKind{
+	"ascent": divelog.EventAscent,
+	"deco":   divelog.EventDecoStop,
+	"error":  divelog.EventViolation,
+}
+
+// Read parses a UDDF document. Dive times without a zone are interpreted
+// in loc.
+func Read(r io.Reader, loc *time.Location) ([]*divelog.Dive, error) {
+	var u xmlUDDF
+	if err := xml.NewDecoder(r).Decode(&u); err != nil {
+		return nil, fmt.Errorf("uddf: %w", err)
+	}
+	refs := newIndex(&u)
+	var dives []*divelog.Dive
+	for _, g := range u.ProfileData.Groups {
+		for _, x := range g.Dives {
+			d, err := refs.convertDive(&x, loc)
+			if err != nil {
+				return nil, fmt.Errorf("uddf: dive %s: %w", x.ID, err)
+			}
+			dives = append(dives, d)
+		}
+	}
+	return dives, nil
+}
+
+// index resolves the id references a dive makes to the document's sites,
+// buddies, gas mixes and equipment.
+type index struct {
+	sites     map[string]*divelog.Site
+	buddies   map[string]divelog.Buddy
+	mixes     map[string]divelog.GasMix
+	equipment map[string]divelog.Equipment
+}
+
+func newIndex(u *xmlUDDF) *index {
+	ix := &index{
+		sites:     make(map[string]*divelog.Site),
+		buddies:   make(map[string]divelog.Buddy),
+		mixes:     make(map[string]divelog.GasMix),
+		equipment: make(map[string]divelog.Equipment),
+	}
+	if u.DiveSite != nil {
+		for _, s := range u.DiveSite.Sites {
+			site := &divelog.Site{Name: s.Name}
+			if g := s.Geography; g != nil {
+				if site.Name == "" {
+					site.Name = g.Location
+				}
+				if g.Latitude != nil && g.Longitude != nil {
+					site.Coords = &divelog.Coordinates{Lat: *g.Latitude, Lon: *g.Longitude}
+				}
+			}
+			site.Notes = s.Notes.text()
+			ix.sites[s.ID] = site
+		}
+	}
+	if u.Diver != nil {
+		for _, b := range u.Diver.Buddies {
+			name := strings.TrimSpace(b.Personal.FirstName + " " + b.Personal.LastName)
+			ix.buddies[b.ID] = divelog.Buddy{Name: name}
+		}
+		if o := u.Diver.Owner; o != nil && o.Equipment != nil {
+			e := o.Equipment
+			add := func(items []xmlItem, kind divelog.EquipmentKind) {
+				for _, it := range items {
+					k := kind
+					if kind == divelog.Wetsuit && strings.Contains(it.SuitType, "dry") {
+						k = divelog.Drysuit
+					}
+					ix.equipment[it.ID] = divelog.Equipment{Kind: k, Name: it.Name, Serial: it.SerialNumber}
+				}
+			}
+			add(e.BCDs, divelog.BCD)
+			add(e.DiveComputers, divelog.Computer)
+			add(e.Lights, divelog.Light)
+			add(e.Regulators, divelog.Regulator)
+			add(e.Suits, divelog.Wetsuit)
+			add(e.Tanks, divelog.Cylinder)
+			add(e.Various, divelog.Other)
+		}
+	}
+	if u.Gases != nil {
+		for _, m := range u.Gases.Mixes {
+			ix.mixes[m.ID] = divelog.GasMix{O2: m.O2, He: m.He}
+		}
+	}
+	return ix
+}
+
+func (ix *index) convertDive(x *xmlDive, loc *time.Location) (*divelog.Dive, error) {
+	start, err := parseDateTime(x.Before.DateTime, loc)
+	if err != nil {
+		return nil, err
+	}
+	a := x.After
+	d := &divelog.Dive{
+		Number:         x.Before.DiveNumber,
+		Start:          start,
+		Duration:       seconds(a.DiveDuration),
+		MaxDepth:       divelog.Depth(a.GreatestDepth),
+		AvgDepth:       divelog.Depth(a.AverageDepth),
+		MinTemperature: divelog.Temperature(a.LowestTemperature),
+		Notes:          a.Notes.text(),
+	}
+	if a.Rating != nil && a.Rating.Value > 0 {
+		d.Rating = (a.Rating.Value + 1) / 2
+	}
+	for _, l := range x.Before.Links {
+		if s, ok := ix.sites[l.Ref]; ok {
+			site := *s
+			d.Site = &site
+		} else if b, ok := ix.buddies[l.Ref]; ok {
+			d.Buddies = append(d.Buddies, b)
+		}
+	}
+	if used := x.Before.EquipmentUsed; used != nil {
+		for _, l := range used.Links {
+			if e, ok := ix.equipment[l.Ref]; ok {
+				d.Equipment = append(d.Equipment, e)
+			}
+		}
+	}
+
+	// Tanks are found by their tankdata id, and by their mix id for
+	// switchmix elements. A tankdata links to its mix and to the tank in
+	// the equipment, whose name is the tank's description.
+	tankByID := make(map[string]int)
+	tankByMix := make(map[string]int)
+	for i, t := range x.Tanks {
+		tank := divelog.Tank{
+			Volume:        divelog.Volume(t.TankVolume),
+			StartPressure: divelog.Pressure(t.PressureBegin),
+			EndPressure:   divelog.Pressure(t.PressureEnd),
+			Gas:           divelog.Air,
+		}
+		for _, l := range t.Links {
+			if mix, ok := ix.mixes[l.Ref]; ok {
+				tank.Gas = mix
+				if _, dup := tankByMix[l.Ref]; !dup {
+					tankByMix[l.Ref] = i
+				}
+			} else if e, ok := ix.equipment[l.Ref]; ok {
+				tank.Description = e.Name
+			} else {
+				return nil, fmt.Errorf("tank %s refers to unknown %q", t.ID, l.Ref)
+			}
+		}
+		tankByID[t.ID] = i
+		d.Tanks = append(d.Tanks, tank)
+	}
+
+	if x.Samples != nil {
+		current := 0
+		for _, w := range x.Samples.Waypoints {
+			s := divelog.Sample{
+				Time:        seconds(w.DiveTime),
+				Depth:       divelog.Depth(w.Depth),
+				Temperature: divelog.Temperature(w.Temperature),
+			}
+			if w.SwitchMix != nil {
+				tank, ok := tankByMix[w.SwitchMix.Ref]
+				if !ok {
+					// A mix switched to without tank data gets a tank of its own.
+					mix, known := ix.mixes[w.SwitchMix.Ref]
+					if !known {
+						return nil, fmt.Errorf("switch to unknown mix %q", w.SwitchMix.Ref)
+					}
+					tank = len(d.Tanks)
+					d.Tanks = append(d.Tanks, divelog.Tank{Gas: mix})
+					tankByMix[w.SwitchMix.Ref] = tank
+				}
+				current = tank
+				d.Events = append(d.Events, divelog.Event{Time: s.Time, Kind: divelog.EventGasChange, Tank: tank})
+			}
+			// A sample holds one pressure: that of the tank breathed
+			// from if the waypoint has it, otherwise the first given. A
+			// pressure without a ref is of the first tank.
+			for i, p := range w.TankPressure {
+				tank, ok := tankByID[p.Ref]
+				if !ok && p.Ref != "" {
+					return nil, fmt.Errorf("pressure at %v of unknown tank %q", s.Time, p.Ref)
+				}
+				if i == 0 || tank == current {
+					s.Pressure, s.Tank = divelog.Pressure(p.Value), tank
+				}
+			}
+			for _, al := range w.Alarms {
+				kind, ok := alarms[strings.TrimSpace(al)]
+				if !ok {
+					kind = divelog.EventKind(strings.TrimSpace(al))
+				}
+				d.Events = append(d.Events, divelog.Event{Time: s.Time, Kind: kind})
+			}
+			for range w.SetMarkers {
+				d.Events = append(d.Events, divelog.Event{Time: s.Time, Kind: divelog.EventBookmark})
+			}
+			d.Samples = append(d.Samples, s)
+		}
+	}
+	if len(d.Samples) > 0 && (d.MaxDepth == 0 || d.Duration == 0) {
+		s := *d
+		s.Summarize()
+		d.Duration = max(d.Duration, s.Duration)
+		d.MaxDepth = max(d.MaxDepth, s.MaxDepth)
+	}
+	return d, nil
+}
+
+// Write writes dives as a UDDF document.
+func Write(w io.Writer, dives []*divelog.Dive) error {
+	u := xmlUDDF{
+		Version: Version,
+		Generator: xmlGenerator{
+			Name:     "divelog",
+			Type:     "logbook",
+			DateTime: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		},
+	}
+	b := newBuilder()
+	var group *xmlRepetitionGroup
+	for i, d := range dives {
+		// Dives on the same day form one repetition group.
+		if group == nil || !sameDay(dives[i-1].Start, d.Start) {
+			u.ProfileData.Groups = append(u.ProfileData.Groups, xmlRepetitionGroup{
+				ID: fmt.Sprintf("rg%d", len(u.ProfileData.Groups)+1),
+			})
+			group = &u.ProfileData.Groups[len(u.ProfileData.Groups)-1]
+		}
+		x, err := b.dive(d, i+1)
+		if err != nil {
+			return fmt.Errorf("uddf: dive #%d: %w", d.Number, err)
+		}
+		group.Dives = append(group.Dives, x)
+	}
+	u.Diver, u.DiveSite, u.Gases = b.diver(), b.siteList(), b.gasList()
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	root := xml.StartElement{
+		Name: xml.Name{Local: "uddf"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}},
+	}
+	if err := enc.EncodeElement(&u, root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// builder collects the sites, buddies, mixes and equipment referenced by
+// the dives being written, giving each a stable id.
+type builder struct {
+	sites     []xmlSite
+	siteIDs   map[string]string
+	buddies   []xmlPerson
+	buddyIDs  map[string]string
+	mixes     []xmlMix
+	mixIDs    map[divelog.GasMix]string
+	equipment xmlEquipment
+	equipIDs  map[divelog.Equipment]string
+}
+
+func newBuilder() *builder {
+	return &builder{
+		siteIDs:  make(map[string]string),
+		buddyIDs: make(map[string]string),
+		mixIDs:   make(map[divelog.GasMix]string),
+		equipIDs: make(map[divelog.Equipment]string),
+	}
+}
+
+func (b *builder) site(s *divelog.Site) string {
+	key := s.Name
+	if s.Coords != nil {
+		key += fmt.Sprintf("@%f,%f", s.Coords.Lat, s.Coords.Lon)
+	}
+	if id, ok := b.siteIDs[key]; ok {
+		return id
+	}
+	id := fmt.Sprintf("site%d", len(b.sites)+1)
+	x := xmlSite{ID: id, Name: s.Name, Notes: notes(s.Notes)}
+	if s.Coords != nil {
+		lat, lon := s.Coords.Lat, s.Coords.Lon
+		x.Geography = &xmlGeography{Latitude: &lat, Longitude: &lon}
+	}
+	b.sites = append(b.sites, x)
+	b.siteIDs[key] = id
+	return id
+}
+
+func (b *builder) buddy(bd divelog.Buddy) string {
+	if id, ok := b.buddyIDs[bd.Name]; ok {
+		return id
+	}
+	id := fmt.Sprintf("buddy%d", len(b.buddies)+1)
+	first, last := bd.Name, ""
+	if i := strings.LastIndexByte(bd.Name, ' '); i > 0 {
+		first, last = bd.Name[:i], bd.Name[i+1:]
+	}
+	b.buddies = append(b.buddies, xmlPerson{ID: id, Personal: xmlPersonal{FirstName: first, LastName: last}})
+	b.buddyIDs[bd.Name] = id
+	return id
+}
+
+func (b *builder) mix(m divelog.GasMix) string {
+	if id, ok := b.mixIDs[m]; ok {
+		return id
+	}
+	id := fmt.Sprintf("mix%d", len(b.mixes)+1)
+	b.mixes = append(b.mixes, xmlMix{ID: id, Name: m.String(), O2: m.O2, N2: round(m.N2(), 6), He: m.He})
+	b.mixIDs[m] = id
+	return id
+}
+
+func (b *builder) item(e divelog.Equipment) string {
+	if id, ok := b.equipIDs[e]; ok {
+		return id
+	}
+	id := fmt.Sprintf("eq%d", len(b.equipIDs)+1)
+	it := xmlItem{ID: id, Name: e.Name, SerialNumber: e.Serial}
+	q := &b.equipment
+	switch e.Kind {
+	case divelog.BCD:
+		q.BCDs = append(q.BCDs, it)
+	case divelog.Computer:
+		q.DiveComputers = append(q.DiveComputers, it)
+	case divelog.Light:
+		q.Lights = append(q.Lights, it)
+	case divelog.Regulator:
+		q.Regulators = append(q.Regulators, it)
+	case divelog.Drysuit:
+		it.SuitType = "dry-suit"
+		q.Suits = append(q.Suits, it)
+	case divelog.Wetsuit:
+		it.SuitType = "wet-suit"
+		q.Suits = append(q.Suits, it)
+	case divelog.Cylinder:
+		q.Tanks = append(q.Tanks, it)
+	default:
+		q.Various = append(q.Various, it)
+	}
+	b.equipIDs[e] = id
+	return id
+}
+
+func (b *builder) dive(d *divelog.Dive, seq int) (xmlDive, error) {
+	x := xmlDive{ID: fmt.Sprintf("dive%d", seq)}
+	x.Before.DiveNumber = d.Number
+	x.Before.DateTime = d.Start.Format(time.RFC3339)
+	if d.Site != nil {
+		x.Before.Links = append(x.Before.Links, xmlLink{Ref: b.site(d.Site)})
+	}
+	for _, bd := range d.Buddies {
+		x.Before.Links = append(x.Before.Links, xmlLink{Ref: b.buddy(bd)})
+	}
+	if len(d.Equipment) > 0 {
+		x.Before.EquipmentUsed = &xmlEquipUsed{}
+		for _, e := range d.Equipment {
+			x.Before.EquipmentUsed.Links = append(x.Before.EquipmentUsed.Links, xmlLink{Ref: b.item(e)})
+		}
+	}
+
+	// UDDF has no working pressure for a tank; it is not written.
+	tankIDs := make([]string, len(d.Tanks))
+	for i, t := range d.Tanks {
+		tankIDs[i] = fmt.Sprintf("%s-tank%d", x.ID, i+1)
+		td := xmlTankData{
+			ID:            tankIDs[i],
+			Links:         []xmlLink{{Ref: b.mix(t.Gas)}},
+			TankVolume:    float64(t.Volume),
+			PressureBegin: float64(t.StartPressure),
+			PressureEnd:   float64(t.EndPressure),
+		}
+		if t.Description != "" {
+			td.Links = append(td.Links, xmlLink{Ref: b.item(divelog.Equipment{Kind: divelog.Cylinder, Name: t.Description})})
+		}
+		x.Tanks = append(x.Tanks, td)
+	}
+
+	if len(d.Samples) > 0 {
+		x.Samples = &xmlSamples{}
+		events := d.Events
+		for i, s := range d.Samples {
+			w := xmlWaypoint{
+				Depth:       float64(s.Depth),
+				DiveTime:    s.Time.Seconds(),
+				Temperature: float64(s.Temperature),
+			}
+			if s.Pressure != 0 && s.Tank >= 0 && s.Tank < len(tankIDs) {
+				w.TankPressure = []xmlTankPressure{{Ref: tankIDs[s.Tank], Value: float64(s.Pressure)}}
+			}
+			// Events belong to the first waypoint at or after them; any
+			// after the last sample go on the last waypoint. Their texts
+			// have no place in UDDF and are not written.
+			last := i == len(d.Samples)-1
+			var switched time.Duration
+			for len(events) > 0 && (events[0].Time <= s.Time || last) {
+				e := events[0]
+				events = events[1:]
+				switch e.Kind {
+				case divelog.EventGasChange:
+					if e.Tank < 0 || e.Tank >= len(d.Tanks) {
+						return xmlDive{}, fmt.Errorf("gas change at %v to tank %d, which the dive does not have", e.Time, e.Tank+1)
+					}
+					if w.SwitchMix != nil {
+						return xmlDive{}, fmt.Errorf("gas changes at %v and %v fall on one waypoint, which switches to one mix",
+							switched, e.Time)
+					}
+					w.SwitchMix = &xmlLink{Ref: b.mix(d.Tanks[e.Tank].Gas)}
+					switched = e.Time
+				case divelog.EventBookmark:
+					w.SetMarkers = append(w.SetMarkers, struct{}{})
+				case divelog.EventAscent:
+					w.Alarms = append(w.Alarms, "ascent")
+				case divelog.EventDecoStop:
+					w.Alarms = append(w.Alarms, "deco")
+				case divelog.EventViolation:
+					w.Alarms = append(w.Alarms, "error")
+				default:
+					// Other kinds, such as those read from alarms this
+					// package has no kind for, are written as alarms.
+					w.Alarms = append(w.Alarms, string(e.Kind))
+				}
+			}
+			x.Samples.Waypoints = append(x.Samples.Waypoints, w)
+		}
+	}
+
+	x.After = xmlAfterDive{
+		GreatestDepth:     float64(d.MaxDepth),
+		AverageDepth:      float64(d.AvgDepth),
+		DiveDuration:      d.Duration.Seconds(),
+		LowestTemperature: float64(d.MinTemperature),
+		Notes:             notes(d.Notes),
+	}
+	if d.Rating > 0 {
+		x.After.Rating = &xmlRating{Value: d.Rating * 2}
+	}
+	return x, nil
+}
+
+func (b *builder) diver() *xmlDiver {
+	if len(b.buddies) == 0 && len(b.equipIDs) == 0 {
+		return nil
+	}
+	dv := &xmlDiver{Owner: &xmlOwner{ID: "owner"}, Buddies: b.buddies}
+	if len(b.equipIDs) > 0 {
+		dv.Owner.Equipment = &b.equipment
+	}
+	return dv
+}
+
+func (b *builder) siteList() *xmlDiveSite {
+	if len(b.sites) == 0 {
+		return nil
+	}
+	return &xmlDiveSite{Sites: b.sites}
+}
+
+func (b *builder) gasList() *xmlGases {
+	if len(b.mixes) == 0 {
+		return nil
+	}
+	return &xmlGases{Mixes: b.mixes}
+}
+
+func (n *xmlNotes) text() string {
+	if n == nil {
+		return ""
+	}
+	var paras []string
+	for _, p := range n.Paras {
+		if p = strings.TrimSpace(p); p != "" {
+			paras = append(paras, p)
+		}
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+func notes(s string) *xmlNotes {
+	if s == "" {
+		return nil
+	}
+	return &xmlNotes{Paras: strings.Split(s, "\n\n")}
+}
+
+func parseDateTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid datetime %q", s)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func round(v float64, prec int) float64 {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'f', prec, 64), 64)
+	return f
+}
@@ -0,0 +1,261 @@
+package uddf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+func readFile(t *testing.T, path string) []*divelog.Dive {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dives, err := Read(f, time.UTC)
+	if err != nil {
+		t.Fatalf("Read(%s): %v", path, err)
+	}
+	return dives
+}
+
+// documents describes what each sample document must read as.
+var documents = []struct {
+	file  string
+	dives int
+	check func(t *testing.T, dives []*divelog.Dive)
+}{
+	{"testdata/vendor.uddf", 2, func(t *testing.T, dives []*divelog.Dive) {
+		d := dives[0]
+		if d.Number != 412 || !d.Start.Equal(time.Date(2024, 6, 3, 8, 12, 0, 0, time.UTC)) {
+			t.Errorf("dive = #%d at %v", d.Number, d.Start)
+		}
+		if d.Duration != 40*time.Minute || d.MaxDepth != 30.4 || d.AvgDepth != 17.6 || d.Rating != 5 {
+			t.Errorf("summary = %v %v %v rating %d", d.Duration, d.MaxDepth, d.AvgDepth, d.Rating)
+		}
+		if math.Abs(d.MinTemperature.Celsius()-24) > 1e-9 {
+			t.Errorf("lowest temperature = %v °C", d.MinTemperature.Celsius())
+		}
+		if d.Site == nil || d.Site.Name != "SS Thistlegorm" || d.Site.Coords == nil || d.Site.Coords.Lon != 33.921 {
+			t.Errorf("site = %+v", d.Site)
+		}
+		if d.Site.Notes != "WWII wreck.\n\nStrong current on the stern." {
+			t.Errorf("site notes = %q", d.Site.Notes)
+		}
+		if !reflect.DeepEqual(d.Buddies, []divelog.Buddy{{Name: "Ana Ruiz"}}) {
+			t.Errorf("buddies = %+v", d.Buddies)
+		}
+		wantEq := []divelog.Equipment{
+			{Kind: divelog.Computer, Name: "Acme Nautilus", Serial: "NX-00412"},
+			{Kind: divelog.Drysuit, Name: "Trilaminate"},
+		}
+		if !reflect.DeepEqual(d.Equipment, wantEq) {
+			t.Errorf("equipment = %+v", d.Equipment)
+		}
+		if len(d.Tanks) != 2 || d.Tanks[1].Gas.String() != "EAN50" || math.Abs(d.Tanks[0].Volume.Liters()-12) > 1e-9 {
+			t.Fatalf("tanks = %+v", d.Tanks)
+		}
+		if d.Tanks[0].StartPressure.Bar() != 210 || d.Tanks[1].EndPressure.Bar() != 160 {
+			t.Errorf("tank pressures = %+v", d.Tanks)
+		}
+		wantEvents := []divelog.Event{
+			{Time: 0, Kind: divelog.EventGasChange, Tank: 0},
+			{Time: 25 * time.Minute, Kind: divelog.EventAscent},
+			{Time: 30 * time.Minute, Kind: divelog.EventGasChange, Tank: 1},
+		}
+		if !reflect.DeepEqual(d.Events, wantEvents) {
+			t.Errorf("events = %+v", d.Events)
+		}
+		// After the switch the sample carries the stage pressure.
+		if s := d.Samples[5]; s.Tank != 1 || s.Pressure.Bar() != 200 {
+			t.Errorf("sample at switch = %+v", s)
+		}
+		if err := d.Validate(); err != nil {
+			t.Error(err)
+		}
+		if dives[1].Number != 413 || len(dives[1].Samples) != 4 {
+			t.Errorf("second dive = %+v", dives[1])
+		}
+	}},
+	{"testdata/minimal.uddf", 1, func(t *testing.T, dives []*divelog.Dive) {
+		d := dives[0]
+		if !d.Start.Equal(time.Date(2023, 11, 12, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("start = %v", d.Start)
+		}
+		if d.MaxDepth != 12.5 || d.Duration != 50*time.Minute || d.Samples != nil {
+			t.Errorf("dive = %+v", d)
+		}
+	}},
+}
+
+func TestDocuments(t *testing.T) {
+	for _, doc := range documents {
+		t.Run(doc.file, func(t *testing.T) {
+			f, err := os.Open(doc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := validate(f); err != nil {
+				t.Fatalf("sample document does not match schema: %v", err)
+			}
+			dives := readFile(t, doc.file)
+			if len(dives) != doc.dives {
+				t.Fatalf("read %d dives, want %d", len(dives), doc.dives)
+			}
+			doc.check(t, dives)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, doc := range documents {
+		t.Run(doc.file, func(t *testing.T) {
+			want := readFile(t, doc.file)
+			var buf bytes.Buffer
+			if err := Write(&buf, want); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := validate(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatalf("written document does not match schema: %v\n%s", err, buf.String())
+			}
+			got, err := Read(&buf, time.UTC)
+			if err != nil {
+				t.Fatalf("reading written document: %v", err)
+			}
+			for i := range want {
+				// Zones are written as offsets; compare instants.
+				if !got[i].Start.Equal(want[i].Start) {
+					t.Errorf("dive %d start = %v, want %v", i, got[i].Start, want[i].Start)
+				}
+				got[i].Start = want[i].Start
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip changed dives:\ngot  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteModel(t *testing.T) {
+	d := &divelog.Dive{
+		Number:   3,
+		Start:    time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		Duration: 20 * time.Minute,
+		MaxDepth: 18,
+		Tanks:    []divelog.Tank{{Volume: divelog.Liters(12), Gas: divelog.GasMix{O2: 0.18, He: 0.45}}},
+		Buddies:  []divelog.Buddy{{Name: "Jean Luc Picard"}},
+		Equipment: []divelog.Equipment{
+			{Kind: divelog.Regulator, Name: "MK25"},
+			{Kind: divelog.BCD, Name: "Wing"},
+		},
+		Samples: []divelog.Sample{{Time: 0}, {Time: 10 * time.Minute, Depth: 18, Pressure: divelog.Bar(150)}, {Time: 20 * time.Minute}},
+		Events:  []divelog.Event{{Time: 0, Kind: divelog.EventGasChange}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, []*divelog.Dive{d}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validate(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("written document does not match schema: %v\n%s", err, buf.String())
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`xmlns="` + Namespace + `"`,
+		"<o2>0.18</o2>", "<he>0.45</he>", "<n2>0.37</n2>",
+		"<firstname>Jean Luc</firstname>", "<lastname>Picard</lastname>",
+		"<tankpressure ref=\"dive1-tank1\">1.5e+07</tankpressure>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+// TestRoundTripModel checks that what the model holds beyond the sample
+// documents survives a round trip: tank descriptions, bookmarks and kinds
+// of event UDDF has no name for.
+func TestRoundTripModel(t *testing.T) {
+	ean50, _ := divelog.ParseGasMix("EAN50")
+	want := &divelog.Dive{
+		Number:   8,
+		Start:    time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		Duration: 20 * time.Minute,
+		MaxDepth: 30,
+		Tanks:    []divelog.Tank{{Description: "AL80", Gas: divelog.Air}, {Description: "AL40", Gas: ean50}},
+		Samples: []divelog.Sample{
+			{Time: 0}, {Time: 5 * time.Minute, Depth: 30}, {Time: 10 * time.Minute, Depth: 20},
+			{Time: 15 * time.Minute, Depth: 6, Pressure: divelog.Bar(190), Tank: 1}, {Time: 20 * time.Minute},
+		},
+		Events: []divelog.Event{
+			{Time: 0, Kind: divelog.EventGasChange},
+			{Time: 5 * time.Minute, Kind: divelog.EventBookmark},
+			{Time: 10 * time.Minute, Kind: "rbt"},
+			{Time: 15 * time.Minute, Kind: divelog.EventGasChange, Tank: 1},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, []*divelog.Dive{want}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validate(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("written document does not match schema: %v\n%s", err, buf.String())
+	}
+	got, err := Read(&buf, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("round trip changed the dive:\ngot  %+v\nwant %+v", got[0], want)
+	}
+}
+
+func TestWriteRejectsTwoSwitchesOnAWaypoint(t *testing.T) {
+	ean50, _ := divelog.ParseGasMix("EAN50")
+	d := &divelog.Dive{
+		Start:    time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		MaxDepth: 20,
+		Tanks:    []divelog.Tank{{Gas: divelog.Air}, {Gas: ean50}},
+		Samples:  []divelog.Sample{{Time: 0}, {Time: time.Minute, Depth: 20}, {Time: 2 * time.Minute}},
+		Events: []divelog.Event{
+			{Time: 20 * time.Second, Kind: divelog.EventGasChange, Tank: 1},
+			{Time: 40 * time.Second, Kind: divelog.EventGasChange},
+		},
+	}
+	if err := Write(io.Discard, []*divelog.Dive{d}); err == nil {
+		t.Error("Write kept one of two gas changes between samples")
+	}
+}
+
+func TestReadRejectsUnknownRefs(t *testing.T) {
+	const doc = `<uddf version="3.2.1"><generator><name>test</name></generator>
+<profiledata><repetitiongroup id="rg1"><dive id="d1">
+<informationbeforedive><datetime>2024-01-02T09:00:00</datetime></informationbeforedive>
+<tankdata id="t1"><tankvolume>0.012</tankvolume></tankdata>
+%s
+<informationafterdive><greatestdepth>10</greatestdepth></informationafterdive>
+</dive></repetitiongroup></profiledata></uddf>`
+	for _, samples := range []string{
+		`<samples><waypoint><depth>0</depth><divetime>0</divetime><tankpressure ref="t2">20000000</tankpressure></waypoint></samples>`,
+		`<samples><waypoint><depth>0</depth><divetime>0</divetime><switchmix ref="nitrox"/></waypoint></samples>`,
+	} {
+		if _, err := Read(strings.NewReader(fmt.Sprintf(doc, samples)), time.UTC); err == nil {
+			t.Errorf("Read accepted %s", samples)
+		}
+	}
+	// A pressure without a ref is of the first tank.
+	dives, err := Read(strings.NewReader(fmt.Sprintf(doc,
+		`<samples><waypoint><depth>0</depth><divetime>0</divetime><tankpressure>20000000</tankpressure></waypoint></samples>`)), time.UTC)
+	if err != nil || dives[0].Samples[0].Pressure.Bar() != 200 || dives[0].Samples[0].Tank != 0 {
+		t.Errorf("pressure without a ref: %v, %v", dives, err)
+	}
+}
@@ -0,0 +1,169 @@
+package uddf
+
+import "encoding/xml"
+
+// The structs below mirror the parts of UDDF 3.2 that divelog maps onto
+// its model. Field names follow the UDDF element names. Element names are
+// given without a namespace so documents are read whether or not they
+// declare the UDDF namespace.
+
+type xmlUDDF struct {
+	XMLName     xml.Name       `xml:"uddf"`
+	Version     string         `xml:"version,attr"`
+	Generator   xmlGenerator   `xml:"generator"`
+	Diver       *xmlDiver      `xml:"diver"`
+	DiveSite    *xmlDiveSite   `xml:"divesite"`
+	Gases       *xmlGases      `xml:"gasdefinitions"`
+	ProfileData xmlProfileData `xml:"profiledata"`
+}
+
+type xmlGenerator struct {
+	Name     string `xml:"name"`
+	Type     string `xml:"type,omitempty"`
+	Version  string `xml:"version,omitempty"`
+	DateTime string `xml:"datetime,omitempty"`
+}
+
+type xmlDiver struct {
+	Owner   *xmlOwner   `xml:"owner"`
+	Buddies []xmlPerson `xml:"buddy"`
+}
+
+type xmlOwner struct {
+	ID        string        `xml:"id,attr"`
+	Personal  xmlPersonal   `xml:"personal"`
+	Equipment *xmlEquipment `xml:"equipment"`
+}
+
+type xmlPerson struct {
+	ID       string      `xml:"id,attr"`
+	Personal xmlPersonal `xml:"personal"`
+}
+
+type xmlPersonal struct {
+	FirstName string `xml:"firstname,omitempty"`
+	LastName  string `xml:"lastname,omitempty"`
+}
+
+// xmlEquipment holds the owner's gear, one list per UDDF element type.
+type xmlEquipment struct {
+	BCDs          []xmlItem `xml:"buoyancycontroldevice"`
+	DiveComputers []xmlItem `xml:"divecomputer"`
+	Lights        []xmlItem `xml:"light"`
+	Regulators    []xmlItem `xml:"regulator"`
+	Suits         []xmlItem `xml:"suit"`
+	Tanks         []xmlItem `xml:"tank"`
+	Various       []xmlItem `xml:"variouspieces"`
+}
+
+type xmlItem struct {
+	ID           string `xml:"id,attr"`
+	Name         string `xml:"name"`
+	SerialNumber string `xml:"serialnumber,omitempty"`
+	SuitType     string `xml:"suittype,omitempty"`
+}
+
+type xmlDiveSite struct {
+	Sites []xmlSite `xml:"site"`
+}
+
+type xmlSite struct {
+	ID        string        `xml:"id,attr"`
+	Name      string        `xml:"name"`
+	Geography *xmlGeography `xml:"geography"`
+	Notes     *xmlNotes     `xml:"notes"`
+}
+
+type xmlGeography struct {
+	Location  string   `xml:"location,omitempty"`
+	Latitude  *float64 `xml:"latitude"`
+	Longitude *float64 `xml:"longitude"`
+}
+
+type xmlNotes struct {
+	Paras []string `xml:"para"`
+}
+
+type xmlGases struct {
+	Mixes []xmlMix `xml:"mix"`
+}
+
+type xmlMix struct {
+	ID   string  `xml:"id,attr"`
+	Name string  `xml:"name,omitempty"`
+	O2   float64 `xml:"o2"`
+	N2   float64 `xml:"n2"`
+	He   float64 `xml:"he"`
+}
+
+type xmlProfileData struct {
+	Groups []xmlRepetitionGroup `xml:"repetitiongroup"`
+}
+
+type xmlRepetitionGroup struct {
+	ID    string    `xml:"id,attr"`
+	Dives []xmlDive `xml:"dive"`
+}
+
+type xmlDive struct {
+	ID      string        `xml:"id,attr"`
+	Before  xmlBeforeDive `xml:"informationbeforedive"`
+	Tanks   []xmlTankData `xml:"tankdata"`
+	Samples *xmlSamples   `xml:"samples"`
+	After   xmlAfterDive  `xml:"informationafterdive"`
+}
+
+type xmlLink struct {
+	Ref string `xml:"ref,attr"`
+}
+
+type xmlBeforeDive struct {
+	Links         []xmlLink     `xml:"link"`
+	DiveNumber    int           `xml:"divenumber,omitempty"`
+	DateTime      string        `xml:"datetime"`
+	EquipmentUsed *xmlEquipUsed `xml:"equipmentused"`
+}
+
+type xmlEquipUsed struct {
+	Links []xmlLink `xml:"link"`
+}
+
+type xmlTankData struct {
+	ID            string    `xml:"id,attr"`
+	Links         []xmlLink `xml:"link"` // to the mix and the tank in the equipment
+	TankVolume    float64   `xml:"tankvolume,omitempty"`
+	PressureBegin float64   `xml:"tankpressurebegin,omitempty"`
+	PressureEnd   float64   `xml:"tankpressureend,omitempty"`
+}
+
+type xmlSamples struct {
+	Waypoints []xmlWaypoint `xml:"waypoint"`
+}
+
+type xmlWaypoint struct {
+	Alarms       []string          `xml:"alarm"`
+	Depth        float64           `xml:"depth"`
+	DiveTime     float64           `xml:"divetime"`
+	SetMarkers   []struct{}        `xml:"setmarker"`
+	SwitchMix    *xmlLink          `xml:"switchmix"`
+	TankPressure []xmlTankPressure `xml:"tankpressure"`
+	Temperature  float64           `xml:"temperature,omitempty"`
+}
+
+type xmlTankPressure struct {
+	Ref   string  `xml:"ref,attr,omitempty"`
+	Value float64 `xml:",chardata"`
+}
+
+type xmlAfterDive struct {
+	GreatestDepth     float64    `xml:"greatestdepth"`
+	AverageDepth      float64    `xml:"averagedepth,omitempty"`
+	DiveDuration      float64    `xml:"diveduration,omitempty"`
+	LowestTemperature float64    `xml:"lowesttemperature,omitempty"`
+	Notes             *xmlNotes  `xml:"notes"`
+	Rating            *xmlRating `xml:"rating"`
+}
+
+type xmlRating struct {
+	Value int `xml:"ratingvalue"`
+}
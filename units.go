@@ -0,0 +1,257 @@
+package divelog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Depth is a depth below the surface in metres.
+type Depth float64
+
+// Temperature is an absolute temperature in kelvin. The zero value means
+// "not recorded".
+type Temperature float64
+
+// Pressure is an absolute pressure in pascals. The zero value means
+// "not recorded".
+type Pressure float64
+
+// Volume is a volume in cubic metres.
+type Volume float64
+
+// Salinity is the density of the water a dive took place in, in kg/m³.
+type Salinity float64
+
+// Physical constants used for unit and pressure conversions.
+const (
+	// Gravity is standard gravity in m/s².
+	Gravity = 9.80665
+
+	// StandardAtmosphere is the surface pressure assumed when a dive does
+	// not record one.
+	StandardAtmosphere Pressure = 101325
+
+	FreshWater Salinity = 1000
+	SaltWater  Salinity = 1025
+
+	metresPerFoot  = 0.3048
+	pascalsPerBar  = 1e5
+	pascalsPerPSI  = 6894.757293168
+	m3PerLitre     = 1e-3
+	m3PerCubicFoot = 0.028316846592
+	zeroCelsius    = 273.15
+)
+
+// Feet returns the depth corresponding to ft feet.
+func Feet(ft float64) Depth { return Depth(ft * metresPerFoot) }
+
+// Meters returns d in metres.
+func (d Depth) Meters() float64 { return float64(d) }
+
+// Feet returns d in feet.
+func (d Depth) Feet() float64 { return float64(d) / metresPerFoot }
+
+// Celsius returns the temperature corresponding to c degrees Celsius.
+func Celsius(c float64) Temperature { return Temperature(c + zeroCelsius) }
+
+// Fahrenheit returns the temperature corresponding to f degrees Fahrenheit.
+func Fahrenheit(f float64) Temperature { return Celsius((f - 32) * 5 / 9) }
+
+// Kelvin returns t in kelvin.
+func (t Temperature) Kelvin() float64 { return float64(t) }
+
+// Celsius returns t in degrees Celsius.
+func (t Temperature) Celsius() float64 { return float64(t) - zeroCelsius }
+
+// Fahrenheit returns t in degrees Fahrenheit.
+func (t Temperature) Fahrenheit() float64 { return t.Celsius()*9/5 + 32 }
+
+// Bar returns the pressure corresponding to b bar.
+func Bar(b float64) Pressure { return Pressure(b * pascalsPerBar) }
+
+// PSI returns the pressure corresponding to p pounds per square inch.
+func PSI(p float64) Pressure { return Pressure(p * pascalsPerPSI) }
+
+// Pascals returns p in pascals.
+func (p Pressure) Pascals() float64 { return float64(p) }
+
+// Bar returns p in bar.
+func (p Pressure) Bar() float64 { return float64(p) / pascalsPerBar }
+
+// PSI returns p in pounds per square inch.
+func (p Pressure) PSI() float64 { return float64(p) / pascalsPerPSI }
+
+// Liters returns the volume corresponding to l litres.
+func Liters(l float64) Volume { return Volume(l * m3PerLitre) }
+
+// CubicFeet returns the volume corresponding to cf cubic feet.
+func CubicFeet(cf float64) Volume { return Volume(cf * m3PerCubicFoot) }
+
+// CubicMeters returns v in cubic metres.
+func (v Volume) CubicMeters() float64 { return float64(v) }
+
+// Liters returns v in litres.
+func (v Volume) Liters() float64 { return float64(v) / m3PerLitre }
+
+// CubicFeet returns v in cubic feet.
+func (v Volume) CubicFeet() float64 { return float64(v) / m3PerCubicFoot }
+
+// AmbientPressure returns the absolute pressure at depth d in water of
+// density s below a surface at pressure surface.
+func (s Salinity) AmbientPressure(d Depth, surface Pressure) Pressure {
+	return surface + Pressure(float64(s)*Gravity*float64(d))
+}
+
+// DepthAt is the inverse of AmbientPressure: it returns the depth at which
+// the absolute pressure is p.
+func (s Salinity) DepthAt(p, surface Pressure) Depth {
+	return Depth(float64(p-surface) / (float64(s) * Gravity))
+}
+
+// UnitSystem selects how values are entered and displayed.
+type UnitSystem int
+
+const (
+	Metric UnitSystem = iota
+	Imperial
+)
+
+// ParseUnitSystem parses "metric" or "imperial".
+func ParseUnitSystem(s string) (UnitSystem, error) {
+	switch strings.ToLower(s) {
+	case "metric", "si", "m":
+		return Metric, nil
+	case "imperial", "us", "i":
+		return Imperial, nil
+	}
+	return Metric, fmt.Errorf("unknown unit system %q", s)
+}
+
+func (u UnitSystem) String() string {
+	if u == Imperial {
+		return "imperial"
+	}
+	return "metric"
+}
+
+// Depth converts v, given in this system's depth unit, to a Depth.
+func (u UnitSystem) Depth(v float64) Depth {
+	if u == Imperial {
+		return Feet(v)
+	}
+	return Depth(v)
+}
+
+// Temperature converts v, given in this system's temperature unit.
+func (u UnitSystem) Temperature(v float64) Temperature {
+	if u == Imperial {
+		return Fahrenheit(v)
+	}
+	return Celsius(v)
+}
+
+// Pressure converts v, given in this system's pressure unit.
+func (u UnitSystem) Pressure(v float64) Pressure {
+	if u == Imperial {
+		return PSI(v)
+	}
+	return Bar(v)
+}
+
+// Volume converts v, given in this system's volume unit.
+func (u UnitSystem) Volume(v float64) Volume {
+	if u == Imperial {
+		return CubicFeet(v)
+	}
+	return Liters(v)
+}
+
+// DepthValue returns d expressed in this system's depth unit.
+func (u UnitSystem) DepthValue(d Depth) float64 {
+	if u == Imperial {
+		return d.Feet()
+	}
+	return d.Meters()
+}
+
+// TemperatureValue returns t expressed in this system's temperature unit.
+func (u UnitSystem) TemperatureValue(t Temperature) float64 {
+	if u == Imperial {
+		return t.Fahrenheit()
+	}
+	return t.Celsius()
+}
+
+// PressureValue returns p expressed in this system's pressure unit.
+func (u UnitSystem) PressureValue(p Pressure) float64 {
+	if u == Imperial {
+		return p.PSI()
+	}
+	return p.Bar()
+}
+
+// VolumeValue returns v expressed in this system's volume unit.
+func (u UnitSystem) VolumeValue(v Volume) float64 {
+	if u == Imperial {
+		return v.CubicFeet()
+	}
+	return v.Liters()
+}
+
+// DepthUnit returns the abbreviation of this system's depth unit.
+func (u UnitSystem) DepthUnit() string {
+	if u == Imperial {
+		return "ft"
+	}
+	return "m"
+}
+
+// TemperatureUnit returns the abbreviation of this system's temperature unit.
+func (u UnitSystem) TemperatureUnit() string {
+	if u == Imperial {
+		return "°F"
+	}
+	return "°C"
+}
+
+// PressureUnit returns the abbreviation of this system's pressure unit.
+func (u UnitSystem) PressureUnit() string {
+	if u == Imperial {
+		return "psi"
+	}
+	return "bar"
+}
+
+// VolumeUnit returns the abbreviation of this system's volume unit.
+func (u UnitSystem) VolumeUnit() string {
+	if u == Imperial {
+		return "cuft"
+	}
+	return "l"
+}
+
+// FormatDepth formats d for display, e.g. "30.5 m" or "100 ft".
+func (u UnitSystem) FormatDepth(d Depth) string {
+	if u == Imperial {
+		return fmt.Sprintf("%.0f ft", d.Feet())
+	}
+	return fmt.Sprintf("%.1f m", d.Meters())
+}
+
+// FormatTemperature formats t for display, e.g. "24.0 °C".
+func (u UnitSystem) FormatTemperature(t Temperature) string {
+	return fmt.Sprintf("%.1f %s", u.TemperatureValue(t), u.TemperatureUnit())
+}
+
+// FormatPressure formats p for display, e.g. "200 bar" or "3000 psi".
+func (u UnitSystem) FormatPressure(p Pressure) string {
+	return fmt.Sprintf("%.0f %s", u.PressureValue(p), u.PressureUnit())
+}
+
+// FormatVolume formats v for display, e.g. "12.0 l" or "0.42 cuft".
+func (u UnitSystem) FormatVolume(v Volume) string {
+	if u == Imperial {
+		return fmt.Sprintf("%.2f cuft", v.CubicFeet())
+	}
+	return fmt.Sprintf("%.1f l", v.Liters())
+}
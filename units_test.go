@@ -0,0 +1,53 @@
+package divelog
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b, tol float64) bool { return math.Abs(a-b) <= tol }
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"100 ft in m", Feet(100).Meters(), 30.48},
+		{"30 m in ft", Depth(30).Feet(), 98.425},
+		{"20 °C in °F", Celsius(20).Fahrenheit(), 68},
+		{"50 °F in °C", Fahrenheit(50).Celsius(), 10},
+		{"3000 psi in bar", PSI(3000).Bar(), 206.843},
+		{"200 bar in psi", Bar(200).PSI(), 2900.755},
+		{"80 cuft in l", CubicFeet(80).Liters(), 2265.348},
+		// Ideal-gas figure; the real AL80 holds 11.1 l because air is
+		// less compressible than ideal at 3000 psi.
+		{"AL80 water capacity", ImperialCylinder(CubicFeet(77.4), PSI(3000)).Liters(), 10.74},
+	}
+	for _, tt := range tests {
+		if !near(tt.got, tt.want, 0.01) {
+			t.Errorf("%s = %.4f, want %.4f", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestAmbientPressure(t *testing.T) {
+	p := SaltWater.AmbientPressure(10, StandardAtmosphere)
+	if !near(p.Bar(), 2.018, 0.001) {
+		t.Errorf("pressure at 10 m = %.4f bar, want 2.018", p.Bar())
+	}
+	if d := SaltWater.DepthAt(p, StandardAtmosphere); !near(float64(d), 10, 1e-9) {
+		t.Errorf("DepthAt round trip = %v, want 10", d)
+	}
+}
+
+func TestUnitSystemFormat(t *testing.T) {
+	if got := Imperial.FormatDepth(Feet(100)); got != "100 ft" {
+		t.Errorf("Imperial.FormatDepth = %q", got)
+	}
+	if got := Metric.FormatPressure(Bar(200)); got != "200 bar" {
+		t.Errorf("Metric.FormatPressure = %q", got)
+	}
+	if got := Metric.FormatTemperature(Celsius(24)); got != "24.0 °C" {
+		t.Errorf("Metric.FormatTemperature = %q", got)
+	}
+}
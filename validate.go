@@ -0,0 +1,185 @@
+package divelog
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes one problem found by Validate.
+type ValidationError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ValidationError) Error() string { return e.Field + ": " + e.Msg }
+
+// Validate checks the dive for impossible values: negative depths, sample
+// times that do not increase, gas mixes with more than 100% O2+He and
+// references to tanks that do not exist. All problems found are returned
+// joined; each is a *ValidationError.
+func (d *Dive) Validate() error {
+	var errs []error
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &ValidationError{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if d.Duration < 0 {
+		add("duration", "negative duration %v", d.Duration)
+	}
+	if d.MaxDepth < 0 {
+		add("max_depth", "negative depth %.2f m", d.MaxDepth)
+	}
+	if d.AvgDepth < 0 {
+		add("avg_depth", "negative depth %.2f m", d.AvgDepth)
+	}
+	if d.AvgDepth > d.MaxDepth+0.01 {
+		add("avg_depth", "average depth %.2f m exceeds maximum %.2f m", d.AvgDepth, d.MaxDepth)
+	}
+	if d.MinTemperature < 0 || d.SurfacePressure < 0 || d.Salinity < 0 {
+		add("conditions", "temperature, surface pressure and salinity must not be negative")
+	}
+	if d.Rating < 0 || d.Rating > 5 {
+		add("rating", "rating %d outside 0-5", d.Rating)
+	}
+	if d.Site != nil {
+		if err := d.Site.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.Training != nil && strings.TrimSpace(d.Training.Course) == "" {
+		add("training.course", "a training dive needs a course")
+	}
+	for i, sig := range d.Signatures {
+		field := fmt.Sprintf("signatures[%d]", i)
+		switch {
+		case strings.TrimSpace(sig.Signer) == "":
+			add(field+".signer", "a signature needs a signer")
+		case len(sig.PublicKey) != ed25519.PublicKeySize:
+			add(field+".public_key", "not an ed25519 public key")
+		case len(sig.Sig) != ed25519.SignatureSize:
+			add(field+".sig", "not an ed25519 signature")
+		}
+	}
+	for i, t := range d.Tanks {
+		field := fmt.Sprintf("tanks[%d]", i)
+		if err := t.Gas.Validate(); err != nil {
+			add(field+".gas", "%v", err)
+		}
+		if t.Volume < 0 || t.WorkingPressure < 0 || t.StartPressure < 0 || t.EndPressure < 0 {
+			add(field, "volume and pressures must not be negative")
+		}
+	}
+	d.validateProfile(add, "", d.Samples, d.Events)
+	for i, p := range d.Profiles {
+		prefix := fmt.Sprintf("profiles[%d].", i)
+		if len(p.Samples) == 0 {
+			add(prefix+"samples", "a profile needs samples")
+		}
+		d.validateProfile(add, prefix, p.Samples, p.Events)
+	}
+	return errors.Join(errs...)
+}
+
+// validateProfile checks the samples and events of one of d's profiles,
+// naming the fields found wrong after prefix.
+func (d *Dive) validateProfile(add func(field, format string, args ...any), prefix string, samples []Sample, events []Event) {
+	for i, s := range samples {
+		field := fmt.Sprintf("%ssamples[%d]", prefix, i)
+		if s.Time < 0 {
+			add(field+".time", "negative time %v", s.Time)
+		}
+		if i > 0 && s.Time <= samples[i-1].Time {
+			add(field+".time", "time %v does not follow %v", s.Time, samples[i-1].Time)
+		}
+		if s.Depth < 0 {
+			add(field+".depth", "negative depth %.2f m", s.Depth)
+		}
+		if s.Temperature < 0 {
+			add(field+".temperature", "below absolute zero")
+		}
+		if s.Pressure < 0 {
+			add(field+".pressure", "negative pressure")
+		}
+		if s.Pressure != 0 && (s.Tank < 0 || s.Tank >= len(d.Tanks)) {
+			add(field+".tank", "no tank %d", s.Tank)
+		}
+	}
+	for i, e := range events {
+		if e.Kind == EventGasChange && (e.Tank < 0 || e.Tank >= len(d.Tanks)) {
+			add(fmt.Sprintf("%sevents[%d].tank", prefix, i), "no tank %d", e.Tank)
+		}
+	}
+}
+
+// Validate checks that c lies within the valid latitude and longitude
+// ranges.
+func (c Coordinates) Validate() error {
+	if c.Lat < -90 || c.Lat > 90 {
+		return fmt.Errorf("latitude %f out of range", c.Lat)
+	}
+	if c.Lon < -180 || c.Lon > 180 {
+		return fmt.Errorf("longitude %f out of range", c.Lon)
+	}
+	return nil
+}
+
+// Validate checks the site's coordinates, depth and entry type. Problems
+// are returned joined as *ValidationErrors with fields starting "site".
+func (s *Site) Validate() error {
+	var errs []error
+	if s.Coords != nil {
+		if err := s.Coords.Validate(); err != nil {
+			errs = append(errs, &ValidationError{Field: "site.coords", Msg: err.Error()})
+		}
+	}
+	if s.MaxDepth < 0 {
+		errs = append(errs, &ValidationError{Field: "site.max_depth", Msg: fmt.Sprintf("negative depth %.2f m", s.MaxDepth)})
+	}
+	switch s.Entry {
+	case "", EntryShore, EntryBoat:
+	default:
+		errs = append(errs, &ValidationError{Field: "site.entry", Msg: fmt.Sprintf("unknown entry type %q", s.Entry)})
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the item has a name and a known kind and that its
+// service intervals are not negative. Problems are returned joined as
+// *ValidationErrors.
+func (it *Item) Validate() error {
+	var errs []error
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &ValidationError{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+	if strings.TrimSpace(it.Name) == "" {
+		add("name", "an item needs a name")
+	}
+	switch it.Kind {
+	case Regulator, BCD, Computer, Cylinder, Drysuit, Wetsuit, Light, Other:
+	default:
+		add("kind", "unknown equipment kind %q", it.Kind)
+	}
+	if it.ServiceMonths < 0 || it.ServiceDives < 0 {
+		add("service", "service intervals must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the certification names its agency and level and has a
+// date.
+func (c *Certification) Validate() error {
+	var errs []error
+	add := func(field, msg string) { errs = append(errs, &ValidationError{Field: field, Msg: msg}) }
+	if strings.TrimSpace(c.Agency) == "" {
+		add("agency", "a certification needs an agency")
+	}
+	if strings.TrimSpace(c.Level) == "" {
+		add("level", "a certification needs a level")
+	}
+	if c.Date.IsZero() {
+		add("date", "a certification needs a date")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,444 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/gas"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+// The JSON API, under /api/v1, exchanges dives, registered sites and
+// inventory items in the log's own JSON form: SI units and durations in
+// nanoseconds. Lists are paged with offset and limit, and each dive, site
+// and item carries an ETag that updates and deletes must send back in
+// If-Match, so that a client cannot overwrite a change it has not seen.
+
+// Page sizes of API lists.
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// maxBody is the largest request body a client may send.
+const maxBody = 32 << 20
+
+func (s *Server) routeAPI() {
+	s.mux.HandleFunc("GET /api/v1/openapi.json", s.apiOpenAPI)
+	s.mux.HandleFunc("GET /api/v1/dives", s.apiListDives)
+	s.mux.HandleFunc("POST /api/v1/dives", s.apiCreateDive)
+	s.mux.HandleFunc("GET /api/v1/dives/{number}", s.apiGetDive)
+	s.mux.HandleFunc("PUT /api/v1/dives/{number}", s.apiPutDive)
+	s.mux.HandleFunc("DELETE /api/v1/dives/{number}", s.apiDeleteDive)
+	s.mux.HandleFunc("GET /api/v1/sites", s.apiListSites)
+	s.mux.HandleFunc("POST /api/v1/sites", s.apiCreateSite)
+	s.mux.HandleFunc("GET /api/v1/sites/{id}", s.apiGetSite)
+	s.mux.HandleFunc("PUT /api/v1/sites/{id}", s.apiPutSite)
+	s.mux.HandleFunc("DELETE /api/v1/sites/{id}", s.apiDeleteSite)
+	s.mux.HandleFunc("GET /api/v1/equipment", s.apiListItems)
+	s.mux.HandleFunc("POST /api/v1/equipment", s.apiCreateItem)
+	s.mux.HandleFunc("GET /api/v1/equipment/{id}", s.apiGetItem)
+	s.mux.HandleFunc("PUT /api/v1/equipment/{id}", s.apiPutItem)
+	s.mux.HandleFunc("DELETE /api/v1/equipment/{id}", s.apiDeleteItem)
+	s.mux.HandleFunc("GET /api/v1/stats", s.apiStats)
+}
+
+// apiError is the body of every API error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		status, data = http.StatusInternalServerError, []byte(`{"error": "encoding the response failed"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func apiFail(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, apiError{fmt.Sprintf(format, args...)})
+}
+
+// list is a page of an API list.
+type list[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+
+	// Next is the URL of the following page, if there is one.
+	Next string `json:"next,omitempty"`
+}
+
+// paginate returns the page of items selected by r's offset and limit
+// parameters.
+func paginate[T any](r *http.Request, items []T) (list[T], error) {
+	l := list[T]{Total: len(items), Limit: defaultLimit, Items: []T{}}
+	v := r.URL.Query()
+	var err error
+	if s := v.Get("offset"); s != "" {
+		if l.Offset, err = strconv.Atoi(s); err != nil || l.Offset < 0 {
+			return l, fmt.Errorf("invalid offset %q", s)
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if l.Limit, err = strconv.Atoi(s); err != nil || l.Limit < 1 || l.Limit > maxLimit {
+			return l, fmt.Errorf("invalid limit %q, want 1 to %d", s, maxLimit)
+		}
+	}
+	if l.Offset < len(items) {
+		l.Items = items[l.Offset:min(l.Offset+l.Limit, len(items))]
+	}
+	if end := l.Offset + l.Limit; end < len(items) {
+		v.Set("offset", strconv.Itoa(end))
+		l.Next = r.URL.Path + "?" + v.Encode()
+	}
+	return l, nil
+}
+
+// apiQuery reads the dive filters from r's query parameters: from and to
+// as dates or RFC 3339 times, site, and min_depth and max_depth in metres.
+func apiQuery(r *http.Request) (store.Query, error) {
+	v := r.URL.Query()
+	q := store.Query{Site: v.Get("site")}
+	var err error
+	parseTime := func(name string) (time.Time, bool, error) {
+		s := v.Get(name)
+		if s == "" {
+			return time.Time{}, false, nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, false, nil
+		}
+		t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			return t, false, fmt.Errorf("invalid %s %q, want YYYY-MM-DD or an RFC 3339 time", name, s)
+		}
+		return t, true, nil
+	}
+	if q.From, _, err = parseTime("from"); err != nil {
+		return q, err
+	}
+	var day bool
+	if q.To, day, err = parseTime("to"); err != nil {
+		return q, err
+	}
+	if day {
+		q.To = q.To.AddDate(0, 0, 1) // include the whole day
+	}
+	for name, depth := range map[string]*divelog.Depth{"min_depth": &q.MinDepth, "max_depth": &q.MaxDepth} {
+		if s := v.Get(name); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f < 0 {
+				return q, fmt.Errorf("invalid %s %q", name, s)
+			}
+			*depth = divelog.Depth(f)
+		}
+	}
+	return q, nil
+}
+
+// filtered returns the dives matching r's filters, ordered by number, or
+// writes the error response and returns false.
+func (s *Server) filtered(w http.ResponseWriter, r *http.Request, samples bool) ([]*divelog.Dive, bool) {
+	q, err := apiQuery(r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return nil, false
+	}
+	q.OmitSamples = !samples
+	dives, err := s.store.Query(q)
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return nil, false
+	}
+	return dives, true
+}
+
+// respond writes a page of items, or the error paginating them.
+func respond[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	l, err := paginate(r, items)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// apiListDives lists dives without their samples unless asked for with
+// samples=true.
+func (s *Server) apiListDives(w http.ResponseWriter, r *http.Request) {
+	samples, _ := strconv.ParseBool(r.URL.Query().Get("samples"))
+	if dives, ok := s.filtered(w, r, samples); ok {
+		respond(w, r, dives)
+	}
+}
+
+// etag returns the entity tag of the current contents of v, a dive, site
+// or item.
+func etag(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// matches reports whether an If-Match or If-None-Match header lists tag.
+func matches(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// apiLookup returns the dive named by the request's path, or writes the
+// error response and returns nil.
+func (s *Server) apiLookup(w http.ResponseWriter, r *http.Request) *divelog.Dive {
+	n, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || n <= 0 {
+		apiFail(w, http.StatusNotFound, "invalid dive number %q", r.PathValue("number"))
+		return nil
+	}
+	d, err := s.store.Get(n)
+	if errors.Is(err, store.ErrNotFound) {
+		apiFail(w, http.StatusNotFound, "no dive #%d", n)
+		return nil
+	}
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return nil
+	}
+	return d
+}
+
+// precondition checks that a request changing v, named what in errors,
+// names its current version in If-Match, writing the error response if
+// not.
+func precondition(w http.ResponseWriter, r *http.Request, v any, what string) bool {
+	h := r.Header.Get("If-Match")
+	switch {
+	case h == "":
+		apiFail(w, http.StatusPreconditionRequired, "send the ETag of %s in If-Match", what)
+		return false
+	case !matches(h, etag(v)):
+		w.Header().Set("ETag", etag(v))
+		apiFail(w, http.StatusPreconditionFailed, "%s has changed", what)
+		return false
+	}
+	return true
+}
+
+// force reports whether r asks for a change to go ahead even though it
+// breaks signatures.
+func force(r *http.Request) bool {
+	f, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	return f
+}
+
+// keepsSignatures checks that replacing old with d, or deleting old if d
+// is nil, leaves the signatures that verify on old good, unless r asks to
+// force the change. It writes the 409 response if not.
+func keepsSignatures(w http.ResponseWriter, r *http.Request, old, d *divelog.Dive) bool {
+	if force(r) {
+		return true
+	}
+	var broken []string
+	for i := range old.Signatures {
+		sig := &old.Signatures[i]
+		if sign.Verify(old, sig) == nil && (d == nil || sign.Verify(d, sig) != nil) {
+			broken = append(broken, sig.Signer)
+		}
+	}
+	if len(broken) == 0 {
+		return true
+	}
+	apiFail(w, http.StatusConflict, "the change invalidates the signatures of %s on dive #%d; send force=true to make it anyway",
+		strings.Join(broken, ", "), old.Number)
+	return false
+}
+
+// decode decodes r's body into v, a kind of value named what in errors.
+func decode(w http.ResponseWriter, r *http.Request, v any, what string) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %v", what, err)
+	}
+	return nil
+}
+
+// readDive decodes and validates the dive in r's body.
+func readDive(w http.ResponseWriter, r *http.Request) (*divelog.Dive, error) {
+	var d divelog.Dive
+	if err := decode(w, r, &d, "dive"); err != nil {
+		return nil, err
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// writeTagged writes v with its ETag.
+func writeTagged(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("ETag", etag(v))
+	writeJSON(w, status, v)
+}
+
+// serveTagged writes v, or 304 Not Modified if r's If-None-Match shows
+// the client already has it.
+func serveTagged(w http.ResponseWriter, r *http.Request, v any) {
+	if tag := etag(v); matches(r.Header.Get("If-None-Match"), tag) {
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeTagged(w, http.StatusOK, v)
+}
+
+func (s *Server) apiGetDive(w http.ResponseWriter, r *http.Request) {
+	if d := s.apiLookup(w, r); d != nil {
+		serveTagged(w, r, d)
+	}
+}
+
+func (s *Server) apiCreateDive(w http.ResponseWriter, r *http.Request) {
+	d, err := readDive(w, r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if d.Number != 0 {
+		apiFail(w, http.StatusBadRequest, "new dives are numbered by the log; leave number out")
+		return
+	}
+	if err := sites.PutDive(s.store, d); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/dives/%d", d.Number))
+	writeTagged(w, http.StatusCreated, d)
+}
+
+// apiPutDive replaces a dive. The number in the body, if any, must be the
+// one in the path.
+func (s *Server) apiPutDive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.apiLookup(w, r)
+	if old == nil || !precondition(w, r, old, fmt.Sprintf("dive #%d", old.Number)) {
+		return
+	}
+	d, err := readDive(w, r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if d.Number != 0 && d.Number != old.Number {
+		apiFail(w, http.StatusBadRequest, "dive numbers cannot be changed")
+		return
+	}
+	d.Number = old.Number
+	// Check the dive as it will be saved, with its site linked.
+	if reg, ok := s.store.(store.SiteRegistry); ok {
+		if err := sites.Link(reg, d); err != nil {
+			apiFail(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+	}
+	if !keepsSignatures(w, r, old, d) {
+		return
+	}
+	if err := s.store.Put(d); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	writeTagged(w, http.StatusOK, d)
+}
+
+func (s *Server) apiDeleteDive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.apiLookup(w, r)
+	if d == nil || !precondition(w, r, d, fmt.Sprintf("dive #%d", d.Number)) || !keepsSignatures(w, r, d, nil) {
+		return
+	}
+	if err := s.store.Delete(d.Number); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiStatistics sums up the dives matching a stats request.
+type apiStatistics struct {
+	Dives       int           `json:"dives"`
+	TotalTime   time.Duration `json:"total_time"`
+	MaxDepth    divelog.Depth `json:"max_depth"`
+	AvgMaxDepth divelog.Depth `json:"avg_max_depth"`
+	DeepestDive int           `json:"deepest_dive,omitempty"`
+	LongestDive int           `json:"longest_dive,omitempty"`
+	FirstDive   *time.Time    `json:"first_dive,omitempty"`
+	LastDive    *time.Time    `json:"last_dive,omitempty"`
+	Sites       int           `json:"sites"`
+
+	// RMV is the mean consumption of the SACDives dives whose tank
+	// pressures allow working it out.
+	RMV      divelog.Volume `json:"rmv,omitempty"`
+	SACDives int            `json:"sac_dives"`
+}
+
+func (s *Server) apiStats(w http.ResponseWriter, r *http.Request) {
+	dives, ok := s.filtered(w, r, false)
+	if !ok {
+		return
+	}
+	var st apiStatistics
+	var longest time.Duration
+	for _, d := range dives {
+		st.Dives++
+		st.TotalTime += d.Duration
+		st.AvgMaxDepth += d.MaxDepth
+		if d.MaxDepth > st.MaxDepth {
+			st.MaxDepth, st.DeepestDive = d.MaxDepth, d.Number
+		}
+		if d.Duration > longest {
+			longest, st.LongestDive = d.Duration, d.Number
+		}
+		if st.FirstDive == nil || d.Start.Before(*st.FirstDive) {
+			st.FirstDive = &d.Start
+		}
+		if st.LastDive == nil || d.Start.After(*st.LastDive) {
+			st.LastDive = &d.Start
+		}
+		if c, err := gas.DiveConsumption(d); err == nil {
+			st.RMV += c.RMV
+			st.SACDives++
+		}
+	}
+	if st.Dives > 0 {
+		st.AvgMaxDepth /= divelog.Depth(st.Dives)
+	}
+	if st.SACDives > 0 {
+		st.RMV /= divelog.Volume(st.SACDives)
+	}
+	st.Sites = len(summarizeSites(dives))
+	writeJSON(w, http.StatusOK, st)
+}
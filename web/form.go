@@ -0,0 +1,250 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+)
+
+// dateTimeLayout is the value format of an HTML datetime-local input.
+const dateTimeLayout = "2006-01-02T15:04"
+
+// diveForm is the edit form's fields as entered, so that a form that fails
+// to save can be shown again as it was. Values are in the server's unit
+// system; an empty field clears the value.
+type diveForm struct {
+	Date     string
+	Duration string // minutes
+	Depth    string
+	AvgDepth string
+	Temp     string
+	Site     string
+	Lat, Lon string
+	Buddies  string // comma separated
+	Gas      string
+	Volume   string // water capacity, or rated capacity in imperial units
+	Working  string // working pressure
+	StartP   string
+	EndP     string
+	Tags     string // comma separated
+	Rating   string
+	Notes    string
+}
+
+// formFor fills a form from d.
+func formFor(d *divelog.Dive, u divelog.UnitSystem) diveForm {
+	num := func(v float64, prec int) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	}
+	f := diveForm{
+		Duration: num(d.Duration.Minutes(), -1),
+		Depth:    num(u.DepthValue(d.MaxDepth), 1),
+		AvgDepth: num(u.DepthValue(d.AvgDepth), 1),
+		Tags:     strings.Join(d.Tags, ", "),
+		Rating:   strconv.Itoa(d.Rating),
+		Notes:    d.Notes,
+	}
+	if !d.Start.IsZero() {
+		f.Date = d.Start.Format(dateTimeLayout)
+	}
+	if d.MinTemperature != 0 {
+		f.Temp = strconv.FormatFloat(u.TemperatureValue(d.MinTemperature), 'f', 1, 64)
+	}
+	if d.Site != nil {
+		f.Site = d.Site.Name
+		if c := d.Site.Coords; c != nil {
+			f.Lat, f.Lon = strconv.FormatFloat(c.Lat, 'f', -1, 64), strconv.FormatFloat(c.Lon, 'f', -1, 64)
+		}
+	}
+	var names []string
+	for _, b := range d.Buddies {
+		names = append(names, b.Name)
+	}
+	f.Buddies = strings.Join(names, ", ")
+	if len(d.Tanks) > 0 {
+		t := d.Tanks[0]
+		f.Gas = t.Gas.String()
+		if u == divelog.Imperial && t.RatedCapacity() != 0 {
+			f.Volume = num(u.VolumeValue(t.RatedCapacity()), 1)
+		} else {
+			f.Volume = num(u.VolumeValue(t.Volume), 1)
+		}
+		f.Working = num(u.PressureValue(t.WorkingPressure), 0)
+		f.StartP = num(u.PressureValue(t.StartPressure), 0)
+		f.EndP = num(u.PressureValue(t.EndPressure), 0)
+	}
+	return f
+}
+
+// readForm reads the form posted with r.
+func readForm(r *http.Request) diveForm {
+	v := func(name string) string { return strings.TrimSpace(r.PostFormValue(name)) }
+	return diveForm{
+		Date:     v("date"),
+		Duration: v("duration"),
+		Depth:    v("depth"),
+		AvgDepth: v("avg_depth"),
+		Temp:     v("temp"),
+		Site:     v("site"),
+		Lat:      v("lat"),
+		Lon:      v("lon"),
+		Buddies:  v("buddies"),
+		Gas:      v("gas"),
+		Volume:   v("volume"),
+		Working:  v("working_pressure"),
+		StartP:   v("start_pressure"),
+		EndP:     v("end_pressure"),
+		Tags:     v("tags"),
+		Rating:   v("rating"),
+		Notes:    r.PostFormValue("notes"),
+	}
+}
+
+// apply sets d's fields from the form. Fields the form does not show, such
+// as the profile and any tanks after the first, are left alone, and so are
+// numbers the form shows rounded unless they were changed.
+func (f diveForm) apply(d *divelog.Dive, u divelog.UnitSystem) error {
+	was := formFor(d, u)
+	var errs []error
+	number := func(label, s string) float64 {
+		if s == "" {
+			return 0
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q is not a number", label, s))
+		}
+		return v
+	}
+
+	loc := time.Local
+	if !d.Start.IsZero() {
+		loc = d.Start.Location()
+	}
+	if t, err := time.ParseInLocation(dateTimeLayout, f.Date, loc); err != nil {
+		errs = append(errs, fmt.Errorf("date: want YYYY-MM-DDTHH:MM, not %q", f.Date))
+	} else if !t.Equal(d.Start.Truncate(time.Minute)) {
+		// Keep the seconds a dive computer recorded unless the time was
+		// changed.
+		d.Start = t
+	}
+	if f.Duration != was.Duration {
+		d.Duration = time.Duration(number("duration", f.Duration) * float64(time.Minute)).Round(time.Second)
+	}
+	if f.Depth != was.Depth {
+		d.MaxDepth = u.Depth(number("max depth", f.Depth))
+	}
+	if f.AvgDepth != was.AvgDepth {
+		d.AvgDepth = u.Depth(number("average depth", f.AvgDepth))
+	}
+	if f.Temp != was.Temp {
+		// Zero is no temperature, not zero kelvin.
+		d.MinTemperature = 0
+		if f.Temp != "" {
+			d.MinTemperature = u.Temperature(number("water temperature", f.Temp))
+		}
+	}
+
+	switch {
+	case f.Site == "":
+		d.Site = nil
+	case d.Site == nil:
+		d.Site = &divelog.Site{Name: f.Site}
+	default:
+		d.Site.Name = f.Site
+	}
+	if f.Lat != "" || f.Lon != "" {
+		c := divelog.Coordinates{Lat: number("latitude", f.Lat), Lon: number("longitude", f.Lon)}
+		if err := c.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if d.Site == nil {
+			errs = append(errs, errors.New("coordinates need a site name"))
+		} else {
+			d.Site.Coords = &c
+		}
+	} else if d.Site != nil {
+		d.Site.Coords = nil
+	}
+
+	// Keep the roles of buddies already on the dive.
+	roles := map[string]string{}
+	for _, b := range d.Buddies {
+		roles[b.Name] = b.Role
+	}
+	d.Buddies = nil
+	for _, name := range splitList(f.Buddies) {
+		d.Buddies = append(d.Buddies, divelog.Buddy{Name: name, Role: roles[name]})
+	}
+	d.Tags = splitList(f.Tags)
+
+	if f.Gas != "" || f.Volume != "" || f.Working != "" || f.StartP != "" || f.EndP != "" || len(d.Tanks) > 0 {
+		if len(d.Tanks) == 0 {
+			d.Tanks = append(d.Tanks, divelog.Tank{Gas: divelog.Air})
+		}
+		t := &d.Tanks[0]
+		switch m, err := divelog.ParseGasMix(f.Gas); {
+		case f.Gas == was.Gas:
+		case f.Gas == "":
+			t.Gas = divelog.Air
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			t.Gas = m
+		}
+		if f.Working != was.Working {
+			t.WorkingPressure = u.Pressure(number("working pressure", f.Working))
+		}
+		if f.StartP != was.StartP {
+			t.StartPressure = u.Pressure(number("start pressure", f.StartP))
+		}
+		if f.EndP != was.EndP {
+			t.EndPressure = u.Pressure(number("end pressure", f.EndP))
+		}
+		if volume := number("tank size", f.Volume); f.Volume != was.Volume {
+			switch {
+			case u == divelog.Imperial && volume != 0 && t.WorkingPressure == 0:
+				errs = append(errs, errors.New("a tank size in cuft needs a working pressure"))
+			case u == divelog.Imperial && volume != 0:
+				// Imperial cylinders are sold by the gas they hold when
+				// full.
+				t.Volume = divelog.ImperialCylinder(divelog.CubicFeet(volume), t.WorkingPressure)
+			default:
+				t.Volume = u.Volume(volume)
+			}
+		}
+	}
+
+	if f.Rating == "" {
+		d.Rating = 0
+	} else if r, err := strconv.Atoi(f.Rating); err != nil || r < 0 || r > 5 {
+		errs = append(errs, fmt.Errorf("rating: want 0 to 5, not %q", f.Rating))
+	} else {
+		d.Rating = r
+	}
+	d.Notes = strings.TrimSpace(strings.ReplaceAll(f.Notes, "\r\n", "\n"))
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return d.Validate()
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,262 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/betonavab/divelog"
+)
+
+// unitDocs describe the unit types of the log's JSON form.
+var unitDocs = map[reflect.Type]string{
+	reflect.TypeFor[divelog.Depth]():       "metres",
+	reflect.TypeFor[divelog.Pressure]():    "pascals, absolute; 0 when not recorded",
+	reflect.TypeFor[divelog.Temperature](): "kelvin; 0 when not recorded",
+	reflect.TypeFor[divelog.Volume]():      "cubic metres",
+	reflect.TypeFor[divelog.Salinity]():    "water density in kg/m³",
+	reflect.TypeFor[time.Duration]():       "nanoseconds",
+}
+
+// schemas collects the OpenAPI schemas of the types the API exchanges,
+// by name.
+type schemas map[string]any
+
+// of returns the schema of values of type t, adding the schemas of the
+// structs it uses to c and referring to them.
+func (c schemas) of(t reflect.Type) map[string]any {
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return c.of(t.Elem())
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": c.of(t.Elem())}
+	case reflect.Struct:
+		name := []rune(t.Name())
+		name[0] = unicode.ToUpper(name[0])
+		if _, ok := c[string(name)]; !ok {
+			c[string(name)] = nil // for types that refer to themselves
+			c[string(name)] = c.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + string(name)}
+	}
+	s := map[string]any{}
+	switch t.Kind() {
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Float32, reflect.Float64:
+		s["type"] = "number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s["type"] = "integer"
+	}
+	if doc, ok := unitDocs[t]; ok {
+		s["description"] = doc
+	}
+	return s
+}
+
+// object returns the schema of a struct from its fields' JSON names,
+// folding in embedded structs as encoding/json does.
+func (c schemas) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			switch {
+			case name == "-", !f.IsExported() && !f.Anonymous:
+				continue
+			case f.Anonymous && name == "":
+				add(f.Type)
+				continue
+			case name == "":
+				name = f.Name
+			}
+			props[name] = c.of(f.Type)
+		}
+	}
+	add(t)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// listOf returns the schema of a page of an API list of items.
+func (c schemas) listOf(item reflect.Type) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"items":  map[string]any{"type": "array", "items": c.of(item)},
+			"total":  map[string]any{"type": "integer", "description": "items in all pages"},
+			"offset": map[string]any{"type": "integer"},
+			"limit":  map[string]any{"type": "integer"},
+			"next":   map[string]any{"type": "string", "description": "URL of the next page, absent on the last"},
+		},
+	}
+}
+
+// openAPI returns the OpenAPI 3 description of the API, with schemas
+// generated from the Go types it sends and receives.
+func (s *Server) openAPI() map[string]any {
+	c := schemas{}
+	dive := c.of(reflect.TypeFor[divelog.Dive]())
+	failure := c.of(reflect.TypeFor[apiError]())
+
+	param := func(name, in, doc string, typ string) map[string]any {
+		return map[string]any{"name": name, "in": in, "description": doc, "schema": map[string]any{"type": typ},
+			"required": in == "path"}
+	}
+	number := param("number", "path", "dive number", "integer")
+	siteID := param("id", "path", "site ID", "integer")
+	itemID := param("id", "path", "item ID", "integer")
+	forced := param("force", "query", "make the change even if it breaks signatures", "boolean")
+	ifNoneMatch := param("If-None-Match", "header", "an ETag the client already has", "string")
+	filters := []any{
+		param("from", "query", "only dives starting on or after this date (YYYY-MM-DD) or RFC 3339 time", "string"),
+		param("to", "query", "only dives starting on or before this date, or before this RFC 3339 time", "string"),
+		param("site", "query", "only dives at sites whose name contains this, ignoring case", "string"),
+		param("min_depth", "query", "only dives at least this deep, in metres", "number"),
+		param("max_depth", "query", "only dives at most this deep, in metres", "number"),
+	}
+	paged := append([]any{
+		param("offset", "query", "items to skip", "integer"),
+		param("limit", "query", "items per page, 1 to 500; default 50", "integer"),
+	}, filters...)
+	ifMatch := param("If-Match", "header", "the current ETag, from the response that returned it", "string")
+	ifMatch["required"] = true
+
+	content := func(schema any) map[string]any {
+		return map[string]any{"application/json": map[string]any{"schema": schema}}
+	}
+	reply := func(doc string, schema any) map[string]any {
+		r := map[string]any{"description": doc}
+		if schema != nil {
+			r["content"] = content(schema)
+		}
+		return r
+	}
+	fail := func(doc string) map[string]any { return reply(doc, failure) }
+	withETag := func(r map[string]any) map[string]any {
+		r["headers"] = map[string]any{"ETag": map[string]any{"schema": map[string]any{"type": "string"}}}
+		return r
+	}
+	op := func(id, summary string, params []any, responses map[string]any) map[string]any {
+		o := map[string]any{"operationId": id, "summary": summary, "responses": responses}
+		if len(params) > 0 {
+			o["parameters"] = params
+		}
+		return o
+	}
+	withBody := func(o map[string]any, schema any) map[string]any {
+		o["requestBody"] = map[string]any{"required": true, "content": content(schema)}
+		return o
+	}
+	site := c.of(reflect.TypeFor[divelog.Site]())
+	item := c.of(reflect.TypeFor[divelog.Item]())
+	changed := fail("changed since the ETag was issued")
+	noIfMatch := fail("If-Match is missing")
+	broken := fail("the change would break signatures; send force=true to make it anyway")
+	noRegistry := fail("the log keeps no site registry")
+	noInventory := fail("the log keeps no equipment inventory")
+
+	paths := map[string]any{
+		"/dives": map[string]any{
+			"get": op("listDives", "List dives by number, without their samples unless asked for",
+				slices.Concat(paged, []any{param("samples", "query", "include the dives' profiles", "boolean")}),
+				map[string]any{"200": reply("a page of dives", c.listOf(reflect.TypeFor[divelog.Dive]())), "400": fail("invalid parameters")}),
+			"post": withBody(op("createDive", "Add a dive; the log gives it the next number", nil,
+				map[string]any{"201": withETag(reply("the dive as saved", dive)), "400": fail("invalid dive")}), dive),
+		},
+		"/dives/{number}": map[string]any{
+			"get": op("getDive", "Get a dive with its profile",
+				[]any{number, ifNoneMatch},
+				map[string]any{"200": withETag(reply("the dive", dive)), "304": reply("the dive has not changed", nil),
+					"404": fail("no such dive")}),
+			"put": withBody(op("updateDive", "Replace a dive", []any{number, ifMatch, forced},
+				map[string]any{"200": withETag(reply("the dive as saved", dive)), "400": fail("invalid dive"),
+					"404": fail("no such dive"), "409": broken, "412": changed, "428": noIfMatch}), dive),
+			"delete": op("deleteDive", "Delete a dive", []any{number, ifMatch, forced},
+				map[string]any{"204": reply("deleted", nil), "404": fail("no such dive"), "409": broken, "412": changed,
+					"428": noIfMatch}),
+		},
+		"/sites": map[string]any{
+			"get": op("listSites", "List the registered sites by ID with the matching dives at each; "+
+				"with dive filters, only the sites of the matching dives", paged,
+				map[string]any{"200": reply("a page of sites", c.listOf(reflect.TypeFor[registeredSite]())),
+					"400": fail("invalid parameters"), "501": noRegistry}),
+			"post": withBody(op("createSite", "Register a site; the log gives it the next ID", nil,
+				map[string]any{"201": withETag(reply("the site as saved", site)), "400": fail("invalid site"),
+					"501": noRegistry}), site),
+		},
+		"/sites/{id}": map[string]any{
+			"get": op("getSite", "Get a registered site", []any{siteID, ifNoneMatch},
+				map[string]any{"200": withETag(reply("the site", site)), "304": reply("the site has not changed", nil),
+					"404": fail("no such site"), "501": noRegistry}),
+			"put": withBody(op("updateSite", "Replace a site and the copies of it the dives at it carry",
+				[]any{siteID, ifMatch, forced},
+				map[string]any{"200": withETag(reply("the site as saved", site)), "400": fail("invalid site"),
+					"404": fail("no such site"), "409": broken, "412": changed,
+					"428": noIfMatch, "501": noRegistry}), site),
+			"delete": op("deleteSite", "Remove a site no dive is at", []any{siteID, ifMatch},
+				map[string]any{"204": reply("deleted", nil), "404": fail("no such site"), "409": fail("dives are at the site"),
+					"412": changed, "428": noIfMatch, "501": noRegistry}),
+		},
+		"/equipment": map[string]any{
+			"get": op("listEquipment", "List the inventory by ID with the matching dives each item was used on; "+
+				"with dive filters, only the items used on the matching dives", paged,
+				map[string]any{"200": reply("a page of items", c.listOf(reflect.TypeFor[inventoryItem]())),
+					"400": fail("invalid parameters"), "501": noInventory}),
+			"post": withBody(op("createItem", "Add an item to the inventory; the log gives it the next ID", nil,
+				map[string]any{"201": withETag(reply("the item as saved", item)), "400": fail("invalid item"),
+					"501": noInventory}), item),
+		},
+		"/equipment/{id}": map[string]any{
+			"get": op("getItem", "Get an inventory item", []any{itemID, ifNoneMatch},
+				map[string]any{"200": withETag(reply("the item", item)), "304": reply("the item has not changed", nil),
+					"404": fail("no such item"), "501": noInventory}),
+			"put": withBody(op("updateItem", "Replace an item and its record on the dives it was used on",
+				[]any{itemID, ifMatch, forced},
+				map[string]any{"200": withETag(reply("the item as saved", item)), "400": fail("invalid item"),
+					"404": fail("no such item"), "409": broken, "412": changed,
+					"428": noIfMatch, "501": noInventory}), item),
+			"delete": op("deleteItem", "Remove an item from the inventory; dives keep their record of it",
+				[]any{itemID, ifMatch},
+				map[string]any{"204": reply("deleted", nil), "404": fail("no such item"), "412": changed,
+					"428": noIfMatch, "501": noInventory}),
+		},
+		"/stats": map[string]any{
+			"get": op("getStats", "Sum up the matching dives", filters,
+				map[string]any{"200": reply("statistics", c.of(reflect.TypeFor[apiStatistics]())), "400": fail("invalid parameters")}),
+		},
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "divelog",
+			"version": "1",
+			"description": "A dive log. Dives, sites and equipment are exchanged in the log's own JSON form, " +
+				"in SI units with durations in nanoseconds. Changing or deleting one needs its current ETag in If-Match.",
+		},
+		"servers":    []any{map[string]any{"url": "/api/v1"}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": c},
+	}
+	if s.o.Username != "" {
+		doc["components"].(map[string]any)["securitySchemes"] = map[string]any{
+			"basic": map[string]any{"type": "http", "scheme": "basic"},
+		}
+		doc["security"] = []any{map[string]any{"basic": []any{}}}
+	}
+	return doc
+}
+
+func (s *Server) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.openAPI())
+}
@@ -0,0 +1,249 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/gas"
+	"github.com/betonavab/divelog/oxtox"
+	"github.com/betonavab/divelog/render"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+type listPage struct {
+	Title          string
+	Site, From, To string
+	Error          string
+	Dives          []*divelog.Dive
+	Total          time.Duration
+}
+
+// list shows the dives, newest first, filtered by the site, from and to
+// query parameters.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+	p := listPage{Title: "Dives", Site: v.Get("site"), From: v.Get("from"), To: v.Get("to")}
+	q := store.Query{Site: p.Site, OmitSamples: true}
+	var err error
+	if p.From != "" {
+		q.From, err = time.ParseInLocation(time.DateOnly, p.From, time.Local)
+	}
+	if err == nil && p.To != "" {
+		if q.To, err = time.ParseInLocation(time.DateOnly, p.To, time.Local); err == nil {
+			q.To = q.To.AddDate(0, 0, 1) // include the whole day
+		}
+	}
+	if err != nil {
+		p.Error = "Dates are written YYYY-MM-DD."
+		s.page(w, http.StatusBadRequest, "list", p)
+		return
+	}
+	if p.Dives, err = s.store.Query(q); err != nil {
+		s.fail(w, err)
+		return
+	}
+	slices.Reverse(p.Dives)
+	for _, d := range p.Dives {
+		p.Total += d.Duration
+	}
+	s.page(w, http.StatusOK, "list", p)
+}
+
+type divePage struct {
+	Title       string
+	Dive        *divelog.Dive
+	Tanks       []string
+	Consumption *gas.Consumption
+	Oxygen      oxtox.Status
+	Signatures  []signatureRow
+	Prev, Next  int
+}
+
+// signatureRow is a dive signature and whether it still matches the dive.
+type signatureRow struct {
+	*divelog.Signature
+	Fingerprint string
+	Valid       bool
+}
+
+func (s *Server) dive(w http.ResponseWriter, r *http.Request) {
+	d := s.lookup(w, r)
+	if d == nil {
+		return
+	}
+	p := divePage{Title: fmt.Sprintf("Dive #%d", d.Number), Dive: d}
+	for _, t := range d.Tanks {
+		p.Tanks = append(p.Tanks, describeTank(t, s.o.Units))
+	}
+	if c, err := gas.DiveConsumption(d); err == nil {
+		p.Consumption = &c
+	}
+	for i := range d.Signatures {
+		sig := &d.Signatures[i]
+		p.Signatures = append(p.Signatures, signatureRow{sig, sign.Fingerprint(sig.PublicKey), sign.Verify(d, sig) == nil})
+	}
+
+	// Oxygen loading carries over from the dives of the trip before this
+	// one.
+	earlier, err := store.Before(s.store, d.Start, oxtox.TripBreak)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	p.Oxygen, _ = oxtox.Find(oxtox.Track(earlier), d.Number)
+
+	all, err := s.store.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	for _, o := range all {
+		if o.Number < d.Number {
+			p.Prev = o.Number
+		}
+		if o.Number > d.Number && p.Next == 0 {
+			p.Next = o.Number
+		}
+	}
+	s.page(w, http.StatusOK, "dive", p)
+}
+
+// describeTank sums up a tank the way divelog show does.
+func describeTank(t divelog.Tank, u divelog.UnitSystem) string {
+	desc := t.Gas.String()
+	switch {
+	case u == divelog.Imperial && t.RatedCapacity() != 0:
+		desc = u.FormatVolume(t.RatedCapacity()) + " " + desc
+	case t.Volume != 0:
+		desc = u.FormatVolume(t.Volume) + " " + desc
+	}
+	if t.StartPressure != 0 || t.EndPressure != 0 {
+		desc += fmt.Sprintf(", %s → %s", u.FormatPressure(t.StartPressure), u.FormatPressure(t.EndPressure))
+	}
+	return desc
+}
+
+// profile serves a dive's profile chart as SVG or PNG, by the extension
+// of the path.
+func (s *Server) profile(w http.ResponseWriter, r *http.Request) {
+	d := s.lookup(w, r)
+	if d == nil {
+		return
+	}
+	draw, contentType := render.SVG, "image/svg+xml"
+	if strings.HasSuffix(r.URL.Path, ".png") {
+		draw, contentType = render.PNG, "image/png"
+	}
+	var buf bytes.Buffer
+	err := draw(&buf, d, render.Options{Units: s.o.Units, Ceiling: true})
+	if errors.Is(err, render.ErrNoProfile) {
+		http.Error(w, fmt.Sprintf("dive #%d has no profile", d.Number), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	buf.WriteTo(w)
+}
+
+type editPage struct {
+	Title  string
+	Action string
+	Number int // zero for a new dive
+	Form   diveForm
+	Units  divelog.UnitSystem
+	Error  string
+
+	// ETag is the version of the dive the form was filled from.
+	ETag string
+}
+
+func (s *Server) newDive(w http.ResponseWriter, r *http.Request) {
+	f := diveForm{Date: time.Now().Truncate(time.Minute).Format(dateTimeLayout), Rating: "0"}
+	s.page(w, http.StatusOK, "edit", editPage{Title: "New dive", Action: "/dives/new", Form: f, Units: s.o.Units})
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	f := readForm(r)
+	d := &divelog.Dive{}
+	if err := f.apply(d, s.o.Units); err != nil {
+		s.page(w, http.StatusBadRequest, "edit", editPage{Title: "New dive", Action: "/dives/new",
+			Form: f, Units: s.o.Units, Error: err.Error()})
+		return
+	}
+	if err := sites.PutDive(s.store, d); err != nil {
+		s.fail(w, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/dives/%d", d.Number), http.StatusSeeOther)
+}
+
+func (s *Server) editDive(w http.ResponseWriter, r *http.Request) {
+	d := s.lookup(w, r)
+	if d == nil {
+		return
+	}
+	s.page(w, http.StatusOK, "edit", s.editPage(d, formFor(d, s.o.Units)))
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.lookup(w, r)
+	if d == nil {
+		return
+	}
+	f := readForm(r)
+	if tag := r.PostFormValue("etag"); tag != "" && tag != etag(d) {
+		p := s.editPage(d, formFor(d, s.o.Units))
+		p.Error = "The dive was changed while you were editing it. This is the changed dive; make your edits again."
+		s.page(w, http.StatusConflict, "edit", p)
+		return
+	}
+	if err := f.apply(d, s.o.Units); err != nil {
+		p := s.editPage(d, f)
+		p.Error = err.Error()
+		s.page(w, http.StatusBadRequest, "edit", p)
+		return
+	}
+	if err := sites.PutDive(s.store, d); err != nil {
+		s.fail(w, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/dives/%d", d.Number), http.StatusSeeOther)
+}
+
+func (s *Server) editPage(d *divelog.Dive, f diveForm) editPage {
+	return editPage{
+		Title:  fmt.Sprintf("Edit dive #%d", d.Number),
+		Action: fmt.Sprintf("/dives/%d/edit", d.Number),
+		Number: d.Number,
+		Form:   f,
+		Units:  s.o.Units,
+		ETag:   etag(d),
+	}
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.lookup(w, r)
+	if d == nil {
+		return
+	}
+	if err := s.store.Delete(d.Number); err != nil {
+		s.fail(w, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,427 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/gear"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+// The site registry and equipment inventory of the API are those of the
+// log, for stores that keep them. Changing a site or an item rewrites the
+// copies the dives carry, as divelog sites edit and gear edit do, and is
+// refused with 409 Conflict if that would break a signature, unless the
+// request asks for it with force=true.
+
+// registeredSite is a registered site as the API lists it, with the
+// matching dives at it.
+type registeredSite struct {
+	divelog.Site
+	Dives    int        `json:"dives"`
+	LastDive *time.Time `json:"last_dive,omitempty"`
+}
+
+// inventoryItem is an inventory item as the API lists it, with the
+// matching dives it was used on.
+type inventoryItem struct {
+	divelog.Item
+	Dives     int        `json:"dives"`
+	FirstUsed *time.Time `json:"first_used,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// filters reports whether r restricts the dives an API list counts.
+func filters(r *http.Request) bool {
+	v := r.URL.Query()
+	for _, name := range []string{"from", "to", "site", "min_depth", "max_depth"} {
+		if v.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pathID returns the ID in the request's path, or writes the error
+// response and returns false.
+func pathID(w http.ResponseWriter, r *http.Request, what string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		apiFail(w, http.StatusNotFound, "invalid %s ID %q", what, r.PathValue("id"))
+		return 0, false
+	}
+	return id, true
+}
+
+// checkSigned writes the 409 response and returns false if a change that
+// rewrites the dives rewrites reports would break signatures that verify,
+// unless r asks to force it.
+func (s *Server) checkSigned(w http.ResponseWriter, r *http.Request, rewrites func(d *divelog.Dive) bool) bool {
+	if force(r) {
+		return true
+	}
+	dives, err := s.store.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return false
+	}
+	var signed []string
+	for _, d := range dives {
+		if len(d.Signatures) == 0 || !rewrites(d) {
+			continue
+		}
+		// Signatures cover the profile, so verify the dive in full.
+		full, err := s.store.Get(d.Number)
+		if err != nil {
+			apiFail(w, http.StatusInternalServerError, "%v", err)
+			return false
+		}
+		for i := range full.Signatures {
+			if sign.Verify(full, &full.Signatures[i]) == nil {
+				signed = append(signed, fmt.Sprintf("#%d", d.Number))
+				break
+			}
+		}
+	}
+	if len(signed) > 0 {
+		apiFail(w, http.StatusConflict, "the change invalidates the signatures on dives %s; send force=true to make it anyway",
+			strings.Join(signed, ", "))
+		return false
+	}
+	return true
+}
+
+// registry returns the log's site registry, or writes the error response
+// and returns false if it has none.
+func (s *Server) registry(w http.ResponseWriter) (store.SiteRegistry, bool) {
+	reg, ok := s.store.(store.SiteRegistry)
+	if !ok {
+		apiFail(w, http.StatusNotImplemented, "this log has no site registry")
+	}
+	return reg, ok
+}
+
+// apiListSites lists the registered sites by ID. With dive filters, only
+// the sites of the matching dives are listed.
+func (s *Server) apiListSites(w http.ResponseWriter, r *http.Request) {
+	reg, ok := s.registry(w)
+	if !ok {
+		return
+	}
+	dives, ok := s.filtered(w, r, false)
+	if !ok {
+		return
+	}
+	registered, err := reg.Sites()
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	index := map[int]*registeredSite{}
+	listed := []*registeredSite{}
+	for _, site := range registered {
+		rs := &registeredSite{Site: *site}
+		index[site.ID] = rs
+		listed = append(listed, rs)
+	}
+	for _, d := range dives {
+		if d.Site == nil || index[d.Site.ID] == nil {
+			continue
+		}
+		rs := index[d.Site.ID]
+		rs.Dives++
+		if rs.LastDive == nil || d.Start.After(*rs.LastDive) {
+			rs.LastDive = &d.Start
+		}
+	}
+	if filters(r) {
+		var used []*registeredSite
+		for _, rs := range listed {
+			if rs.Dives > 0 {
+				used = append(used, rs)
+			}
+		}
+		listed = used
+	}
+	respond(w, r, listed)
+}
+
+// apiLookupSite returns the site named by the request's path, or writes
+// the error response and returns nil.
+func (s *Server) apiLookupSite(w http.ResponseWriter, r *http.Request) (store.SiteRegistry, *divelog.Site) {
+	reg, ok := s.registry(w)
+	if !ok {
+		return nil, nil
+	}
+	id, ok := pathID(w, r, "site")
+	if !ok {
+		return nil, nil
+	}
+	site, err := reg.GetSite(id)
+	if errors.Is(err, store.ErrSiteNotFound) {
+		apiFail(w, http.StatusNotFound, "no site %d", id)
+		return nil, nil
+	}
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return nil, nil
+	}
+	return reg, site
+}
+
+// readSite decodes and validates the site in r's body.
+func readSite(w http.ResponseWriter, r *http.Request) (*divelog.Site, error) {
+	var site divelog.Site
+	if err := decode(w, r, &site, "site"); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(site.Name) == "" {
+		return nil, errors.New("a site needs a name")
+	}
+	if err := site.Validate(); err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+func (s *Server) apiGetSite(w http.ResponseWriter, r *http.Request) {
+	if _, site := s.apiLookupSite(w, r); site != nil {
+		serveTagged(w, r, site)
+	}
+}
+
+func (s *Server) apiCreateSite(w http.ResponseWriter, r *http.Request) {
+	reg, ok := s.registry(w)
+	if !ok {
+		return
+	}
+	site, err := readSite(w, r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if site.ID != 0 {
+		apiFail(w, http.StatusBadRequest, "new sites are numbered by the log; leave id out")
+		return
+	}
+	if err := reg.PutSite(site); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/sites/%d", site.ID))
+	writeTagged(w, http.StatusCreated, site)
+}
+
+// apiPutSite replaces a site and the copies of it the dives at it carry.
+func (s *Server) apiPutSite(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, old := s.apiLookupSite(w, r)
+	if old == nil || !precondition(w, r, old, fmt.Sprintf("site %d", old.ID)) {
+		return
+	}
+	site, err := readSite(w, r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if site.ID != 0 && site.ID != old.ID {
+		apiFail(w, http.StatusBadRequest, "site IDs cannot be changed")
+		return
+	}
+	site.ID = old.ID
+	if !s.checkSigned(w, r, func(d *divelog.Dive) bool { return sites.Relinks(d, site, site.ID) }) {
+		return
+	}
+	if _, err := sites.Update(s.store, site); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	writeTagged(w, http.StatusOK, site)
+}
+
+// apiDeleteSite removes a site no dive is at.
+func (s *Server) apiDeleteSite(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reg, site := s.apiLookupSite(w, r)
+	if site == nil || !precondition(w, r, site, fmt.Sprintf("site %d", site.ID)) {
+		return
+	}
+	dives, err := s.store.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	n := 0
+	for _, d := range dives {
+		if d.Site != nil && d.Site.ID == site.ID {
+			n++
+		}
+	}
+	if n > 0 {
+		apiFail(w, http.StatusConflict, "%d dives are at site %d; merge it into another site instead", n, site.ID)
+		return
+	}
+	if err := reg.DeleteSite(site.ID); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inventory returns the log's equipment inventory, or writes the error
+// response and returns false if it has none.
+func (s *Server) inventory(w http.ResponseWriter) (store.Inventory, bool) {
+	inv, ok := s.store.(store.Inventory)
+	if !ok {
+		apiFail(w, http.StatusNotImplemented, "this log has no equipment inventory")
+	}
+	return inv, ok
+}
+
+// apiListItems lists the inventory by ID. With dive filters, only the
+// items used on the matching dives are listed.
+func (s *Server) apiListItems(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.inventory(w)
+	if !ok {
+		return
+	}
+	dives, ok := s.filtered(w, r, false)
+	if !ok {
+		return
+	}
+	items, err := inv.Items()
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	usage := gear.Tally(items, dives)
+	listed := []*inventoryItem{}
+	for _, it := range items {
+		u := usage[it.ID]
+		if filters(r) && u.Dives == 0 {
+			continue
+		}
+		ii := &inventoryItem{Item: *it, Dives: u.Dives}
+		if u.Dives > 0 {
+			ii.FirstUsed, ii.LastUsed = &u.First, &u.Last
+		}
+		listed = append(listed, ii)
+	}
+	respond(w, r, listed)
+}
+
+// apiLookupItem returns the item named by the request's path, or writes
+// the error response and returns nil.
+func (s *Server) apiLookupItem(w http.ResponseWriter, r *http.Request) (store.Inventory, *divelog.Item) {
+	inv, ok := s.inventory(w)
+	if !ok {
+		return nil, nil
+	}
+	id, ok := pathID(w, r, "item")
+	if !ok {
+		return nil, nil
+	}
+	it, err := inv.GetItem(id)
+	if errors.Is(err, store.ErrItemNotFound) {
+		apiFail(w, http.StatusNotFound, "no item %d", id)
+		return nil, nil
+	}
+	if err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return nil, nil
+	}
+	return inv, it
+}
+
+// readItem decodes and validates the item in r's body.
+func readItem(w http.ResponseWriter, r *http.Request) (*divelog.Item, error) {
+	var it divelog.Item
+	if err := decode(w, r, &it, "item"); err != nil {
+		return nil, err
+	}
+	if err := it.Validate(); err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+func (s *Server) apiGetItem(w http.ResponseWriter, r *http.Request) {
+	if _, it := s.apiLookupItem(w, r); it != nil {
+		serveTagged(w, r, it)
+	}
+}
+
+func (s *Server) apiCreateItem(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.inventory(w)
+	if !ok {
+		return
+	}
+	it, err := readItem(w, r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if it.ID != 0 {
+		apiFail(w, http.StatusBadRequest, "new items are numbered by the log; leave id out")
+		return
+	}
+	if err := inv.PutItem(it); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/equipment/%d", it.ID))
+	writeTagged(w, http.StatusCreated, it)
+}
+
+// apiPutItem replaces an item and its record on the dives it was used on.
+func (s *Server) apiPutItem(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, old := s.apiLookupItem(w, r)
+	if old == nil || !precondition(w, r, old, fmt.Sprintf("item %d", old.ID)) {
+		return
+	}
+	it, err := readItem(w, r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if it.ID != 0 && it.ID != old.ID {
+		apiFail(w, http.StatusBadRequest, "item IDs cannot be changed")
+		return
+	}
+	it.ID = old.ID
+	if old.Equipment() != it.Equipment() && !s.checkSigned(w, r, func(d *divelog.Dive) bool { return gear.Used(old, d) }) {
+		return
+	}
+	if _, err := gear.Update(s.store, it); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	writeTagged(w, http.StatusOK, it)
+}
+
+// apiDeleteItem removes an item from the inventory. Dives keep their
+// record of it.
+func (s *Server) apiDeleteItem(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, it := s.apiLookupItem(w, r)
+	if it == nil || !precondition(w, r, it, fmt.Sprintf("item %d", it.ID)) {
+		return
+	}
+	if err := inv.DeleteItem(it.ID); err != nil {
+		apiFail(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
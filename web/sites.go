@@ -0,0 +1,185 @@
+package web
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+// siteSummary is a site as the sites page lists it: every dive
+// logged under the same name counts towards one site.
+type siteSummary struct {
+	Name     string               `json:"name"`
+	Coords   *divelog.Coordinates `json:"coords,omitempty"`
+	Dives    int                  `json:"dives"`
+	Last     time.Time            `json:"last_dive"`
+	MaxDepth divelog.Depth        `json:"max_depth"`
+}
+
+// summarizeSites gathers the sites of dives, in order of name.
+func summarizeSites(dives []*divelog.Dive) []*siteSummary {
+	var sites []*siteSummary
+	index := map[string]*siteSummary{}
+	for _, d := range dives {
+		if d.Site == nil || d.Site.Name == "" {
+			continue
+		}
+		site := index[d.Site.Name]
+		if site == nil {
+			site = &siteSummary{Name: d.Site.Name}
+			index[site.Name] = site
+			sites = append(sites, site)
+		}
+		site.Dives++
+		if d.Start.After(site.Last) {
+			site.Last = d.Start
+		}
+		site.MaxDepth = max(site.MaxDepth, d.MaxDepth)
+		if d.Site.Coords != nil {
+			site.Coords = d.Site.Coords
+		}
+	}
+	slices.SortFunc(sites, func(a, b *siteSummary) int { return cmp.Compare(a.Name, b.Name) })
+	return sites
+}
+
+type sitesPage struct {
+	Title    string
+	Sites    []*siteSummary
+	Map      *siteMap
+	Unplaced int // sites without coordinates
+}
+
+func (s *Server) sites(w http.ResponseWriter, r *http.Request) {
+	dives, err := s.store.Query(store.Query{OmitSamples: true})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	p := sitesPage{Title: "Sites", Sites: summarizeSites(dives)}
+	var placed []*siteSummary
+	for _, site := range p.Sites {
+		if site.Coords != nil {
+			placed = append(placed, site)
+		} else {
+			p.Unplaced++
+		}
+	}
+	if len(placed) > 0 {
+		p.Map = plotSites(placed, 800, 450)
+	}
+	s.page(w, http.StatusOK, "sites", p)
+}
+
+// siteMap is a plain plot of sites by latitude and longitude, for drawing
+// as SVG without map tiles.
+type siteMap struct {
+	Width, Height float64
+	Lines         []mapLine
+	Points        []mapPoint
+}
+
+// mapLine is a line of the graticule with its label.
+type mapLine struct {
+	X1, Y1, X2, Y2 float64
+	Label          string
+	LX, LY         float64
+	Anchor         string
+}
+
+type mapPoint struct {
+	X, Y float64
+	Name string
+}
+
+// mapMargin is the space around the plot, in pixels, for labels.
+const mapMargin = 40
+
+// plotSites places sites on a width×height map with an equirectangular
+// projection centred on them, scaled so that distances east and north
+// match at their mean latitude.
+func plotSites(sites []*siteSummary, width, height float64) *siteMap {
+	latMin, latMax := sites[0].Coords.Lat, sites[0].Coords.Lat
+	lonMin, lonMax := sites[0].Coords.Lon, sites[0].Coords.Lon
+	for _, s := range sites[1:] {
+		latMin, latMax = min(latMin, s.Coords.Lat), max(latMax, s.Coords.Lat)
+		lonMin, lonMax = min(lonMin, s.Coords.Lon), max(lonMax, s.Coords.Lon)
+	}
+	// Leave room around the outermost sites, and show at least a few
+	// kilometres around a single one.
+	const minSpan = 0.05
+	pad := func(lo, hi float64) (float64, float64) {
+		p := max((hi-lo)*0.1, (minSpan-(hi-lo))/2, 0)
+		return lo - p, hi + p
+	}
+	latMin, latMax = pad(latMin, latMax)
+	lonMin, lonMax = pad(lonMin, lonMax)
+	latMin, latMax = max(latMin, -90), min(latMax, 90)
+
+	aspect := math.Cos((latMin + latMax) / 2 * math.Pi / 180)
+	inner := func(v float64) float64 { return v - 2*mapMargin }
+	scale := min(inner(width)/((lonMax-lonMin)*aspect), inner(height)/(latMax-latMin))
+	cx, cy := (lonMin+lonMax)/2, (latMin+latMax)/2
+	// Tenths of a pixel are plenty and keep the SVG readable.
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	x := func(lon float64) float64 { return round(width/2 + (lon-cx)*aspect*scale) }
+	y := func(lat float64) float64 { return round(height/2 - (lat-cy)*scale) }
+
+	m := &siteMap{Width: width, Height: height}
+	// The plot may reach past the padded range on its longer side; label
+	// the lines across everything shown.
+	left, right := cx-inner(width)/2/(aspect*scale), cx+inner(width)/2/(aspect*scale)
+	bottom, top := cy-inner(height)/2/scale, cy+inner(height)/2/scale
+	step := gridStep(max(right-left, top-bottom))
+	for lon := math.Ceil(left/step) * step; lon <= right; lon += step {
+		m.Lines = append(m.Lines, mapLine{
+			X1: x(lon), Y1: mapMargin, X2: x(lon), Y2: height - mapMargin,
+			Label: formatDegrees(lon, step, "E", "W"), LX: x(lon), LY: height - mapMargin + 14, Anchor: "middle",
+		})
+	}
+	for lat := math.Ceil(bottom/step) * step; lat <= top; lat += step {
+		m.Lines = append(m.Lines, mapLine{
+			X1: mapMargin, Y1: y(lat), X2: width - mapMargin, Y2: y(lat),
+			Label: formatDegrees(lat, step, "N", "S"), LX: mapMargin - 4, LY: y(lat) + 4, Anchor: "end",
+		})
+	}
+	for _, s := range sites {
+		m.Points = append(m.Points, mapPoint{X: x(s.Coords.Lon), Y: y(s.Coords.Lat), Name: s.Name})
+	}
+	return m
+}
+
+// gridStep returns a graticule spacing in degrees giving a handful of lines
+// across span degrees.
+func gridStep(span float64) float64 {
+	raw := span / 5
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, f := range []float64{1, 2, 5} {
+		if f*mag >= raw {
+			return f * mag
+		}
+	}
+	return 10 * mag
+}
+
+// formatDegrees formats a latitude or longitude with a hemisphere letter
+// and as many decimals as step needs.
+func formatDegrees(v, step float64, pos, neg string) string {
+	decimals := max(0, int(math.Ceil(-math.Log10(step)-1e-9)))
+	hemisphere := pos
+	if v < 0 {
+		hemisphere = neg
+	}
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	if strings.Trim(s, "0.") == "" {
+		return "0°"
+	}
+	return s + "°" + hemisphere
+}
@@ -0,0 +1,188 @@
+// Package web serves a dive log as a small website for browsing and
+// editing it from a browser: the list of dives, a page per dive with its
+// rendered profile, a map of the sites and forms to add and change dives.
+// Programs use the JSON API under /api/v1 instead, described by the
+// OpenAPI document at /api/v1/openapi.json. It uses only the standard
+// library, and its templates and style sheet are embedded, so a server
+// needs nothing beside the binary and the log.
+package web
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/store"
+)
+
+//go:embed templates static
+var assets embed.FS
+
+// Options configure a Server.
+type Options struct {
+	// Units is the unit system values are shown and entered in.
+	Units divelog.UnitSystem
+
+	// Username and Password, when Username is set, are required of every
+	// request with HTTP basic authentication.
+	Username, Password string
+}
+
+// Server is an http.Handler serving a dive log.
+type Server struct {
+	store store.Store
+	o     Options
+	mux   *http.ServeMux
+	pages map[string]*template.Template
+
+	// mu is held from reading a dive to saving it again, so that two
+	// edits cannot both be checked against the same version.
+	mu sync.Mutex
+}
+
+// New returns a server for the log in s. Closing s is left to the caller.
+func New(s store.Store, o Options) *Server {
+	srv := &Server{store: s, o: o, mux: http.NewServeMux(), pages: map[string]*template.Template{}}
+	funcs := template.FuncMap{
+		"depth":       o.Units.FormatDepth,
+		"temperature": o.Units.FormatTemperature,
+		"pressure":    o.Units.FormatPressure,
+		"volume":      o.Units.FormatVolume,
+		"sac": func(p divelog.Pressure) string {
+			return fmt.Sprintf("%.1f %s", o.Units.PressureValue(p), o.Units.PressureUnit())
+		},
+		"duration": formatDuration,
+		"siteName": siteName,
+		"stars":    func(n int) string { return strings.Repeat("★", n) },
+		"ratings":  func() []int { return []int{0, 1, 2, 3, 4, 5} },
+		"inc":      func(i int) int { return i + 1 },
+	}
+	for _, name := range []string{"list", "dive", "edit", "sites"} {
+		srv.pages[name] = template.Must(template.New("layout.html").Funcs(funcs).
+			ParseFS(assets, "templates/layout.html", "templates/"+name+".html"))
+	}
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	srv.mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(static)))
+	srv.mux.HandleFunc("GET /{$}", srv.list)
+	srv.mux.HandleFunc("GET /sites", srv.sites)
+	srv.mux.HandleFunc("GET /dives/new", srv.newDive)
+	srv.mux.HandleFunc("POST /dives/new", srv.create)
+	srv.mux.HandleFunc("GET /dives/{number}", srv.dive)
+	srv.mux.HandleFunc("GET /dives/{number}/profile.svg", srv.profile)
+	srv.mux.HandleFunc("GET /dives/{number}/profile.png", srv.profile)
+	srv.mux.HandleFunc("GET /dives/{number}/edit", srv.editDive)
+	srv.mux.HandleFunc("POST /dives/{number}/edit", srv.update)
+	srv.mux.HandleFunc("POST /dives/{number}/delete", srv.delete)
+	srv.routeAPI()
+	return srv
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.o.Username != "" && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="divelog", charset="UTF-8"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries the configured credentials.
+func (s *Server) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	// Compare both in full so the time taken gives nothing away.
+	u := subtle.ConstantTimeCompare([]byte(user), []byte(s.o.Username))
+	p := subtle.ConstantTimeCompare([]byte(password), []byte(s.o.Password))
+	return ok && u&p == 1
+}
+
+// sameOrigin reports whether a request that changes the log was sent by a
+// page of this server rather than by another site in the same browser.
+// Requests from programs, which send neither header, are let through.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// page renders one of the HTML pages with data.
+func (s *Server) page(w http.ResponseWriter, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := s.pages[name].Execute(&buf, data); err != nil {
+		s.fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// fail reports an error that is not the request's fault.
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// lookup returns the dive named by the request's path, or writes the
+// error response and returns nil.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) *divelog.Dive {
+	n, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || n <= 0 {
+		http.NotFound(w, r)
+		return nil
+	}
+	d, err := s.store.Get(n)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("no dive #%d", n), http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		s.fail(w, err)
+		return nil
+	}
+	return d
+}
+
+// formatDuration formats a dive time as minutes, or minutes and seconds
+// when it is not a whole number of minutes.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%d min", d/time.Minute)
+	}
+	return fmt.Sprintf("%d:%02d min", d/time.Minute, d%time.Minute/time.Second)
+}
+
+func siteName(d *divelog.Dive) string {
+	if d.Site == nil {
+		return ""
+	}
+	return d.Site.Name
+}
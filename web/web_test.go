@@ -0,0 +1,619 @@
+package web
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betonavab/divelog"
+	"github.com/betonavab/divelog/sign"
+	"github.com/betonavab/divelog/sites"
+	"github.com/betonavab/divelog/store"
+)
+
+func testServer(t *testing.T, o Options) (*Server, store.Store) {
+	t.Helper()
+	s := store.NewMemory()
+	dives := []*divelog.Dive{
+		{
+			Start:    time.Date(2024, 5, 1, 9, 30, 12, 0, time.UTC),
+			Duration: 35 * time.Minute,
+			MaxDepth: 30.27,
+			Site:     &divelog.Site{Name: "Blue Hole", Coords: &divelog.Coordinates{Lat: 17.3162, Lon: -87.5348}},
+			Buddies:  []divelog.Buddy{{Name: "Ana", Role: divelog.RoleGuide}},
+			Tanks:    []divelog.Tank{{Gas: divelog.Air, Volume: divelog.Liters(12), StartPressure: divelog.Bar(200), EndPressure: divelog.Bar(62.5)}},
+			Samples: []divelog.Sample{
+				{Time: 0, Depth: 0}, {Time: 5 * time.Minute, Depth: 30.27},
+				{Time: 30 * time.Minute, Depth: 5}, {Time: 35 * time.Minute, Depth: 0},
+			},
+		},
+		{
+			Start:    time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+			Duration: 50 * time.Minute,
+			MaxDepth: 12,
+			Site:     &divelog.Site{Name: "Canyon & Arch"},
+		},
+	}
+	for _, d := range dives {
+		d.Summarize()
+		if err := s.Put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(s, o), s
+}
+
+// get requests path and returns the response's status and body.
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code, w.Body.String()
+}
+
+func post(t *testing.T, h http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestPages(t *testing.T) {
+	srv, _ := testServer(t, Options{})
+	tests := []struct {
+		path   string
+		status int
+		want   []string
+	}{
+		{"/", 200, []string{`<a href="/dives/2">2024-05-02 10:00</a>`, "Canyon &amp; Arch", "30.3 m", "2 dives, 85 min under water."}},
+		{"/?site=blue", 200, []string{"Blue Hole", "1 dive, 35 min"}},
+		{"/?from=2024-05-02&to=2024-05-02", 200, []string{"Canyon"}},
+		{"/?from=May", 400, []string{"Dates are written YYYY-MM-DD."}},
+		{"/dives/1", 200, []string{
+			`<img src="/dives/1/profile.svg"`, "Ana (guide)", "12.0 l air, 200 bar → 62 bar",
+			"RMV", "Max ppO2", `<a href="/dives/2">#2 →</a>`, `<a href="/?site=Blue%20Hole">`,
+		}},
+		{"/dives/2", 200, []string{`<a href="/dives/1">← #1</a>`}},
+		{"/dives/3", 404, []string{"no dive #3"}},
+		{"/dives/x", 404, nil},
+		{"/dives/1/edit", 200, []string{`name="depth" value="30.3"`, `value="2024-05-01T09:30"`, `value="-87.5348"`}},
+		{"/dives/new", 200, []string{`action="/dives/new"`}},
+		{"/sites", 200, []string{"<circle", "<title>Blue Hole</title>", "87.5", "°W", "1 site has no coordinates"}},
+		{"/static/style.css", 200, []string{"svg.map"}},
+	}
+	for _, tt := range tests {
+		status, body := get(t, srv, tt.path)
+		if status != tt.status {
+			t.Errorf("GET %s: status %d, want %d\n%s", tt.path, status, tt.status, body)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s lacks %q:\n%s", tt.path, want, body)
+			}
+		}
+	}
+	if _, body := get(t, srv, "/dives/2"); strings.Contains(body, "<img") {
+		t.Error("dive without samples has a profile image")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	srv, _ := testServer(t, Options{})
+	for path, ctype := range map[string]string{"/dives/1/profile.svg": "image/svg+xml", "/dives/1/profile.png": "image/png"} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 || w.Header().Get("Content-Type") != ctype || w.Body.Len() < 1000 {
+			t.Errorf("GET %s: %d %s, %d bytes", path, w.Code, w.Header().Get("Content-Type"), w.Body.Len())
+		}
+	}
+	if status, _ := get(t, srv, "/dives/2/profile.svg"); status != 404 {
+		t.Errorf("profile of a dive without samples: status %d", status)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	_, page := get(t, srv, "/dives/1/edit")
+	form := url.Values{}
+	for _, name := range []string{"date", "duration", "depth", "avg_depth", "temp", "site", "lat", "lon",
+		"buddies", "gas", "volume", "working_pressure", "start_pressure", "end_pressure", "tags", "rating"} {
+		_, rest, _ := strings.Cut(page, `name="`+name+`" value="`)
+		value, _, _ := strings.Cut(rest, `"`)
+		form.Set(name, value)
+	}
+	form.Set("rating", "4")
+	form.Set("buddies", "Ana, Ben")
+	form.Set("notes", "Sharks\r\nat 25 m")
+
+	w := post(t, srv, "/dives/1/edit", form)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/dives/1" {
+		t.Fatalf("POST edit: %d %s\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	d, _ := s.Get(1)
+	// Fields left as shown keep their full precision.
+	if d.MaxDepth != 30.27 || d.Tanks[0].EndPressure != divelog.Bar(62.5) || d.Start.Second() != 12 {
+		t.Errorf("unchanged fields changed: depth %v, end pressure %v, start %v", d.MaxDepth, d.Tanks[0].EndPressure, d.Start)
+	}
+	if d.Rating != 4 || d.Notes != "Sharks\nat 25 m" || len(d.Buddies) != 2 || d.Buddies[0].Role != divelog.RoleGuide || len(d.Samples) != 4 {
+		t.Errorf("after edit: %+v", d)
+	}
+
+	form.Set("depth", "deep")
+	form.Set("gas", "40/70")
+	w = post(t, srv, "/dives/1/edit", form)
+	if body := w.Body.String(); w.Code != http.StatusBadRequest || !strings.Contains(body, "max depth: &#34;deep&#34; is not a number") ||
+		!strings.Contains(body, `value="40/70"`) {
+		t.Errorf("POST bad edit: %d\n%s", w.Code, body)
+	}
+	if d, _ := s.Get(1); d.MaxDepth != 30.27 {
+		t.Error("a failed edit was saved")
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	key, err := sign.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := s.Get(2)
+	sig, err := sign.Sign(d, key, "Ana", "instructor", d.Start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(d)
+	_, body := get(t, srv, "/dives/2")
+	// html/template escapes the + of base64.
+	fp := strings.ReplaceAll(sign.Fingerprint(sig.PublicKey), "+", "&#43;")
+	if !strings.Contains(body, "Ana (instructor) on 2024-05-02") || !strings.Contains(body, fp) ||
+		strings.Contains(body, "invalid") {
+		t.Errorf("signed dive page:\n%s", body)
+	}
+	d.Notes = "Eagle ray"
+	s.Put(d)
+	if _, body := get(t, srv, "/dives/2"); !strings.Contains(body, `class="warn">Ana`) || !strings.Contains(body, "invalid, the dive changed after signing") {
+		t.Errorf("edited signed dive page:\n%s", body)
+	}
+}
+
+func TestCreateDelete(t *testing.T) {
+	srv, s := testServer(t, Options{Units: divelog.Imperial})
+	form := url.Values{"date": {"2024-06-01T08:15"}, "duration": {"42"}, "depth": {"60"}, "site": {"Reef"},
+		"gas": {"EAN32"}, "volume": {"80"}, "working_pressure": {"3000"}, "start_pressure": {"3000"}}
+	w := post(t, srv, "/dives/new", form)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/dives/3" {
+		t.Fatalf("POST new: %d %s\n%s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	d, err := s.Get(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Duration != 42*time.Minute || d.MaxDepth < 18.28 || d.MaxDepth > 18.29 || d.Tanks[0].Gas.O2 != 0.32 || d.Tanks[0].Volume < divelog.Liters(11) || d.MinTemperature != 0 {
+		t.Errorf("new dive: %+v", d)
+	}
+
+	if w := post(t, srv, "/dives/new", url.Values{"date": {"tomorrow"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("POST new without a date: %d", w.Code)
+	}
+	if w := post(t, srv, "/dives/3/delete", nil); w.Code != http.StatusSeeOther {
+		t.Errorf("POST delete: %d", w.Code)
+	}
+	if _, err := s.Get(3); err == nil {
+		t.Error("dive #3 not deleted")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv, _ := testServer(t, Options{Username: "ana", Password: "s3cret"})
+	for _, tt := range []struct {
+		user, password string
+		status         int
+	}{{"", "", 401}, {"ana", "wrong", 401}, {"bob", "s3cret", 401}, {"ana", "s3cret", 200}} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.password)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s:%s: status %d, want %d", tt.user, tt.password, w.Code, tt.status)
+		}
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	for _, tt := range []struct {
+		header, value string
+		status        int
+	}{
+		{"Origin", "http://evil.example", 403},
+		{"Sec-Fetch-Site", "cross-site", 403},
+		{"Origin", "http://example.com", 303}, // httptest's host
+		{"Sec-Fetch-Site", "same-origin", 303},
+	} {
+		r := httptest.NewRequest("POST", "/dives/2/edit", strings.NewReader("date=2024-05-02T10:00&site=Canyon"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: %s: status %d, want %d\n%s", tt.header, tt.value, w.Code, tt.status, w.Body)
+		}
+	}
+	if d, _ := s.Get(2); d.Site.Name != "Canyon" {
+		t.Errorf("site = %q", d.Site.Name)
+	}
+}
+
+func TestGrid(t *testing.T) {
+	for _, tt := range []struct {
+		span float64
+		step float64
+	}{{0.2, 0.05}, {1, 0.2}, {4, 1}, {30, 10}} {
+		if got := gridStep(tt.span); got != tt.step {
+			t.Errorf("gridStep(%v) = %v, want %v", tt.span, got, tt.step)
+		}
+	}
+	for _, tt := range []struct {
+		v, step float64
+		want    string
+	}{{-87.55, 0.05, "87.55°W"}, {17.2, 0.1, "17.2°N"}, {0, 1, "0°"}, {-30, 10, "30°S"}} {
+		pos, neg := "N", "S"
+		if strings.HasSuffix(tt.want, "W") {
+			pos, neg = "E", "W"
+		}
+		if got := formatDegrees(tt.v, tt.step, pos, neg); got != tt.want {
+			t.Errorf("formatDegrees(%v, %v) = %q, want %q", tt.v, tt.step, got, tt.want)
+		}
+	}
+}
+
+// call sends an API request with a JSON body and headers given as name,
+// value pairs, and decodes the response into out if it is not nil.
+func call(t *testing.T, h http.Handler, method, path, body string, out any, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v\n%s", method, path, err, w.Body)
+		}
+	}
+	return w
+}
+
+func TestAPIList(t *testing.T) {
+	srv, _ := testServer(t, Options{})
+	var l list[*divelog.Dive]
+	if w := call(t, srv, "GET", "/api/v1/dives?limit=1", "", &l); w.Code != 200 {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	if l.Total != 2 || len(l.Items) != 1 || l.Items[0].Number != 1 || len(l.Items[0].Samples) != 0 || l.Next != "/api/v1/dives?limit=1&offset=1" {
+		t.Errorf("first page: %+v", l)
+	}
+	next := l.Next
+	l = list[*divelog.Dive]{}
+	call(t, srv, "GET", next+"&samples=true", "", &l)
+	if len(l.Items) != 1 || l.Items[0].Number != 2 || l.Next != "" {
+		t.Errorf("second page: %+v", l)
+	}
+	call(t, srv, "GET", "/api/v1/dives?samples=true&min_depth=20", "", &l)
+	if l.Total != 1 || len(l.Items[0].Samples) != 4 {
+		t.Errorf("dives below 20 m: %+v", l)
+	}
+	call(t, srv, "GET", "/api/v1/dives?offset=5", "", &l)
+	if l.Total != 2 || l.Items == nil || len(l.Items) != 0 {
+		t.Errorf("page past the end: %+v", l)
+	}
+	for _, path := range []string{"/api/v1/dives?limit=0", "/api/v1/dives?offset=-1", "/api/v1/dives?from=May", "/api/v1/stats?min_depth=x"} {
+		var e apiError
+		w := call(t, srv, "GET", path, "", nil)
+		if json.Unmarshal(w.Body.Bytes(), &e); w.Code != 400 || e.Error == "" {
+			t.Errorf("GET %s: %d %s", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestAPIDive(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	var d divelog.Dive
+	w := call(t, srv, "GET", "/api/v1/dives/1", "", &d)
+	tag := w.Header().Get("ETag")
+	if w.Code != 200 || tag == "" || d.Number != 1 || len(d.Samples) != 4 {
+		t.Fatalf("get: %d %q %+v", w.Code, tag, d)
+	}
+	if w := call(t, srv, "GET", "/api/v1/dives/1", "", nil, "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("get with If-None-Match: %d", w.Code)
+	}
+	if w := call(t, srv, "GET", "/api/v1/dives/9", "", nil); w.Code != 404 || !strings.Contains(w.Body.String(), "no dive #9") {
+		t.Errorf("get missing dive: %d %s", w.Code, w.Body)
+	}
+
+	d.Rating = 5
+	body, _ := json.Marshal(d)
+	if w := call(t, srv, "PUT", "/api/v1/dives/1", string(body), nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("put without If-Match: %d", w.Code)
+	}
+	if w := call(t, srv, "PUT", "/api/v1/dives/1", string(body), nil, "If-Match", `"stale"`); w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != tag {
+		t.Errorf("put with a stale ETag: %d", w.Code)
+	}
+	if w := call(t, srv, "PUT", "/api/v1/dives/2", string(body), nil, "If-Match", "*"); w.Code != 400 {
+		t.Errorf("put renumbering a dive: %d", w.Code)
+	}
+	w = call(t, srv, "PUT", "/api/v1/dives/1", string(body), &d, "If-Match", tag)
+	if w.Code != 200 || d.Rating != 5 || w.Header().Get("ETag") == tag {
+		t.Fatalf("put: %d %s", w.Code, w.Body)
+	}
+	if got, _ := s.Get(1); got.Rating != 5 {
+		t.Error("put not saved")
+	}
+	// The old ETag no longer matches.
+	if w := call(t, srv, "DELETE", "/api/v1/dives/1", "", nil, "If-Match", tag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("delete with the old ETag: %d", w.Code)
+	}
+
+	for _, bad := range []string{`{"number": 7, "start": "2024-06-01T08:00:00Z"}`, `{"start": "2024-06-01T08:00:00Z", "depth": 3}`,
+		`{"start": "2024-06-01T08:00:00Z", "max_depth": -3}`, `[`} {
+		if w := call(t, srv, "POST", "/api/v1/dives", bad, nil); w.Code != 400 {
+			t.Errorf("post %s: %d", bad, w.Code)
+		}
+	}
+	w = call(t, srv, "POST", "/api/v1/dives", `{"start": "2024-06-01T08:00:00Z", "duration": 2400000000000, "max_depth": 18}`, &d)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/v1/dives/3" || d.Number != 3 || d.Duration != 40*time.Minute {
+		t.Fatalf("post: %d %s %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if w := call(t, srv, "DELETE", "/api/v1/dives/3", "", nil, "If-Match", w.Header().Get("ETag")); w.Code != http.StatusNoContent {
+		t.Errorf("delete: %d %s", w.Code, w.Body)
+	}
+	if _, err := s.Get(3); err == nil {
+		t.Error("dive #3 not deleted")
+	}
+}
+
+func TestAPISigned(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	if _, err := sites.Sync(s); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := sign.GenerateKey()
+	d, _ := s.Get(1)
+	sign.Sign(d, key, "Ana", "instructor", d.Start.Add(time.Hour))
+	s.Put(d)
+	var got divelog.Dive
+	w := call(t, srv, "GET", "/api/v1/dives/1", "", &got)
+	tag := w.Header().Get("ETag")
+
+	// Sending the dive back unchanged keeps the signature good.
+	body, _ := json.Marshal(got)
+	if w = call(t, srv, "PUT", "/api/v1/dives/1", string(body), nil, "If-Match", tag); w.Code != 200 {
+		t.Fatalf("put unchanged signed dive: %d %s", w.Code, w.Body)
+	}
+	tag = w.Header().Get("ETag")
+	got.Rating = 2
+	body, _ = json.Marshal(got)
+	if w := call(t, srv, "PUT", "/api/v1/dives/1", string(body), nil, "If-Match", tag); w.Code != http.StatusConflict ||
+		!strings.Contains(w.Body.String(), "signatures of Ana on dive #1") {
+		t.Errorf("put changed signed dive: %d %s", w.Code, w.Body)
+	}
+	if w := call(t, srv, "DELETE", "/api/v1/dives/1", "", nil, "If-Match", tag); w.Code != http.StatusConflict {
+		t.Errorf("delete signed dive: %d %s", w.Code, w.Body)
+	}
+	if w = call(t, srv, "PUT", "/api/v1/dives/1?force=true", string(body), nil, "If-Match", tag); w.Code != 200 {
+		t.Errorf("forced put changed signed dive: %d %s", w.Code, w.Body)
+	}
+	// The signature no longer verifies, so there is nothing left to break.
+	if w := call(t, srv, "DELETE", "/api/v1/dives/1", "", nil, "If-Match", w.Header().Get("ETag")); w.Code != http.StatusNoContent {
+		t.Errorf("delete dive with a broken signature: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAPISummaries(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	if _, err := sites.Sync(s); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := s.Get(2)
+	d.Equipment = []divelog.Equipment{{Kind: divelog.Computer, Name: "Perdix"}, {Kind: divelog.BCD, Name: "Wing"}}
+	s.Put(d)
+	inv := s.(store.Inventory)
+	inv.PutItem(&divelog.Item{Kind: divelog.Computer, Name: "Perdix"})
+	inv.PutItem(&divelog.Item{Kind: divelog.Light, Name: "Torch"})
+
+	var reg list[registeredSite]
+	call(t, srv, "GET", "/api/v1/sites", "", &reg)
+	if reg.Total != 2 || reg.Items[0].ID != 1 || reg.Items[0].Name != "Blue Hole" || reg.Items[0].Coords == nil ||
+		reg.Items[1].Dives != 1 || reg.Items[1].LastDive == nil || !reg.Items[1].LastDive.Equal(d.Start) {
+		t.Errorf("sites: %+v", reg)
+	}
+	call(t, srv, "GET", "/api/v1/sites?site=canyon", "", &reg)
+	if reg.Total != 1 || reg.Items[0].ID != 2 {
+		t.Errorf("sites of the dives at Canyon: %+v", reg)
+	}
+	var items list[inventoryItem]
+	call(t, srv, "GET", "/api/v1/equipment", "", &items)
+	if items.Total != 2 || items.Items[0].Name != "Perdix" || items.Items[0].Dives != 1 || items.Items[0].LastUsed == nil ||
+		items.Items[1].Dives != 0 || items.Items[1].LastUsed != nil {
+		t.Errorf("equipment: %+v", items)
+	}
+	call(t, srv, "GET", "/api/v1/equipment?site=blue", "", &items)
+	if items.Total != 0 {
+		t.Errorf("equipment used at Blue Hole: %+v", items)
+	}
+	var st apiStatistics
+	call(t, srv, "GET", "/api/v1/stats", "", &st)
+	if st.Dives != 2 || st.TotalTime != 85*time.Minute || st.DeepestDive != 1 || st.LongestDive != 2 || st.Sites != 2 || st.SACDives != 1 || st.RMV == 0 {
+		t.Errorf("stats: %+v", st)
+	}
+	call(t, srv, "GET", "/api/v1/stats?site=canyon", "", &st)
+	if st.Dives != 1 || st.MaxDepth != 12 || st.FirstDive == nil || !st.FirstDive.Equal(d.Start) {
+		t.Errorf("stats at Canyon: %+v", st)
+	}
+}
+
+func TestAPIRegistry(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	if _, err := sites.Sync(s); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{`{"id": 7, "name": "Aquarium"}`, `{"name": " "}`, `{"name": "Aquarium", "coords": {"lat": 91}}`, `[`} {
+		if w := call(t, srv, "POST", "/api/v1/sites", bad, nil); w.Code != 400 {
+			t.Errorf("post site %s: %d", bad, w.Code)
+		}
+	}
+	var site divelog.Site
+	w := call(t, srv, "POST", "/api/v1/sites", `{"name": "Aquarium"}`, &site)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/v1/sites/3" || site.ID != 3 {
+		t.Fatalf("post site: %d %s %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if w := call(t, srv, "DELETE", "/api/v1/sites/3", "", nil, "If-Match", w.Header().Get("ETag")); w.Code != http.StatusNoContent {
+		t.Errorf("delete unused site: %d %s", w.Code, w.Body)
+	}
+	if w := call(t, srv, "GET", "/api/v1/sites/3", "", nil); w.Code != 404 || !strings.Contains(w.Body.String(), "no site 3") {
+		t.Errorf("get deleted site: %d %s", w.Code, w.Body)
+	}
+
+	w = call(t, srv, "GET", "/api/v1/sites/1", "", &site)
+	tag := w.Header().Get("ETag")
+	if w.Code != 200 || tag == "" || site.Name != "Blue Hole" {
+		t.Fatalf("get site: %d %q %+v", w.Code, tag, site)
+	}
+	if w := call(t, srv, "GET", "/api/v1/sites/1", "", nil, "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("get site with If-None-Match: %d", w.Code)
+	}
+	site.Name = "Great Blue Hole"
+	body, _ := json.Marshal(site)
+	if w := call(t, srv, "PUT", "/api/v1/sites/1", string(body), nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("put site without If-Match: %d", w.Code)
+	}
+	if w := call(t, srv, "PUT", "/api/v1/sites/1", string(body), nil, "If-Match", `"stale"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("put site with a stale ETag: %d", w.Code)
+	}
+	w = call(t, srv, "PUT", "/api/v1/sites/1", string(body), &site, "If-Match", tag)
+	if w.Code != 200 || w.Header().Get("ETag") == tag {
+		t.Fatalf("put site: %d %s", w.Code, w.Body)
+	}
+	if d, _ := s.Get(1); d.Site.Name != "Great Blue Hole" {
+		t.Errorf("dive at the renamed site: %+v", d.Site)
+	}
+	if w := call(t, srv, "DELETE", "/api/v1/sites/1", "", nil, "If-Match", w.Header().Get("ETag")); w.Code != http.StatusConflict {
+		t.Errorf("delete site in use: %d %s", w.Code, w.Body)
+	}
+
+	// Renaming the site of a signed dive needs force=true.
+	key, _ := sign.GenerateKey()
+	d, _ := s.Get(2)
+	sign.Sign(d, key, "Ana", "instructor", d.Start.Add(time.Hour))
+	s.Put(d)
+	w = call(t, srv, "GET", "/api/v1/sites/2", "", &site)
+	site.Name = "Canyon"
+	body, _ = json.Marshal(site)
+	if w := call(t, srv, "PUT", "/api/v1/sites/2", string(body), nil, "If-Match", w.Header().Get("ETag")); w.Code != http.StatusConflict ||
+		!strings.Contains(w.Body.String(), "#2") {
+		t.Errorf("put site of a signed dive: %d %s", w.Code, w.Body)
+	}
+	if w := call(t, srv, "PUT", "/api/v1/sites/2?force=true", string(body), nil, "If-Match", w.Header().Get("ETag")); w.Code != 200 {
+		t.Errorf("forced put site of a signed dive: %d %s", w.Code, w.Body)
+	}
+
+	d, _ = s.Get(1)
+	d.Equipment = []divelog.Equipment{{Kind: divelog.Computer, Name: "Perdix"}}
+	s.Put(d)
+	var it divelog.Item
+	w = call(t, srv, "POST", "/api/v1/equipment", `{"kind": "computer", "name": "Perdix"}`, &it)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/v1/equipment/1" || it.ID != 1 {
+		t.Fatalf("post item: %d %s %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	it.Serial = "A1B2"
+	body, _ = json.Marshal(it)
+	w = call(t, srv, "PUT", "/api/v1/equipment/1", string(body), &it, "If-Match", w.Header().Get("ETag"))
+	if w.Code != 200 || it.Serial != "A1B2" {
+		t.Fatalf("put item: %d %s", w.Code, w.Body)
+	}
+	if d, _ := s.Get(1); d.Equipment[0].Serial != "A1B2" {
+		t.Errorf("dive the item was used on: %+v", d.Equipment)
+	}
+	if w := call(t, srv, "DELETE", "/api/v1/equipment/1", "", nil, "If-Match", w.Header().Get("ETag")); w.Code != http.StatusNoContent {
+		t.Errorf("delete item: %d %s", w.Code, w.Body)
+	}
+	if d, _ := s.Get(1); len(d.Equipment) != 1 {
+		t.Errorf("dive lost its record of the deleted item: %+v", d.Equipment)
+	}
+
+	// A store without a registry or inventory has neither.
+	bare := New(struct{ store.Store }{s}, Options{})
+	for _, path := range []string{"/api/v1/sites", "/api/v1/equipment/1"} {
+		if w := call(t, bare, "GET", path, "", nil); w.Code != http.StatusNotImplemented {
+			t.Errorf("GET %s without a registry: %d", path, w.Code)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv, _ := testServer(t, Options{Username: "ana", Password: "pw"})
+	r := httptest.NewRequest("GET", "/api/v1/openapi.json", nil)
+	r.SetBasicAuth("ana", "pw")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	var doc struct {
+		OpenAPI    string
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Type, Description string
+					Ref               string `json:"$ref"`
+				}
+			}
+			SecuritySchemes map[string]any
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths["/dives/{number}"]) != 3 || doc.Components.SecuritySchemes["basic"] == nil {
+		t.Errorf("document: %+v", doc)
+	}
+	dive := doc.Components.Schemas["Dive"].Properties
+	if dive["max_depth"].Description != "metres" || dive["site"].Ref != "#/components/schemas/Site" || dive["start"].Type != "string" {
+		t.Errorf("Dive schema: %+v", dive)
+	}
+	if len(doc.Paths["/sites/{id}"]) != 3 || len(doc.Paths["/equipment"]) != 2 {
+		t.Errorf("site and equipment paths: %+v", doc.Paths)
+	}
+	// Embedded fields are folded in.
+	if gear := doc.Components.Schemas["InventoryItem"].Properties; gear["kind"].Type != "string" || gear["dives"].Type != "integer" {
+		t.Errorf("InventoryItem schema: %+v", gear)
+	}
+}
+
+func TestEditConflict(t *testing.T) {
+	srv, s := testServer(t, Options{})
+	_, page := get(t, srv, "/dives/2/edit")
+	_, rest, _ := strings.Cut(page, `name="etag" value="`)
+	tag, _, _ := strings.Cut(rest, `"`)
+	tag = html.UnescapeString(tag)
+
+	d, _ := s.Get(2)
+	d.Notes = "changed elsewhere"
+	s.Put(d)
+	w := post(t, srv, "/dives/2/edit", url.Values{"etag": {tag}, "date": {"2024-05-02T10:00"}, "notes": {"mine"}})
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "changed elsewhere") {
+		t.Errorf("edit of a changed dive: %d\n%s", w.Code, w.Body)
+	}
+	if d, _ := s.Get(2); d.Notes != "changed elsewhere" {
+		t.Errorf("notes = %q", d.Notes)
+	}
+}